@@ -0,0 +1,274 @@
+package bacs
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"payments/app/models"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Payment scheme of the payments submitted to Bacs
+const PAYMENT_SCHEME_BACS = "BACS"
+
+// Transaction codes of the Standard 18 records
+const TRANSACTION_CODE_CREDIT = "99"
+const TRANSACTION_CODE_DEBIT_CONTRA = "17"
+const TRANSACTION_CODE_DIRECT_DEBIT = "17"
+const TRANSACTION_CODE_CREDIT_CONTRA = "99"
+
+// Volume serial number of the submissions, one volume per submission
+const VOLUME_SERIAL_NUMBER = "000001"
+
+// ServiceUser is the originator of the submission, identified by its service user number (SUN)
+type ServiceUser struct {
+	Number string
+	Name   string
+}
+
+// ValidationError lists the payments that can not be submitted
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Errors, ", ")
+}
+
+var serviceUserNumberPattern = regexp.MustCompile(`^[0-9]{6}$`)
+var sortCodePattern = regexp.MustCompile(`^[0-9]{6}$`)
+var accountNumberPattern = regexp.MustCompile(`^[0-9]{8}$`)
+
+// Bacs character set, the other characters are replaced by spaces
+var invalidCharacters = regexp.MustCompile(`[^A-Z0-9.&/\- ]`)
+
+// IsBacs check if the payment is a Bacs payment
+func IsBacs(payment models.Payment) bool {
+	return strings.ToUpper(payment.Attributes.PaymentScheme) == PAYMENT_SCHEME_BACS
+}
+
+// IsDebit check if the payment is a direct debit, collected from the account of the debtor
+func IsDebit(payment models.Payment) bool {
+	return strings.EqualFold(strings.TrimSpace(payment.Attributes.PaymentType), "Debit")
+}
+
+// group is a file of the submission: the credits or the direct debits processed on a date for the account of a sponsor
+type group struct {
+	debit          bool
+	processingDate time.Time
+	sortCode       string
+	accountNumber  string
+	payments       []models.Payment
+	amounts        []int64
+}
+
+// MarshalStandard18 writes the payments as a Standard 18 submission
+// The payments are grouped in one file by processing date, sponsor account and direction. Each file has a contra record
+// debiting the sponsor account with the total of its credits, or crediting it with the total of its direct debits, and a
+// UTL1 trailer with the hash totals of the file
+func MarshalStandard18(payments []models.Payment, serviceUser ServiceUser, now time.Time) ([]byte, error) {
+	if !serviceUserNumberPattern.MatchString(serviceUser.Number) {
+		return nil, errors.New("service user number must have 6 digits")
+	}
+	if len(payments) == 0 {
+		return nil, &ValidationError{Errors: []string{"no payments to submit"}}
+	}
+
+	groups, err := groupPayments(payments)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{volumeHeader(serviceUser)}
+	for i, group := range groups {
+		lines = append(lines, fileHeaders(serviceUser, i+1, now, group.processingDate)...)
+
+		var total int64
+		for j, payment := range group.payments {
+			lines = append(lines, itemRecord(payment, group, group.amounts[j], serviceUser))
+			total += group.amounts[j]
+		}
+		lines = append(lines, contraRecord(group, total, serviceUser))
+
+		lines = append(lines, fileTrailers(serviceUser, i+1, now, group, total)...)
+	}
+
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// groupPayments validates the payments and groups them by processing date, sponsor account and direction
+func groupPayments(payments []models.Payment) ([]*group, error) {
+	errs := []string{}
+	groups := map[string]*group{}
+
+	for _, payment := range payments {
+		attributes := payment.Attributes
+		paymentErrors := []string{}
+
+		processingDate, err := time.Parse("2006-01-02", attributes.ProcessingDate)
+		if err != nil {
+			paymentErrors = append(paymentErrors, "processing date must be a YYYY-MM-DD date")
+		}
+		if attributes.Currency != "GBP" {
+			paymentErrors = append(paymentErrors, "currency must be GBP")
+		}
+		amount, err := pence(attributes.Amount)
+		if err != nil {
+			paymentErrors = append(paymentErrors, err.Error())
+		}
+
+		sponsor := attributes.SponsorParty.SponsorPartySkeleton
+		if sponsor == nil || !sortCodePattern.MatchString(sponsor.BankID) || !accountNumberPattern.MatchString(sponsor.AccountNumber) {
+			paymentErrors = append(paymentErrors, "sponsor party must have a sort code and an 8 digits account number")
+		}
+		debit := IsDebit(payment)
+		if destination := destinationParty(payment); destination == nil || destination.SponsorPartySkeleton == nil || !sortCodePattern.MatchString(destination.BankID) || !accountNumberPattern.MatchString(destination.AccountNumber) {
+			if debit {
+				paymentErrors = append(paymentErrors, "debtor party must have a sort code and an 8 digits account number")
+			} else {
+				paymentErrors = append(paymentErrors, "beneficiary party must have a sort code and an 8 digits account number")
+			}
+		}
+
+		if len(paymentErrors) > 0 {
+			errs = append(errs, fmt.Sprintf("payment %s: %s", payment.ID, strings.Join(paymentErrors, ", ")))
+			continue
+		}
+
+		// The credits of a date and sponsor come before its direct debits
+		key := attributes.ProcessingDate + sponsor.BankID + sponsor.AccountNumber
+		if debit {
+			key += "D"
+		} else {
+			key += "C"
+		}
+		if groups[key] == nil {
+			groups[key] = &group{debit: debit, processingDate: processingDate, sortCode: sponsor.BankID, accountNumber: sponsor.AccountNumber}
+		}
+		groups[key].payments = append(groups[key].payments, payment)
+		groups[key].amounts = append(groups[key].amounts, amount)
+	}
+
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+
+	keys := []string{}
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sorted := []*group{}
+	for _, key := range keys {
+		sorted = append(sorted, groups[key])
+	}
+	return sorted, nil
+}
+
+// pence converts the amount in pounds to pence, up to the 11 digits of the amount field
+func pence(amount string) (int64, error) {
+	value, ok := new(big.Rat).SetString(strings.TrimSpace(amount))
+	if !ok || value.Sign() <= 0 {
+		return 0, errors.New("amount must be positive")
+	}
+	value.Mul(value, big.NewRat(100, 1))
+	if !value.IsInt() || !value.Num().IsInt64() || value.Num().Int64() > 99999999999 {
+		return 0, errors.New("amount must have up to 2 decimals and 11 digits in pence")
+	}
+	return value.Num().Int64(), nil
+}
+
+func volumeHeader(serviceUser ServiceUser) string {
+	return record(80, "VOL1", VOLUME_SERIAL_NUMBER, " ", blank(26), blank(4), serviceUser.Number, blank(4), blank(28), "1")
+}
+
+func fileHeaders(serviceUser ServiceUser, number int, now time.Time, processingDate time.Time) []string {
+	return []string{
+		record(80, "HDR1", fileIdentifier(serviceUser), blank(6), "0001", fmt.Sprintf("%04d", number), blank(4), blank(2), julian(now), julian(now), " ", "000000", blank(13), blank(7)),
+		record(80, "HDR2", "F", "02000", "00100", blank(35), "00", blank(28)),
+		record(80, "UHL1", julian(processingDate), "999999    ", "00", "000000", "1 DAILY  ", fmt.Sprintf("%03d", number), blank(7), blank(7), blank(26)),
+	}
+}
+
+func fileTrailers(serviceUser ServiceUser, number int, now time.Time, group *group, total int64) []string {
+	// The contra is the only debit of a file of credits, and the only credit of a file of direct debits
+	debits, credits := 1, len(group.payments)
+	if group.debit {
+		debits, credits = len(group.payments), 1
+	}
+	return []string{
+		record(80, "EOF1", fileIdentifier(serviceUser), blank(6), "0001", fmt.Sprintf("%04d", number), blank(4), blank(2), julian(now), julian(now), " ", "000000", blank(13), blank(7)),
+		record(80, "EOF2", "F", "02000", "00100", blank(35), "00", blank(28)),
+		record(80, "UTL1", fmt.Sprintf("%013d", total), fmt.Sprintf("%013d", total), fmt.Sprintf("%07d", debits), fmt.Sprintf("%07d", credits), blank(36)),
+	}
+}
+
+// itemRecord credits the account of the beneficiary, or debits the account of the debtor of a direct debit
+func itemRecord(payment models.Payment, group *group, amount int64, serviceUser ServiceUser) string {
+	destination := destinationParty(payment)
+	accountType, code := payment.Attributes.BeneficiaryParty.AccountType, TRANSACTION_CODE_CREDIT
+	if group.debit {
+		accountType, code = 0, TRANSACTION_CODE_DIRECT_DEBIT
+	}
+	return record(100,
+		destination.BankID, destination.AccountNumber, fmt.Sprintf("%d", accountType%10), code,
+		group.sortCode, group.accountNumber, blank(4), fmt.Sprintf("%011d", amount),
+		text(serviceUser.Name, 18), text(payment.Attributes.Reference, 18), text(destination.AccountName, 18))
+}
+
+// destinationParty returns the party whose account the payment moves money to or, for direct debits, from
+func destinationParty(payment models.Payment) *models.DebtorPartySkeleton {
+	if IsDebit(payment) {
+		return payment.Attributes.DebtorParty.DebtorPartySkeleton
+	}
+	return payment.Attributes.BeneficiaryParty.DebtorPartySkeleton
+}
+
+// contraRecord debits the sponsor account with the total of the credits of the file, or credits it with the total of
+// the direct debits
+func contraRecord(group *group, total int64, serviceUser ServiceUser) string {
+	code := TRANSACTION_CODE_DEBIT_CONTRA
+	if group.debit {
+		code = TRANSACTION_CODE_CREDIT_CONTRA
+	}
+	return record(100,
+		group.sortCode, group.accountNumber, "0", code,
+		group.sortCode, group.accountNumber, blank(4), fmt.Sprintf("%011d", total),
+		text(serviceUser.Name, 18), text("CONTRA", 18), text(serviceUser.Name, 18))
+}
+
+// fileIdentifier is A, the service user number, S, two spaces, 1 and the service user number again
+func fileIdentifier(serviceUser ServiceUser) string {
+	return "A" + serviceUser.Number + "S  1" + serviceUser.Number
+}
+
+// julian writes the date as a space followed by the year and the day of the year, e.g. ` 17018`
+func julian(date time.Time) string {
+	return fmt.Sprintf(" %02d%03d", date.Year()%100, date.YearDay())
+}
+
+// text writes the value in upper case, with the characters of the Bacs set, padded or truncated to the length
+func text(value string, length int) string {
+	value = invalidCharacters.ReplaceAllString(strings.ToUpper(strings.TrimSpace(value)), " ")
+	if len(value) > length {
+		value = value[:length]
+	}
+	return value + blank(length-len(value))
+}
+
+func blank(length int) string {
+	return strings.Repeat(" ", length)
+}
+
+// record joins the fields, which must fill the length of the record
+func record(length int, fields ...string) string {
+	line := strings.Join(fields, "")
+	if len(line) != length {
+		panic(fmt.Sprintf("bacs record %q has %d characters instead of %d", line[:4], len(line), length))
+	}
+	return line
+}
@@ -0,0 +1,146 @@
+package bacs
+
+import (
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"payments/app/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+var serviceUser = ServiceUser{Number: "123456", Name: "Bank A Payroll"}
+
+func bacsPayment(amount string, processingDate string, sponsorAccount string, reference string) models.Payment {
+	return models.Payment{
+		ID: uuid.NewV4(),
+		Attributes: models.Attributes{
+			Amount:         amount,
+			Currency:       "GBP",
+			PaymentScheme:  "Bacs",
+			ProcessingDate: processingDate,
+			Reference:      reference,
+			BeneficiaryParty: models.BeneficiaryParty{DebtorPartySkeleton: &models.DebtorPartySkeleton{
+				SponsorPartySkeleton: &models.SponsorPartySkeleton{AccountNumber: "31926819", BankID: "403000", BankIDCode: "GBDSC"},
+				AccountName:          "W Owens",
+			}},
+			SponsorParty: models.SponsorParty{SponsorPartySkeleton: &models.SponsorPartySkeleton{AccountNumber: sponsorAccount, BankID: "123123", BankIDCode: "GBDSC"}},
+		},
+	}
+}
+
+func TestMarshalStandard18(t *testing.T) {
+	now := time.Date(2017, 1, 16, 10, 0, 0, 0, time.UTC)
+	payments := []models.Payment{
+		bacsPayment("100.21", "2017-01-18", "56781234", "Em's piano lessons"),
+		bacsPayment("0.79", "2017-01-18", "56781234", "Salary January"),
+	}
+
+	file, err := MarshalStandard18(payments, serviceUser, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.EqualValues(t, []string{
+		"VOL1000001                               123456                                1",
+		"HDR1A123456S  1123456      00010001       17016 17016 000000                    ",
+		"HDR2F0200000100                                   00                            ",
+		"UHL1 17018999999    000000001 DAILY  001                                        ",
+		"4030003192681909912312356781234    00000010021BANK A PAYROLL    EM S PIANO LESSONSW OWENS           ",
+		"4030003192681909912312356781234    00000000079BANK A PAYROLL    SALARY JANUARY    W OWENS           ",
+		"1231235678123401712312356781234    00000010100BANK A PAYROLL    CONTRA            BANK A PAYROLL    ",
+		"EOF1A123456S  1123456      00010001       17016 17016 000000                    ",
+		"EOF2F0200000100                                   00                            ",
+		"UTL10000000010100000000001010000000010000002                                    ",
+	}, strings.Split(strings.TrimSuffix(string(file), "\n"), "\n"))
+}
+
+func TestMarshalStandard18GroupsByDateAndSponsor(t *testing.T) {
+	payments := []models.Payment{
+		bacsPayment("1", "2017-01-19", "56781234", "A"),
+		bacsPayment("2", "2017-01-18", "56781234", "B"),
+		bacsPayment("3", "2017-01-18", "11112222", "C"),
+		bacsPayment("4", "2017-01-18", "56781234", "D"),
+	}
+
+	file, err := MarshalStandard18(payments, serviceUser, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trailers := []string{}
+	headers := []string{}
+	for _, line := range strings.Split(string(file), "\n") {
+		if strings.HasPrefix(line, "UTL1") {
+			trailers = append(trailers, line[:44])
+		}
+		if strings.HasPrefix(line, "UHL1") {
+			headers = append(headers, line[:40])
+		}
+	}
+
+	assert.EqualValues(t, []string{
+		"UHL1 17018999999    000000001 DAILY  001",
+		"UHL1 17018999999    000000001 DAILY  002",
+		"UHL1 17019999999    000000001 DAILY  003",
+	}, headers)
+	// Debit and credit value totals, then the debit (contra) and credit counts
+	assert.EqualValues(t, []string{
+		"UTL1" + "0000000000300" + "0000000000300" + "0000001" + "0000001",
+		"UTL1" + "0000000000600" + "0000000000600" + "0000001" + "0000002",
+		"UTL1" + "0000000000100" + "0000000000100" + "0000001" + "0000001",
+	}, trailers)
+	assert.Equal(t, 1, strings.Count(string(file), "VOL1"))
+}
+
+func TestMarshalStandard18DirectDebits(t *testing.T) {
+	debit := bacsPayment("25.50", "2017-01-18", "56781234", "DDI000123")
+	debit.Attributes.PaymentType = "Debit"
+	debit.Attributes.DebtorParty = models.DebtorParty{DebtorPartySkeleton: &models.DebtorPartySkeleton{
+		SponsorPartySkeleton: &models.SponsorPartySkeleton{AccountNumber: "55779911", BankID: "200000", BankIDCode: "GBDSC"},
+		AccountName:          "J Smith",
+	}}
+	payments := []models.Payment{debit, bacsPayment("100.21", "2017-01-18", "56781234", "A")}
+
+	file, err := MarshalStandard18(payments, serviceUser, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The credits and the direct debits are in separate files, each with its contra
+	lines := strings.Split(string(file), "\n")
+	assert.Contains(t, lines, "2000005577991101712312356781234    00000002550BANK A PAYROLL    DDI000123         J SMITH           ")
+	assert.Contains(t, lines, "1231235678123409912312356781234    00000002550BANK A PAYROLL    CONTRA            BANK A PAYROLL    ")
+	assert.Contains(t, lines, "1231235678123401712312356781234    00000010021BANK A PAYROLL    CONTRA            BANK A PAYROLL    ")
+
+	trailers := []string{}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "UTL1") {
+			trailers = append(trailers, line[:44])
+		}
+	}
+	assert.EqualValues(t, []string{
+		"UTL1" + "0000000010021" + "0000000010021" + "0000001" + "0000001",
+		"UTL1" + "0000000002550" + "0000000002550" + "0000001" + "0000001",
+	}, trailers)
+
+	debit.Attributes.DebtorParty = models.DebtorParty{}
+	_, err = MarshalStandard18([]models.Payment{debit}, serviceUser, time.Now())
+	if assert.IsType(t, &ValidationError{}, err) {
+		assert.EqualValues(t, []string{"payment " + debit.ID.String() + ": debtor party must have a sort code and an 8 digits account number"}, err.(*ValidationError).Errors)
+	}
+}
+
+func TestMarshalStandard18WithInvalidPayments(t *testing.T) {
+	payment := bacsPayment("100.211", "2017-01-18", "5678", "A")
+	payment.Attributes.Currency = "EUR"
+
+	_, err := MarshalStandard18([]models.Payment{payment}, serviceUser, time.Now())
+	if assert.IsType(t, &ValidationError{}, err) {
+		assert.EqualValues(t, []string{"payment " + payment.ID.String() + ": currency must be GBP, amount must have up to 2 decimals and 11 digits in pence, " +
+			"sponsor party must have a sort code and an 8 digits account number"}, err.(*ValidationError).Errors)
+	}
+
+	_, err = MarshalStandard18([]models.Payment{bacsPayment("1", "2017-01-18", "56781234", "A")}, ServiceUser{Number: "12"}, time.Now())
+	assert.Error(t, err)
+}
@@ -0,0 +1,273 @@
+package banks
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Bank id code of the banks identified by their BIC
+const BANK_ID_CODE_BIC = "SWBIC"
+
+// Maximum number of banks returned by a search
+const SEARCH_LIMIT = 50
+
+// Bank is an entry of the bank directory
+type Bank struct {
+	BankID     string   `json:"bank_id"`
+	BankIDCode string   `json:"bank_id_code"`
+	BIC        string   `json:"bic,omitempty"`
+	Name       string   `json:"name"`
+	City       string   `json:"city,omitempty"`
+	Country    string   `json:"country,omitempty"`
+	Schemes    []string `json:"schemes,omitempty"`
+}
+
+// Reaches check if the bank can receive payments of the scheme
+// Banks without schemes in the directory are assumed to be reachable
+func (b Bank) Reaches(scheme string) bool {
+	if len(b.Schemes) == 0 {
+		return true
+	}
+	for _, s := range b.Schemes {
+		if strings.EqualFold(s, strings.TrimSpace(scheme)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Directory is the list of banks, indexed by bank id code and bank id
+type Directory struct {
+	Banks []Bank
+	index map[string]int
+	// Banks identified by another bank id code, by their BIC
+	bics  map[string]int
+	codes map[string]bool
+}
+
+var directory *Directory
+var directoryOnce sync.Once
+
+// GetDirectory returns the directory loaded from the files of the environment, empty when no file is configured
+// BANK_DIRECTORY_FILES: comma separated CSV files with a header line
+func GetDirectory() *Directory {
+	directoryOnce.Do(func() {
+		directory = NewDirectory()
+		for _, file := range strings.Split(os.Getenv("BANK_DIRECTORY_FILES"), ",") {
+			if file = strings.TrimSpace(file); file == "" {
+				continue
+			}
+			if err := directory.LoadFile(file); err != nil {
+				panic(err)
+			}
+		}
+	})
+	return directory
+}
+
+// SetDirectory replaces the directory loaded from the environment
+func SetDirectory(d *Directory) {
+	directoryOnce.Do(func() {})
+	directory = d
+}
+
+// NewDirectory creates an empty directory
+func NewDirectory() *Directory {
+	return &Directory{index: map[string]int{}, bics: map[string]int{}, codes: map[string]bool{}}
+}
+
+// LoadFile adds the banks of a CSV file to the directory
+func (d *Directory) LoadFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := d.Load(f); err != nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+	return nil
+}
+
+// Column names of the CSV files, with the names used by the common bank directory exports
+var columns = map[string]string{
+	"bank_id":           "bank_id",
+	"sort_code":         "bank_id",
+	"national_id":       "bank_id",
+	"bank_id_code":      "bank_id_code",
+	"clearing_system":   "bank_id_code",
+	"bic":               "bic",
+	"bicfi":             "bic",
+	"bic_code":          "bic",
+	"swift_code":        "bic",
+	"name":              "name",
+	"bank_name":         "name",
+	"institution_name":  "name",
+	"city":              "city",
+	"city_heading":      "city",
+	"country":           "country",
+	"country_code":      "country",
+	"iso_country_code":  "country",
+	"schemes":           "schemes",
+	"reachability":      "schemes",
+	"payment_schemes":   "schemes",
+	"reachable_schemes": "schemes",
+}
+
+var bicPattern = regexp.MustCompile(`^[A-Z]{6}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+var schemeSeparators = regexp.MustCompile(`[;|, ]+`)
+
+// Load adds the banks of CSV data to the directory
+// The first line names the columns: bank_id, bank_id_code, bic, name, city, country and schemes (separated by `;`)
+// Banks without bank id and bank id code are identified by their BIC
+func (d *Directory) Load(reader io.Reader) error {
+	records := csv.NewReader(reader)
+	records.FieldsPerRecord = -1
+	records.TrimLeadingSpace = true
+
+	header, err := records.Read()
+	if err != nil {
+		return fmt.Errorf("missing header: %s", err)
+	}
+	positions := map[string]int{}
+	for i, name := range header {
+		name = strings.Replace(strings.ToLower(strings.TrimSpace(name)), " ", "_", -1)
+		if column, ok := columns[name]; ok {
+			positions[column] = i
+		}
+	}
+	if _, ok := positions["name"]; !ok {
+		return fmt.Errorf("missing name column")
+	}
+	if _, ok := positions["bank_id"]; !ok {
+		if _, ok := positions["bic"]; !ok {
+			return fmt.Errorf("missing bank_id or bic column")
+		}
+	}
+
+	for line := 2; ; line++ {
+		record, err := records.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		field := func(column string) string {
+			if i, ok := positions[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		bank := Bank{
+			BankID:     field("bank_id"),
+			BankIDCode: strings.ToUpper(field("bank_id_code")),
+			BIC:        strings.ToUpper(field("bic")),
+			Name:       field("name"),
+			City:       field("city"),
+			Country:    strings.ToUpper(field("country")),
+		}
+		if schemes := strings.TrimSpace(schemeSeparators.ReplaceAllString(strings.ToUpper(field("schemes")), " ")); schemes != "" {
+			bank.Schemes = strings.Split(schemes, " ")
+		}
+
+		if bank.BIC != "" && !bicPattern.MatchString(bank.BIC) {
+			return fmt.Errorf("line %d: invalid BIC %s", line, bank.BIC)
+		}
+		if bank.BankID == "" {
+			bank.BankID, bank.BankIDCode = bank.BIC, BANK_ID_CODE_BIC
+		}
+		if bank.BankID == "" || bank.BankIDCode == "" || bank.Name == "" {
+			return fmt.Errorf("line %d: bank id, bank id code and name are required", line)
+		}
+
+		d.add(bank)
+	}
+}
+
+// add indexes the bank by its bank id and its BIC, a later entry with the same bank id replaces an earlier one
+func (d *Directory) add(bank Bank) {
+	position, ok := d.index[key(bank.BankIDCode, bank.BankID)]
+	if ok {
+		d.Banks[position] = bank
+	} else {
+		position = len(d.Banks)
+		d.Banks = append(d.Banks, bank)
+		d.index[key(bank.BankIDCode, bank.BankID)] = position
+	}
+
+	d.codes[bank.BankIDCode] = true
+	if bank.BIC != "" && bank.BankIDCode != BANK_ID_CODE_BIC {
+		if _, ok := d.bics[key(BANK_ID_CODE_BIC, bank.BIC)]; !ok {
+			d.bics[key(BANK_ID_CODE_BIC, bank.BIC)] = position
+		}
+		d.codes[BANK_ID_CODE_BIC] = true
+	}
+}
+
+// key of the index, BICs of 8 characters are the head office (XXX) branch
+func key(bankIDCode string, bankID string) string {
+	bankIDCode = strings.ToUpper(strings.TrimSpace(bankIDCode))
+	bankID = strings.ToUpper(strings.Replace(strings.TrimSpace(bankID), "-", "", -1))
+	if bankIDCode == BANK_ID_CODE_BIC && len(bankID) == 8 {
+		bankID += "XXX"
+	}
+	return bankIDCode + "/" + bankID
+}
+
+// Lookup finds the bank by bank id code and bank id
+// Without bank id code the bank id is looked up as a BIC
+func (d *Directory) Lookup(bankIDCode string, bankID string) (Bank, bool) {
+	if strings.TrimSpace(bankIDCode) == "" {
+		bankIDCode = BANK_ID_CODE_BIC
+	}
+	if i, ok := d.index[key(bankIDCode, bankID)]; ok {
+		return d.Banks[i], true
+	}
+	// The banks identified by a national bank id are also found by their BIC
+	if i, ok := d.bics[key(bankIDCode, bankID)]; ok {
+		return d.Banks[i], true
+	}
+	return Bank{}, false
+}
+
+// Covers check if the directory lists the banks of the bank id code
+func (d *Directory) Covers(bankIDCode string) bool {
+	return d.codes[strings.ToUpper(strings.TrimSpace(bankIDCode))]
+}
+
+// Search returns the banks whose bank id or BIC starts with the value, optionally limited to a bank id code
+func (d *Directory) Search(bankID string, bankIDCode string) []Bank {
+	bankID = strings.ToUpper(strings.Replace(strings.TrimSpace(bankID), "-", "", -1))
+	bankIDCode = strings.ToUpper(strings.TrimSpace(bankIDCode))
+
+	found := []Bank{}
+	for _, bank := range d.Banks {
+		if bankIDCode != "" && bank.BankIDCode != bankIDCode {
+			continue
+		}
+		if strings.HasPrefix(strings.ToUpper(bank.BankID), bankID) || (bank.BIC != "" && strings.HasPrefix(bank.BIC, bankID)) {
+			found = append(found, bank)
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].BankIDCode != found[j].BankIDCode {
+			return found[i].BankIDCode < found[j].BankIDCode
+		}
+		return found[i].BankID < found[j].BankID
+	})
+	if len(found) > SEARCH_LIMIT {
+		found = found[:SEARCH_LIMIT]
+	}
+	return found
+}
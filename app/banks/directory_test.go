@@ -0,0 +1,100 @@
+package banks
+
+import (
+	"github.com/stretchr/testify/assert"
+	"payments/app/models"
+	"strings"
+	"testing"
+)
+
+func testDirectory(t *testing.T) *Directory {
+	directory := NewDirectory()
+	for _, file := range []string{"testdata/sort_codes.csv", "testdata/bic.csv"} {
+		if err := directory.LoadFile(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return directory
+}
+
+func TestLoad(t *testing.T) {
+	directory := testDirectory(t)
+
+	assert.Len(t, directory.Banks, 6)
+	assert.EqualValues(t, Bank{BankID: "403000", BankIDCode: "GBDSC", BIC: "HBUKGB4B", Name: "HSBC UK Bank", City: "London", Country: "GB", Schemes: []string{"FPS", "BACS", "CHAPS"}}, directory.Banks[0])
+	assert.EqualValues(t, Bank{BankID: "BNPAFRPP", BankIDCode: BANK_ID_CODE_BIC, BIC: "BNPAFRPP", Name: "BNP Paribas", City: "Paris", Country: "FR", Schemes: []string{"SEPA", "SWIFT"}}, directory.Banks[4])
+	assert.True(t, directory.Covers("gbdsc"))
+	assert.True(t, directory.Covers(BANK_ID_CODE_BIC))
+	assert.False(t, directory.Covers("USABA"))
+
+	assert.EqualError(t, NewDirectory().Load(strings.NewReader("bank_id,bank_id_code\n403000,GBDSC\n")), "missing name column")
+	assert.EqualError(t, NewDirectory().Load(strings.NewReader("bic,name\nCOBA,Commerzbank\n")), "line 2: invalid BIC COBA")
+	assert.EqualError(t, NewDirectory().Load(strings.NewReader("bank_id,name\n403000,HSBC\n")), "line 2: bank id, bank id code and name are required")
+}
+
+func TestLookup(t *testing.T) {
+	directory := testDirectory(t)
+
+	bank, ok := directory.Lookup("GBDSC", "40-30-00")
+	assert.True(t, ok)
+	assert.EqualValues(t, "HSBC UK Bank", bank.Name)
+
+	// The 8 characters BIC is the head office branch
+	bank, ok = directory.Lookup("SWBIC", "COBADEFF")
+	assert.True(t, ok)
+	assert.EqualValues(t, "Commerzbank", bank.Name)
+
+	// Without bank id code the bank id is a BIC, the entry identified by the BIC is preferred
+	bank, ok = directory.Lookup("", "hbukgb4bxxx")
+	assert.True(t, ok)
+	assert.EqualValues(t, BANK_ID_CODE_BIC, bank.BankIDCode)
+
+	_, ok = directory.Lookup("GBDSC", "999999")
+	assert.False(t, ok)
+}
+
+func TestSearch(t *testing.T) {
+	directory := testDirectory(t)
+
+	names := func(banks []Bank) []string {
+		result := []string{}
+		for _, bank := range banks {
+			result = append(result, bank.Name)
+		}
+		return result
+	}
+
+	assert.EqualValues(t, []string{"Bank A"}, names(directory.Search("12", "")))
+	// Banks are also found by BIC
+	assert.EqualValues(t, []string{"Barclays Bank UK"}, names(directory.Search("BUKB", "")))
+	assert.EqualValues(t, []string{"HSBC UK Bank", "HSBC UK Bank"}, names(directory.Search("HBUK", "")))
+	assert.EqualValues(t, []string{"HSBC UK Bank"}, names(directory.Search("HBUK", "GBDSC")))
+	assert.Empty(t, directory.Search("99", ""))
+}
+
+func TestReaches(t *testing.T) {
+	bank := Bank{Schemes: []string{"FPS", "BACS"}}
+	assert.True(t, bank.Reaches("fps"))
+	assert.False(t, bank.Reaches("CHAPS"))
+	assert.True(t, Bank{}.Reaches("CHAPS"))
+}
+
+func TestEnrichPayment(t *testing.T) {
+	directory := testDirectory(t)
+
+	payment := models.Payment{Attributes: models.Attributes{BeneficiaryParty: models.BeneficiaryParty{DebtorPartySkeleton: &models.DebtorPartySkeleton{
+		SponsorPartySkeleton: &models.SponsorPartySkeleton{AccountNumber: "31926819", BankID: "403000", BankIDCode: "GBDSC"},
+	}}}}
+	directory.EnrichPayment(&payment)
+	assert.EqualValues(t, "HSBC UK Bank", payment.Attributes.BeneficiaryParty.BankName)
+
+	payment.Attributes.BeneficiaryParty.BankID, payment.Attributes.BeneficiaryParty.BankIDCode = "BNPAFRPP", ""
+	directory.EnrichPayment(&payment)
+	assert.EqualValues(t, "BNP Paribas", payment.Attributes.BeneficiaryParty.BankName)
+	assert.EqualValues(t, BANK_ID_CODE_BIC, payment.Attributes.BeneficiaryParty.BankIDCode)
+
+	// Payments without beneficiary bank are left unchanged
+	payment = models.Payment{}
+	directory.EnrichPayment(&payment)
+	assert.Nil(t, payment.Attributes.BeneficiaryParty.DebtorPartySkeleton)
+}
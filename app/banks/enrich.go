@@ -0,0 +1,24 @@
+package banks
+
+import (
+	"payments/app/models"
+	"strings"
+)
+
+// EnrichPayment completes the bank of the beneficiary with the directory: the bank name and,
+// for a bank id given without code, the SWBIC code when the bank id is a BIC of the directory
+func (d *Directory) EnrichPayment(payment *models.Payment) {
+	beneficiary := &payment.Attributes.BeneficiaryParty
+	if beneficiary.DebtorPartySkeleton == nil || beneficiary.SponsorPartySkeleton == nil || strings.TrimSpace(beneficiary.BankID) == "" {
+		return
+	}
+
+	bank, ok := d.Lookup(beneficiary.BankIDCode, beneficiary.BankID)
+	if !ok {
+		return
+	}
+	if strings.TrimSpace(beneficiary.BankIDCode) == "" {
+		beneficiary.BankIDCode = BANK_ID_CODE_BIC
+	}
+	beneficiary.BankName = bank.Name
+}
@@ -0,0 +1,260 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	// The time zones of the schemes are embedded, the image may not have them
+	_ "time/tzdata"
+)
+
+// Format of the dates of the calendars and of the processing dates
+const DATE_FORMAT = "2006-01-02"
+
+// Calendar is the business days of a payment scheme
+type Calendar struct {
+	Scheme string
+	// Time zone of the scheme, the cut-off time and the current day are in this time zone
+	Location *time.Location
+	// Time of the day (HH:MM) after which payments are processed the next business day, empty without cut-off
+	CutOff string
+	// Schemes that also settle on Saturdays and Sundays, e.g. Faster Payments
+	Weekends bool
+	// Holidays by date (YYYY-MM-DD), with their name
+	Holidays map[string]string
+}
+
+// Default calendars of the payment schemes, before the holidays of the files
+var defaults = []struct {
+	scheme   string
+	timeZone string
+	cutOff   string
+	weekends bool
+}{
+	{"FPS", "Europe/London", "", true},
+	{"BACS", "Europe/London", "22:30", false},
+	{"CHAPS", "Europe/London", "17:40", false},
+	{"SEPA", "Europe/Brussels", "16:00", false},
+	{"SWIFT", "UTC", "", false},
+}
+
+// Calendars is the calendars by upper case scheme name
+type Calendars struct {
+	calendars map[string]*Calendar
+}
+
+var calendars *Calendars
+var calendarsOnce sync.Once
+
+// GetCalendars returns the calendars configured by the environment
+// CALENDAR_DIR: directory with a holiday file per scheme, named after the scheme, e.g. bacs.txt
+// CALENDAR_CUT_OFFS: comma separated cut-off times that replace the default ones, e.g. BACS=15:00,CHAPS=17:00
+func GetCalendars() *Calendars {
+	calendarsOnce.Do(func() {
+		calendars = NewCalendars()
+
+		if dir := os.Getenv("CALENDAR_DIR"); dir != "" {
+			if err := calendars.LoadDir(dir); err != nil {
+				panic(err)
+			}
+		}
+		if cutOffs := os.Getenv("CALENDAR_CUT_OFFS"); cutOffs != "" {
+			if err := calendars.SetCutOffs(cutOffs); err != nil {
+				panic(err)
+			}
+		}
+	})
+	return calendars
+}
+
+// SetCalendars replaces the calendars configured by the environment
+func SetCalendars(c *Calendars) {
+	calendarsOnce.Do(func() {})
+	calendars = c
+}
+
+// NewCalendars creates the default calendars of the schemes, without holidays
+func NewCalendars() *Calendars {
+	c := &Calendars{calendars: map[string]*Calendar{}}
+	for _, d := range defaults {
+		location, err := time.LoadLocation(d.timeZone)
+		if err != nil {
+			panic(err)
+		}
+		c.Add(&Calendar{Scheme: d.scheme, Location: location, CutOff: d.cutOff, Weekends: d.weekends, Holidays: map[string]string{}})
+	}
+	return c
+}
+
+// Add sets the calendar of its scheme
+func (c *Calendars) Add(calendar *Calendar) {
+	c.calendars[strings.ToUpper(calendar.Scheme)] = calendar
+}
+
+// Get returns the calendar of the payment scheme, if the scheme has one
+func (c *Calendars) Get(scheme string) (*Calendar, bool) {
+	calendar, ok := c.calendars[strings.ToUpper(strings.TrimSpace(scheme))]
+	return calendar, ok
+}
+
+// LoadDir adds the holidays of the .txt files of the directory to the calendar of the scheme named by the file
+// The files of schemes without a default calendar create a calendar in UTC, closed on weekends and without cut-off
+func (c *Calendars) LoadDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".txt" {
+			continue
+		}
+		scheme := strings.ToUpper(strings.TrimSuffix(file.Name(), ".txt"))
+
+		calendar, ok := c.Get(scheme)
+		if !ok {
+			calendar = &Calendar{Scheme: scheme, Location: time.UTC, Holidays: map[string]string{}}
+			c.Add(calendar)
+		}
+		if err := calendar.LoadHolidaysFile(filepath.Join(dir, file.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var cutOffPattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// SetCutOffs replaces the cut-off times of the schemes, e.g. BACS=15:00,CHAPS=17:00
+// An empty time removes the cut-off of the scheme
+func (c *Calendars) SetCutOffs(value string) error {
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid cut-off %s, expected SCHEME=HH:MM", entry)
+		}
+
+		calendar, ok := c.Get(parts[0])
+		if !ok {
+			return fmt.Errorf("invalid cut-off %s, unknown scheme", entry)
+		}
+		cutOff := strings.TrimSpace(parts[1])
+		if cutOff != "" && !cutOffPattern.MatchString(cutOff) {
+			return fmt.Errorf("invalid cut-off %s, expected SCHEME=HH:MM", entry)
+		}
+		calendar.CutOff = cutOff
+	}
+	return nil
+}
+
+// LoadHolidaysFile adds the holidays of the file to the calendar
+func (calendar *Calendar) LoadHolidaysFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := calendar.LoadHolidays(f); err != nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+	return nil
+}
+
+// LoadHolidays adds the holidays of the reader, one date (YYYY-MM-DD) per line followed by an optional name
+// Blank lines and lines starting with # are ignored
+func (calendar *Calendar) LoadHolidays(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		date, err := time.Parse(DATE_FORMAT, fields[0])
+		if err != nil {
+			return fmt.Errorf("line %d: invalid date %s", number, fields[0])
+		}
+		name := "Holiday"
+		if len(fields) == 2 && strings.TrimSpace(fields[1]) != "" {
+			name = strings.TrimSpace(fields[1])
+		}
+		calendar.Holidays[date.Format(DATE_FORMAT)] = name
+	}
+	return scanner.Err()
+}
+
+// IsBusinessDay check if the scheme processes payments on the day of the date
+func (calendar *Calendar) IsBusinessDay(date time.Time) bool {
+	if _, ok := calendar.Holidays[date.Format(DATE_FORMAT)]; ok {
+		return false
+	}
+	if calendar.Weekends {
+		return true
+	}
+	return date.Weekday() != time.Saturday && date.Weekday() != time.Sunday
+}
+
+// BusinessDay returns the date if it is a business day, otherwise the next business day
+func (calendar *Calendar) BusinessDay(date time.Time) time.Time {
+	// A year of holidays is the most a calendar can close for
+	for i := 0; i < 366 && !calendar.IsBusinessDay(date); i++ {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date
+}
+
+// NextBusinessDay returns the first business day after the date
+func (calendar *Calendar) NextBusinessDay(date time.Time) time.Time {
+	return calendar.BusinessDay(date.AddDate(0, 0, 1))
+}
+
+// Today returns the current date of the scheme, at midnight UTC like the parsed dates
+func (calendar *Calendar) Today(now time.Time) time.Time {
+	year, month, day := now.In(calendar.Location).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// AfterCutOff check if the time is after the cut-off of the scheme on its day
+func (calendar *Calendar) AfterCutOff(now time.Time) bool {
+	if calendar.CutOff == "" {
+		return false
+	}
+	return now.In(calendar.Location).Format("15:04") >= calendar.CutOff
+}
+
+// ProcessingDate returns the earliest date a payment requested for the date can be processed, at the time now
+// Dates in the past are processed today, and today after the cut-off the next day
+func (calendar *Calendar) ProcessingDate(date time.Time, now time.Time) time.Time {
+	today := calendar.Today(now)
+	if date.Before(today) {
+		date = today
+	}
+	if date.Equal(today) && calendar.AfterCutOff(now) {
+		date = date.AddDate(0, 0, 1)
+	}
+	return calendar.BusinessDay(date)
+}
+
+// Reason returns why the scheme does not process payments on the date, empty on business days
+func (calendar *Calendar) Reason(date time.Time) string {
+	if name, ok := calendar.Holidays[date.Format(DATE_FORMAT)]; ok {
+		return name
+	}
+	if !calendar.IsBusinessDay(date) {
+		return "Weekend"
+	}
+	return ""
+}
@@ -0,0 +1,131 @@
+package calendar
+
+import (
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"payments/app/models"
+	"payments/utils"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCalendars(t *testing.T) *Calendars {
+	c := NewCalendars()
+	if err := c.LoadDir("testdata"); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func date(value string) time.Time {
+	d, err := time.Parse(DATE_FORMAT, value)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestLoadDir(t *testing.T) {
+	c := testCalendars(t)
+
+	bacs, ok := c.Get("Bacs")
+	assert.True(t, ok)
+	assert.Len(t, bacs.Holidays, 8)
+	assert.EqualValues(t, "Christmas Day", bacs.Holidays["2026-12-25"])
+	assert.EqualValues(t, "22:30", bacs.CutOff)
+	assert.EqualValues(t, "Europe/London", bacs.Location.String())
+
+	// A file of a scheme without default calendar creates one
+	target, ok := c.Get("TARGET2")
+	assert.True(t, ok)
+	assert.EqualValues(t, map[string]string{"2026-05-01": "Holiday"}, target.Holidays)
+	assert.EqualValues(t, time.UTC, target.Location)
+
+	_, ok = c.Get("Internal")
+	assert.False(t, ok)
+
+	err := (&Calendar{Holidays: map[string]string{}}).LoadHolidays(strings.NewReader("2026-01-01\n2026-13-01 Invalid"))
+	assert.EqualError(t, err, "line 2: invalid date 2026-13-01")
+}
+
+func TestSetCutOffs(t *testing.T) {
+	c := NewCalendars()
+	assert.NoError(t, c.SetCutOffs("bacs=15:00, CHAPS="))
+
+	bacs, _ := c.Get("BACS")
+	assert.EqualValues(t, "15:00", bacs.CutOff)
+	chaps, _ := c.Get("CHAPS")
+	assert.EqualValues(t, "", chaps.CutOff)
+
+	assert.EqualError(t, c.SetCutOffs("BACS"), "invalid cut-off BACS, expected SCHEME=HH:MM")
+	assert.EqualError(t, c.SetCutOffs("BACS=24:00"), "invalid cut-off BACS=24:00, expected SCHEME=HH:MM")
+	assert.EqualError(t, c.SetCutOffs("Internal=15:00"), "invalid cut-off Internal=15:00, unknown scheme")
+}
+
+func TestBusinessDays(t *testing.T) {
+	c := testCalendars(t)
+	bacs, _ := c.Get("BACS")
+	fps, _ := c.Get("FPS")
+
+	assert.True(t, bacs.IsBusinessDay(date("2026-12-24")))
+	assert.False(t, bacs.IsBusinessDay(date("2026-12-25")))
+	assert.False(t, bacs.IsBusinessDay(date("2026-12-26")))
+	assert.True(t, fps.IsBusinessDay(date("2026-12-26")))
+
+	// Christmas, the weekend and the substitute Boxing Day
+	assert.EqualValues(t, date("2026-12-29"), bacs.NextBusinessDay(date("2026-12-24")))
+	assert.EqualValues(t, date("2026-12-29"), bacs.BusinessDay(date("2026-12-25")))
+	assert.EqualValues(t, date("2026-12-24"), bacs.BusinessDay(date("2026-12-24")))
+	assert.EqualValues(t, date("2026-12-25"), fps.NextBusinessDay(date("2026-12-24")))
+
+	assert.EqualValues(t, "Christmas Day", bacs.Reason(date("2026-12-25")))
+	assert.EqualValues(t, "Weekend", bacs.Reason(date("2026-12-26")))
+	assert.EqualValues(t, "", bacs.Reason(date("2026-12-29")))
+}
+
+func TestProcessingDate(t *testing.T) {
+	c := testCalendars(t)
+	bacs, _ := c.Get("BACS")
+
+	// 21:00 in London on Thursday 2026-12-24, before the cut-off
+	before := time.Date(2026, 12, 24, 21, 0, 0, 0, time.UTC)
+	// 22:30 in London, the cut-off
+	after := time.Date(2026, 12, 24, 22, 30, 0, 0, time.UTC)
+
+	assert.EqualValues(t, date("2026-12-24"), bacs.ProcessingDate(date("2026-12-24"), before))
+	assert.EqualValues(t, date("2026-12-29"), bacs.ProcessingDate(date("2026-12-24"), after))
+	assert.EqualValues(t, date("2026-12-24"), bacs.ProcessingDate(date("2026-12-01"), before))
+	assert.EqualValues(t, date("2026-12-30"), bacs.ProcessingDate(date("2026-12-30"), after))
+
+	// The current day is the one of the scheme, 23:30 UTC on 2026-06-30 is 2026-07-01 in London
+	assert.EqualValues(t, date("2026-07-01"), bacs.Today(time.Date(2026, 6, 30, 23, 30, 0, 0, time.UTC)))
+	assert.True(t, bacs.AfterCutOff(time.Date(2026, 6, 30, 21, 30, 0, 0, time.UTC)))
+}
+
+func TestRollPayment(t *testing.T) {
+	c := testCalendars(t)
+	now := time.Date(2026, 12, 24, 23, 0, 0, 0, time.UTC)
+
+	payment := models.Payment{ID: uuid.NewV4(), Attributes: models.Attributes{PaymentScheme: "Bacs", ProcessingDate: "2026-12-25"}}
+	assert.EqualValues(t, []string{"processing_date: " + utils.WARNING_PROCESSING_DATE_ROLLED + " (2026-12-25 Christmas Day, moved to 2026-12-29)"}, c.RollPayment(&payment, now))
+	assert.EqualValues(t, "2026-12-29", payment.Attributes.ProcessingDate)
+
+	payment.Attributes.ProcessingDate = "2026-12-24"
+	assert.EqualValues(t, []string{"processing_date: " + utils.WARNING_PROCESSING_DATE_ROLLED + " (2026-12-24 After the cut-off 22:30, moved to 2026-12-29)"}, c.RollPayment(&payment, now))
+	assert.EqualValues(t, "2026-12-29", payment.Attributes.ProcessingDate)
+
+	// Business days, past dates, invalid dates and schemes without calendar are not changed
+	for _, attributes := range []models.Attributes{
+		{PaymentScheme: "BACS", ProcessingDate: "2026-12-30"},
+		{PaymentScheme: "BACS", ProcessingDate: "2026-12-20"},
+		{PaymentScheme: "BACS", ProcessingDate: "25/12/2026"},
+		{PaymentScheme: "BACS"},
+		{PaymentScheme: "FPS", ProcessingDate: "2026-12-26"},
+		{PaymentScheme: "Internal", ProcessingDate: "2026-12-26"},
+	} {
+		payment := models.Payment{Attributes: attributes}
+		assert.Empty(t, c.RollPayment(&payment, now), attributes.ProcessingDate)
+		assert.EqualValues(t, attributes.ProcessingDate, payment.Attributes.ProcessingDate)
+	}
+}
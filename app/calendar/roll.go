@@ -0,0 +1,39 @@
+package calendar
+
+import (
+	"fmt"
+	"payments/app/models"
+	"payments/utils"
+	"strings"
+	"time"
+)
+
+// RollPayment moves the processing date of the payment to the next business day of its scheme when the scheme
+// does not process payments on that date, or when the date is today and the cut-off has passed
+// Returns a warning for each change. Payments of schemes without calendar, without processing date, with an invalid
+// processing date or with a date in the past are not changed
+func (c *Calendars) RollPayment(payment *models.Payment, now time.Time) []string {
+	calendar, ok := c.Get(payment.Attributes.PaymentScheme)
+	if !ok {
+		return nil
+	}
+
+	date, err := time.Parse(DATE_FORMAT, strings.TrimSpace(payment.Attributes.ProcessingDate))
+	if err != nil || date.Before(calendar.Today(now)) {
+		return nil
+	}
+
+	processingDate := calendar.ProcessingDate(date, now)
+	if processingDate.Equal(date) {
+		return nil
+	}
+
+	reason := calendar.Reason(date)
+	if reason == "" {
+		reason = "After the cut-off " + calendar.CutOff
+	}
+	payment.Attributes.ProcessingDate = processingDate.Format(DATE_FORMAT)
+
+	return []string{fmt.Sprintf("processing_date: %s (%s %s, moved to %s)", utils.WARNING_PROCESSING_DATE_ROLLED,
+		date.Format(DATE_FORMAT), reason, payment.Attributes.ProcessingDate)}
+}
@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"payments/app/bacs"
+	"payments/app/export"
+	"payments/app/iso20022"
+	"payments/app/models"
+	"payments/utils"
+	"sort"
+	"time"
+)
+
+// command is a subcommand of the api binary, it returns the exit code
+type command struct {
+	usage string
+	run   func(args []string, stdout io.Writer, stderr io.Writer) int
+}
+
+const importPain001Usage = "import-pain001 -org <organisation id> [-dry-run] <file.xml>"
+const exportUsage = "export --format=pacs008|bacs18 -org <organisation id> [-date YYYY-MM-DD] [-output <file>]"
+
+var commands = map[string]command{
+	"import-pain001": {usage: importPain001Usage, run: importPain001},
+	"export":         {usage: exportUsage, run: exportPayments},
+}
+
+// Run runs the command named by the first argument, e.g. `payments import-pain001 -org <id> file.xml`
+func Run(args []string) int {
+	return run(args, os.Stdout, os.Stderr)
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		printUsage(stderr)
+		return 2
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+		printUsage(stderr)
+		return 2
+	}
+
+	return cmd.run(args[1:], stdout, stderr)
+}
+
+func printUsage(w io.Writer) {
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "Usage:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  payments %s\n", commands[name].usage)
+	}
+}
+
+// importPain001 imports a pain.001 file and prints the result of each transaction as JSON
+// Exits with 1 if the file is invalid or some transaction is rejected
+func importPain001(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("import-pain001", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	organisation := flags.String("org", "", "id of the organisation of the payments")
+	dryRun := flags.Bool("dry-run", false, "only validate the transactions")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(stderr, "Usage: payments "+importPain001Usage)
+		return 2
+	}
+
+	organisationID, err := utils.ConvertStringToUUID(*organisation)
+	if err != nil {
+		fmt.Fprintln(stderr, utils.ERROR_ORGANISATION_NOT_FOUND)
+		return 2
+	}
+	if _, err := models.GetOrganisationByID(organisationID); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer file.Close()
+
+	result, err := iso20022.ImportPain001(file, organisationID, "", *dryRun)
+	if err != nil {
+		if validationError, ok := err.(*iso20022.ValidationError); ok {
+			for _, message := range validationError.Errors {
+				fmt.Fprintln(stderr, message)
+			}
+		} else {
+			fmt.Fprintln(stderr, err)
+		}
+		return 1
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	if result.Rejected > 0 {
+		return 1
+	}
+	return 0
+}
+
+// exportPayments writes the payments of the organisation in the format to the output file or to stdout
+func exportPayments(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", export.FORMAT_PACS008, "format of the export: pacs008 or bacs18")
+	organisation := flags.String("org", "", "id of the organisation of the payments")
+	processingDate := flags.String("date", "", "only the payments processed on the date")
+	output := flags.String("output", "", "file to write, stdout by default")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		fmt.Fprintln(stderr, "Usage: payments "+exportUsage)
+		return 2
+	}
+
+	organisationID, err := utils.ConvertStringToUUID(*organisation)
+	if err != nil {
+		fmt.Fprintln(stderr, utils.ERROR_ORGANISATION_NOT_FOUND)
+		return 2
+	}
+	if _, err := time.Parse("2006-01-02", *processingDate); *processingDate != "" && err != nil {
+		fmt.Fprintln(stderr, utils.ERROR_PROCESSING_DATE_INVALID)
+		return 2
+	}
+
+	payments, err := models.GetPayments(organisationID, *processingDate)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	document, _, err := export.Export(*format, payments, time.Now())
+	if err != nil {
+		if validationError, ok := err.(*bacs.ValidationError); ok {
+			for _, message := range validationError.Errors {
+				fmt.Fprintln(stderr, message)
+			}
+		} else {
+			fmt.Fprintln(stderr, err)
+		}
+		return 1
+	}
+
+	if *output == "" {
+		_, err = stdout.Write(document)
+	} else {
+		err = ioutil.WriteFile(*output, document, 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
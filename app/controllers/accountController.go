@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+)
+
+// GetMe handler to get the account of the user
+var GetMe = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	account, ok := getCaller(w, r)
+	if !ok {
+		return
+	}
+
+	account.Password = ""
+
+	// Create Api Response
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: "/v1/user/me",
+	}}
+	utils.CreateApiResponse(w, account, http.StatusOK, links)
+}
+
+// ChangePassword handler to change the password of the user
+// Receives the current and the new password. The tokens issued before are revoked, so a new token is returned
+var ChangePassword = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	account, ok := getCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var request models.AccountUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	if !checkCurrentPassword(w, r, account, request.CurrentPassword) {
+		return
+	}
+
+	if err := account.ChangePassword(request.Password); err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	models.RecordAuditEvent(models.AuditEvent{Type: models.AUDIT_PASSWORD_CHANGED, AccountID: &account.ID, IP: utils.ClientIP(r)})
+
+	account.Password = ""
+
+	// Create JWT token
+	if err := account.CreateToken(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, account, http.StatusOK, nil)
+}
+
+// ChangeEmail handler to change the email of the user
+// Receives the new email and the current password. The email only changes after it is verified with the token sent to it
+var ChangeEmail = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	account, ok := getCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var request models.AccountUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	if !checkCurrentPassword(w, r, account, request.CurrentPassword) {
+		return
+	}
+
+	if err := account.ChangeEmail(request.Email); err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, nil, http.StatusAccepted, nil)
+}
+
+// DeleteMe handler to delete the account of the user
+// Receives the current password. Tokens, api keys, signing keys and client certificates of the account stop working
+// The only owner of an organisation must transfer the ownership before
+var DeleteMe = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	account, ok := getCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var request models.AccountUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	if !checkCurrentPassword(w, r, account, request.CurrentPassword) {
+		return
+	}
+
+	if err := account.Delete(); err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	models.RecordAuditEvent(models.AuditEvent{Type: models.AUDIT_ACCOUNT_DELETED, AccountID: &account.ID, IP: utils.ClientIP(r), Details: account.Email})
+
+	// Create Api Response
+	utils.CreateApiResponse(w, nil, http.StatusNoContent, nil)
+}
+
+// checkCurrentPassword check the password confirming a change, writing the error response if it is wrong
+// Wrong passwords are throttled as failed logins, so a stolen token can not be used to guess the password
+func checkCurrentPassword(w http.ResponseWriter, r *http.Request, account models.Account, password string) bool {
+	ip := utils.ClientIP(r)
+	emailKey := models.EmailThrottleKey(account.Email)
+	ipKey := models.IPThrottleKey(ip)
+
+	if loginThrottled(w, emailKey, ipKey) {
+		return false
+	}
+
+	if err := account.CheckPassword(password); err != nil {
+		loginFailed(w, &account.ID, emailKey, ipKey, ip, utils.ERROR_CURRENT_PASSWORD_INVALID)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+	"testing"
+	"time"
+)
+
+func TestGetMe(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+
+	rw := doRequestWithAuthorization(t, http.MethodGet, "/v1/user/me", nil, "Bearer "+token, http.StatusOK)
+	validateHeaderContentType(t, rw)
+	response := decodeApiResponse(t, rw)
+
+	var account models.Account
+	if err := json.Unmarshal(response.Data, &account); err != nil {
+		t.Fatalf("Failed to decode response to account: %s", err)
+	}
+
+	assert.EqualValues(t, "dummy@email.com", account.Email)
+	assert.EqualValues(t, "", account.Password, "Password Returned")
+}
+
+func TestChangePassword(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+
+	// Tokens have a precision of seconds, the old token must be issued before the change
+	time.Sleep(time.Second)
+
+	jsonBytes, _ := json.Marshal(models.AccountUpdateRequest{CurrentPassword: "wrongPassword", Password: "newPassword"})
+	rw := doRequestWithAuthorization(t, http.MethodPut, "/v1/user/me/password", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusUnauthorized)
+	assert.EqualValues(t, []string{utils.ERROR_CURRENT_PASSWORD_INVALID}, decodeApiResponse(t, rw).Errors)
+
+	jsonBytes, _ = json.Marshal(models.AccountUpdateRequest{CurrentPassword: "dummyPassword", Password: "short"})
+	rw = doRequestWithAuthorization(t, http.MethodPut, "/v1/user/me/password", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusBadRequest)
+	assert.EqualValues(t, []string{utils.ERROR_PASSWORD_TOO_SHORT + " (at least 8 characters)"}, decodeApiResponse(t, rw).Errors)
+
+	jsonBytes, _ = json.Marshal(models.AccountUpdateRequest{CurrentPassword: "dummyPassword", Password: "newPassword"})
+	rw = doRequestWithAuthorization(t, http.MethodPut, "/v1/user/me/password", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusOK)
+
+	var account models.Account
+	if err := json.Unmarshal(decodeApiResponse(t, rw).Data, &account); err != nil {
+		t.Fatalf("Failed to decode response to account: %s", err)
+	}
+
+	// The old token is revoked, the new one works
+	rw = doRequestWithAuthorization(t, http.MethodGet, "/v1/user/me", nil, "Bearer "+token, http.StatusForbidden)
+	assert.EqualValues(t, []string{utils.ERROR_TOKEN_REVOKED}, decodeApiResponse(t, rw).Errors)
+	doRequestWithAuthorization(t, http.MethodGet, "/v1/user/me", nil, "Bearer "+account.Token, http.StatusOK)
+
+	loginWithPassword(t, "dummy@email.com", "dummyPassword", http.StatusUnauthorized)
+	loginWithPassword(t, "dummy@email.com", "newPassword", http.StatusOK)
+}
+
+func TestChangeEmail(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	createAndLogUser(t, "other@email.com", "dummyPassword")
+
+	jsonBytes, _ := json.Marshal(models.AccountUpdateRequest{CurrentPassword: "dummyPassword", Email: "other@email.com"})
+	rw := doRequestWithAuthorization(t, http.MethodPut, "/v1/user/me/email", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusBadRequest)
+	assert.EqualValues(t, []string{utils.ERROR_EMAIL_ALREADY_EXISTS}, decodeApiResponse(t, rw).Errors)
+
+	jsonBytes, _ = json.Marshal(models.AccountUpdateRequest{CurrentPassword: "dummyPassword", Email: "new@email.com"})
+	doRequestWithAuthorization(t, http.MethodPut, "/v1/user/me/email", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusAccepted)
+
+	// The email only changes after the verification
+	loginWithPassword(t, "dummy@email.com", "dummyPassword", http.StatusOK)
+
+	jsonBytes, _ = json.Marshal(models.AccountTokenRequest{Token: mailer.lastToken(t, "new@email.com")})
+	doRequestWithoutLogin(t, http.MethodPost, "/v1/user/email/verify", bytes.NewBuffer(jsonBytes), http.StatusNoContent)
+
+	account, err := models.GetAccountByEmail("new@email.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, account.EmailVerified)
+
+	loginWithPassword(t, "new@email.com", "dummyPassword", http.StatusOK)
+
+	var events []models.AuditEvent
+	infrastructure.GetDB().Where("type = ?", models.AUDIT_EMAIL_CHANGED).Find(&events)
+	assert.Len(t, events, 1)
+}
+
+func TestDeleteMe(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	apiKey := createApiKey(t, token, models.SCOPE_PAYMENTS_READ)
+
+	jsonBytes, _ := json.Marshal(models.AccountUpdateRequest{CurrentPassword: "wrongPassword"})
+	doRequestWithAuthorization(t, http.MethodDelete, "/v1/user/me", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusUnauthorized)
+
+	jsonBytes, _ = json.Marshal(models.AccountUpdateRequest{CurrentPassword: "dummyPassword"})
+	doRequestWithAuthorization(t, http.MethodDelete, "/v1/user/me", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusNoContent)
+
+	// The token and the api key stop working
+	doRequestWithAuthorization(t, http.MethodGet, "/v1/user/me", nil, "Bearer "+token, http.StatusForbidden)
+	doRequestWithAuthorization(t, http.MethodGet, "/v1/payments", nil, "ApiKey "+apiKey.Key, http.StatusForbidden)
+
+	loginWithPassword(t, "dummy@email.com", "dummyPassword", http.StatusUnauthorized)
+}
+
+func TestAdminDisableAccount(t *testing.T) {
+	deleteDatabase()
+
+	userToken := createAndLogUser(t, "user@dummy.com", "dummypassword")
+	adminToken := createAndLogAdmin(t, "admin@dummy.com", "dummypassword")
+
+	// Only admins list accounts
+	doRequestWithAuthorization(t, http.MethodGet, "/v1/admin/accounts", nil, "Bearer "+userToken, http.StatusForbidden)
+
+	rw := doRequestWithAuthorization(t, http.MethodGet, "/v1/admin/accounts", nil, "Bearer "+adminToken, http.StatusOK)
+	var accounts []models.Account
+	if err := json.Unmarshal(decodeApiResponse(t, rw).Data, &accounts); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, accounts, 2)
+	assert.EqualValues(t, "", accounts[0].Password, "Password Returned")
+
+	user, _ := models.GetAccountByEmail("user@dummy.com")
+	admin, _ := models.GetAccountByEmail("admin@dummy.com")
+
+	// Admins can not disable themselves
+	doRequestWithAuthorization(t, http.MethodPost, fmt.Sprintf("/v1/admin/accounts/%d/disable", admin.ID), nil, "Bearer "+adminToken, http.StatusBadRequest)
+
+	doRequestWithAuthorization(t, http.MethodPost, fmt.Sprintf("/v1/admin/accounts/%d/disable", user.ID), nil, "Bearer "+adminToken, http.StatusNoContent)
+
+	rw = doRequestWithAuthorization(t, http.MethodGet, "/v1/user/me", nil, "Bearer "+userToken, http.StatusForbidden)
+	assert.EqualValues(t, []string{utils.ERROR_ACCOUNT_DISABLED}, decodeApiResponse(t, rw).Errors)
+
+	response := loginWithPassword(t, "user@dummy.com", "dummypassword", http.StatusForbidden)
+	assert.EqualValues(t, []string{utils.ERROR_ACCOUNT_DISABLED}, response.Errors)
+
+	doRequestWithAuthorization(t, http.MethodPost, fmt.Sprintf("/v1/admin/accounts/%d/enable", user.ID), nil, "Bearer "+adminToken, http.StatusNoContent)
+
+	loginWithPassword(t, "user@dummy.com", "dummypassword", http.StatusOK)
+
+	var events []models.AuditEvent
+	infrastructure.GetDB().Where("type IN (?)", []string{models.AUDIT_ACCOUNT_DISABLED, models.AUDIT_ACCOUNT_ENABLED}).Find(&events)
+	assert.Len(t, events, 2)
+}
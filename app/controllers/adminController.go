@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+	"strconv"
+)
+
+// GetLockouts handler to get the emails and ip addresses locked after failed logins
+// Only admins can access
+var GetLockouts = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	throttles, err := models.GetLockedLoginThrottles()
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Create Links
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: "/v1/admin/lockouts",
+	}}
+	for _, throttle := range throttles {
+		links = append(links, utils.Link{
+			Rel:  throttle.Key,
+			Href: fmt.Sprintf("/v1/admin/lockouts/%d", throttle.ID),
+		})
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, throttles, http.StatusOK, links)
+}
+
+// ClearLockout handler to clear the failed logins of an email or ip address
+// Only admins can access. The clearance is recorded as an audit event
+var ClearLockout = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	admin, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	// Read the ID from the mux vars
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_RESOURCE_NOT_FOUND, http.StatusNotFound)
+		return
+	}
+
+	throttle, err := models.GetLoginThrottleByID(id)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := models.ClearLoginThrottle(throttle.Key); err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	models.RecordAuditEvent(models.AuditEvent{
+		Type:    models.AUDIT_LOCKOUT_CLEARED,
+		ActorID: &admin.ID,
+		IP:      utils.ClientIP(r),
+		Details: throttle.Key,
+	})
+
+	// Create Api Response
+	utils.CreateApiResponse(w, nil, http.StatusNoContent, nil)
+}
+
+// GetAuditEvents handler to get the most recent audit events
+// Only admins can access
+var GetAuditEvents = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	events, err := models.GetAuditEvents(100)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Create Api Response
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: "/v1/admin/audit-events",
+	}}
+	utils.CreateApiResponse(w, events, http.StatusOK, links)
+}
+
+// GetAccounts handler to get all accounts
+// Only admins can access
+var GetAccounts = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	if _, ok := requireAdmin(w, r); !ok {
+		return
+	}
+
+	accounts, err := models.GetAccounts()
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Create Links
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: "/v1/admin/accounts",
+	}}
+	for _, account := range accounts {
+		links = append(links, utils.Link{
+			Rel:  account.Email,
+			Href: fmt.Sprintf("/v1/admin/accounts/%d", account.ID),
+		})
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, accounts, http.StatusOK, links)
+}
+
+// DisableAccount handler to disable an account, its tokens, api keys and client certificates stop working
+// Only admins can access. The change is recorded as an audit event
+var DisableAccount = func(w http.ResponseWriter, r *http.Request) {
+	setAccountDisabled(w, r, true)
+}
+
+// EnableAccount handler to enable a disabled account
+// Only admins can access. The change is recorded as an audit event
+var EnableAccount = func(w http.ResponseWriter, r *http.Request) {
+	setAccountDisabled(w, r, false)
+}
+
+func setAccountDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+
+	infrastructure.LogApiRequest(r)
+
+	admin, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	// Read the ID from the mux vars
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_RESOURCE_NOT_FOUND, http.StatusNotFound)
+		return
+	}
+
+	account, err := models.GetAccountByID(uint(id))
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Admins would lock themselves out
+	if disabled && account.ID == admin.ID {
+		utils.CreateApiErrorResponse(w, utils.ERROR_ADMIN_SELF_DISABLE, http.StatusBadRequest)
+		return
+	}
+
+	if err := account.SetDisabled(disabled); err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	eventType := models.AUDIT_ACCOUNT_ENABLED
+	if disabled {
+		eventType = models.AUDIT_ACCOUNT_DISABLED
+	}
+	models.RecordAuditEvent(models.AuditEvent{
+		Type:      eventType,
+		AccountID: &account.ID,
+		ActorID:   &admin.ID,
+		IP:        utils.ClientIP(r),
+	})
+
+	// Create Api Response
+	utils.CreateApiResponse(w, nil, http.StatusNoContent, nil)
+}
+
+// requireAdmin returns the account of the caller if it is an admin, otherwise writes a forbidden response
+func requireAdmin(w http.ResponseWriter, r *http.Request) (models.Account, bool) {
+	user := r.Context().Value("user").(uint) //Grab the id of the user that send the request
+
+	account, err := models.GetAccountByID(user)
+	if err != nil && err.Error() == utils.ERROR_SERVER {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return account, false
+	}
+
+	if err != nil || !account.IsAdmin() {
+		utils.CreateApiErrorResponse(w, utils.ERROR_FORBIDDEN, http.StatusForbidden)
+		return account, false
+	}
+
+	return account, true
+}
+
+// ClaimOrganisation handler to make an account the owner of an organisation without owner
+// Only admins can access. The organisations of the payments stored before the organisations are created without members,
+// and are claimed for their account. The claim is recorded as an audit event
+var ClaimOrganisation = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	admin, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	// Read the ID from the mux vars
+	vars := mux.Vars(r)
+	id, err := uuid.FromString(vars["id"])
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_RESOURCE_NOT_FOUND, http.StatusNotFound)
+		return
+	}
+
+	organisation, err := models.GetOrganisationByID(id)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var request models.Membership
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	account, err := models.GetAccountByID(request.AccountID)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	membership, err := organisation.Claim(account.ID)
+	if err != nil {
+		if err.Error() == utils.ERROR_ORGANISATION_HAS_OWNER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusConflict)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	models.RecordAuditEvent(models.AuditEvent{
+		Type:      models.AUDIT_ORGANISATION_CLAIMED,
+		AccountID: &account.ID,
+		ActorID:   &admin.ID,
+		IP:        utils.ClientIP(r),
+		Details:   organisation.ID.String(),
+	})
+
+	// Create Api Response
+	links := []utils.Link{{
+		Rel:  "members",
+		Href: fmt.Sprintf("/v1/organisations/%s/members", organisation.ID.String()),
+	}}
+	utils.CreateApiResponse(w, membership, http.StatusOK, links)
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+	"strconv"
+	"time"
+)
+
+// CreateApiKey handler to create a new api key
+// Receives name, scopes and optional expiration and returns the key. The key is only returned here
+var CreateApiKey = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	user := r.Context().Value("user").(uint) //Grab the id of the user that send the request
+
+	var request models.ApiKey
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	if err := request.IsValid(); err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Keys restricted to an organisation can only be created by its members
+	if request.OrganisationID != nil {
+		if _, err := models.GetMembership(*request.OrganisationID, user); err != nil {
+			if err.Error() != utils.ERROR_SERVER {
+				utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+			} else {
+				utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
+	apiKey := models.ApiKey{
+		AccountID:      user,
+		OrganisationID: request.OrganisationID,
+		Name:           request.Name,
+		Scopes:         request.Scopes,
+		ExpiresAt:      request.ExpiresAt,
+	}
+
+	if err := apiKey.GenerateKey(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := infrastructure.GetDB().Create(&apiKey).Error; err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Create Api Response
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: fmt.Sprintf("/v1/api-keys/%d", apiKey.ID),
+	}}
+	utils.CreateApiResponse(w, apiKey, http.StatusCreated, links)
+}
+
+// GetApiKeys handler to get the api keys of the user
+// The keys are returned without the secret
+var GetApiKeys = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	user := r.Context().Value("user").(uint) //Grab the id of the user that send the request
+
+	apiKeys, err := models.GetApiKeysByAccount(user)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Create Links
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: "/v1/api-keys",
+	}}
+	for _, apiKey := range apiKeys {
+		links = append(links, utils.Link{
+			Rel:  strconv.FormatUint(uint64(apiKey.ID), 10),
+			Href: fmt.Sprintf("/v1/api-keys/%d", apiKey.ID),
+		})
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, apiKeys, http.StatusOK, links)
+}
+
+// RevokeApiKey handler to revoke an api key
+// Receives the api key id. Revoked keys are kept to audit their usage
+var RevokeApiKey = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	user := r.Context().Value("user").(uint) //Grab the id of the user that send the request
+
+	// Read the ID from the mux vars
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_RESOURCE_NOT_FOUND, http.StatusNotFound)
+		return
+	}
+
+	apiKey, err := models.GetApiKeyByID(uint(id), user)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if apiKey.RevokedAt == nil {
+		now := time.Now()
+		if err := infrastructure.GetDB().Model(&apiKey).UpdateColumn("revoked_at", now).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, nil, http.StatusNoContent, nil)
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"payments/app/models"
+	"payments/utils"
+	"testing"
+)
+
+func createApiKey(t *testing.T, token string, scopes ...string) models.ApiKey {
+	jsonBytes, err := json.Marshal(models.ApiKey{Name: "batch job", Scopes: scopes})
+	if err != nil {
+		t.Fatalf("Failed to encode to JSON: %s", err)
+	}
+
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/api-keys", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusCreated)
+	validateHeaderContentType(t, rw)
+	response := decodeApiResponse(t, rw)
+
+	var apiKey models.ApiKey
+	if err := json.Unmarshal(response.Data, &apiKey); err != nil {
+		t.Fatalf("Failed to decode response to api key: %s", err)
+	}
+
+	return apiKey
+}
+
+func TestCreateApiKey(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	apiKey := createApiKey(t, token, models.SCOPE_PAYMENTS_READ)
+
+	assert.NotEmpty(t, apiKey.Key)
+	assert.EqualValues(t, []string{models.SCOPE_PAYMENTS_READ}, apiKey.Scopes)
+
+	// The key is not returned again
+	rw := doRequestWithAuthorization(t, http.MethodGet, "/v1/api-keys", nil, "Bearer "+token, http.StatusOK)
+	response := decodeApiResponse(t, rw)
+
+	var apiKeys []models.ApiKey
+	if err := json.Unmarshal(response.Data, &apiKeys); err != nil {
+		t.Fatalf("Failed to decode response to api keys: %s", err)
+	}
+
+	assert.Len(t, apiKeys, 1)
+	assert.Empty(t, apiKeys[0].Key)
+	assert.EqualValues(t, []string{models.SCOPE_PAYMENTS_READ}, apiKeys[0].Scopes)
+}
+
+func TestCreateApiKeyWithInvalidScope(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	jsonBytes := []byte(`{"name": "batch job", "scopes": ["payments:admin"]}`)
+
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/api-keys", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusBadRequest)
+	response := decodeApiResponse(t, rw)
+
+	assert.EqualValues(t, []string{utils.ERROR_API_KEY_SCOPE_INVALID}, response.Errors)
+}
+
+func TestApiKeyWithReadScope(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	apiKey := createApiKey(t, token, models.SCOPE_PAYMENTS_READ)
+
+	doRequestWithAuthorization(t, http.MethodGet, "/v1/payments", nil, "ApiKey "+apiKey.Key, http.StatusOK)
+
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(paymentExample(uuid.NewV4())), "ApiKey "+apiKey.Key, http.StatusForbidden)
+	response := decodeApiResponse(t, rw)
+	assert.EqualValues(t, []string{utils.ERROR_API_KEY_SCOPE}, response.Errors)
+}
+
+func TestApiKeyCannotManageApiKeys(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	apiKey := createApiKey(t, token, models.SCOPE_PAYMENTS_READ, models.SCOPE_PAYMENTS_WRITE)
+
+	doRequestWithAuthorization(t, http.MethodGet, "/v1/api-keys", nil, "ApiKey "+apiKey.Key, http.StatusForbidden)
+}
+
+func TestRevokedApiKey(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	apiKey := createApiKey(t, token, models.SCOPE_PAYMENTS_READ)
+
+	doRequestWithAuthorization(t, http.MethodDelete, fmt.Sprintf("/v1/api-keys/%d", apiKey.ID), nil, "Bearer "+token, http.StatusNoContent)
+
+	rw := doRequestWithAuthorization(t, http.MethodGet, "/v1/payments", nil, "ApiKey "+apiKey.Key, http.StatusForbidden)
+	response := decodeApiResponse(t, rw)
+	assert.EqualValues(t, []string{utils.ERROR_API_KEY_INVALID}, response.Errors)
+}
+
+func TestInvalidApiKey(t *testing.T) {
+	deleteDatabase()
+
+	doRequestWithAuthorization(t, http.MethodGet, "/v1/payments", nil, "ApiKey pk_000000000000.invalid", http.StatusForbidden)
+}
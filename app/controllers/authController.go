@@ -2,10 +2,12 @@ package controllers
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
 	"payments/app/models"
 	"payments/infrastructure"
 	"payments/utils"
+	"strconv"
 )
 
 // CreateAccount handler to create new user
@@ -14,13 +16,19 @@ var CreateAccount = func(w http.ResponseWriter, r *http.Request) {
 
 	infrastructure.LogApiRequest(r)
 
-	account := models.Account{}
+	request := models.Account{}
 	// Decode the request body into struct and failed if any error occur
-	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
 		return
 	}
 
+	// Only the email and password are chosen by the user
+	account := models.Account{
+		Email:    request.Email,
+		Password: request.Password,
+	}
+
 	// Check if Email is valid
 	if err := account.IsEmailValid(); err != nil {
 		if err.Error() != utils.ERROR_SERVER {
@@ -32,15 +40,19 @@ var CreateAccount = func(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if Password has 6 or more characters
-	if !account.IsPasswordValid() {
-		utils.CreateApiErrorResponse(w, utils.ERROR_PASSWORD_REQUIRED, http.StatusBadRequest)
+	// Check if Password follows the password policy
+	if err := account.ValidatePassword(); err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	// Only emails listed in ADMIN_EMAILS are admins
+	account.AssignRole()
+
 	// Create Hashed password
 	if err := account.CreateHashedPassword(); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	// Create Account
@@ -49,7 +61,15 @@ var CreateAccount = func(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	account.CreateToken()
+	// The account is created even if the email fails, the user can ask a new one
+	if err := account.SendEmailVerification(account.Email); err != nil {
+		infrastructure.LogError(http.StatusInternalServerError, err.Error())
+	}
+
+	if err := account.CreateToken(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 	account.Password = "" // Delete password
 
 	// Create Api Response
@@ -69,19 +89,59 @@ var Authenticate = func(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify if email exists
+	ip := utils.ClientIP(r)
+	emailKey := models.EmailThrottleKey(request.Email)
+	ipKey := models.IPThrottleKey(ip)
+
+	// Refuse the attempt while the email or the ip address must wait after failed logins
+	if loginThrottled(w, emailKey, ipKey) {
+		return
+	}
+
+	// Verify if email exists. Unknown emails get the same response, after the same work, as wrong passwords
 	account, err := models.GetAccountByEmail(request.Email)
 	if err != nil {
 		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
 		return
 	} else if account.Email == "" {
-		utils.CreateApiErrorResponse(w, utils.ERROR_EMAIL_NON_EXISTS, http.StatusBadRequest)
+		models.CheckDummyPassword(request.Password)
+		loginFailed(w, nil, emailKey, ipKey, ip, utils.ERROR_INVALID_LOGIN)
 		return
-
 	}
 
 	if err := account.CheckPassword(request.Password); err != nil {
-		utils.CreateApiErrorResponse(w, err.Error(), http.StatusUnauthorized)
+		loginFailed(w, &account.ID, emailKey, ipKey, ip, utils.ERROR_INVALID_LOGIN)
+		return
+	}
+
+	// Only the right password tells the account is disabled
+	if account.Disabled {
+		utils.CreateApiErrorResponse(w, utils.ERROR_ACCOUNT_DISABLED, http.StatusForbidden)
+		return
+	}
+
+	// Upgrade bcrypt hashes, and argon2id hashes with old parameters, now that the password is known
+	if account.PasswordNeedsRehash() {
+		if err := account.RehashPassword(request.Password); err != nil {
+			infrastructure.LogError(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	// With two-factor authentication the password only gives a challenge token to exchange with a TOTP code
+	// The failed logins are only cleared after the code, so the password can not be used to reset them
+	if account.TOTPEnabled {
+		challengeToken, err := account.CreateChallengeToken()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		utils.CreateApiResponse(w, models.MFAChallenge{MFARequired: true, ChallengeToken: challengeToken}, http.StatusOK, nil)
+		return
+	}
+
+	if err := models.ClearLoginThrottle(emailKey); err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -89,8 +149,50 @@ var Authenticate = func(w http.ResponseWriter, r *http.Request) {
 	account.Password = ""
 
 	// Create JWT token
-	account.CreateToken()
+	if err := account.CreateToken(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
 	// Create Api Response
 	utils.CreateApiResponse(w, account, http.StatusOK, nil)
 }
+
+// loginFailed records the failed login for the email and the ip address and writes the error response
+// An audit event is recorded when the email or the ip address gets locked
+func loginFailed(w http.ResponseWriter, accountID *uint, emailKey string, ipKey string, ip string, error string) {
+	emailLocked, err := models.RecordLoginFailure(emailKey, models.LOGIN_MAX_EMAIL_FAILURES)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ipLocked, err := models.RecordLoginFailure(ipKey, models.LOGIN_MAX_IP_FAILURES)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if emailLocked {
+		models.RecordAuditEvent(models.AuditEvent{Type: models.AUDIT_ACCOUNT_LOCKED, AccountID: accountID, IP: ip, Details: emailKey})
+	}
+	if ipLocked {
+		models.RecordAuditEvent(models.AuditEvent{Type: models.AUDIT_IP_LOCKED, IP: ip, Details: ipKey})
+	}
+
+	utils.CreateApiErrorResponse(w, error, http.StatusUnauthorized)
+}
+
+// loginThrottled writes the throttled response if the email or the ip address must wait after failed logins
+func loginThrottled(w http.ResponseWriter, emailKey string, ipKey string) bool {
+	wait, err := models.LoginWait(emailKey, ipKey)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return true
+	} else if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		utils.CreateApiErrorResponse(w, utils.ERROR_LOGIN_THROTTLED, http.StatusTooManyRequests)
+		return true
+	}
+	return false
+}
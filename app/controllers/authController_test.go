@@ -3,14 +3,20 @@ package controllers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 	"net/http"
-	"os"
+	"net/http/httptest"
 	"payments/app/models"
 	"payments/infrastructure"
 	"payments/utils"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestCreateAccountWithInvalidBody(t *testing.T) {
@@ -61,7 +67,7 @@ func TestCreateAccountWithInvalidPassword(t *testing.T) {
 	validateHeaderContentType(t, rw)
 	response := decodeApiResponse(t, rw)
 
-	assert.EqualValues(t, []string{utils.ERROR_PASSWORD_REQUIRED}, response.Errors)
+	assert.EqualValues(t, []string{utils.ERROR_PASSWORD_TOO_SHORT + " (at least 8 characters)"}, response.Errors)
 }
 
 func TestCreateAccountWithExistsEmail(t *testing.T) {
@@ -118,15 +124,12 @@ func TestCreateAccount(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	tk := &models.Token{}
-
-	token, err := jwt.ParseWithClaims(accountNew.Token, tk, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("token_password")), nil
-	})
+	tk, err := models.ParseToken(accountNew.Token)
 
 	assert.EqualValues(t, account.Email, existingAccountInDB.Email)
 	assert.EqualValues(t, accountNew.Password, "", "Password returned to client")
-	assert.True(t, token.Valid, "Token Invalid")
+	assert.Nil(t, err, "Token Invalid")
+	assert.EqualValues(t, accountNew.ID, tk.UserId)
 	assert.NotEqual(t, account.Password, existingAccountInDB.Password, "Password not encrypted")
 
 }
@@ -157,11 +160,11 @@ func TestLoginWithNonExistsEmail(t *testing.T) {
 		t.Fatalf("Failed to encode to JSON: %s", err)
 	}
 
-	rw := doRequestWithoutLogin(t, http.MethodPost, "/v1/user/login", bytes.NewBuffer(jsonBytes), http.StatusBadRequest)
+	rw := doRequestWithoutLogin(t, http.MethodPost, "/v1/user/login", bytes.NewBuffer(jsonBytes), http.StatusUnauthorized)
 	validateHeaderContentType(t, rw)
 	response := decodeApiResponse(t, rw)
 
-	assert.EqualValues(t, []string{utils.ERROR_EMAIL_NON_EXISTS}, response.Errors)
+	assert.EqualValues(t, []string{utils.ERROR_INVALID_LOGIN}, response.Errors)
 }
 
 func TestLogin(t *testing.T) {
@@ -173,6 +176,10 @@ func TestLogin(t *testing.T) {
 		Password: "dummypassword",
 	}
 
+	if err := account.CreateHashedPassword(); err != nil {
+		t.Fatal(err)
+	}
+
 	if err := infrastructure.GetDB().Create(&account).Error; err != nil {
 		t.Fatal(err)
 	}
@@ -197,14 +204,237 @@ func TestLogin(t *testing.T) {
 		t.Fatalf("Failed to decode response to payment: %s", err)
 	}
 
-	tk := &models.Token{}
-
-	token, err := jwt.ParseWithClaims(accountLogged.Token, tk, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("token_password")), nil
-	})
+	_, err = models.ParseToken(accountLogged.Token)
 
 	assert.EqualValues(t, []string(nil), response.Errors)
 	assert.EqualValues(t, account.Email, accountLogged.Email)
 	assert.EqualValues(t, accountLogged.Password, "", "Password Returned")
-	assert.True(t, token.Valid, "Token Invalid")
+	assert.Nil(t, err, "Token Invalid")
+}
+
+func TestLoginTokenIsPublishedInJWKS(t *testing.T) {
+
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummyemail@dummy.com", "dummypassword")
+
+	parsedToken, _, err := new(jwt.Parser).ParseUnverified(token, &models.Token{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rw := doRequestWithoutLogin(t, http.MethodGet, "/.well-known/jwks.json", nil, http.StatusOK)
+	validateHeaderContentType(t, rw)
+
+	var jwks infrastructure.JWKSet
+	if err := json.NewDecoder(rw.Body).Decode(&jwks); err != nil {
+		t.Fatalf("Failed to decode JWKS: %s", err)
+	}
+
+	var kids []string
+	for _, key := range jwks.Keys {
+		kids = append(kids, key.KeyID)
+	}
+
+	assert.Contains(t, kids, parsedToken.Header["kid"])
+	assert.Contains(t, []string{infrastructure.ALGORITHM_RS256, infrastructure.ALGORITHM_ES256}, parsedToken.Header["alg"])
+}
+
+func TestRequestWithHMACSignedTokenIsRefused(t *testing.T) {
+
+	deleteDatabase()
+
+	key, err := infrastructure.GetKeyRing().SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Token signed with HS256 using the public key as secret (algorithm confusion)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &models.Token{UserId: 1})
+	token.Header["kid"] = key.ID
+	tokenString, err := token.SignedString([]byte(key.JWK().X + key.JWK().N))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/payments", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	rw := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rw, req)
+
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+}
+
+func loginWithPassword(t *testing.T, email string, password string, expectedResultCode int) utils.Response {
+	jsonBytes, err := json.Marshal(models.Account{Email: email, Password: password})
+	if err != nil {
+		t.Fatalf("Failed to encode to JSON: %s", err)
+	}
+
+	rw := doRequestWithoutLogin(t, http.MethodPost, "/v1/user/login", bytes.NewBuffer(jsonBytes), expectedResultCode)
+	validateHeaderContentType(t, rw)
+	return decodeApiResponse(t, rw)
+}
+
+func TestLoginRehashesBcryptPassword(t *testing.T) {
+
+	deleteDatabase()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("dummypassword"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := models.Account{Email: "dummyemail@dummy.com", Password: string(hashedPassword)}
+	if err := infrastructure.GetDB().Create(&account).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	loginWithPassword(t, "dummyemail@dummy.com", "dummypassword", http.StatusOK)
+
+	var existingAccountInDB models.Account
+	if err := infrastructure.GetDB().Where("ID = ?", account.ID).First(&existingAccountInDB).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, strings.HasPrefix(existingAccountInDB.Password, "$argon2id$"), "Password not rehashed")
+
+	// The new hash is accepted
+	loginWithPassword(t, "dummyemail@dummy.com", "dummypassword", http.StatusOK)
+}
+
+func TestLoginWithWrongPassword(t *testing.T) {
+
+	deleteDatabase()
+
+	createAndLogUser(t, "dummyemail@dummy.com", "dummypassword")
+
+	response := loginWithPassword(t, "dummyemail@dummy.com", "wrongpassword", http.StatusUnauthorized)
+
+	assert.EqualValues(t, []string{utils.ERROR_INVALID_LOGIN}, response.Errors)
+}
+
+func TestLoginIsDelayedAfterFailures(t *testing.T) {
+
+	deleteDatabase()
+
+	createAndLogUser(t, "dummyemail@dummy.com", "dummypassword")
+
+	for i := 0; i < models.LOGIN_DELAY_AFTER_FAILURES; i++ {
+		loginWithPassword(t, "dummyemail@dummy.com", "wrongpassword", http.StatusUnauthorized)
+	}
+
+	// Even the right password must wait
+	response := loginWithPassword(t, "dummyemail@dummy.com", "dummypassword", http.StatusTooManyRequests)
+
+	assert.EqualValues(t, []string{utils.ERROR_LOGIN_THROTTLED}, response.Errors)
+}
+
+func TestParallelLoginFailures(t *testing.T) {
+
+	deleteDatabase()
+
+	key := models.EmailThrottleKey("dummyemail@dummy.com")
+	var wg sync.WaitGroup
+	locks := make(chan bool, models.LOGIN_MAX_EMAIL_FAILURES)
+	for i := 0; i < models.LOGIN_MAX_EMAIL_FAILURES; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			locked, err := models.RecordLoginFailure(key, models.LOGIN_MAX_EMAIL_FAILURES)
+			assert.Nil(t, err)
+			locks <- locked
+		}()
+	}
+	wg.Wait()
+	close(locks)
+
+	// Every failure is counted and the key is locked once
+	throttle, err := models.GetLoginThrottle(key)
+	require.Nil(t, err)
+	assert.EqualValues(t, models.LOGIN_MAX_EMAIL_FAILURES, throttle.Failures)
+	assert.True(t, throttle.IsLocked(time.Now()))
+	locked := 0
+	for lock := range locks {
+		if lock {
+			locked++
+		}
+	}
+	assert.EqualValues(t, 1, locked)
+}
+
+func TestLoginThrottleIgnoresForwardedFor(t *testing.T) {
+
+	deleteDatabase()
+
+	createAndLogUser(t, "dummyemail@dummy.com", "dummypassword")
+
+	// Without trusted proxies, a client changing X-Forwarded-For is still throttled by its address
+	for i := 0; i < models.LOGIN_DELAY_AFTER_FAILURES; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/v1/user/login", bytes.NewBufferString(`{"email": "other@dummy.com", "password": "wrongpassword"}`))
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i))
+		server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	throttle, err := models.GetLoginThrottle(models.IPThrottleKey("192.0.2.1"))
+	require.Nil(t, err)
+	assert.EqualValues(t, models.LOGIN_DELAY_AFTER_FAILURES, throttle.Failures)
+}
+
+func TestLockedAccountClearedByAdmin(t *testing.T) {
+
+	deleteDatabase()
+
+	createAndLogUser(t, "dummyemail@dummy.com", "dummypassword")
+
+	// Lock the account with one failure before the maximum
+	throttle := models.LoginThrottle{
+		Key:           models.EmailThrottleKey("dummyemail@dummy.com"),
+		Failures:      models.LOGIN_MAX_EMAIL_FAILURES - 1,
+		LastFailureAt: time.Now().Add(-models.LOGIN_MAX_DELAY),
+	}
+	if err := infrastructure.GetDB().Create(&throttle).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	loginWithPassword(t, "dummyemail@dummy.com", "wrongpassword", http.StatusUnauthorized)
+	loginWithPassword(t, "dummyemail@dummy.com", "dummypassword", http.StatusTooManyRequests)
+
+	var events []models.AuditEvent
+	infrastructure.GetDB().Where("type = ?", models.AUDIT_ACCOUNT_LOCKED).Find(&events)
+	assert.Len(t, events, 1)
+
+	// Only admins clear lockouts
+	userToken := createAndLogUser(t, "user@dummy.com", "dummypassword")
+	doRequestWithAuthorization(t, http.MethodDelete, fmt.Sprintf("/v1/admin/lockouts/%d", throttle.ID), nil, "Bearer "+userToken, http.StatusForbidden)
+
+	adminToken := createAndLogAdmin(t, "admin@dummy.com", "dummypassword")
+
+	rw := doRequestWithAuthorization(t, http.MethodGet, "/v1/admin/lockouts", nil, "Bearer "+adminToken, http.StatusOK)
+	var lockouts []models.LoginThrottle
+	if err := json.Unmarshal(decodeApiResponse(t, rw).Data, &lockouts); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, lockouts, 1)
+
+	doRequestWithAuthorization(t, http.MethodDelete, fmt.Sprintf("/v1/admin/lockouts/%d", throttle.ID), nil, "Bearer "+adminToken, http.StatusNoContent)
+
+	loginWithPassword(t, "dummyemail@dummy.com", "dummypassword", http.StatusOK)
+}
+
+func TestCreateAccountCannotChooseRole(t *testing.T) {
+
+	deleteDatabase()
+
+	jsonBytes := []byte(`{"email": "dummyemail@dummy.com", "password": "dummypassword", "role": "admin"}`)
+
+	rw := doRequestWithoutLogin(t, http.MethodPost, "/v1/user", bytes.NewBuffer(jsonBytes), http.StatusCreated)
+	response := decodeApiResponse(t, rw)
+
+	var account models.Account
+	if err := json.Unmarshal(response.Data, &account); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, models.ROLE_USER, account.Role)
 }
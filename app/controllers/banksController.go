@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"net/http"
+	"payments/app/banks"
+	"payments/infrastructure"
+	"payments/utils"
+	"strings"
+)
+
+// GetBanks handler to search the bank directory
+// Returns the banks whose bank id or BIC starts with the bank_id parameter, optionally limited to a bank_id_code
+var GetBanks = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	query := r.URL.Query()
+	bankID := strings.TrimSpace(query.Get("bank_id"))
+	if bankID == "" {
+		utils.CreateApiErrorResponse(w, utils.ERROR_BANK_ID_REQUIRED, http.StatusBadRequest)
+		return
+	}
+
+	found := banks.GetDirectory().Search(bankID, query.Get("bank_id_code"))
+
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: "/v1/banks?" + r.URL.RawQuery,
+	}}
+	utils.CreateApiResponse(w, found, http.StatusOK, links)
+}
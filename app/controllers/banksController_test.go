@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"payments/app/banks"
+	"payments/app/models"
+	"payments/utils"
+	"strings"
+	"testing"
+)
+
+func setBankDirectory(t *testing.T) {
+	directory := banks.NewDirectory()
+	require.Nil(t, directory.Load(strings.NewReader("sort_code,bank_id_code,bic,name,schemes\n403000,GBDSC,HBUKGB4B,HSBC UK Bank,FPS;BACS\n403001,GBDSC,,HSBC UK Bank Leeds,BACS\n")))
+	banks.SetDirectory(directory)
+}
+
+func TestGetBanks(t *testing.T) {
+
+	deleteDatabase()
+	setBankDirectory(t)
+	defer banks.SetDirectory(banks.NewDirectory())
+
+	rw := doRequestWithLogin(t, http.MethodGet, "/v1/banks?bank_id=4030&bank_id_code=GBDSC", nil, http.StatusOK)
+
+	var found []banks.Bank
+	require.Nil(t, json.Unmarshal(decodeApiResponse(t, rw).Data, &found))
+	assert.Len(t, found, 2)
+	assert.EqualValues(t, "HSBC UK Bank", found[0].Name)
+	assert.EqualValues(t, []string{"FPS", "BACS"}, found[0].Schemes)
+
+	rw = doRequestWithLogin(t, http.MethodGet, "/v1/banks", nil, http.StatusBadRequest)
+	assert.EqualValues(t, []string{utils.ERROR_BANK_ID_REQUIRED}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestCreatePaymentWithBankDirectory(t *testing.T) {
+
+	deleteDatabase()
+	setBankDirectory(t)
+	defer banks.SetDirectory(banks.NewDirectory())
+
+	// The bank name of the beneficiary is completed
+	paymentID := uuid.NewV4()
+	doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(paymentExample(paymentID)), http.StatusCreated)
+	payment, err := models.GetPaymentByID(paymentID)
+	require.Nil(t, err)
+	assert.EqualValues(t, "HSBC UK Bank", payment.Attributes.BeneficiaryParty.BankName)
+
+	// The beneficiary bank does not take Faster Payments
+	payment = models.Payment{}
+	require.Nil(t, json.Unmarshal(paymentExample(uuid.NewV4()), &payment))
+	payment.Attributes.BeneficiaryParty.BankID = "403001"
+	rw := doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(convertToJson(t, payment)), http.StatusBadRequest)
+	assert.EqualValues(t, []string{"beneficiary_party.bank_id: " + utils.ERROR_BANK_NOT_REACHABLE}, decodeApiResponse(t, rw).Errors)
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"payments/app/calendar"
+	"payments/infrastructure"
+	"payments/utils"
+	"time"
+)
+
+// BusinessDay is the response of the next business day of a scheme
+type BusinessDay struct {
+	Scheme          string `json:"scheme"`
+	Date            string `json:"date"`
+	BusinessDay     bool   `json:"business_day"`
+	NextBusinessDay string `json:"next_business_day"`
+	ProcessingDate  string `json:"processing_date"`
+	CutOff          string `json:"cut_off,omitempty"`
+	TimeZone        string `json:"time_zone"`
+}
+
+// GetNextBusinessDay handler to get the next business day of a payment scheme
+// Receives the scheme and an optional date (YYYY-MM-DD, default today in the time zone of the scheme) and returns the
+// first business day after the date and the earliest processing date of a payment requested now for the date
+var GetNextBusinessDay = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	scheme := mux.Vars(r)["scheme"]
+	schemeCalendar, ok := calendar.GetCalendars().Get(scheme)
+	if !ok {
+		utils.CreateApiErrorResponse(w, utils.ERROR_CALENDAR_NOT_FOUND, http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	date := schemeCalendar.Today(now)
+	if value := r.URL.Query().Get("date"); value != "" {
+		var err error
+		if date, err = time.Parse(calendar.DATE_FORMAT, value); err != nil {
+			utils.CreateApiErrorResponse(w, utils.ERROR_DATE_INVALID, http.StatusBadRequest)
+			return
+		}
+	}
+
+	businessDay := BusinessDay{
+		Scheme:          schemeCalendar.Scheme,
+		Date:            date.Format(calendar.DATE_FORMAT),
+		BusinessDay:     schemeCalendar.IsBusinessDay(date),
+		NextBusinessDay: schemeCalendar.NextBusinessDay(date).Format(calendar.DATE_FORMAT),
+		ProcessingDate:  schemeCalendar.ProcessingDate(date, now).Format(calendar.DATE_FORMAT),
+		CutOff:          schemeCalendar.CutOff,
+		TimeZone:        schemeCalendar.Location.String(),
+	}
+
+	// Create Api Response
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: fmt.Sprintf("/v1/calendars/%s/next-business-day", scheme),
+	}}
+	utils.CreateApiResponse(w, businessDay, http.StatusOK, links)
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"payments/app/calendar"
+	"payments/app/models"
+	"payments/utils"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetNextBusinessDay(t *testing.T) {
+
+	deleteDatabase()
+	calendars := calendar.NewCalendars()
+	bacs, _ := calendars.Get("BACS")
+	require.Nil(t, bacs.LoadHolidays(strings.NewReader("2026-12-25 Christmas Day\n2026-12-28 Boxing Day (substitute day)")))
+	calendar.SetCalendars(calendars)
+	defer calendar.SetCalendars(calendar.NewCalendars())
+
+	rw := doRequestWithLogin(t, http.MethodGet, "/v1/calendars/bacs/next-business-day?date=2026-12-24", nil, http.StatusOK)
+
+	var businessDay BusinessDay
+	require.Nil(t, json.Unmarshal(decodeApiResponse(t, rw).Data, &businessDay))
+	assert.EqualValues(t, "BACS", businessDay.Scheme)
+	assert.True(t, businessDay.BusinessDay)
+	assert.EqualValues(t, "2026-12-29", businessDay.NextBusinessDay)
+	assert.EqualValues(t, "22:30", businessDay.CutOff)
+	assert.EqualValues(t, "Europe/London", businessDay.TimeZone)
+
+	rw = doRequestWithLogin(t, http.MethodGet, "/v1/calendars/bacs/next-business-day?date=24/12/2026", nil, http.StatusBadRequest)
+	assert.EqualValues(t, []string{utils.ERROR_DATE_INVALID}, decodeApiResponse(t, rw).Errors)
+
+	rw = doRequestWithLogin(t, http.MethodGet, "/v1/calendars/internal/next-business-day", nil, http.StatusNotFound)
+	assert.EqualValues(t, []string{utils.ERROR_CALENDAR_NOT_FOUND}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestCreatePaymentOnHoliday(t *testing.T) {
+
+	deleteDatabase()
+
+	// Faster Payments are closed in two days, a future date in every time zone
+	closed := time.Now().UTC().AddDate(0, 0, 2).Format(calendar.DATE_FORMAT)
+	calendars := calendar.NewCalendars()
+	fps, _ := calendars.Get("FPS")
+	require.Nil(t, fps.LoadHolidays(strings.NewReader(closed+" Closed")))
+	calendar.SetCalendars(calendars)
+	defer calendar.SetCalendars(calendar.NewCalendars())
+
+	payment := models.Payment{}
+	require.Nil(t, json.Unmarshal(paymentExample(uuid.NewV4()), &payment))
+	payment.Attributes.ProcessingDate = closed
+	rw := doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(convertToJson(t, payment)), http.StatusCreated)
+
+	next, _ := time.Parse(calendar.DATE_FORMAT, closed)
+	expected := next.AddDate(0, 0, 1).Format(calendar.DATE_FORMAT)
+	assert.EqualValues(t, []string{"processing_date: " + utils.WARNING_PROCESSING_DATE_ROLLED + " (" + closed + " Closed, moved to " + expected + ")"}, decodeApiResponse(t, rw).Warnings)
+
+	created, err := models.GetPaymentByID(payment.ID)
+	require.Nil(t, err)
+	assert.EqualValues(t, expected, created.Attributes.ProcessingDate)
+}
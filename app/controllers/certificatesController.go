@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+	"strconv"
+)
+
+// CreateCertificate handler to register a client certificate subject for an account
+// Receives the subject of the certificate, requests with a verified certificate with that subject are authenticated as
+// the account. Only admins can access, so an user can not capture the identity of a bank partner by registering its
+// subject first. The registration is recorded as an audit event
+var CreateCertificate = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	admin, ok := requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	// Read the ID of the account from the mux vars
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_RESOURCE_NOT_FOUND, http.StatusNotFound)
+		return
+	}
+
+	account, err := models.GetAccountByID(uint(id))
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var request models.ClientCertificate
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	certificate := models.ClientCertificate{
+		AccountID: account.ID,
+		Subject:   request.Subject,
+	}
+
+	if err := certificate.IsValid(); err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := infrastructure.GetDB().Create(&certificate).Error; err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	models.RecordAuditEvent(models.AuditEvent{
+		Type:      models.AUDIT_CERTIFICATE_REGISTERED,
+		AccountID: &account.ID,
+		ActorID:   &admin.ID,
+		IP:        utils.ClientIP(r),
+		Details:   certificate.Subject,
+	})
+
+	// Create Api Response
+	links := []utils.Link{{
+		Rel:  "certificates",
+		Href: "/v1/user/certificates",
+	}}
+	utils.CreateApiResponse(w, certificate, http.StatusCreated, links)
+}
+
+// GetCertificates handler to get the client certificate subjects of the user
+var GetCertificates = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	user := r.Context().Value("user").(uint) //Grab the id of the user that send the request
+
+	certificates, err := models.GetClientCertificatesByAccount(user)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Create Api Response
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: "/v1/user/certificates",
+	}}
+	utils.CreateApiResponse(w, certificates, http.StatusOK, links)
+}
+
+// DeleteCertificate handler to delete a client certificate subject
+// Receives the certificate id. Certificates with the subject stop authenticating the user
+var DeleteCertificate = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	user := r.Context().Value("user").(uint) //Grab the id of the user that send the request
+
+	// Read the ID from the mux vars
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_RESOURCE_NOT_FOUND, http.StatusNotFound)
+		return
+	}
+
+	certificate, err := models.GetClientCertificateByID(uint(id), user)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Hard delete so the subject can be registered again
+	if err := infrastructure.GetDB().Unscoped().Delete(&certificate).Error; err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, nil, http.StatusNoContent, nil)
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"payments/app/models"
+	"payments/utils"
+	"testing"
+)
+
+func doRequestWithClientCertificate(t *testing.T, method string, url string, subject pkix.Name, expectedResultCode int) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, nil)
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: subject}}},
+	}
+
+	rw := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rw, req)
+	if rw.Code != expectedResultCode {
+		t.Fatalf("Status code was not %d: %d\n", expectedResultCode, rw.Code)
+	}
+
+	return rw
+}
+
+// registerCertificate registers the subject for the account of the email, as an admin
+func registerCertificate(t *testing.T, adminToken string, email string, subject string, expectedResultCode int) *httptest.ResponseRecorder {
+	account, err := models.GetAccountByEmail(email)
+	require.Nil(t, err)
+
+	body := []byte(fmt.Sprintf(`{"subject": "%s"}`, subject))
+	return doRequestWithAuthorization(t, http.MethodPost, fmt.Sprintf("/v1/admin/accounts/%d/certificates", account.ID), bytes.NewBuffer(body), "Bearer "+adminToken, expectedResultCode)
+}
+
+func TestRequestWithRegisteredClientCertificate(t *testing.T) {
+	deleteDatabase()
+
+	subject := pkix.Name{CommonName: "payments", Organization: []string{"Bank A"}, Country: []string{"GB"}}
+	createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	adminToken := createAndLogAdmin(t, "admin@email.com", "dummyPassword")
+
+	registerCertificate(t, adminToken, "dummy@email.com", "CN=payments,O=Bank A,C=GB", http.StatusCreated)
+
+	doRequestWithClientCertificate(t, http.MethodGet, "/v1/payments", subject, http.StatusOK)
+}
+
+func TestCreateCertificateWithoutAdmin(t *testing.T) {
+	deleteDatabase()
+
+	// An user can not register the subject of a bank partner for its own account
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	rw := registerCertificate(t, token, "dummy@email.com", "CN=payments,O=Bank A,C=GB", http.StatusForbidden)
+	assert.EqualValues(t, []string{utils.ERROR_FORBIDDEN}, decodeApiResponse(t, rw).Errors)
+
+	doRequestWithClientCertificate(t, http.MethodGet, "/v1/payments", pkix.Name{CommonName: "payments", Organization: []string{"Bank A"}, Country: []string{"GB"}}, http.StatusForbidden)
+}
+
+func TestRequestWithUnknownClientCertificate(t *testing.T) {
+	deleteDatabase()
+
+	rw := doRequestWithClientCertificate(t, http.MethodGet, "/v1/payments", pkix.Name{CommonName: "unknown"}, http.StatusForbidden)
+	response := decodeApiResponse(t, rw)
+
+	assert.EqualValues(t, []string{utils.ERROR_CERTIFICATE_UNKNOWN}, response.Errors)
+}
+
+func TestCreateCertificateWithSubjectInUse(t *testing.T) {
+	deleteDatabase()
+
+	createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	createAndLogUser(t, "other@email.com", "dummyPassword")
+	adminToken := createAndLogAdmin(t, "admin@email.com", "dummyPassword")
+
+	registerCertificate(t, adminToken, "dummy@email.com", "CN=payments,O=Bank A,C=GB", http.StatusCreated)
+	rw := registerCertificate(t, adminToken, "other@email.com", "CN=payments,O=Bank A,C=GB", http.StatusBadRequest)
+	response := decodeApiResponse(t, rw)
+
+	assert.EqualValues(t, []string{utils.ERROR_CERTIFICATE_SUBJECT_ALREADY_EXISTS}, response.Errors)
+}
+
+func TestCreateCertificateAfterAccountDeleted(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	createAndLogUser(t, "other@email.com", "dummyPassword")
+	adminToken := createAndLogAdmin(t, "admin@email.com", "dummyPassword")
+
+	registerCertificate(t, adminToken, "dummy@email.com", "CN=payments,O=Bank A,C=GB", http.StatusCreated)
+
+	jsonBytes := []byte(`{"current_password": "dummyPassword"}`)
+	doRequestWithAuthorization(t, http.MethodDelete, "/v1/user/me", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusNoContent)
+
+	// The subject of the deleted account can be registered again
+	registerCertificate(t, adminToken, "other@email.com", "CN=payments,O=Bank A,C=GB", http.StatusCreated)
+}
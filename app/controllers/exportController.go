@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"net/http"
+	"payments/app/bacs"
+	"payments/app/export"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+	"time"
+)
+
+// ExportPayments handler to export the payments of an organisation (organisation_id parameter) as one document
+// The payments can be limited to a processing date (processing_date parameter)
+// Formats: pacs008 (default) for the pacs.008 message and bacs18 for the Bacs Standard 18 submission of the Bacs payments
+var ExportPayments = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = export.FORMAT_PACS008
+	}
+	if format != export.FORMAT_PACS008 && format != export.FORMAT_BACS18 {
+		utils.CreateApiErrorResponse(w, utils.ERROR_EXPORT_FORMAT_INVALID, http.StatusBadRequest)
+		return
+	}
+
+	processingDate := query.Get("processing_date")
+	if _, err := time.Parse("2006-01-02", processingDate); processingDate != "" && err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_PROCESSING_DATE_INVALID, http.StatusBadRequest)
+		return
+	}
+
+	organisationID, err := utils.ConvertStringToUUID(query.Get("organisation_id"))
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_ORGANISATION_NOT_FOUND, http.StatusBadRequest)
+		return
+	}
+
+	// The organisation must exist and the user must be a member
+	if !checkPaymentOrganisation(w, r, models.Payment{OrganisationID: organisationID}) {
+		return
+	}
+
+	payments, err := models.GetPayments(organisationID, processingDate)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	document, contentType, err := export.Export(format, payments, time.Now())
+	if err != nil {
+		if err == export.ErrNoPayments {
+			utils.CreateApiResponse(w, nil, http.StatusNoContent, nil)
+		} else if validationError, ok := err.(*bacs.ValidationError); ok {
+			utils.CreateApiErrorsResponse(w, validationError.Errors, http.StatusBadRequest)
+		} else {
+			infrastructure.LogError(http.StatusInternalServerError, err.Error())
+			utils.CreateApiErrorResponse(w, utils.ERROR_SERVER, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	utils.CreateDocumentResponse(w, contentType, document, http.StatusOK)
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"payments/app/models"
+	"payments/utils"
+	"strings"
+	"testing"
+)
+
+func TestGetPaymentAsPacs008(t *testing.T) {
+	deleteDatabase()
+
+	paymentID := uuid.NewV4()
+	doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(paymentExample(paymentID)), http.StatusCreated)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/payments/"+paymentID.String(), nil)
+	req.Header.Set("Accept", "application/xml")
+	req.Header.Set("Authorization", "Bearer "+createAndLogUser(t, "dummy@email.com", "dummyPassword"))
+	rw := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.EqualValues(t, "application/xml", rw.Header().Get("Content-Type"))
+	assert.Contains(t, rw.Body.String(), "<TxId>"+strings.Replace(paymentID.String(), "-", "", -1)+"</TxId>")
+	assert.Contains(t, rw.Body.String(), `<IntrBkSttlmAmt Ccy="GBP">100.21</IntrBkSttlmAmt>`)
+}
+
+func TestExportPayments(t *testing.T) {
+	deleteDatabase()
+
+	doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(paymentExample(uuid.NewV4())), http.StatusCreated)
+	doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(paymentExample(uuid.NewV4())), http.StatusCreated)
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	rw := doRequestWithAuthorization(t, http.MethodGet, "/v1/payments/export?format=pacs008&organisation_id="+exampleOrganisationID.String(), nil, "Bearer "+token, http.StatusOK)
+
+	assert.EqualValues(t, "application/xml", rw.Header().Get("Content-Type"))
+	assert.Contains(t, rw.Body.String(), "<NbOfTxs>2</NbOfTxs>")
+	assert.Contains(t, rw.Body.String(), "<CtrlSum>200.42</CtrlSum>")
+	assert.Contains(t, rw.Body.String(), `<TtlIntrBkSttlmAmt Ccy="GBP">200.42</TtlIntrBkSttlmAmt>`)
+
+	// No payment processed on the date
+	doRequestWithAuthorization(t, http.MethodGet, "/v1/payments/export?processing_date=2020-01-01&organisation_id="+exampleOrganisationID.String(), nil, "Bearer "+token, http.StatusNoContent)
+}
+
+func TestExportPaymentsWithInvalidFormat(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	rw := doRequestWithAuthorization(t, http.MethodGet, "/v1/payments/export?format=mt103&organisation_id="+exampleOrganisationID.String(), nil, "Bearer "+token, http.StatusBadRequest)
+
+	assert.EqualValues(t, []string{utils.ERROR_EXPORT_FORMAT_INVALID}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestExportPaymentsAsBacs18(t *testing.T) {
+	deleteDatabase()
+	os.Setenv("BACS_SERVICE_USER_NUMBER", "123456")
+	os.Setenv("BACS_SERVICE_USER_NAME", "Bank A Payroll")
+	defer os.Unsetenv("BACS_SERVICE_USER_NUMBER")
+	defer os.Unsetenv("BACS_SERVICE_USER_NAME")
+
+	var payment models.Payment
+	if err := json.Unmarshal(paymentExample(uuid.NewV4()), &payment); err != nil {
+		t.Fatal(err)
+	}
+	payment.Attributes.PaymentScheme = "Bacs"
+	payment.Attributes.SchemePaymentType = "DirectCredit"
+	payment.Attributes.SchemePaymentSubType = ""
+	doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(convertToJson(t, payment)), http.StatusCreated)
+
+	// Only the Bacs payments are submitted
+	doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(paymentExample(uuid.NewV4())), http.StatusCreated)
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	rw := doRequestWithAuthorization(t, http.MethodGet, "/v1/payments/export?format=bacs18&organisation_id="+exampleOrganisationID.String(), nil, "Bearer "+token, http.StatusOK)
+
+	assert.EqualValues(t, "text/plain", rw.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(rw.Body.String()), "\n")
+	assert.Len(t, lines, 9)
+	assert.True(t, strings.HasPrefix(lines[4], "4030003192681909912312356781234    00000010021"))
+	assert.True(t, strings.HasPrefix(lines[8], "UTL1"+"0000000010021"+"0000000010021"+"0000001"+"0000001"))
+}
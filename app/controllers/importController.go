@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"payments/app/iso20022"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+)
+
+// Maximum size of an imported message
+const IMPORT_MAX_BYTES = 10 << 20
+
+// ImportPayments handler to import a pain.001 customer credit transfer initiation
+// Creates a payment of the organisation (organisation_id parameter) for each valid transaction and returns the result of each one
+// With dry_run=true the message is only validated
+var ImportPayments = func(w http.ResponseWriter, r *http.Request) {
+
+	// Limit the body before the log reads it
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, IMPORT_MAX_BYTES))
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_REQUEST_TOO_LARGE, http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	infrastructure.LogApiRequest(r)
+
+	organisationID, err := utils.ConvertStringToUUID(r.URL.Query().Get("organisation_id"))
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_ORGANISATION_NOT_FOUND, http.StatusBadRequest)
+		return
+	}
+
+	// The organisation must exist and the user must be a member
+	if !checkPaymentOrganisation(w, r, models.Payment{OrganisationID: organisationID}) {
+		return
+	}
+
+	// The payments record the key that signed the request
+	signatureKey, _ := r.Context().Value("signature_key").(string)
+
+	result, err := iso20022.ImportPain001(bytes.NewReader(body), organisationID, signatureKey, r.URL.Query().Get("dry_run") == "true")
+	if err != nil {
+		if validationError, ok := err.(*iso20022.ValidationError); ok {
+			utils.CreateApiErrorsResponse(w, validationError.Errors, http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, utils.ERROR_SERVER, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, result, http.StatusOK, nil)
+}
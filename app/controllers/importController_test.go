@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"payments/app/iso20022"
+	"payments/app/models"
+	"payments/utils"
+	"strings"
+	"testing"
+)
+
+func importPain001(t *testing.T, token string, file string, query string, expectedResultCode int) iso20022.ImportResult {
+	body, err := ioutil.ReadFile("../iso20022/testdata/" + file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/payments/import?organisation_id="+exampleOrganisationID.String()+query, bytes.NewBuffer(body), "Bearer "+token, expectedResultCode)
+
+	var result iso20022.ImportResult
+	if expectedResultCode == http.StatusOK {
+		if err := json.Unmarshal(decodeApiResponse(t, rw).Data, &result); err != nil {
+			t.Fatalf("Failed to decode response to import result: %s", err)
+		}
+	}
+	return result
+}
+
+func TestImportPayments(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	result := importPain001(t, token, "pain.001.001.03.xml", "", http.StatusOK)
+
+	assert.EqualValues(t, "MSG-20170118-001", result.MessageID)
+	assert.EqualValues(t, 2, result.Created)
+	assert.Len(t, result.Transactions, 2)
+	assert.EqualValues(t, iso20022.TRANSACTION_CREATED, result.Transactions[0].Status)
+
+	payment, err := models.GetPaymentByID(*result.Transactions[0].PaymentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.EqualValues(t, "100.21", payment.Attributes.Amount)
+	assert.EqualValues(t, "31926819", payment.Attributes.BeneficiaryParty.AccountNumber)
+
+	// Importing the message again does not duplicate the payments
+	result = importPain001(t, token, "pain.001.001.03.xml", "", http.StatusOK)
+	assert.EqualValues(t, 0, result.Created)
+	assert.EqualValues(t, 2, result.Duplicates)
+}
+
+func TestImportPaymentsDryRun(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	result := importPain001(t, token, "pain.001.001.09.xml", "&dry_run=true", http.StatusOK)
+
+	assert.EqualValues(t, iso20022.TRANSACTION_VALID, result.Transactions[0].Status)
+
+	_, err := models.GetPaymentByID(*result.Transactions[0].PaymentID)
+	assert.EqualValues(t, utils.ERROR_RESOURCE_NOT_FOUND, err.Error())
+}
+
+func TestImportPaymentsWithRejectedTransaction(t *testing.T) {
+	deleteDatabase()
+
+	body, _ := ioutil.ReadFile("../iso20022/testdata/pain.001.001.03.xml")
+	body = []byte(strings.Replace(string(body), "<IBAN>GB82WEST12345698765432</IBAN>", "<IBAN>GB82 WEST</IBAN>", 1))
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/payments/import?organisation_id="+exampleOrganisationID.String(), bytes.NewBuffer(body), "Bearer "+token, http.StatusOK)
+
+	var result iso20022.ImportResult
+	if err := json.Unmarshal(decodeApiResponse(t, rw).Data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.EqualValues(t, 1, result.Created)
+	assert.EqualValues(t, 1, result.Rejected)
+	assert.EqualValues(t, iso20022.TRANSACTION_REJECTED, result.Transactions[1].Status)
+	assert.EqualValues(t, []string{"CdtrAcct/Id/IBAN is not a valid IBAN"}, result.Transactions[1].Errors)
+}
+
+func TestImportInvalidMessage(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/payments/import?organisation_id="+exampleOrganisationID.String(), bytes.NewBuffer([]byte(`{"type": "Payment"}`)), "Bearer "+token, http.StatusBadRequest)
+
+	assert.Len(t, decodeApiResponse(t, rw).Errors, 1)
+}
+
+func TestImportPaymentsForOrganisationOfOtherUser(t *testing.T) {
+	deleteDatabase()
+
+	organisation := createOrganisation(t, createAndLogUser(t, "dummy@email.com", "dummyPassword"), "Bank A")
+	token := createAndLogUser(t, "other@email.com", "dummyPassword")
+
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/payments/import?organisation_id="+organisation.ID.String(), nil, "Bearer "+token, http.StatusForbidden)
+	assert.EqualValues(t, []string{utils.ERROR_ORGANISATION_FORBIDDEN}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestSignedImportRecordsSigner(t *testing.T) {
+	deleteDatabase()
+
+	body, err := ioutil.ReadFile("../iso20022/testdata/pain.001.001.03.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	key := createSigningKey(t, token)
+	rw := doSignedRequest(t, http.MethodPost, "/v1/payments/import?organisation_id="+exampleOrganisationID.String(), body, token, key, "nonce-1", http.StatusOK)
+
+	var result iso20022.ImportResult
+	if err := json.Unmarshal(decodeApiResponse(t, rw).Data, &result); err != nil {
+		t.Fatal(err)
+	}
+	for _, transaction := range result.Transactions {
+		payment, err := models.GetPaymentByID(*transaction.PaymentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, key.KeyID, payment.SignatureKeyID)
+	}
+}
@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"payments/infrastructure"
+)
+
+// JWKS handler to publish the public keys used to sign tokens
+// Downstream services use this document to verify the tokens issued by this service
+var JWKS = func(w http.ResponseWriter, r *http.Request) {
+
+	response, err := json.Marshal(infrastructure.GetKeyRing().JWKS())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
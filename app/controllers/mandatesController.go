@@ -0,0 +1,324 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"payments/app/mandates"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+	"time"
+)
+
+// CreateMandate handler to set up a direct debit mandate
+// Receives the creditor, the debtor, the reference and the scheme, the mandate is active once set up
+var CreateMandate = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	var mandate models.Mandate
+	if err := json.NewDecoder(r.Body).Decode(&mandate); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	if !validateMandate(w, r, &mandate) {
+		return
+	}
+
+	if uuid.Equal(mandate.ID, uuid.Nil) {
+		mandate.ID = uuid.NewV4()
+	} else if _, err := models.GetMandateByID(mandate.ID); err == nil || err.Error() != utils.ERROR_RESOURCE_NOT_FOUND {
+		utils.CreateApiErrorResponse(w, utils.ERROR_MANDATE_ALREADY_EXISTS, http.StatusBadRequest)
+		return
+	}
+
+	mandate.Status = models.MANDATE_ACTIVE
+	mandate.Collections, mandate.LastCollectionDate, mandate.CancelledAt = 0, "", nil
+	mandate.SignatureKeyID, _ = r.Context().Value("signature_key").(string)
+
+	if infrastructure.GetDB().Create(&mandate).Error != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	utils.CreateApiResponse(w, mandate, http.StatusCreated, mandateLinks(mandate))
+}
+
+// GetMandates handler to get the mandates of an organisation (organisation_id parameter)
+var GetMandates = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	organisationID, err := utils.ConvertStringToUUID(r.URL.Query().Get("organisation_id"))
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_ORGANISATION_NOT_FOUND, http.StatusBadRequest)
+		return
+	}
+
+	// The organisation must exist and the user must be a member
+	if !checkPaymentOrganisation(w, r, models.Payment{OrganisationID: organisationID}) {
+		return
+	}
+
+	list, err := models.GetMandates(organisationID)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: "/v1/mandates?organisation_id=" + organisationID.String(),
+	}}
+	now := time.Now()
+	for i := range list {
+		list[i].Refresh(now)
+		links = append(links, utils.Link{
+			Rel:  list[i].ID.String(),
+			Href: fmt.Sprintf("/v1/mandates/%s", list[i].ID.String()),
+		})
+	}
+	utils.CreateApiResponse(w, list, http.StatusOK, links)
+}
+
+// GetMandate handler to get a single mandate
+var GetMandate = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	mandate, ok := getMandate(w, r)
+	if !ok {
+		return
+	}
+
+	utils.CreateApiResponse(w, mandate, http.StatusOK, mandateLinks(mandate))
+}
+
+// UpdateMandate handler to amend the reference, the creditor and the debtor of an active mandate
+// The payments already collected are not changed
+var UpdateMandate = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	mandate, ok := getMandate(w, r)
+	if !ok {
+		return
+	}
+
+	var amended models.Mandate
+	if err := json.NewDecoder(r.Body).Decode(&amended); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+	if !uuid.Equal(amended.ID, uuid.Nil) && !uuid.Equal(amended.ID, mandate.ID) {
+		utils.CreateApiErrorResponse(w, utils.ERROR_ID_MISMATCH, http.StatusBadRequest)
+		return
+	}
+
+	// The mandate stays in its organisation and scheme
+	amended.ID, amended.OrganisationID, amended.Scheme = mandate.ID, mandate.OrganisationID, mandate.Scheme
+	if !validateMandate(w, r, &amended) {
+		return
+	}
+
+	signatureKey, _ := r.Context().Value("signature_key").(string)
+	changeMandate(w, mandate.ID, func(mandate *models.Mandate) error {
+		mandate.Refresh(time.Now())
+		if mandate.Status != models.MANDATE_ACTIVE {
+			return errors.New(utils.ERROR_MANDATE_STATUS)
+		}
+		mandate.Reference, mandate.CreditorID = amended.Reference, amended.CreditorID
+		mandate.Creditor, mandate.Debtor = amended.Creditor, amended.Debtor
+		if signatureKey != "" {
+			mandate.SignatureKeyID = signatureKey
+		}
+		return nil
+	})
+}
+
+// CancelMandate handler to cancel an active or dormant mandate, it can not be collected anymore
+var CancelMandate = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	mandate, ok := getMandate(w, r)
+	if !ok {
+		return
+	}
+
+	changeMandate(w, mandate.ID, func(mandate *models.Mandate) error {
+		if mandate.Status == models.MANDATE_CANCELLED {
+			return errors.New(utils.ERROR_MANDATE_STATUS)
+		}
+		now := time.Now()
+		mandate.Status, mandate.CancelledAt = models.MANDATE_CANCELLED, &now
+		return nil
+	})
+}
+
+// CreateCollection handler to collect a payment from the debtor of an active mandate
+// The payment is a pending direct debit of the scheme of the mandate, with the mandate_id of the mandate
+var CreateCollection = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	mandate, ok := getMandate(w, r)
+	if !ok {
+		return
+	}
+
+	var collection mandates.Collection
+	if err := json.NewDecoder(r.Body).Decode(&collection); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	// Verify if the requested payment already exists in DB
+	if !uuid.Equal(collection.ID, uuid.Nil) {
+		if _, err := models.GetPaymentByID(collection.ID); err == nil || err.Error() != utils.ERROR_RESOURCE_NOT_FOUND {
+			utils.CreateApiErrorResponse(w, utils.ERROR_PAYMENT_ALREADY_EXISTS, http.StatusBadRequest)
+			return
+		}
+	}
+
+	signatureKey, _ := r.Context().Value("signature_key").(string)
+	var warnings []string
+	payment, err := models.CollectMandate(mandate.ID, func(mandate *models.Mandate) (models.Payment, error) {
+		payment, paymentWarnings, err := mandates.Collect(mandate, collection, time.Now())
+		warnings = paymentWarnings
+		payment.SignatureKeyID = signatureKey
+		return payment, err
+	})
+	if err != nil {
+		if validationError, ok := err.(*mandates.ValidationError); ok {
+			utils.CreateApiErrorsResponse(w, validationError.Errors, http.StatusBadRequest)
+			return
+		}
+		switch err.Error() {
+		case utils.ERROR_MANDATE_NOT_ACTIVE:
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusConflict)
+		case utils.ERROR_RESOURCE_NOT_FOUND:
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		default:
+			utils.CreateApiErrorResponse(w, utils.ERROR_SERVER, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: fmt.Sprintf("/v1/payments/%s", payment.ID.String()),
+	}, {
+		Rel:  "mandate",
+		Href: fmt.Sprintf("/v1/mandates/%s", mandate.ID.String()),
+	}}
+	utils.CreateApiResponseWithWarnings(w, payment, http.StatusCreated, links, warnings)
+}
+
+// GetCollections handler to get the payments collected with a mandate
+var GetCollections = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	mandate, ok := getMandate(w, r)
+	if !ok {
+		return
+	}
+
+	payments, err := models.GetCollections(mandate.ID)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: fmt.Sprintf("/v1/mandates/%s/collections", mandate.ID.String()),
+	}}
+	for _, payment := range payments {
+		links = append(links, utils.Link{
+			Rel:  payment.ID.String(),
+			Href: fmt.Sprintf("/v1/payments/%s", payment.ID.String()),
+		})
+	}
+	utils.CreateApiResponse(w, payments, http.StatusOK, links)
+}
+
+// getMandate reads the mandate of the id of the url, the user must be a member of its organisation
+// An active mandate not collected for too long is returned as dormant
+func getMandate(w http.ResponseWriter, r *http.Request) (models.Mandate, bool) {
+	id, err := utils.ConvertStringToUUID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_REQUESTED_UUID_INVALID, http.StatusBadRequest)
+		return models.Mandate{}, false
+	}
+
+	mandate, err := models.GetMandateByID(id)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return mandate, false
+	}
+	mandate.Refresh(time.Now())
+
+	return mandate, checkPaymentOrganisation(w, r, models.Payment{OrganisationID: mandate.OrganisationID})
+}
+
+// changeMandate applies the change to the locked mandate and writes the response
+func changeMandate(w http.ResponseWriter, id uuid.UUID, change func(mandate *models.Mandate) error) {
+	mandate, err := models.UpdateMandate(id, change)
+	if err != nil {
+		switch err.Error() {
+		case utils.ERROR_MANDATE_STATUS:
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusConflict)
+		case utils.ERROR_RESOURCE_NOT_FOUND:
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		default:
+			utils.CreateApiErrorResponse(w, utils.ERROR_SERVER, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	utils.CreateApiResponse(w, mandate, http.StatusOK, mandateLinks(mandate))
+}
+
+// validateMandate checks the organisation and the mandate, its reference must be unique in the organisation
+func validateMandate(w http.ResponseWriter, r *http.Request, mandate *models.Mandate) bool {
+	// The organisation must exist and the user must be a member
+	if !checkPaymentOrganisation(w, r, models.Payment{OrganisationID: mandate.OrganisationID}) {
+		return false
+	}
+
+	mandates.Normalize(mandate)
+	if errs := mandates.Validate(*mandate); len(errs) > 0 {
+		utils.CreateApiErrorsResponse(w, errs, http.StatusBadRequest)
+		return false
+	}
+
+	if existing, err := models.GetMandateByReference(mandate.OrganisationID, mandate.Reference); err == nil && !uuid.Equal(existing.ID, mandate.ID) {
+		utils.CreateApiErrorResponse(w, utils.ERROR_MANDATE_REFERENCE_EXISTS, http.StatusBadRequest)
+		return false
+	} else if err != nil && err.Error() != utils.ERROR_RESOURCE_NOT_FOUND {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func mandateLinks(mandate models.Mandate) []utils.Link {
+	return []utils.Link{{
+		Rel:  "self",
+		Href: fmt.Sprintf("/v1/mandates/%s", mandate.ID.String()),
+	}, {
+		Rel:  "collections",
+		Href: fmt.Sprintf("/v1/mandates/%s/collections", mandate.ID.String()),
+	}}
+}
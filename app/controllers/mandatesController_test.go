@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+	"testing"
+	"time"
+)
+
+func mandateExample(reference string) []byte {
+	return []byte(`
+	{
+		"organisation_id": "` + exampleOrganisationID.String() + `",
+		"reference": "` + reference + `",
+		"scheme": "BACS",
+		"creditor_id": "123456",
+		"creditor": {"name": "Gym Ltd", "account_name": "Gym Ltd", "account_number": "56781234", "bank_id": "123123", "bank_id_code": "GBDSC"},
+		"debtor": {"name": "Jane Smith", "account_name": "J Smith", "account_number": "55779911", "bank_id": "200000", "bank_id_code": "GBDSC"}
+	}`)
+}
+
+func decodeMandate(t *testing.T, response utils.Response) models.Mandate {
+	mandate := models.Mandate{}
+	require.Nil(t, json.Unmarshal(response.Data, &mandate))
+	return mandate
+}
+
+func TestMandate(t *testing.T) {
+
+	deleteDatabase()
+
+	rw := doRequestWithLogin(t, http.MethodPost, "/v1/mandates", bytes.NewBuffer(mandateExample("ddi-000123")), http.StatusCreated)
+	mandate := decodeMandate(t, decodeApiResponse(t, rw))
+	assert.EqualValues(t, models.MANDATE_ACTIVE, mandate.Status)
+	assert.EqualValues(t, "DDI-000123", mandate.Reference)
+
+	// The reference is unique in the organisation
+	rw = doRequestWithLogin(t, http.MethodPost, "/v1/mandates", bytes.NewBuffer(mandateExample("DDI-000123")), http.StatusBadRequest)
+	assert.EqualValues(t, []string{utils.ERROR_MANDATE_REFERENCE_EXISTS}, decodeApiResponse(t, rw).Errors)
+
+	// Collect a payment
+	collection := fmt.Sprintf(`{"amount": "25.50", "processing_date": "%s"}`, time.Now().UTC().AddDate(0, 0, 30).Format("2006-01-02"))
+	rw = doRequestWithLogin(t, http.MethodPost, fmt.Sprintf("/v1/mandates/%s/collections", mandate.ID), bytes.NewBufferString(collection), http.StatusCreated)
+	payment := models.Payment{}
+	require.Nil(t, json.Unmarshal(decodeApiResponse(t, rw).Data, &payment))
+	assert.EqualValues(t, mandate.ID, *payment.MandateID)
+	assert.EqualValues(t, models.PAYMENT_STATUS_PENDING, payment.Status)
+	assert.EqualValues(t, "Debit", payment.Attributes.PaymentType)
+
+	rw = doRequestWithLogin(t, http.MethodGet, fmt.Sprintf("/v1/mandates/%s/collections", mandate.ID), nil, http.StatusOK)
+	payments := []models.Payment{}
+	require.Nil(t, json.Unmarshal(decodeApiResponse(t, rw).Data, &payments))
+	require.Len(t, payments, 1)
+	assert.EqualValues(t, "25.50", payments[0].Attributes.Amount)
+
+	rw = doRequestWithLogin(t, http.MethodGet, fmt.Sprintf("/v1/mandates/%s", mandate.ID), nil, http.StatusOK)
+	assert.EqualValues(t, 1, decodeMandate(t, decodeApiResponse(t, rw)).Collections)
+
+	// Amend the debtor account
+	amended := bytes.Replace(mandateExample("DDI-000123"), []byte("55779911"), []byte("11223344"), 1)
+	rw = doRequestWithLogin(t, http.MethodPut, fmt.Sprintf("/v1/mandates/%s", mandate.ID), bytes.NewBuffer(amended), http.StatusOK)
+	assert.EqualValues(t, "11223344", decodeMandate(t, decodeApiResponse(t, rw)).Debtor.AccountNumber)
+
+	// Cancelled mandates can not be collected or amended
+	rw = doRequestWithLogin(t, http.MethodPost, fmt.Sprintf("/v1/mandates/%s/cancel", mandate.ID), nil, http.StatusOK)
+	assert.EqualValues(t, models.MANDATE_CANCELLED, decodeMandate(t, decodeApiResponse(t, rw)).Status)
+
+	rw = doRequestWithLogin(t, http.MethodPost, fmt.Sprintf("/v1/mandates/%s/collections", mandate.ID), bytes.NewBufferString(collection), http.StatusConflict)
+	assert.EqualValues(t, []string{utils.ERROR_MANDATE_NOT_ACTIVE}, decodeApiResponse(t, rw).Errors)
+
+	doRequestWithLogin(t, http.MethodPut, fmt.Sprintf("/v1/mandates/%s", mandate.ID), bytes.NewBuffer(amended), http.StatusConflict)
+	doRequestWithLogin(t, http.MethodPost, fmt.Sprintf("/v1/mandates/%s/cancel", mandate.ID), nil, http.StatusConflict)
+}
+
+func TestCollectDormantMandate(t *testing.T) {
+
+	deleteDatabase()
+
+	rw := doRequestWithLogin(t, http.MethodPost, "/v1/mandates", bytes.NewBuffer(mandateExample("DDI-000124")), http.StatusCreated)
+	mandate := decodeMandate(t, decodeApiResponse(t, rw))
+
+	// Not collected since its set up, 14 months ago
+	require.Nil(t, infrastructure.GetDB().Model(&models.Mandate{}).Where("id = ?", mandate.ID).UpdateColumn("created_at", time.Now().AddDate(0, -14, 0)).Error)
+
+	rw = doRequestWithLogin(t, http.MethodGet, fmt.Sprintf("/v1/mandates/%s", mandate.ID), nil, http.StatusOK)
+	assert.EqualValues(t, models.MANDATE_DORMANT, decodeMandate(t, decodeApiResponse(t, rw)).Status)
+
+	rw = doRequestWithLogin(t, http.MethodPost, fmt.Sprintf("/v1/mandates/%s/collections", mandate.ID), bytes.NewBufferString(`{"amount": "25.50"}`), http.StatusConflict)
+	assert.EqualValues(t, []string{utils.ERROR_MANDATE_NOT_ACTIVE}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestCreateInvalidMandate(t *testing.T) {
+
+	deleteDatabase()
+
+	body := bytes.Replace(mandateExample("DDI-000125"), []byte(`"123456"`), []byte(`"12"`), 1)
+	rw := doRequestWithLogin(t, http.MethodPost, "/v1/mandates", bytes.NewBuffer(body), http.StatusBadRequest)
+	assert.EqualValues(t, []string{"creditor_id: " + utils.ERROR_SERVICE_USER_NUMBER_INVALID}, decodeApiResponse(t, rw).Errors)
+
+	doRequestWithLogin(t, http.MethodPost, fmt.Sprintf("/v1/mandates/%s/collections", uuid.NewV4()), bytes.NewBufferString(`{"amount": "1"}`), http.StatusNotFound)
+}
+
+func TestSignedCollection(t *testing.T) {
+
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	key := createSigningKey(t, token)
+
+	// The signatures are required by default
+	os.Unsetenv("REQUEST_SIGNING_REQUIRED")
+	defer os.Setenv("REQUEST_SIGNING_REQUIRED", "false")
+
+	doRequestWithAuthorization(t, http.MethodPost, "/v1/mandates", bytes.NewBuffer(mandateExample("DDI-000123")), "Bearer "+token, http.StatusUnauthorized)
+	rw := doSignedRequest(t, http.MethodPost, "/v1/mandates", mandateExample("DDI-000123"), token, key, "nonce-1", http.StatusCreated)
+	mandate := decodeMandate(t, decodeApiResponse(t, rw))
+	assert.EqualValues(t, key.KeyID, mandate.SignatureKeyID)
+
+	url := fmt.Sprintf("/v1/mandates/%s/collections", mandate.ID)
+	collection := []byte(fmt.Sprintf(`{"amount": "25.50", "processing_date": "%s"}`, time.Now().UTC().AddDate(0, 0, 30).Format("2006-01-02")))
+	rw = doRequestWithAuthorization(t, http.MethodPost, url, bytes.NewBuffer(collection), "Bearer "+token, http.StatusUnauthorized)
+	assert.EqualValues(t, []string{utils.ERROR_SIGNATURE_REQUIRED}, decodeApiResponse(t, rw).Errors)
+
+	// The collected payment records the key that signed the collection
+	rw = doSignedRequest(t, http.MethodPost, url, collection, token, key, "nonce-2", http.StatusCreated)
+	payment := models.Payment{}
+	require.Nil(t, json.Unmarshal(decodeApiResponse(t, rw).Data, &payment))
+	stored, err := models.GetPaymentByID(payment.ID)
+	require.Nil(t, err)
+	assert.EqualValues(t, key.KeyID, stored.SignatureKeyID)
+}
@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+)
+
+// EnrolTOTP handler to start the TOTP enrolment of the user
+// Returns the secret and the otpauth URI to add in the authenticator app
+var EnrolTOTP = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	account, ok := getCaller(w, r)
+	if !ok {
+		return
+	}
+
+	enrolment, err := account.StartTOTPEnrolment()
+	if err != nil {
+		if err.Error() == utils.ERROR_TOTP_ALREADY_ENABLED {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, utils.ERROR_SERVER, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, enrolment, http.StatusCreated, nil)
+}
+
+// ConfirmTOTP handler to confirm the TOTP enrolment with a code from the authenticator app
+// Enables two-factor authentication and returns the recovery codes. The recovery codes are only returned here
+var ConfirmTOTP = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	account, ok := getCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var request models.MFARequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	var codes []string
+	if !checkTOTPCode(w, r, account, func() (err error) {
+		codes, err = account.ConfirmTOTPEnrolment(request.Code)
+		return err
+	}) {
+		return
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, map[string][]string{"recovery_codes": codes}, http.StatusOK, nil)
+}
+
+// DisableTOTP handler to disable two-factor authentication
+// Receives a valid TOTP code
+var DisableTOTP = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	account, ok := getCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var request models.MFARequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	if !account.TOTPEnabled {
+		utils.CreateApiErrorResponse(w, utils.ERROR_TOTP_NOT_ENABLED, http.StatusBadRequest)
+		return
+	}
+
+	if !checkTOTPCode(w, r, account, func() error { return account.CheckTOTP(request.Code) }) {
+		return
+	}
+
+	if err := account.DisableTOTP(); err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, nil, http.StatusNoContent, nil)
+}
+
+// AuthenticateMFA handler for the second step of the login
+// Receives the challenge token returned by the login and a TOTP or recovery code and returns the token
+var AuthenticateMFA = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	var request models.MFARequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	tk, err := models.ParseChallengeToken(request.ChallengeToken)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_TOKEN_INVALID, http.StatusUnauthorized)
+		return
+	}
+
+	account, err := models.GetAccountByID(tk.UserId)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, utils.ERROR_TOKEN_INVALID, http.StatusUnauthorized)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The account could be disabled after the password
+	if account.Disabled {
+		utils.CreateApiErrorResponse(w, utils.ERROR_ACCOUNT_DISABLED, http.StatusForbidden)
+		return
+	}
+
+	ip := utils.ClientIP(r)
+	emailKey := models.EmailThrottleKey(account.Email)
+	ipKey := models.IPThrottleKey(ip)
+
+	// Codes are throttled as passwords
+	if loginThrottled(w, emailKey, ipKey) {
+		return
+	}
+
+	if request.RecoveryCode != "" {
+		err = account.UseRecoveryCode(request.RecoveryCode)
+	} else {
+		err = account.CheckTOTP(request.Code)
+	}
+	if err != nil {
+		if err.Error() == utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			loginFailed(w, &account.ID, emailKey, ipKey, ip, utils.ERROR_TOTP_INVALID)
+		}
+		return
+	}
+
+	if err := models.ClearLoginThrottle(emailKey); err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	//Worked! Logged In
+	account.Password = ""
+
+	// Create JWT token
+	if err := account.CreateToken(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, account, http.StatusOK, nil)
+}
+
+// checkTOTPCode runs the check of the TOTP code confirming a change, writing the error response if it fails
+// Wrong codes are throttled as failed logins, so a stolen token can not be used to guess the code
+func checkTOTPCode(w http.ResponseWriter, r *http.Request, account models.Account, check func() error) bool {
+	ip := utils.ClientIP(r)
+	emailKey := models.EmailThrottleKey(account.Email)
+	ipKey := models.IPThrottleKey(ip)
+
+	if loginThrottled(w, emailKey, ipKey) {
+		return false
+	}
+
+	if err := check(); err != nil {
+		switch err.Error() {
+		case utils.ERROR_SERVER:
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		case utils.ERROR_TOTP_INVALID:
+			loginFailed(w, &account.ID, emailKey, ipKey, ip, utils.ERROR_TOTP_INVALID)
+		default:
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		}
+		return false
+	}
+
+	return true
+}
+
+// getCaller returns the account of the user that send the request
+func getCaller(w http.ResponseWriter, r *http.Request) (models.Account, bool) {
+	user := r.Context().Value("user").(uint) //Grab the id of the user that send the request
+
+	account, err := models.GetAccountByID(user)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return account, false
+	}
+
+	return account, true
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"payments/app/models"
+	"payments/utils"
+	"testing"
+	"time"
+)
+
+// enableTOTP enrols and confirms TOTP for the user, returning the secret and the recovery codes
+func enableTOTP(t *testing.T, token string) (string, []string) {
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/user/mfa/totp", nil, "Bearer "+token, http.StatusCreated)
+	var enrolment models.TOTPEnrolment
+	if err := json.Unmarshal(decodeApiResponse(t, rw).Data, &enrolment); err != nil {
+		t.Fatalf("Failed to decode response to enrolment: %s", err)
+	}
+
+	code, err := utils.TOTPCode(enrolment.Secret, utils.TOTPCounter(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonBytes, _ := json.Marshal(models.MFARequest{Code: code})
+	rw = doRequestWithAuthorization(t, http.MethodPost, "/v1/user/mfa/totp/confirm", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusOK)
+	var response map[string][]string
+	if err := json.Unmarshal(decodeApiResponse(t, rw).Data, &response); err != nil {
+		t.Fatalf("Failed to decode response to recovery codes: %s", err)
+	}
+
+	return enrolment.Secret, response["recovery_codes"]
+}
+
+func loginWithChallenge(t *testing.T, email string, password string) string {
+	response := loginWithPassword(t, email, password, http.StatusOK)
+
+	var challenge models.MFAChallenge
+	if err := json.Unmarshal(response.Data, &challenge); err != nil {
+		t.Fatalf("Failed to decode response to challenge: %s", err)
+	}
+	assert.True(t, challenge.MFARequired)
+
+	return challenge.ChallengeToken
+}
+
+func TestLoginWithTOTP(t *testing.T) {
+	deleteDatabase()
+
+	secret, _ := enableTOTP(t, createAndLogUser(t, "dummy@email.com", "dummyPassword"))
+	challengeToken := loginWithChallenge(t, "dummy@email.com", "dummyPassword")
+
+	// The challenge token does not give access to the api
+	doRequestWithAuthorization(t, http.MethodGet, "/v1/payments", nil, "Bearer "+challengeToken, http.StatusForbidden)
+
+	// The code used in the confirmation can not be used again, so use the next one
+	code, _ := utils.TOTPCode(secret, utils.TOTPCounter(time.Now())+1)
+	jsonBytes, _ := json.Marshal(models.MFARequest{ChallengeToken: challengeToken, Code: code})
+	rw := doRequestWithoutLogin(t, http.MethodPost, "/v1/user/login/mfa", bytes.NewBuffer(jsonBytes), http.StatusOK)
+
+	var account models.Account
+	if err := json.Unmarshal(decodeApiResponse(t, rw).Data, &account); err != nil {
+		t.Fatal(err)
+	}
+	doRequestWithAuthorization(t, http.MethodGet, "/v1/payments", nil, "Bearer "+account.Token, http.StatusOK)
+
+	// Replayed code
+	doRequestWithoutLogin(t, http.MethodPost, "/v1/user/login/mfa", bytes.NewBuffer(jsonBytes), http.StatusUnauthorized)
+}
+
+func TestLoginWithRecoveryCode(t *testing.T) {
+	deleteDatabase()
+
+	_, recoveryCodes := enableTOTP(t, createAndLogUser(t, "dummy@email.com", "dummyPassword"))
+	assert.Len(t, recoveryCodes, models.RECOVERY_CODES)
+
+	jsonBytes, _ := json.Marshal(models.MFARequest{ChallengeToken: loginWithChallenge(t, "dummy@email.com", "dummyPassword"), RecoveryCode: recoveryCodes[0]})
+	doRequestWithoutLogin(t, http.MethodPost, "/v1/user/login/mfa", bytes.NewBuffer(jsonBytes), http.StatusOK)
+
+	// Recovery codes are single use
+	jsonBytes, _ = json.Marshal(models.MFARequest{ChallengeToken: loginWithChallenge(t, "dummy@email.com", "dummyPassword"), RecoveryCode: recoveryCodes[0]})
+	rw := doRequestWithoutLogin(t, http.MethodPost, "/v1/user/login/mfa", bytes.NewBuffer(jsonBytes), http.StatusUnauthorized)
+
+	assert.EqualValues(t, []string{utils.ERROR_TOTP_INVALID}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestConfirmTOTPWithInvalidCode(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	doRequestWithAuthorization(t, http.MethodPost, "/v1/user/mfa/totp", nil, "Bearer "+token, http.StatusCreated)
+
+	jsonBytes, _ := json.Marshal(models.MFARequest{Code: "000000"})
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/user/mfa/totp/confirm", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusUnauthorized)
+
+	assert.EqualValues(t, []string{utils.ERROR_TOTP_INVALID}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestDisableTOTPThrottled(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	secret, _ := enableTOTP(t, token)
+
+	jsonBytes, _ := json.Marshal(models.MFARequest{Code: "000000"})
+	for i := 0; i < models.LOGIN_DELAY_AFTER_FAILURES; i++ {
+		doRequestWithAuthorization(t, http.MethodDelete, "/v1/user/mfa/totp", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusUnauthorized)
+	}
+
+	// Even a valid code must wait
+	code, _ := utils.TOTPCode(secret, utils.TOTPCounter(time.Now())+1)
+	jsonBytes, _ = json.Marshal(models.MFARequest{Code: code})
+	rw := doRequestWithAuthorization(t, http.MethodDelete, "/v1/user/mfa/totp", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusTooManyRequests)
+
+	assert.EqualValues(t, []string{utils.ERROR_LOGIN_THROTTLED}, decodeApiResponse(t, rw).Errors)
+}
@@ -0,0 +1,434 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+	"strconv"
+)
+
+// CreateOrganisation handler to create a new organisation
+// Receives the name, the id is generated. The user becomes the owner of the organisation
+var CreateOrganisation = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	user := r.Context().Value("user").(uint) //Grab the id of the user that send the request
+
+	var request models.Organisation
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	organisation := models.Organisation{Name: request.Name}
+	if err := organisation.IsValid(); err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := organisation.Create(user); err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Create Api Response
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: fmt.Sprintf("/v1/organisations/%s", organisation.ID.String()),
+	}}
+	utils.CreateApiResponse(w, organisation, http.StatusCreated, links)
+}
+
+// GetOrganisations handler to get the organisations of the user
+var GetOrganisations = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	user := r.Context().Value("user").(uint) //Grab the id of the user that send the request
+
+	organisations, err := models.GetOrganisationsByAccount(user)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Create Links
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: "/v1/organisations",
+	}}
+	for _, organisation := range organisations {
+		links = append(links, utils.Link{
+			Rel:  organisation.ID.String(),
+			Href: fmt.Sprintf("/v1/organisations/%s", organisation.ID.String()),
+		})
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, organisations, http.StatusOK, links)
+}
+
+// GetOrganisation handler to get an organisation
+// Only members can access
+var GetOrganisation = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	organisation, _, ok := getOrganisationMembership(w, r)
+	if !ok {
+		return
+	}
+
+	// Create Api Response
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: fmt.Sprintf("/v1/organisations/%s", organisation.ID.String()),
+	}, {
+		Rel:  "members",
+		Href: fmt.Sprintf("/v1/organisations/%s/members", organisation.ID.String()),
+	}}
+	utils.CreateApiResponse(w, organisation, http.StatusOK, links)
+}
+
+// UpdateOrganisation handler to rename an organisation
+// Only owners and admins can access
+var UpdateOrganisation = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	organisation, membership, ok := getOrganisationMembership(w, r)
+	if !ok {
+		return
+	}
+
+	if !membership.CanManageMembers() {
+		utils.CreateApiErrorResponse(w, utils.ERROR_FORBIDDEN, http.StatusForbidden)
+		return
+	}
+
+	var request models.Organisation
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	organisation.Name = request.Name
+	if err := organisation.IsValid(); err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := infrastructure.GetDB().Model(&organisation).Update("name", organisation.Name).Error; err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Create Api Response
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: fmt.Sprintf("/v1/organisations/%s", organisation.ID.String()),
+	}}
+	utils.CreateApiResponse(w, organisation, http.StatusOK, links)
+}
+
+// DeleteOrganisation handler to delete an organisation
+// Only owners can access. The payments of the organisation are kept
+var DeleteOrganisation = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	organisation, membership, ok := getOrganisationMembership(w, r)
+	if !ok {
+		return
+	}
+
+	if !membership.IsOwner() {
+		utils.CreateApiErrorResponse(w, utils.ERROR_FORBIDDEN, http.StatusForbidden)
+		return
+	}
+
+	if err := organisation.Delete(); err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, nil, http.StatusNoContent, nil)
+}
+
+// GetMembers handler to get the members of an organisation
+// Only members can access
+var GetMembers = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	organisation, _, ok := getOrganisationMembership(w, r)
+	if !ok {
+		return
+	}
+
+	memberships, err := models.GetMembershipsByOrganisation(organisation.ID)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Create Links
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: fmt.Sprintf("/v1/organisations/%s/members", organisation.ID.String()),
+	}}
+	for _, membership := range memberships {
+		links = append(links, utils.Link{
+			Rel:  membership.Email,
+			Href: fmt.Sprintf("/v1/organisations/%s/members/%d", organisation.ID.String(), membership.AccountID),
+		})
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, memberships, http.StatusOK, links)
+}
+
+// UpdateMember handler to change the role of a member
+// Only owners and admins can access, only owners can give or take the owner role
+var UpdateMember = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	_, membership, ok := getOrganisationMembership(w, r)
+	if !ok {
+		return
+	}
+
+	member, ok := getMember(w, r, membership)
+	if !ok {
+		return
+	}
+
+	var request models.Membership
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	if !membership.CanManageMembers() || ((member.IsOwner() || request.Role == models.ORGANISATION_ROLE_OWNER) && !membership.IsOwner()) {
+		utils.CreateApiErrorResponse(w, utils.ERROR_FORBIDDEN, http.StatusForbidden)
+		return
+	}
+
+	if err := member.SetRole(request.Role); err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, member, http.StatusOK, nil)
+}
+
+// DeleteMember handler to remove a member from an organisation
+// Owners and admins can remove members, only owners can remove owners. Every member can leave
+var DeleteMember = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	_, membership, ok := getOrganisationMembership(w, r)
+	if !ok {
+		return
+	}
+
+	member, ok := getMember(w, r, membership)
+	if !ok {
+		return
+	}
+
+	leaving := member.ID == membership.ID
+	if !leaving && (!membership.CanManageMembers() || (member.IsOwner() && !membership.IsOwner())) {
+		utils.CreateApiErrorResponse(w, utils.ERROR_FORBIDDEN, http.StatusForbidden)
+		return
+	}
+
+	if err := member.Delete(); err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, nil, http.StatusNoContent, nil)
+}
+
+// CreateInvitation handler to invite an email to join an organisation
+// Receives the email and the role. Only owners and admins can access, only owners can invite owners
+var CreateInvitation = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	organisation, membership, ok := getOrganisationMembership(w, r)
+	if !ok {
+		return
+	}
+
+	var request models.Invitation
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	if !membership.CanManageMembers() || (request.Role == models.ORGANISATION_ROLE_OWNER && !membership.IsOwner()) {
+		utils.CreateApiErrorResponse(w, utils.ERROR_FORBIDDEN, http.StatusForbidden)
+		return
+	}
+
+	invitation, err := organisation.Invite(request.Email, request.Role, membership.AccountID)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, invitation, http.StatusCreated, nil)
+}
+
+// GetInvitations handler to get the pending invitations of an organisation
+// Only owners and admins can access
+var GetInvitations = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	organisation, membership, ok := getOrganisationMembership(w, r)
+	if !ok {
+		return
+	}
+
+	if !membership.CanManageMembers() {
+		utils.CreateApiErrorResponse(w, utils.ERROR_FORBIDDEN, http.StatusForbidden)
+		return
+	}
+
+	invitations, err := models.GetPendingInvitations(organisation.ID)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Create Api Response
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: fmt.Sprintf("/v1/organisations/%s/invitations", organisation.ID.String()),
+	}}
+	utils.CreateApiResponse(w, invitations, http.StatusOK, links)
+}
+
+// AcceptInvitation handler to join an organisation with the token sent by email
+// The invitation must be accepted by the account of the invited email
+var AcceptInvitation = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	account, ok := getCaller(w, r)
+	if !ok {
+		return
+	}
+
+	var request models.InvitationAcceptRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	membership, err := models.AcceptInvitation(request.Token, account)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Create Api Response
+	links := []utils.Link{{
+		Rel:  "organisation",
+		Href: fmt.Sprintf("/v1/organisations/%s", membership.OrganisationID.String()),
+	}}
+	utils.CreateApiResponse(w, membership, http.StatusOK, links)
+}
+
+// getOrganisationMembership returns the organisation of the url and the membership of the caller
+// Writes a not found response if the organisation does not exist or the caller is not a member
+func getOrganisationMembership(w http.ResponseWriter, r *http.Request) (models.Organisation, models.Membership, bool) {
+	user := r.Context().Value("user").(uint) //Grab the id of the user that send the request
+
+	// Read the ID from the mux vars
+	vars := mux.Vars(r)
+	id, err := utils.ConvertStringToUUID(vars["id"])
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_REQUESTED_UUID_INVALID, http.StatusBadRequest)
+		return models.Organisation{}, models.Membership{}, false
+	}
+
+	organisation, err := models.GetOrganisationByID(id)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return organisation, models.Membership{}, false
+	}
+
+	// Organisations of other users are not found
+	membership, err := models.GetMembership(organisation.ID, user)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, utils.ERROR_RESOURCE_NOT_FOUND, http.StatusNotFound)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return organisation, membership, false
+	}
+
+	return organisation, membership, true
+}
+
+// getMember returns the membership of the account of the url in the organisation of the caller
+func getMember(w http.ResponseWriter, r *http.Request, membership models.Membership) (models.Membership, bool) {
+	vars := mux.Vars(r)
+	accountID, err := strconv.ParseUint(vars["account_id"], 10, 64)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_RESOURCE_NOT_FOUND, http.StatusNotFound)
+		return models.Membership{}, false
+	}
+
+	member, err := models.GetMembership(membership.OrganisationID, uint(accountID))
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, utils.ERROR_RESOURCE_NOT_FOUND, http.StatusNotFound)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return member, false
+	}
+
+	return member, true
+}
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+	"testing"
+)
+
+func createOrganisation(t *testing.T, token string, name string) models.Organisation {
+	jsonBytes, err := json.Marshal(models.Organisation{Name: name})
+	if err != nil {
+		t.Fatalf("Failed to encode to JSON: %s", err)
+	}
+
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/organisations", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusCreated)
+	validateHeaderContentType(t, rw)
+
+	var organisation models.Organisation
+	if err := json.Unmarshal(decodeApiResponse(t, rw).Data, &organisation); err != nil {
+		t.Fatalf("Failed to decode response to organisation: %s", err)
+	}
+
+	return organisation
+}
+
+func inviteAndAccept(t *testing.T, organisation models.Organisation, ownerToken string, email string, role string) string {
+	token := createAndLogUser(t, email, "dummyPassword")
+
+	jsonBytes, _ := json.Marshal(models.Invitation{Email: email, Role: role})
+	doRequestWithAuthorization(t, http.MethodPost, fmt.Sprintf("/v1/organisations/%s/invitations", organisation.ID), bytes.NewBuffer(jsonBytes), "Bearer "+ownerToken, http.StatusCreated)
+
+	jsonBytes, _ = json.Marshal(models.InvitationAcceptRequest{Token: mailer.lastToken(t, email)})
+	doRequestWithAuthorization(t, http.MethodPost, "/v1/organisations/invitations/accept", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusOK)
+
+	return token
+}
+
+func TestCreateOrganisation(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	organisation := createOrganisation(t, token, "Bank A")
+
+	assert.NotEqual(t, uuid.Nil, organisation.ID)
+	assert.EqualValues(t, "Bank A", organisation.Name)
+
+	rw := doRequestWithAuthorization(t, http.MethodGet, fmt.Sprintf("/v1/organisations/%s/members", organisation.ID), nil, "Bearer "+token, http.StatusOK)
+	var members []models.Membership
+	if err := json.Unmarshal(decodeApiResponse(t, rw).Data, &members); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, members, 1)
+	assert.EqualValues(t, models.ORGANISATION_ROLE_OWNER, members[0].Role)
+	assert.EqualValues(t, "dummy@email.com", members[0].Email)
+}
+
+func TestCreateOrganisationWithoutName(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/organisations", bytes.NewBuffer([]byte(`{"name": " "}`)), "Bearer "+token, http.StatusBadRequest)
+	assert.EqualValues(t, []string{utils.ERROR_ORGANISATION_NAME_REQUIRED}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestGetOrganisationOfOtherUser(t *testing.T) {
+	deleteDatabase()
+
+	organisation := createOrganisation(t, createAndLogUser(t, "dummy@email.com", "dummyPassword"), "Bank A")
+	token := createAndLogUser(t, "other@email.com", "dummyPassword")
+
+	doRequestWithAuthorization(t, http.MethodGet, fmt.Sprintf("/v1/organisations/%s", organisation.ID), nil, "Bearer "+token, http.StatusNotFound)
+
+	rw := doRequestWithAuthorization(t, http.MethodGet, "/v1/organisations", nil, "Bearer "+token, http.StatusOK)
+	var organisations []models.Organisation
+	if err := json.Unmarshal(decodeApiResponse(t, rw).Data, &organisations); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the example organisation joined by the test users
+	assert.Len(t, organisations, 1)
+	assert.EqualValues(t, exampleOrganisationID, organisations[0].ID)
+}
+
+func TestInvitation(t *testing.T) {
+	deleteDatabase()
+
+	ownerToken := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	organisation := createOrganisation(t, ownerToken, "Bank A")
+
+	memberToken := inviteAndAccept(t, organisation, ownerToken, "member@email.com", models.ORGANISATION_ROLE_MEMBER)
+
+	doRequestWithAuthorization(t, http.MethodGet, fmt.Sprintf("/v1/organisations/%s", organisation.ID), nil, "Bearer "+memberToken, http.StatusOK)
+
+	// Members can not manage the organisation
+	jsonBytes, _ := json.Marshal(models.Invitation{Email: "other@email.com", Role: models.ORGANISATION_ROLE_MEMBER})
+	doRequestWithAuthorization(t, http.MethodPost, fmt.Sprintf("/v1/organisations/%s/invitations", organisation.ID), bytes.NewBuffer(jsonBytes), "Bearer "+memberToken, http.StatusForbidden)
+	doRequestWithAuthorization(t, http.MethodDelete, fmt.Sprintf("/v1/organisations/%s", organisation.ID), nil, "Bearer "+memberToken, http.StatusForbidden)
+}
+
+func TestInvitationOfOtherEmail(t *testing.T) {
+	deleteDatabase()
+
+	ownerToken := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	organisation := createOrganisation(t, ownerToken, "Bank A")
+	token := createAndLogUser(t, "other@email.com", "dummyPassword")
+
+	jsonBytes, _ := json.Marshal(models.Invitation{Email: "member@email.com", Role: models.ORGANISATION_ROLE_MEMBER})
+	doRequestWithAuthorization(t, http.MethodPost, fmt.Sprintf("/v1/organisations/%s/invitations", organisation.ID), bytes.NewBuffer(jsonBytes), "Bearer "+ownerToken, http.StatusCreated)
+
+	jsonBytes, _ = json.Marshal(models.InvitationAcceptRequest{Token: mailer.lastToken(t, "member@email.com")})
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/organisations/invitations/accept", bytes.NewBuffer(jsonBytes), "Bearer "+token, http.StatusBadRequest)
+
+	assert.EqualValues(t, []string{utils.ERROR_INVITATION_INVALID}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestOrganisationKeepsOneOwner(t *testing.T) {
+	deleteDatabase()
+
+	ownerToken := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	organisation := createOrganisation(t, ownerToken, "Bank A")
+	adminToken := inviteAndAccept(t, organisation, ownerToken, "admin@email.com", models.ORGANISATION_ROLE_ADMIN)
+
+	owner, _ := models.GetAccountByEmail("dummy@email.com")
+
+	// Admins can not change owners
+	jsonBytes, _ := json.Marshal(models.Membership{Role: models.ORGANISATION_ROLE_MEMBER})
+	doRequestWithAuthorization(t, http.MethodPut, fmt.Sprintf("/v1/organisations/%s/members/%d", organisation.ID, owner.ID), bytes.NewBuffer(jsonBytes), "Bearer "+adminToken, http.StatusForbidden)
+
+	// The only owner can not leave
+	rw := doRequestWithAuthorization(t, http.MethodDelete, fmt.Sprintf("/v1/organisations/%s/members/%d", organisation.ID, owner.ID), nil, "Bearer "+ownerToken, http.StatusBadRequest)
+	assert.EqualValues(t, []string{utils.ERROR_ORGANISATION_LAST_OWNER}, decodeApiResponse(t, rw).Errors)
+
+	jsonBytes, _ = json.Marshal(models.AccountUpdateRequest{CurrentPassword: "dummyPassword"})
+	rw = doRequestWithAuthorization(t, http.MethodDelete, "/v1/user/me", bytes.NewBuffer(jsonBytes), "Bearer "+ownerToken, http.StatusBadRequest)
+	assert.EqualValues(t, []string{utils.ERROR_ORGANISATION_LAST_OWNER}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestCreatePaymentForUnknownOrganisation(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+
+	var payment models.Payment
+	if err := json.Unmarshal(paymentExample(uuid.NewV4()), &payment); err != nil {
+		t.Fatal(err)
+	}
+	payment.OrganisationID = uuid.NewV4()
+
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(convertToJson(t, payment)), "Bearer "+token, http.StatusBadRequest)
+	assert.EqualValues(t, []string{utils.ERROR_ORGANISATION_NOT_FOUND}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestCreatePaymentForOrganisationOfOtherUser(t *testing.T) {
+	deleteDatabase()
+
+	organisation := createOrganisation(t, createAndLogUser(t, "dummy@email.com", "dummyPassword"), "Bank A")
+	token := createAndLogUser(t, "other@email.com", "dummyPassword")
+
+	var payment models.Payment
+	if err := json.Unmarshal(paymentExample(uuid.NewV4()), &payment); err != nil {
+		t.Fatal(err)
+	}
+	payment.OrganisationID = organisation.ID
+
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(convertToJson(t, payment)), "Bearer "+token, http.StatusForbidden)
+	assert.EqualValues(t, []string{utils.ERROR_ORGANISATION_FORBIDDEN}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestPaymentOfOrganisationOfOtherUser(t *testing.T) {
+	deleteDatabase()
+
+	ownerToken := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	organisation := createOrganisation(t, ownerToken, "Bank A")
+	token := createAndLogUser(t, "other@email.com", "dummyPassword")
+
+	var payment models.Payment
+	if err := json.Unmarshal(paymentExample(uuid.NewV4()), &payment); err != nil {
+		t.Fatal(err)
+	}
+	payment.OrganisationID = organisation.ID
+	doRequestWithAuthorization(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(convertToJson(t, payment)), "Bearer "+ownerToken, http.StatusCreated)
+	url := fmt.Sprintf("/v1/payments/%s", payment.ID)
+
+	// Only the members of the organisation list its payments
+	_, payments := convertJsonToPayments(t, doRequestWithAuthorization(t, http.MethodGet, "/v1/payments", nil, "Bearer "+token, http.StatusOK))
+	assert.Len(t, payments, 0)
+	_, payments = convertJsonToPayments(t, doRequestWithAuthorization(t, http.MethodGet, "/v1/payments", nil, "Bearer "+ownerToken, http.StatusOK))
+	assert.Len(t, payments, 1)
+
+	rw := doRequestWithAuthorization(t, http.MethodGet, url, nil, "Bearer "+token, http.StatusForbidden)
+	assert.EqualValues(t, []string{utils.ERROR_ORGANISATION_FORBIDDEN}, decodeApiResponse(t, rw).Errors)
+
+	// The payment can not be moved to an organisation of the user
+	moved := payment
+	moved.OrganisationID = exampleOrganisationID
+	rw = doRequestWithAuthorization(t, http.MethodPut, url, bytes.NewBuffer(convertToJson(t, moved)), "Bearer "+token, http.StatusForbidden)
+	assert.EqualValues(t, []string{utils.ERROR_ORGANISATION_FORBIDDEN}, decodeApiResponse(t, rw).Errors)
+
+	rw = doRequestWithAuthorization(t, http.MethodDelete, url, nil, "Bearer "+token, http.StatusForbidden)
+	assert.EqualValues(t, []string{utils.ERROR_ORGANISATION_FORBIDDEN}, decodeApiResponse(t, rw).Errors)
+
+	stored, err := models.GetPaymentByID(payment.ID)
+	require.Nil(t, err)
+	assert.EqualValues(t, organisation.ID, stored.OrganisationID)
+}
+
+func TestCreateOrganisationWithID(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	payment := insertPayments(t, uuid.NewV4())
+	payment.OrganisationID = uuid.NewV4()
+	require.Nil(t, infrastructure.GetDB().Model(&payment).UpdateColumn("organisation_id", payment.OrganisationID).Error)
+
+	// The id of the request is ignored, the organisation of the payment cannot be taken
+	body := []byte(fmt.Sprintf(`{"id": "%s", "name": "Bank A"}`, payment.OrganisationID))
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/organisations", bytes.NewBuffer(body), "Bearer "+token, http.StatusCreated)
+	var organisation models.Organisation
+	require.Nil(t, json.Unmarshal(decodeApiResponse(t, rw).Data, &organisation))
+	assert.NotEqual(t, payment.OrganisationID, organisation.ID)
+
+	doRequestWithAuthorization(t, http.MethodGet, fmt.Sprintf("/v1/payments/%s", payment.ID), nil, "Bearer "+token, http.StatusBadRequest)
+}
+
+func TestClaimOrganisation(t *testing.T) {
+	deleteDatabase()
+
+	adminToken := createAndLogAdmin(t, "admin@email.com", "dummyPassword")
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	account, err := models.GetAccountByEmail("dummy@email.com")
+	require.Nil(t, err)
+
+	// A payment stored before the organisations
+	payment := insertPayments(t, uuid.NewV4())
+	payment.OrganisationID = uuid.NewV4()
+	require.Nil(t, infrastructure.GetDB().Model(&payment).UpdateColumn("organisation_id", payment.OrganisationID).Error)
+
+	created, err := models.CreateMissingOrganisations()
+	require.Nil(t, err)
+	assert.EqualValues(t, 1, created)
+	url := fmt.Sprintf("/v1/payments/%s", payment.ID)
+	doRequestWithAuthorization(t, http.MethodGet, url, nil, "Bearer "+token, http.StatusForbidden)
+
+	claimURL := fmt.Sprintf("/v1/admin/organisations/%s/owner", payment.OrganisationID)
+	body := []byte(fmt.Sprintf(`{"account_id": %d}`, account.ID))
+	doRequestWithAuthorization(t, http.MethodPost, claimURL, bytes.NewBuffer(body), "Bearer "+token, http.StatusForbidden)
+	doRequestWithAuthorization(t, http.MethodPost, claimURL, bytes.NewBuffer(body), "Bearer "+adminToken, http.StatusOK)
+	doRequestWithAuthorization(t, http.MethodGet, url, nil, "Bearer "+token, http.StatusOK)
+
+	// Only the organisations without owner are claimed
+	rw := doRequestWithAuthorization(t, http.MethodPost, claimURL, bytes.NewBuffer(body), "Bearer "+adminToken, http.StatusConflict)
+	assert.EqualValues(t, []string{utils.ERROR_ORGANISATION_HAS_OWNER}, decodeApiResponse(t, rw).Errors)
+	created, err = models.CreateMissingOrganisations()
+	require.Nil(t, err)
+	assert.EqualValues(t, 0, created)
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"payments/app/models"
+	"payments/app/outbox"
+	"payments/infrastructure"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPaymentEvents(t *testing.T) {
+
+	deleteDatabase()
+
+	paymentID := uuid.NewV4()
+	doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(paymentExample(paymentID)), http.StatusCreated)
+	doRequestWithLogin(t, http.MethodPut, fmt.Sprintf("/v1/payments/%s", paymentID), bytes.NewBuffer(paymentExample(paymentID)), http.StatusOK)
+	doRequestWithLogin(t, http.MethodDelete, fmt.Sprintf("/v1/payments/%s", paymentID), nil, http.StatusNoContent)
+
+	// A failing sink keeps the events in the outbox
+	failing := outbox.NewRelay(outbox.NewHTTPSink("http://127.0.0.1:1"))
+	relayed, err := failing.RelayDue(time.Now())
+	require.Nil(t, err)
+	assert.EqualValues(t, 0, relayed)
+
+	// The events of the payment are published in order, once
+	var published bytes.Buffer
+	relay := outbox.NewRelay(&outbox.WriterSink{Writer: &published})
+	relayed, err = relay.RelayDue(time.Now())
+	require.Nil(t, err)
+	assert.EqualValues(t, 3, relayed)
+	relayed, err = relay.RelayDue(time.Now())
+	require.Nil(t, err)
+	assert.EqualValues(t, 0, relayed)
+
+	types := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(published.String()), "\n") {
+		message := outbox.Message{}
+		require.Nil(t, json.Unmarshal([]byte(line), &message))
+		assert.EqualValues(t, paymentID, message.PaymentID)
+		types = append(types, message.Type)
+	}
+	assert.EqualValues(t, []string{models.EVENT_PAYMENT_CREATED, models.EVENT_PAYMENT_UPDATED, models.EVENT_PAYMENT_DELETED}, types)
+}
+
+func TestRelayClaimedEvents(t *testing.T) {
+
+	deleteDatabase()
+
+	paymentID := uuid.NewV4()
+	doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(paymentExample(paymentID)), http.StatusCreated)
+	doRequestWithLogin(t, http.MethodPut, fmt.Sprintf("/v1/payments/%s", paymentID), bytes.NewBuffer(paymentExample(paymentID)), http.StatusOK)
+
+	// The first event is being published by another relay, the second one waits for it
+	first := models.OutboxEvent{}
+	require.Nil(t, infrastructure.GetDB().Where("payment_id = ?", paymentID).Order("sequence").First(&first).Error)
+	claim := map[string]interface{}{"claim_token": "other", "claimed_until": time.Now().Add(time.Minute)}
+	require.Nil(t, infrastructure.GetDB().Model(&first).Updates(claim).Error)
+
+	var published bytes.Buffer
+	relay := outbox.NewRelay(&outbox.WriterSink{Writer: &published})
+	relayed, err := relay.RelayDue(time.Now())
+	require.Nil(t, err)
+	assert.EqualValues(t, 0, relayed)
+	assert.Empty(t, published.String())
+
+	// The claim of the other relay expired, the events are published in order and their claims released
+	relayed, err = relay.RelayDue(time.Now().Add(2 * time.Minute))
+	require.Nil(t, err)
+	assert.EqualValues(t, 2, relayed)
+
+	events := []models.OutboxEvent{}
+	require.Nil(t, infrastructure.GetDB().Where("payment_id = ?", paymentID).Order("sequence").Find(&events).Error)
+	require.Len(t, events, 2)
+	for _, event := range events {
+		assert.NotNil(t, event.PublishedAt)
+		assert.Empty(t, event.ClaimToken)
+		assert.Nil(t, event.ClaimedUntil)
+	}
+	types := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(published.String()), "\n") {
+		message := outbox.Message{}
+		require.Nil(t, json.Unmarshal([]byte(line), &message))
+		types = append(types, message.Type)
+	}
+	assert.EqualValues(t, []string{models.EVENT_PAYMENT_CREATED, models.EVENT_PAYMENT_UPDATED}, types)
+}
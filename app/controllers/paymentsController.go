@@ -4,10 +4,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
 	"net/http"
+	"payments/app/banks"
+	"payments/app/calendar"
+	"payments/app/iso20022"
 	"payments/app/models"
+	"payments/app/schemes"
 	"payments/infrastructure"
 	"payments/utils"
+	"strings"
+	"time"
 )
 
 // CreatePayment handler to create a single payment
@@ -25,14 +33,40 @@ var CreatePayment = func(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The organisation must exist and the user must be a member
+	if !checkPaymentOrganisation(w, r, payment) {
+		return
+	}
+
+	// Complete the beneficiary bank with the bank directory
+	banks.GetDirectory().EnrichPayment(&payment)
+
+	// Move the processing date to a business day of the scheme
+	warnings := calendar.GetCalendars().RollPayment(&payment, time.Now())
+
+	// The payment must follow the rules of its scheme
+	if errs := schemes.ValidatePayment(payment); len(errs) > 0 {
+		utils.CreateApiErrorsResponse(w, errs, http.StatusBadRequest)
+		return
+	}
+
 	// Verify if the requested payment already exists in DB
 	if _, err := models.GetPaymentByID(payment.ID); err == nil || (err != nil && err.Error() != utils.ERROR_RESOURCE_NOT_FOUND) {
 		utils.CreateApiErrorResponse(w, utils.ERROR_PAYMENT_ALREADY_EXISTS, http.StatusBadRequest)
 		return
 	}
 
-	// Creates the payment in DB
-	if infrastructure.GetDB().Create(&payment).Error != nil {
+	// Record the key that signed the request
+	payment.SignatureKeyID, _ = r.Context().Value("signature_key").(string)
+
+	// Only the collections of a mandate reference the mandate
+	payment.MandateID = nil
+
+	// The payment is submitted by the scheduler on its processing date
+	payment.Schedule()
+
+	// Creates the payment in DB, with its event
+	if models.CreatePayment(&payment) != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -42,19 +76,30 @@ var CreatePayment = func(w http.ResponseWriter, r *http.Request) {
 		Rel:  "self",
 		Href: fmt.Sprintf("/v1/payments/%s", payment.ID.String()),
 	}}
-	utils.CreateApiResponse(w, nil, http.StatusCreated, links)
+	utils.CreateApiResponseWithWarnings(w, nil, http.StatusCreated, links, warnings)
 }
 
 // GetPayments handler to get all payments
-// Returns all payments from database
+// Returns the payments of the organisations of the user, only the ones of its organisation for an organisation api key
 var GetPayments = func(w http.ResponseWriter, r *http.Request) {
 
 	infrastructure.LogApiRequest(r)
 
-	var payments []models.Payment
+	user := r.Context().Value("user").(uint) //Grab the id of the user that send the request
+
+	var organisationID *uuid.UUID
+	if apiKeyID, ok := r.Context().Value("api_key").(uint); ok {
+		apiKey, err := models.GetApiKeyByID(apiKeyID, user)
+		if err != nil {
+			utils.CreateApiErrorResponse(w, utils.ERROR_SERVER, http.StatusInternalServerError)
+			return
+		}
+		organisationID = apiKey.OrganisationID
+	}
 
-	// Fetch all payments from DB
-	if err := infrastructure.GetDB().Set("gorm:auto_preload", true).Find(&payments).Error; err != nil {
+	// Fetch the payments of the organisations of the user from DB
+	payments, err := models.GetPaymentsByAccount(user, organisationID)
+	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -107,6 +152,22 @@ var GetPayment = func(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The user must be a member of the organisation of the payment
+	if !checkPaymentOrganisation(w, r, payment) {
+		return
+	}
+
+	// Clearing integrations ask for the payment as a pacs.008 message
+	if utils.AcceptsXML(r) {
+		document, err := iso20022.MarshalPacs008(strings.Replace(payment.ID.String(), "-", "", -1), []models.Payment{payment}, time.Now())
+		if err != nil {
+			utils.CreateApiErrorResponse(w, utils.ERROR_SERVER, http.StatusInternalServerError)
+			return
+		}
+		utils.CreateXmlResponse(w, document, http.StatusOK)
+		return
+	}
+
 	// Create Api Response
 	links := []utils.Link{{
 		Rel:  "self",
@@ -161,10 +222,48 @@ var UpdatePayment = func(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The user must be a member of the organisation of the payment
+	if !checkPaymentOrganisation(w, r, oldPayment) {
+		return
+	}
+
+	// The payment can only be moved to an organisation of the user
+	if !checkPaymentOrganisation(w, r, payment) {
+		return
+	}
+
+	// Complete the beneficiary bank with the bank directory
+	banks.GetDirectory().EnrichPayment(&payment)
+
+	// Move the processing date to a business day of the scheme
+	warnings := calendar.GetCalendars().RollPayment(&payment, time.Now())
+
+	// The payment must follow the rules of its scheme
+	if errs := schemes.ValidatePayment(payment); len(errs) > 0 {
+		utils.CreateApiErrorsResponse(w, errs, http.StatusBadRequest)
+		return
+	}
+
+	// A collection keeps its mandate
+	payment.MandateID = oldPayment.MandateID
+	// An unsigned update keeps the signer of the payment, the audit trail is never cleared
+	payment.SignatureKeyID = oldPayment.SignatureKeyID
+	if signatureKey, _ := r.Context().Value("signature_key").(string); signatureKey != "" {
+		payment.SignatureKeyID = signatureKey
+	}
 	oldPayment = payment
+	// The updated payment is scheduled again, unless it was already submitted
+	oldPayment.Schedule()
 	// Update the payment in DB
-	if err := infrastructure.GetDB().Save(&oldPayment).Error; err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	if err := models.SavePayment(&oldPayment); err != nil {
+		switch err.Error() {
+		case utils.ERROR_PAYMENT_SUBMITTED, utils.ERROR_PAYMENT_SUBMITTING:
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusConflict)
+		case utils.ERROR_RESOURCE_NOT_FOUND:
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -173,7 +272,7 @@ var UpdatePayment = func(w http.ResponseWriter, r *http.Request) {
 		Rel:  "self",
 		Href: fmt.Sprintf("/v1/payments/%s", payment.ID.String()),
 	}}
-	utils.CreateApiResponse(w, nil, http.StatusOK, links)
+	utils.CreateApiResponseWithWarnings(w, nil, http.StatusOK, links, warnings)
 }
 
 // DeletePayment handler to delete a single payment
@@ -209,12 +308,69 @@ var DeletePayment = func(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete the payment
-	if err := infrastructure.GetDB().Delete(&payment).Error; err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	// The user must be a member of the organisation of the payment
+	if !checkPaymentOrganisation(w, r, payment) {
+		return
+	}
+
+	// Delete the payment, with its event
+	if err := models.DeletePayment(&payment); err != nil {
+		switch err.Error() {
+		case utils.ERROR_PAYMENT_SUBMITTING:
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusConflict)
+		case utils.ERROR_RESOURCE_NOT_FOUND:
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 		return
 	}
 
+	// The payment is removed, so the key that signed the request is kept in the log
+	signatureKey, _ := r.Context().Value("signature_key").(string)
+	infrastructure.GetLog().WithFields(logrus.Fields{
+		"payment_id":       payment.ID.String(),
+		"signature_key_id": signatureKey,
+	}).Info("Payment deleted")
+
 	// Create Api Response
 	utils.CreateApiResponse(w, nil, http.StatusNoContent, nil)
 }
+
+// checkPaymentOrganisation check if the organisation of the payment exists and the user is a member
+// Api keys created for an organisation only access the payments of that organisation
+func checkPaymentOrganisation(w http.ResponseWriter, r *http.Request, payment models.Payment) bool {
+	user := r.Context().Value("user").(uint) //Grab the id of the user that send the request
+
+	if _, err := models.GetOrganisationByID(payment.OrganisationID); err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, utils.ERROR_ORGANISATION_NOT_FOUND, http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return false
+	}
+
+	if _, err := models.GetMembership(payment.OrganisationID, user); err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusForbidden)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return false
+	}
+
+	if apiKeyID, ok := r.Context().Value("api_key").(uint); ok {
+		apiKey, err := models.GetApiKeyByID(apiKeyID, user)
+		if err != nil {
+			utils.CreateApiErrorResponse(w, utils.ERROR_SERVER, http.StatusInternalServerError)
+			return false
+		}
+		if apiKey.OrganisationID != nil && !uuid.Equal(*apiKey.OrganisationID, payment.OrganisationID) {
+			utils.CreateApiErrorResponse(w, utils.ERROR_ORGANISATION_FORBIDDEN, http.StatusForbidden)
+			return false
+		}
+	}
+
+	return true
+}
@@ -28,16 +28,90 @@ func TestMain(m *testing.M) {
 	// Disable Log to Testing
 	infrastructure.GetLog().Out = ioutil.Discard
 
+	// Sign the tokens with an ephemeral key
+	os.Setenv("DEV_MODE", "true")
+	// The payment requests are only signed by the tests of the signatures
+	os.Setenv("REQUEST_SIGNING_REQUIRED", "false")
+
+	// Keep the emails to read the tokens
+	infrastructure.SetMailer(mailer)
+
 	router := mux.NewRouter()
 	router.Use(middleware.JwtAuthentication)
+	router.Use(middleware.RequestSignature)
 
 	router.HandleFunc("/v1/user", CreateAccount).Methods(http.MethodPost)
 	router.HandleFunc("/v1/user/login", Authenticate).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/login/mfa", AuthenticateMFA).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/email/verify", VerifyEmail).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/email/verify/resend", ResendEmailVerification).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/password/forgot", ForgotPassword).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/password/reset", ResetPassword).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/me", GetMe).Methods(http.MethodGet)
+	router.HandleFunc("/v1/user/me", DeleteMe).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/user/me/password", ChangePassword).Methods(http.MethodPut)
+	router.HandleFunc("/v1/user/me/email", ChangeEmail).Methods(http.MethodPut)
+	router.HandleFunc("/v1/user/mfa/totp", EnrolTOTP).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/mfa/totp/confirm", ConfirmTOTP).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/mfa/totp", DisableTOTP).Methods(http.MethodDelete)
 	router.HandleFunc("/v1/payments", CreatePayment).Methods(http.MethodPost)
 	router.HandleFunc("/v1/payments", GetPayments).Methods(http.MethodGet)
+	router.HandleFunc("/v1/payments/import", ImportPayments).Methods(http.MethodPost)
+	router.HandleFunc("/v1/payments/export", ExportPayments).Methods(http.MethodGet)
 	router.HandleFunc("/v1/payments/{id}", GetPayment).Methods(http.MethodGet)
 	router.HandleFunc("/v1/payments/{id}", UpdatePayment).Methods(http.MethodPut)
 	router.HandleFunc("/v1/payments/{id}", DeletePayment).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/standing-orders", CreateStandingOrder).Methods(http.MethodPost)
+	router.HandleFunc("/v1/standing-orders", GetStandingOrders).Methods(http.MethodGet)
+	router.HandleFunc("/v1/standing-orders/{id}", GetStandingOrder).Methods(http.MethodGet)
+	router.HandleFunc("/v1/standing-orders/{id}", UpdateStandingOrder).Methods(http.MethodPut)
+	router.HandleFunc("/v1/standing-orders/{id}/pause", PauseStandingOrder).Methods(http.MethodPost)
+	router.HandleFunc("/v1/standing-orders/{id}/resume", ResumeStandingOrder).Methods(http.MethodPost)
+	router.HandleFunc("/v1/standing-orders/{id}/cancel", CancelStandingOrder).Methods(http.MethodPost)
+	router.HandleFunc("/v1/mandates", CreateMandate).Methods(http.MethodPost)
+	router.HandleFunc("/v1/mandates", GetMandates).Methods(http.MethodGet)
+	router.HandleFunc("/v1/mandates/{id}", GetMandate).Methods(http.MethodGet)
+	router.HandleFunc("/v1/mandates/{id}", UpdateMandate).Methods(http.MethodPut)
+	router.HandleFunc("/v1/mandates/{id}/cancel", CancelMandate).Methods(http.MethodPost)
+	router.HandleFunc("/v1/mandates/{id}/collections", CreateCollection).Methods(http.MethodPost)
+	router.HandleFunc("/v1/mandates/{id}/collections", GetCollections).Methods(http.MethodGet)
+	router.HandleFunc("/v1/webhooks", CreateWebhook).Methods(http.MethodPost)
+	router.HandleFunc("/v1/webhooks", GetWebhooks).Methods(http.MethodGet)
+	router.HandleFunc("/v1/webhooks/{id}", GetWebhook).Methods(http.MethodGet)
+	router.HandleFunc("/v1/webhooks/{id}", UpdateWebhook).Methods(http.MethodPut)
+	router.HandleFunc("/v1/webhooks/{id}", DeleteWebhook).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/webhooks/{id}/deliveries", GetWebhookDeliveries).Methods(http.MethodGet)
+	router.HandleFunc("/v1/webhooks/{id}/deliveries/{delivery_id}/redeliver", RedeliverWebhook).Methods(http.MethodPost)
+	router.HandleFunc("/v1/banks", GetBanks).Methods(http.MethodGet)
+	router.HandleFunc("/v1/calendars/{scheme}/next-business-day", GetNextBusinessDay).Methods(http.MethodGet)
+	router.HandleFunc("/.well-known/jwks.json", JWKS).Methods(http.MethodGet)
+	router.HandleFunc("/v1/organisations", CreateOrganisation).Methods(http.MethodPost)
+	router.HandleFunc("/v1/organisations", GetOrganisations).Methods(http.MethodGet)
+	router.HandleFunc("/v1/organisations/invitations/accept", AcceptInvitation).Methods(http.MethodPost)
+	router.HandleFunc("/v1/organisations/{id}", GetOrganisation).Methods(http.MethodGet)
+	router.HandleFunc("/v1/organisations/{id}", UpdateOrganisation).Methods(http.MethodPut)
+	router.HandleFunc("/v1/organisations/{id}", DeleteOrganisation).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/organisations/{id}/members", GetMembers).Methods(http.MethodGet)
+	router.HandleFunc("/v1/organisations/{id}/members/{account_id}", UpdateMember).Methods(http.MethodPut)
+	router.HandleFunc("/v1/organisations/{id}/members/{account_id}", DeleteMember).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/organisations/{id}/invitations", CreateInvitation).Methods(http.MethodPost)
+	router.HandleFunc("/v1/organisations/{id}/invitations", GetInvitations).Methods(http.MethodGet)
+	router.HandleFunc("/v1/api-keys", CreateApiKey).Methods(http.MethodPost)
+	router.HandleFunc("/v1/api-keys", GetApiKeys).Methods(http.MethodGet)
+	router.HandleFunc("/v1/api-keys/{id}", RevokeApiKey).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/signing-keys", CreateSigningKey).Methods(http.MethodPost)
+	router.HandleFunc("/v1/signing-keys", GetSigningKeys).Methods(http.MethodGet)
+	router.HandleFunc("/v1/signing-keys/{id}", RevokeSigningKey).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/admin/accounts/{id}/certificates", CreateCertificate).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/certificates", GetCertificates).Methods(http.MethodGet)
+	router.HandleFunc("/v1/user/certificates/{id}", DeleteCertificate).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/admin/lockouts", GetLockouts).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/lockouts/{id}", ClearLockout).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/admin/accounts", GetAccounts).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/accounts/{id}/disable", DisableAccount).Methods(http.MethodPost)
+	router.HandleFunc("/v1/admin/accounts/{id}/enable", EnableAccount).Methods(http.MethodPost)
+	router.HandleFunc("/v1/admin/audit-events", GetAuditEvents).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/organisations/{id}/owner", ClaimOrganisation).Methods(http.MethodPost)
 
 	infrastructure.GetDB().AutoMigrate(
 		&models.Account{},
@@ -49,6 +123,22 @@ func TestMain(m *testing.M) {
 		&models.ChargesInformation{},
 		&models.Charge{},
 		&models.FX{},
+		&models.ApiKey{},
+		&models.RequestSigningKey{},
+		&models.RequestNonce{},
+		&models.ClientCertificate{},
+		&models.LoginThrottle{},
+		&models.AuditEvent{},
+		&models.RecoveryCode{},
+		&models.AccountToken{},
+		&models.Organisation{},
+		&models.Membership{},
+		&models.Invitation{},
+		&models.StandingOrder{},
+		&models.Mandate{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+		&models.OutboxEvent{},
 	)
 
 	deleteDatabase()
@@ -67,11 +157,18 @@ func createAndLogUser(t *testing.T, email string, password string) string {
 		Password: password,
 	}
 
+	if err := user.CreateHashedPassword(); err != nil {
+		t.Fatal(err)
+	}
+
 	if err := infrastructure.GetDB().Create(&user).Error; err != nil {
 		t.Fatalf("Failed create User")
 	}
 
-	jsonBytes, err := json.Marshal(user)
+	// Users create the payments of the example organisation
+	joinOrganisation(t, exampleOrganisationID, user.ID, models.ORGANISATION_ROLE_MEMBER)
+
+	jsonBytes, err := json.Marshal(models.Account{Email: email, Password: password})
 
 	if err != nil {
 		t.Fatalf("Failed to encode to JSON: %s", err)
@@ -89,6 +186,32 @@ func createAndLogUser(t *testing.T, email string, password string) string {
 	return accountNew.Token
 }
 
+// createAndLogAdmin creates an user with the admin role and a verified email, and returns its token
+func createAndLogAdmin(t *testing.T, email string, password string) string {
+	token := createAndLogUser(t, email, password)
+	admin := map[string]interface{}{"role": models.ROLE_ADMIN, "email_verified": true}
+	if err := infrastructure.GetDB().Model(&models.Account{}).Where("email = ?", email).Updates(admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// Organisation of the payment example
+var exampleOrganisationID = uuid.FromStringOrNil("743d5b63-8e6f-432e-a8fa-c5d8d2ee5fcb")
+
+// joinOrganisation adds the account to the organisation, creating the organisation if it does not exist
+func joinOrganisation(t *testing.T, organisationID uuid.UUID, accountID uint, role string) {
+	organisation := models.Organisation{}
+	if err := infrastructure.GetDB().Where(models.Organisation{ID: organisationID}).Attrs(models.Organisation{Name: "Example"}).FirstOrCreate(&organisation).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	membership := models.Membership{OrganisationID: organisationID, AccountID: accountID, Role: role}
+	if err := infrastructure.GetDB().Create(&membership).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
 func deleteDatabase() {
 	infrastructure.GetDB().Unscoped().Delete(&models.Account{})
 	infrastructure.GetDB().Unscoped().Delete(&models.Payment{})
@@ -99,6 +222,22 @@ func deleteDatabase() {
 	infrastructure.GetDB().Unscoped().Delete(&models.ChargesInformation{})
 	infrastructure.GetDB().Unscoped().Delete(&models.Charge{})
 	infrastructure.GetDB().Unscoped().Delete(&models.FX{})
+	infrastructure.GetDB().Unscoped().Delete(&models.ApiKey{})
+	infrastructure.GetDB().Unscoped().Delete(&models.RequestSigningKey{})
+	infrastructure.GetDB().Unscoped().Delete(&models.RequestNonce{})
+	infrastructure.GetDB().Unscoped().Delete(&models.ClientCertificate{})
+	infrastructure.GetDB().Unscoped().Delete(&models.LoginThrottle{})
+	infrastructure.GetDB().Unscoped().Delete(&models.AuditEvent{})
+	infrastructure.GetDB().Unscoped().Delete(&models.RecoveryCode{})
+	infrastructure.GetDB().Unscoped().Delete(&models.AccountToken{})
+	infrastructure.GetDB().Unscoped().Delete(&models.Organisation{})
+	infrastructure.GetDB().Unscoped().Delete(&models.Membership{})
+	infrastructure.GetDB().Unscoped().Delete(&models.Invitation{})
+	infrastructure.GetDB().Unscoped().Delete(&models.StandingOrder{})
+	infrastructure.GetDB().Unscoped().Delete(&models.Mandate{})
+	infrastructure.GetDB().Unscoped().Delete(&models.WebhookSubscription{})
+	infrastructure.GetDB().Unscoped().Delete(&models.WebhookDelivery{})
+	infrastructure.GetDB().Unscoped().Delete(&models.OutboxEvent{})
 }
 
 func paymentExample(paymentId uuid.UUID) []byte {
@@ -156,7 +295,7 @@ func paymentExample(paymentId uuid.UUID) []byte {
 			"payment_scheme": "FPS",
 			"payment_type": "Credit",
 			"processing_date": "2017-01-18",
-			"reference": "Payment for Em\u0027s piano lessons",
+			"reference": "Em\u0027s piano lessons",
 			"scheme_payment_sub_type": "InternetBanking",
 			"scheme_payment_type": "ImmediatePayment",
 			"sponsor_party": {
@@ -217,6 +356,19 @@ func doRequestWithoutLogin(t *testing.T, method string, url string, body io.Read
 	return rw
 }
 
+func doRequestWithAuthorization(t *testing.T, method string, url string, body io.Reader, authorization string, expectedResultCode int) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", authorization)
+	rw := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rw, req)
+	if rw.Code != expectedResultCode {
+		t.Fatalf("Status code was not %d: %d\n", expectedResultCode, rw.Code)
+	}
+
+	return rw
+}
+
 func validateHeaderContentType(t *testing.T, rw *httptest.ResponseRecorder) {
 	if rw.Header().Get("Content-Type") != "application/json" {
 		t.Fatalf("Content type was not application/json")
@@ -403,6 +555,8 @@ func TestCreateSinglePayment(t *testing.T) {
 
 	infrastructure.GetDB().Set("gorm:auto_preload", true).Find(&actualPayment)
 
+	// The created payment waits for the scheduler
+	testPayment.Status = models.PAYMENT_STATUS_PENDING
 	assert.JSONEq(t, string(convertToJson(t, testPayment)), string(convertToJson(t, actualPayment)))
 	assert.EqualValues(t, []utils.Link{{Rel: "self", Href: fmt.Sprintf("/v1/payments/%s", actualPayment.ID.String())}}, response.Links)
 }
@@ -448,7 +602,7 @@ func TestUpdatePayment(t *testing.T) {
 	deleteDatabase()
 
 	testPayment := insertPayments(t, uuid.NewV1())
-	testPayment.Attributes.Currency = "Euro"
+	testPayment.Attributes.Amount = "150.00"
 
 	jsonBytes, err := json.Marshal(testPayment)
 	require.Nil(t, err)
@@ -461,6 +615,7 @@ func TestUpdatePayment(t *testing.T) {
 	}
 
 	infrastructure.GetDB().Set("gorm:auto_preload", true).Find(&actualPayment)
+	testPayment.Status = models.PAYMENT_STATUS_PENDING
 	assert.JSONEq(t, string(convertToJson(t, testPayment)), string(convertToJson(t, actualPayment)))
 	assert.EqualValues(t, []utils.Link{{Rel: "self", Href: fmt.Sprintf("/v1/payments/%s", actualPayment.ID.String())}}, response.Links)
 
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"payments/app/models"
+	"payments/app/scheduler"
+	"payments/infrastructure"
+	"payments/utils"
+	"testing"
+	"time"
+)
+
+func TestUpdateSubmittedPayment(t *testing.T) {
+
+	deleteDatabase()
+
+	testPayment := insertPayments(t, uuid.NewV1())
+	require.Nil(t, infrastructure.GetDB().Model(&models.Payment{}).Where("id = ?", testPayment.ID).Update("status", models.PAYMENT_STATUS_SUBMITTED).Error)
+	testPayment.Attributes.Amount = "150.00"
+
+	rw := doRequestWithLogin(t, http.MethodPut, fmt.Sprintf("/v1/payments/%s", testPayment.ID), bytes.NewBuffer(convertToJson(t, testPayment)), http.StatusConflict)
+	assert.EqualValues(t, []string{utils.ERROR_PAYMENT_SUBMITTED}, decodeApiResponse(t, rw).Errors)
+
+	payment, err := models.GetPaymentByID(testPayment.ID)
+	require.Nil(t, err)
+	assert.EqualValues(t, "100.21", payment.Attributes.Amount)
+}
+
+func TestChangeSubmittingPayment(t *testing.T) {
+
+	deleteDatabase()
+
+	testPayment := insertPayments(t, uuid.NewV1())
+	require.Nil(t, infrastructure.GetDB().Model(&models.Payment{}).Where("id = ?", testPayment.ID).Update("status", models.PAYMENT_STATUS_SUBMITTING).Error)
+
+	// The payment claimed by the scheduler is neither updated nor deleted during its submission
+	rw := doRequestWithLogin(t, http.MethodPut, fmt.Sprintf("/v1/payments/%s", testPayment.ID), bytes.NewBuffer(convertToJson(t, testPayment)), http.StatusConflict)
+	assert.EqualValues(t, []string{utils.ERROR_PAYMENT_SUBMITTING}, decodeApiResponse(t, rw).Errors)
+	rw = doRequestWithLogin(t, http.MethodDelete, fmt.Sprintf("/v1/payments/%s", testPayment.ID), nil, http.StatusConflict)
+	assert.EqualValues(t, []string{utils.ERROR_PAYMENT_SUBMITTING}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestDispatchDuePayments(t *testing.T) {
+
+	deleteDatabase()
+
+	now := time.Now()
+	pending, stale, claimed, exhausted := insertPayments(t, uuid.NewV4()), insertPayments(t, uuid.NewV4()), insertPayments(t, uuid.NewV4()), insertPayments(t, uuid.NewV4())
+	require.Nil(t, infrastructure.GetDB().Model(&models.Payment{}).Where("id = ?", pending.ID).Update("status", models.PAYMENT_STATUS_PENDING).Error)
+	// The claim of a stopped scheduler expired, the other claim is still running
+	require.Nil(t, infrastructure.GetDB().Model(&models.Payment{}).Where("id = ?", stale.ID).
+		Updates(map[string]interface{}{"status": models.PAYMENT_STATUS_SUBMITTING, "attempts": 1, "next_attempt_at": now.Add(-time.Minute), "claim_token": "stopped"}).Error)
+	require.Nil(t, infrastructure.GetDB().Model(&models.Payment{}).Where("id = ?", claimed.ID).
+		Updates(map[string]interface{}{"status": models.PAYMENT_STATUS_SUBMITTING, "attempts": 1, "next_attempt_at": now.Add(time.Minute), "claim_token": "running"}).Error)
+	// The last attempt of the payment was interrupted
+	require.Nil(t, infrastructure.GetDB().Model(&models.Payment{}).Where("id = ?", exhausted.ID).
+		Updates(map[string]interface{}{"status": models.PAYMENT_STATUS_SUBMITTING, "attempts": 5, "next_attempt_at": now.Add(-time.Minute), "claim_token": "stopped"}).Error)
+
+	submitter := &recordingSubmitter{}
+	dispatched, err := scheduler.NewScheduler(submitter).DispatchDue(now)
+	require.Nil(t, err)
+	assert.EqualValues(t, 3, dispatched)
+	assert.ElementsMatch(t, []uuid.UUID{pending.ID, stale.ID}, submitter.submitted)
+
+	expected := map[uuid.UUID]models.Payment{
+		pending.ID:   {Status: models.PAYMENT_STATUS_SUBMITTED, Attempts: 1},
+		stale.ID:     {Status: models.PAYMENT_STATUS_SUBMITTED, Attempts: 2},
+		claimed.ID:   {Status: models.PAYMENT_STATUS_SUBMITTING, Attempts: 1, ClaimToken: "running"},
+		exhausted.ID: {Status: models.PAYMENT_STATUS_FAILED, Attempts: 5, LastError: utils.ERROR_PAYMENT_SUBMISSION_INTERRUPTED},
+	}
+	for id, want := range expected {
+		payment, err := models.GetPaymentByID(id)
+		require.Nil(t, err)
+		assert.EqualValues(t, want.Status, payment.Status)
+		assert.EqualValues(t, want.Attempts, payment.Attempts)
+		assert.EqualValues(t, want.ClaimToken, payment.ClaimToken)
+		assert.EqualValues(t, want.LastError, payment.LastError)
+	}
+}
+
+// recordingSubmitter records the submitted payments
+type recordingSubmitter struct {
+	submitted []uuid.UUID
+}
+
+func (s *recordingSubmitter) Submit(payment models.Payment) error {
+	s.submitted = append(s.submitted, payment.ID)
+	return nil
+}
+
+func TestRecordAfterClaimExpired(t *testing.T) {
+
+	deleteDatabase()
+
+	// The claim of the submission expired and the payment was claimed by another scheduler
+	payment := insertPayments(t, uuid.NewV4())
+	require.Nil(t, infrastructure.GetDB().Model(&models.Payment{}).Where("id = ?", payment.ID).Update("status", models.PAYMENT_STATUS_PENDING).Error)
+	reclaim := &reclaimingSubmitter{}
+	_, err := scheduler.NewScheduler(reclaim).DispatchDue(time.Now())
+	require.Nil(t, err)
+
+	// The result of the expired claim is ignored
+	stored, err := models.GetPaymentByID(payment.ID)
+	require.Nil(t, err)
+	assert.EqualValues(t, models.PAYMENT_STATUS_SUBMITTING, stored.Status)
+	assert.EqualValues(t, "other", stored.ClaimToken)
+}
+
+// reclaimingSubmitter gives the payment to another claim during its submission
+type reclaimingSubmitter struct{}
+
+func (s *reclaimingSubmitter) Submit(payment models.Payment) error {
+	return infrastructure.GetDB().Model(&models.Payment{}).Where("id = ?", payment.ID).
+		Updates(map[string]interface{}{"claim_token": "other", "next_attempt_at": time.Now().Add(time.Hour)}).Error
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"payments/app/models"
+	"payments/utils"
+	"strings"
+	"testing"
+)
+
+// sepaPaymentExample turns the example payment into a SEPA Credit Transfer between IBANs
+func sepaPaymentExample(t *testing.T, paymentId uuid.UUID) models.Payment {
+	var payment models.Payment
+	require.Nil(t, json.Unmarshal(paymentExample(paymentId), &payment))
+
+	payment.Attributes.PaymentScheme = "SEPA"
+	payment.Attributes.Currency = "EUR"
+	payment.Attributes.DebtorParty.AccountNumber = "DE89370400440532013000"
+	payment.Attributes.DebtorParty.AccountNumberCode = "IBAN"
+	payment.Attributes.DebtorParty.BankID = "COBADEFFXXX"
+	payment.Attributes.DebtorParty.BankIDCode = "SWBIC"
+	payment.Attributes.BeneficiaryParty.AccountNumber = "FR1420041010050500013M02606"
+	payment.Attributes.BeneficiaryParty.AccountNumberCode = "IBAN"
+	payment.Attributes.BeneficiaryParty.BankID = "BNPAFRPP"
+	payment.Attributes.BeneficiaryParty.BankIDCode = "SWBIC"
+	return payment
+}
+
+func TestCreateSepaPayment(t *testing.T) {
+
+	deleteDatabase()
+
+	payment := sepaPaymentExample(t, uuid.NewV4())
+	doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(convertToJson(t, payment)), http.StatusCreated)
+}
+
+func TestCreateSepaPaymentWithInvalidAccounts(t *testing.T) {
+
+	deleteDatabase()
+
+	payment := sepaPaymentExample(t, uuid.NewV4())
+	payment.Attributes.Currency = "GBP"
+	payment.Attributes.DebtorParty.AccountNumber = "DE88370400440532013000"
+	payment.Attributes.BeneficiaryParty.BankID = "BNPA"
+
+	rw := doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(convertToJson(t, payment)), http.StatusBadRequest)
+	response := decodeApiResponse(t, rw)
+
+	assert.EqualValues(t, []string{
+		"[SEPA] currency: " + utils.ERROR_SCHEME_CURRENCY,
+		"[SEPA] debtor_party.account_number: " + utils.ERROR_IBAN_CHECKSUM,
+		"[SEPA] beneficiary_party.bank_id: " + utils.ERROR_BIC_INVALID,
+	}, response.Errors)
+
+	_, err := models.GetPaymentByID(payment.ID)
+	assert.EqualValues(t, utils.ERROR_RESOURCE_NOT_FOUND, err.Error())
+}
+
+func TestUpdateSepaPaymentWithLongReference(t *testing.T) {
+
+	deleteDatabase()
+
+	payment := sepaPaymentExample(t, uuid.NewV4())
+	doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(convertToJson(t, payment)), http.StatusCreated)
+
+	payment.Attributes.Reference = strings.Repeat("x", 141)
+	rw := doRequestWithLogin(t, http.MethodPut, fmt.Sprintf("/v1/payments/%s", payment.ID), bytes.NewBuffer(convertToJson(t, payment)), http.StatusBadRequest)
+
+	assert.EqualValues(t, []string{"[SEPA] reference: " + utils.ERROR_SCHEME_REFERENCE_TOO_LONG}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestCreatePaymentWithSchemeRules(t *testing.T) {
+
+	deleteDatabase()
+
+	var payment models.Payment
+	require.Nil(t, json.Unmarshal(paymentExample(uuid.NewV4()), &payment))
+	payment.Attributes.Amount = "1000000.01"
+	payment.Attributes.SchemePaymentType = "DirectDebit"
+	payment.Attributes.BeneficiaryParty.AccountName = ""
+
+	rw := doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(convertToJson(t, payment)), http.StatusBadRequest)
+	assert.EqualValues(t, []string{
+		"[FPS] amount: " + utils.ERROR_SCHEME_AMOUNT_TOO_HIGH,
+		"[FPS] scheme_payment_type: " + utils.ERROR_SCHEME_PAYMENT_TYPE,
+		"[FPS] beneficiary_party.account_name: " + utils.ERROR_SCHEME_FIELD_REQUIRED,
+	}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestUpdatePaymentWithSchemeRules(t *testing.T) {
+
+	deleteDatabase()
+
+	testPayment := insertPayments(t, uuid.NewV4())
+	testPayment.Attributes.Currency = "EUR"
+
+	rw := doRequestWithLogin(t, http.MethodPut, fmt.Sprintf("/v1/payments/%s", testPayment.ID), bytes.NewBuffer(convertToJson(t, testPayment)), http.StatusBadRequest)
+	assert.EqualValues(t, []string{"[FPS] currency: " + utils.ERROR_SCHEME_CURRENCY}, decodeApiResponse(t, rw).Errors)
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+	"strconv"
+	"time"
+)
+
+// CreateSigningKey handler to create a new request signing key
+// Receives the name and returns the key id and secret. The secret is only returned here
+var CreateSigningKey = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	user := r.Context().Value("user").(uint) //Grab the id of the user that send the request
+
+	var request models.RequestSigningKey
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	if err := request.IsValid(); err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key := models.RequestSigningKey{
+		AccountID: user,
+		Name:      request.Name,
+	}
+
+	if err := key.GenerateSecret(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if err := infrastructure.GetDB().Create(&key).Error; err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Create Api Response
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: fmt.Sprintf("/v1/signing-keys/%d", key.ID),
+	}}
+	utils.CreateApiResponse(w, key, http.StatusCreated, links)
+}
+
+// GetSigningKeys handler to get the request signing keys of the user
+// The keys are returned without the secret
+var GetSigningKeys = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	user := r.Context().Value("user").(uint) //Grab the id of the user that send the request
+
+	keys, err := models.GetRequestSigningKeysByAccount(user)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Create Links
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: "/v1/signing-keys",
+	}}
+	for i := range keys {
+		keys[i].Secret = "" // Delete secret
+		links = append(links, utils.Link{
+			Rel:  keys[i].KeyID,
+			Href: fmt.Sprintf("/v1/signing-keys/%d", keys[i].ID),
+		})
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, keys, http.StatusOK, links)
+}
+
+// RevokeSigningKey handler to revoke a request signing key
+// Receives the signing key id. Revoked keys are kept because payments reference them
+var RevokeSigningKey = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	user := r.Context().Value("user").(uint) //Grab the id of the user that send the request
+
+	// Read the ID from the mux vars
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_RESOURCE_NOT_FOUND, http.StatusNotFound)
+		return
+	}
+
+	key, err := models.GetRequestSigningKeyByID(uint(id), user)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if key.RevokedAt == nil {
+		if err := infrastructure.GetDB().Model(&key).UpdateColumn("revoked_at", time.Now()).Error; err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, nil, http.StatusNoContent, nil)
+}
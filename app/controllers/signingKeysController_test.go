@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"payments/app/middleware"
+	"payments/app/models"
+	"payments/utils"
+	"testing"
+)
+
+func createSigningKey(t *testing.T, token string) models.RequestSigningKey {
+	rw := doRequestWithAuthorization(t, http.MethodPost, "/v1/signing-keys", bytes.NewBuffer([]byte(`{"name": "payments"}`)), "Bearer "+token, http.StatusCreated)
+	validateHeaderContentType(t, rw)
+	response := decodeApiResponse(t, rw)
+
+	var key models.RequestSigningKey
+	if err := json.Unmarshal(response.Data, &key); err != nil {
+		t.Fatalf("Failed to decode response to signing key: %s", err)
+	}
+
+	return key
+}
+
+func doSignedRequest(t *testing.T, method string, url string, body []byte, token string, key models.RequestSigningKey, nonce string, expectedResultCode int) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if err := middleware.SignRequest(req, key.KeyID, key.Secret, nonce); err != nil {
+		t.Fatal(err)
+	}
+
+	rw := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rw, req)
+	if rw.Code != expectedResultCode {
+		t.Fatalf("Status code was not %d: %d\n", expectedResultCode, rw.Code)
+	}
+
+	return rw
+}
+
+func TestCreateSignedPayment(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	key := createSigningKey(t, token)
+	paymentId := uuid.NewV4()
+
+	doSignedRequest(t, http.MethodPost, "/v1/payments", paymentExample(paymentId), token, key, "nonce-1", http.StatusCreated)
+
+	payment, err := models.GetPaymentByID(paymentId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, key.KeyID, payment.SignatureKeyID)
+}
+
+func TestReplayedSignedRequest(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	key := createSigningKey(t, token)
+
+	doSignedRequest(t, http.MethodPost, "/v1/payments", paymentExample(uuid.NewV4()), token, key, "nonce-1", http.StatusCreated)
+	rw := doSignedRequest(t, http.MethodPost, "/v1/payments", paymentExample(uuid.NewV4()), token, key, "nonce-1", http.StatusUnauthorized)
+	response := decodeApiResponse(t, rw)
+
+	assert.EqualValues(t, []string{utils.ERROR_SIGNATURE_REPLAYED}, response.Errors)
+}
+
+func TestSignedRequestWithTamperedBody(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	key := createSigningKey(t, token)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/payments", bytes.NewBuffer(paymentExample(uuid.NewV4())))
+	req.Header.Set("Authorization", "Bearer "+token)
+	if err := middleware.SignRequest(req, key.KeyID, key.Secret, "nonce-1"); err != nil {
+		t.Fatal(err)
+	}
+	req.Body = httptest.NewRequest(http.MethodPost, "/v1/payments", bytes.NewBuffer(paymentExample(uuid.NewV4()))).Body
+
+	rw := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rw, req)
+	response := decodeApiResponse(t, rw)
+
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	assert.EqualValues(t, []string{utils.ERROR_SIGNATURE_DIGEST}, response.Errors)
+}
+
+func TestSignedRequestWithKeyOfOtherUser(t *testing.T) {
+	deleteDatabase()
+
+	key := createSigningKey(t, createAndLogUser(t, "dummy@email.com", "dummyPassword"))
+	token := createAndLogUser(t, "other@email.com", "dummyPassword")
+
+	rw := doSignedRequest(t, http.MethodPost, "/v1/payments", paymentExample(uuid.NewV4()), token, key, "nonce-1", http.StatusUnauthorized)
+	response := decodeApiResponse(t, rw)
+
+	assert.EqualValues(t, []string{utils.ERROR_SIGNATURE_UNKNOWN_KEY}, response.Errors)
+}
+
+func TestUnsignedRequestWhenSignatureRequired(t *testing.T) {
+	deleteDatabase()
+
+	// The signatures are required by default
+	os.Unsetenv("REQUEST_SIGNING_REQUIRED")
+	defer os.Setenv("REQUEST_SIGNING_REQUIRED", "false")
+
+	rw := doRequestWithLogin(t, http.MethodDelete, "/v1/payments/"+uuid.NewV4().String(), nil, http.StatusUnauthorized)
+	response := decodeApiResponse(t, rw)
+
+	assert.EqualValues(t, []string{utils.ERROR_SIGNATURE_REQUIRED}, response.Errors)
+}
+
+func TestUnsignedUpdateKeepsSigner(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummy@email.com", "dummyPassword")
+	key := createSigningKey(t, token)
+	paymentId := uuid.NewV4()
+
+	doSignedRequest(t, http.MethodPost, "/v1/payments", paymentExample(paymentId), token, key, "nonce-1", http.StatusCreated)
+	doRequestWithAuthorization(t, http.MethodPut, "/v1/payments/"+paymentId.String(), bytes.NewBuffer(paymentExample(paymentId)), "Bearer "+token, http.StatusOK)
+
+	payment, err := models.GetPaymentByID(paymentId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, key.KeyID, payment.SignatureKeyID)
+}
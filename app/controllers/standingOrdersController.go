@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"payments/app/banks"
+	"payments/app/models"
+	"payments/app/schemes"
+	"payments/app/standingorders"
+	"payments/infrastructure"
+	"payments/utils"
+	"time"
+)
+
+// CreateStandingOrder handler to create a standing order
+// Receives the payment template and the recurrence, the payments are generated ahead of their processing date
+var CreateStandingOrder = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	var order models.StandingOrder
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	if !validateStandingOrder(w, r, &order) {
+		return
+	}
+
+	if uuid.Equal(order.ID, uuid.Nil) {
+		order.ID = uuid.NewV4()
+	} else if _, err := models.GetStandingOrderByID(order.ID); err == nil || err.Error() != utils.ERROR_RESOURCE_NOT_FOUND {
+		utils.CreateApiErrorResponse(w, utils.ERROR_STANDING_ORDER_ALREADY_EXISTS, http.StatusBadRequest)
+		return
+	}
+
+	order.Status = models.STANDING_ORDER_ACTIVE
+	order.Generated, order.LastDate = 0, ""
+	order.SignatureKeyID, _ = r.Context().Value("signature_key").(string)
+	standingorders.Restart(&order, time.Now())
+
+	if infrastructure.GetDB().Create(&order).Error != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	utils.CreateApiResponse(w, order, http.StatusCreated, standingOrderLinks(order))
+}
+
+// GetStandingOrders handler to get the standing orders of an organisation (organisation_id parameter)
+var GetStandingOrders = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	organisationID, err := utils.ConvertStringToUUID(r.URL.Query().Get("organisation_id"))
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_ORGANISATION_NOT_FOUND, http.StatusBadRequest)
+		return
+	}
+
+	// The organisation must exist and the user must be a member
+	if !checkPaymentOrganisation(w, r, models.Payment{OrganisationID: organisationID}) {
+		return
+	}
+
+	orders, err := models.GetStandingOrders(organisationID)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: "/v1/standing-orders?organisation_id=" + organisationID.String(),
+	}}
+	for _, order := range orders {
+		links = append(links, utils.Link{
+			Rel:  order.ID.String(),
+			Href: fmt.Sprintf("/v1/standing-orders/%s", order.ID.String()),
+		})
+	}
+	utils.CreateApiResponse(w, orders, http.StatusOK, links)
+}
+
+// GetStandingOrder handler to get a single standing order
+var GetStandingOrder = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	order, ok := getStandingOrder(w, r)
+	if !ok {
+		return
+	}
+
+	utils.CreateApiResponse(w, order, http.StatusOK, standingOrderLinks(order))
+}
+
+// UpdateStandingOrder handler to amend the payment template and the recurrence of an active or paused standing order
+// The payments already generated are not changed, the next occurrence is the first one after the last generated
+var UpdateStandingOrder = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	order, ok := getStandingOrder(w, r)
+	if !ok {
+		return
+	}
+
+	var amended models.StandingOrder
+	if err := json.NewDecoder(r.Body).Decode(&amended); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+	if !uuid.Equal(amended.ID, uuid.Nil) && !uuid.Equal(amended.ID, order.ID) {
+		utils.CreateApiErrorResponse(w, utils.ERROR_ID_MISMATCH, http.StatusBadRequest)
+		return
+	}
+
+	// The order stays in its organisation
+	amended.OrganisationID = order.OrganisationID
+	if !validateStandingOrder(w, r, &amended) {
+		return
+	}
+
+	signatureKey, _ := r.Context().Value("signature_key").(string)
+	changeStandingOrder(w, order.ID, func(order *models.StandingOrder) error {
+		if order.Status != models.STANDING_ORDER_ACTIVE && order.Status != models.STANDING_ORDER_PAUSED {
+			return errors.New(utils.ERROR_STANDING_ORDER_STATUS)
+		}
+		order.Payment, order.Recurrence = amended.Payment, amended.Recurrence
+		if signatureKey != "" {
+			order.SignatureKeyID = signatureKey
+		}
+		standingorders.Restart(order, time.Now())
+		return nil
+	})
+}
+
+// PauseStandingOrder handler to pause an active standing order, the occurrences are skipped until it is resumed
+var PauseStandingOrder = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	order, ok := getStandingOrder(w, r)
+	if !ok {
+		return
+	}
+
+	changeStandingOrder(w, order.ID, func(order *models.StandingOrder) error {
+		if order.Status != models.STANDING_ORDER_ACTIVE {
+			return errors.New(utils.ERROR_STANDING_ORDER_STATUS)
+		}
+		order.Status = models.STANDING_ORDER_PAUSED
+		return nil
+	})
+}
+
+// ResumeStandingOrder handler to resume a paused standing order from its next occurrence after today
+var ResumeStandingOrder = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	order, ok := getStandingOrder(w, r)
+	if !ok {
+		return
+	}
+
+	changeStandingOrder(w, order.ID, func(order *models.StandingOrder) error {
+		if order.Status != models.STANDING_ORDER_PAUSED {
+			return errors.New(utils.ERROR_STANDING_ORDER_STATUS)
+		}
+		order.Status = models.STANDING_ORDER_ACTIVE
+		standingorders.Restart(order, time.Now())
+		return nil
+	})
+}
+
+// CancelStandingOrder handler to cancel an active or paused standing order, it does not generate payments anymore
+var CancelStandingOrder = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	order, ok := getStandingOrder(w, r)
+	if !ok {
+		return
+	}
+
+	changeStandingOrder(w, order.ID, func(order *models.StandingOrder) error {
+		if order.Status != models.STANDING_ORDER_ACTIVE && order.Status != models.STANDING_ORDER_PAUSED {
+			return errors.New(utils.ERROR_STANDING_ORDER_STATUS)
+		}
+		order.Status, order.NextDate = models.STANDING_ORDER_CANCELLED, ""
+		return nil
+	})
+}
+
+// getStandingOrder reads the standing order of the id of the url, the user must be a member of its organisation
+func getStandingOrder(w http.ResponseWriter, r *http.Request) (models.StandingOrder, bool) {
+	id, err := utils.ConvertStringToUUID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_REQUESTED_UUID_INVALID, http.StatusBadRequest)
+		return models.StandingOrder{}, false
+	}
+
+	order, err := models.GetStandingOrderByID(id)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return order, false
+	}
+
+	return order, checkPaymentOrganisation(w, r, models.Payment{OrganisationID: order.OrganisationID})
+}
+
+// changeStandingOrder applies the change to the locked order and writes the response
+func changeStandingOrder(w http.ResponseWriter, id uuid.UUID, change func(order *models.StandingOrder) error) {
+	order, err := models.UpdateStandingOrder(id, change)
+	if err != nil {
+		switch err.Error() {
+		case utils.ERROR_STANDING_ORDER_STATUS:
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusConflict)
+		case utils.ERROR_RESOURCE_NOT_FOUND:
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		default:
+			utils.CreateApiErrorResponse(w, utils.ERROR_SERVER, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	utils.CreateApiResponse(w, order, http.StatusOK, standingOrderLinks(order))
+}
+
+// validateStandingOrder checks the organisation, the recurrence and the payment template of the order
+// The beneficiary bank of the template is completed with the bank directory
+func validateStandingOrder(w http.ResponseWriter, r *http.Request, order *models.StandingOrder) bool {
+	// The organisation must exist and the user must be a member
+	if !checkPaymentOrganisation(w, r, models.Payment{OrganisationID: order.OrganisationID}) {
+		return false
+	}
+
+	template := models.Payment{OrganisationID: order.OrganisationID, Attributes: order.Payment}
+	banks.GetDirectory().EnrichPayment(&template)
+	order.Payment = template.Attributes
+
+	// The payments must follow the rules of their scheme
+	errs := append(standingorders.ValidateRecurrence(order.Recurrence), schemes.ValidatePayment(template)...)
+	if len(errs) > 0 {
+		utils.CreateApiErrorsResponse(w, errs, http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func standingOrderLinks(order models.StandingOrder) []utils.Link {
+	return []utils.Link{{
+		Rel:  "self",
+		Href: fmt.Sprintf("/v1/standing-orders/%s", order.ID.String()),
+	}}
+}
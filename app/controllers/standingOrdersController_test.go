@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"payments/app/calendar"
+	"payments/app/models"
+	"payments/app/standingorders"
+	"payments/infrastructure"
+	"payments/utils"
+	"testing"
+	"time"
+)
+
+func standingOrderExample(t *testing.T, recurrence models.Recurrence) []byte {
+	payment := models.Payment{}
+	require.Nil(t, json.Unmarshal(paymentExample(uuid.NewV4()), &payment))
+
+	order := models.StandingOrder{OrganisationID: payment.OrganisationID, Payment: payment.Attributes, Recurrence: recurrence}
+	body, err := json.Marshal(order)
+	require.Nil(t, err)
+	return body
+}
+
+func decodeStandingOrder(t *testing.T, response utils.Response) models.StandingOrder {
+	order := models.StandingOrder{}
+	require.Nil(t, json.Unmarshal(response.Data, &order))
+	return order
+}
+
+func TestStandingOrder(t *testing.T) {
+
+	deleteDatabase()
+
+	today := time.Now().UTC().Format(calendar.DATE_FORMAT)
+	body := standingOrderExample(t, models.Recurrence{Frequency: models.RECURRENCE_WEEKLY, StartDate: today, Count: 2})
+
+	rw := doRequestWithLogin(t, http.MethodPost, "/v1/standing-orders", bytes.NewBuffer(body), http.StatusCreated)
+	order := decodeStandingOrder(t, decodeApiResponse(t, rw))
+	assert.EqualValues(t, models.STANDING_ORDER_ACTIVE, order.Status)
+	assert.EqualValues(t, today, order.NextDate)
+	assert.EqualValues(t, "100.21", order.Payment.Amount)
+
+	// The first occurrence is generated, the second is after the lead days
+	_, err := standingorders.GenerateDue(time.Now(), 3, 100)
+	require.Nil(t, err)
+
+	payments := []models.Payment{}
+	require.Nil(t, infrastructure.GetDB().Set("gorm:auto_preload", true).Where("standing_order_id = ?", order.ID).Find(&payments).Error)
+	require.Len(t, payments, 1)
+	assert.EqualValues(t, models.PAYMENT_STATUS_PENDING, payments[0].Status)
+	assert.EqualValues(t, "100.21", payments[0].Attributes.Amount)
+
+	rw = doRequestWithLogin(t, http.MethodGet, fmt.Sprintf("/v1/standing-orders/%s", order.ID), nil, http.StatusOK)
+	order = decodeStandingOrder(t, decodeApiResponse(t, rw))
+	assert.EqualValues(t, 1, order.Generated)
+	assert.EqualValues(t, time.Now().UTC().AddDate(0, 0, 7).Format(calendar.DATE_FORMAT), order.NextDate)
+
+	// Pause, resume and cancel
+	rw = doRequestWithLogin(t, http.MethodPost, fmt.Sprintf("/v1/standing-orders/%s/pause", order.ID), nil, http.StatusOK)
+	assert.EqualValues(t, models.STANDING_ORDER_PAUSED, decodeStandingOrder(t, decodeApiResponse(t, rw)).Status)
+
+	rw = doRequestWithLogin(t, http.MethodPost, fmt.Sprintf("/v1/standing-orders/%s/pause", order.ID), nil, http.StatusConflict)
+	assert.EqualValues(t, []string{utils.ERROR_STANDING_ORDER_STATUS}, decodeApiResponse(t, rw).Errors)
+
+	doRequestWithLogin(t, http.MethodPost, fmt.Sprintf("/v1/standing-orders/%s/resume", order.ID), nil, http.StatusOK)
+
+	rw = doRequestWithLogin(t, http.MethodPost, fmt.Sprintf("/v1/standing-orders/%s/cancel", order.ID), nil, http.StatusOK)
+	order = decodeStandingOrder(t, decodeApiResponse(t, rw))
+	assert.EqualValues(t, models.STANDING_ORDER_CANCELLED, order.Status)
+	assert.EqualValues(t, "", order.NextDate)
+
+	doRequestWithLogin(t, http.MethodPut, fmt.Sprintf("/v1/standing-orders/%s", order.ID), bytes.NewBuffer(body), http.StatusConflict)
+}
+
+func TestAmendStandingOrder(t *testing.T) {
+
+	deleteDatabase()
+
+	body := standingOrderExample(t, models.Recurrence{Frequency: models.RECURRENCE_MONTHLY, StartDate: "2100-01-01"})
+	rw := doRequestWithLogin(t, http.MethodPost, "/v1/standing-orders", bytes.NewBuffer(body), http.StatusCreated)
+	order := decodeStandingOrder(t, decodeApiResponse(t, rw))
+	assert.EqualValues(t, "2100-01-01", order.NextDate)
+
+	order.Payment.Amount = "25.00"
+	order.Recurrence = models.Recurrence{Frequency: models.RECURRENCE_LAST_BUSINESS_DAY, StartDate: "2100-01-01"}
+	body, err := json.Marshal(order)
+	require.Nil(t, err)
+
+	rw = doRequestWithLogin(t, http.MethodPut, fmt.Sprintf("/v1/standing-orders/%s", order.ID), bytes.NewBuffer(body), http.StatusOK)
+	order = decodeStandingOrder(t, decodeApiResponse(t, rw))
+	assert.EqualValues(t, "25.00", order.Payment.Amount)
+	assert.EqualValues(t, "2100-01-31", order.NextDate)
+
+	rw = doRequestWithLogin(t, http.MethodGet, "/v1/standing-orders?organisation_id="+order.OrganisationID.String(), nil, http.StatusOK)
+	orders := []models.StandingOrder{}
+	require.Nil(t, json.Unmarshal(decodeApiResponse(t, rw).Data, &orders))
+	assert.Len(t, orders, 1)
+}
+
+func TestCreateStandingOrderWithInvalidRecurrence(t *testing.T) {
+
+	deleteDatabase()
+
+	body := standingOrderExample(t, models.Recurrence{Frequency: "daily", StartDate: "2100-01-01"})
+	rw := doRequestWithLogin(t, http.MethodPost, "/v1/standing-orders", bytes.NewBuffer(body), http.StatusBadRequest)
+	assert.EqualValues(t, []string{"recurrence.frequency: " + utils.ERROR_RECURRENCE_FREQUENCY}, decodeApiResponse(t, rw).Errors)
+}
@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+)
+
+// VerifyEmail handler to verify the email of the user
+// Receives the token sent by email
+var VerifyEmail = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	var request models.AccountTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	accountToken, err := models.UseAccountToken(request.Token, models.ACCOUNT_TOKEN_VERIFY_EMAIL)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	account, err := models.GetAccountByID(accountToken.AccountID)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, utils.ERROR_ACCOUNT_TOKEN_INVALID, http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The token verifies the email it was sent to, which replaces the email of the account after a change
+	oldEmail := account.Email
+	if err := account.VerifyEmail(accountToken.Email); err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if oldEmail != accountToken.Email {
+		models.RecordAuditEvent(models.AuditEvent{
+			Type:      models.AUDIT_EMAIL_CHANGED,
+			AccountID: &account.ID,
+			IP:        utils.ClientIP(r),
+			Details:   oldEmail + " -> " + accountToken.Email,
+		})
+
+		// Warn the old email, in case the change was not requested by its owner
+		err := infrastructure.GetMailer().Send(infrastructure.Email{
+			To:      oldEmail,
+			Subject: "Your email was changed",
+			Body:    fmt.Sprintf("The email of your account was changed to %s.\nIf you did not change it contact the support.\n", accountToken.Email),
+		})
+		if err != nil {
+			infrastructure.LogError(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, nil, http.StatusNoContent, nil)
+}
+
+// ResendEmailVerification handler to send a new email verification to the user
+var ResendEmailVerification = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	account, ok := getCaller(w, r)
+	if !ok {
+		return
+	}
+
+	if !account.EmailVerified {
+		if err := account.SendEmailVerification(account.Email); err != nil {
+			utils.CreateApiErrorResponse(w, utils.ERROR_SERVER, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, nil, http.StatusAccepted, nil)
+}
+
+// ForgotPassword handler to send a password reset token by email
+// Always returns 202, so it can not be used to find which emails have an account
+var ForgotPassword = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	var request models.Account
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	account, err := models.GetAccountByEmail(request.Email)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if account.Email != "" {
+		if err := account.SendPasswordReset(); err != nil {
+			infrastructure.LogError(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, nil, http.StatusAccepted, nil)
+}
+
+// ResetPassword handler to choose a new password
+// Receives the token sent by email and the new password
+var ResetPassword = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	var request models.AccountTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	accountToken, err := models.GetValidAccountToken(request.Token, models.ACCOUNT_TOKEN_RESET_PASSWORD)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	account, err := models.GetAccountByID(accountToken.AccountID)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, utils.ERROR_ACCOUNT_TOKEN_INVALID, http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The password change revokes the issued tokens, and uses the reset tokens, this one included, only once the
+	// password is updated, so the user can try again with the token after a refused password or a failure
+	if err := account.ChangePassword(request.Password); err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusBadRequest)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The user proved the access to the email, so the failed logins are cleared
+	if err := models.ClearLoginThrottle(models.EmailThrottleKey(account.Email)); err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Create Api Response
+	utils.CreateApiResponse(w, nil, http.StatusNoContent, nil)
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"os"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+// recordingMailer keeps the sent emails
+type recordingMailer struct {
+	mu     sync.Mutex
+	emails []infrastructure.Email
+}
+
+func (m *recordingMailer) Send(email infrastructure.Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.emails = append(m.emails, email)
+	return nil
+}
+
+// lastToken returns the token of the last email sent to the address
+func (m *recordingMailer) lastToken(t *testing.T, to string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.emails) - 1; i >= 0; i-- {
+		if m.emails[i].To == to {
+			if match := regexp.MustCompile(`token=([A-Za-z0-9_-]+)`).FindStringSubmatch(m.emails[i].Body); match != nil {
+				return match[1]
+			}
+		}
+	}
+	t.Fatalf("No token sent to %s", to)
+	return ""
+}
+
+var mailer = &recordingMailer{}
+
+func TestVerifyEmail(t *testing.T) {
+	deleteDatabase()
+
+	jsonBytes := []byte(`{"email": "dummyemail@dummy.com", "password": "dummypassword"}`)
+	doRequestWithoutLogin(t, http.MethodPost, "/v1/user", bytes.NewBuffer(jsonBytes), http.StatusCreated)
+
+	jsonBytes, _ = json.Marshal(models.AccountTokenRequest{Token: mailer.lastToken(t, "dummyemail@dummy.com")})
+	doRequestWithoutLogin(t, http.MethodPost, "/v1/user/email/verify", bytes.NewBuffer(jsonBytes), http.StatusNoContent)
+
+	account, err := models.GetAccountByEmail("dummyemail@dummy.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, account.EmailVerified)
+
+	// Tokens are single use
+	rw := doRequestWithoutLogin(t, http.MethodPost, "/v1/user/email/verify", bytes.NewBuffer(jsonBytes), http.StatusBadRequest)
+	assert.EqualValues(t, []string{utils.ERROR_ACCOUNT_TOKEN_INVALID}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestResetPassword(t *testing.T) {
+	deleteDatabase()
+
+	token := createAndLogUser(t, "dummyemail@dummy.com", "dummypassword")
+
+	doRequestWithoutLogin(t, http.MethodPost, "/v1/user/password/forgot", bytes.NewBuffer([]byte(`{"email": "dummyemail@dummy.com"}`)), http.StatusAccepted)
+
+	jsonBytes, _ := json.Marshal(models.AccountTokenRequest{Token: mailer.lastToken(t, "dummyemail@dummy.com"), Password: "newpassword"})
+	doRequestWithoutLogin(t, http.MethodPost, "/v1/user/password/reset", bytes.NewBuffer(jsonBytes), http.StatusNoContent)
+
+	loginWithPassword(t, "dummyemail@dummy.com", "dummypassword", http.StatusUnauthorized)
+	loginWithPassword(t, "dummyemail@dummy.com", "newpassword", http.StatusOK)
+
+	// The tokens issued before the reset are revoked
+	rw := doRequestWithAuthorization(t, http.MethodGet, "/v1/user/me", nil, "Bearer "+token, http.StatusForbidden)
+	assert.EqualValues(t, []string{utils.ERROR_TOKEN_REVOKED}, decodeApiResponse(t, rw).Errors)
+
+	// Tokens are single use
+	doRequestWithoutLogin(t, http.MethodPost, "/v1/user/password/reset", bytes.NewBuffer(jsonBytes), http.StatusBadRequest)
+}
+
+func TestForgotPasswordWithUnknownEmail(t *testing.T) {
+	deleteDatabase()
+
+	doRequestWithoutLogin(t, http.MethodPost, "/v1/user/password/forgot", bytes.NewBuffer([]byte(`{"email": "unknown@dummy.com"}`)), http.StatusAccepted)
+}
+
+func TestResetPasswordWithInvalidToken(t *testing.T) {
+	deleteDatabase()
+
+	jsonBytes, _ := json.Marshal(models.AccountTokenRequest{Token: "invalid", Password: "newpassword"})
+	rw := doRequestWithoutLogin(t, http.MethodPost, "/v1/user/password/reset", bytes.NewBuffer(jsonBytes), http.StatusBadRequest)
+
+	assert.EqualValues(t, []string{utils.ERROR_ACCOUNT_TOKEN_INVALID}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestResetPasswordWithInvalidPasswordKeepsToken(t *testing.T) {
+	deleteDatabase()
+
+	createAndLogUser(t, "dummyemail@dummy.com", "dummypassword")
+
+	doRequestWithoutLogin(t, http.MethodPost, "/v1/user/password/forgot", bytes.NewBuffer([]byte(`{"email": "dummyemail@dummy.com"}`)), http.StatusAccepted)
+	token := mailer.lastToken(t, "dummyemail@dummy.com")
+
+	jsonBytes, _ := json.Marshal(models.AccountTokenRequest{Token: token, Password: "dummyemail123"})
+	rw := doRequestWithoutLogin(t, http.MethodPost, "/v1/user/password/reset", bytes.NewBuffer(jsonBytes), http.StatusBadRequest)
+	assert.EqualValues(t, []string{utils.ERROR_PASSWORD_CONTAINS_EMAIL}, decodeApiResponse(t, rw).Errors)
+
+	// The token was not used by the refused password
+	jsonBytes, _ = json.Marshal(models.AccountTokenRequest{Token: token, Password: "newpassword"})
+	doRequestWithoutLogin(t, http.MethodPost, "/v1/user/password/reset", bytes.NewBuffer(jsonBytes), http.StatusNoContent)
+}
+
+func TestAdminEmailRequiresVerification(t *testing.T) {
+	deleteDatabase()
+
+	os.Setenv("ADMIN_EMAILS", "admin@dummy.com")
+	defer os.Unsetenv("ADMIN_EMAILS")
+
+	jsonBytes := []byte(`{"email": "admin@dummy.com", "password": "dummypassword"}`)
+	doRequestWithoutLogin(t, http.MethodPost, "/v1/user", bytes.NewBuffer(jsonBytes), http.StatusCreated)
+
+	var account models.Account
+	if err := json.Unmarshal(loginWithPassword(t, "admin@dummy.com", "dummypassword", http.StatusOK).Data, &account); err != nil {
+		t.Fatal(err)
+	}
+
+	// The admin role waits for the verification of the email
+	doRequestWithAuthorization(t, http.MethodGet, "/v1/admin/accounts", nil, "Bearer "+account.Token, http.StatusForbidden)
+
+	jsonBytes, _ = json.Marshal(models.AccountTokenRequest{Token: mailer.lastToken(t, "admin@dummy.com")})
+	doRequestWithoutLogin(t, http.MethodPost, "/v1/user/email/verify", bytes.NewBuffer(jsonBytes), http.StatusNoContent)
+
+	doRequestWithAuthorization(t, http.MethodGet, "/v1/admin/accounts", nil, "Bearer "+account.Token, http.StatusOK)
+}
@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"payments/app/models"
+	"payments/app/webhooks"
+	"payments/infrastructure"
+	"payments/utils"
+)
+
+// CreateWebhook handler to subscribe an url to the payment events of an organisation
+// Receives the url and the event types, and returns the secret signing the deliveries. The secret is only returned here
+var CreateWebhook = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	var subscription models.WebhookSubscription
+	if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+
+	// The organisation must exist and the user must be a member
+	if !checkPaymentOrganisation(w, r, models.Payment{OrganisationID: subscription.OrganisationID}) {
+		return
+	}
+
+	if errs := webhooks.ValidateSubscription(subscription); len(errs) > 0 {
+		utils.CreateApiErrorsResponse(w, errs, http.StatusBadRequest)
+		return
+	}
+
+	subscription.ID = uuid.NewV4()
+	subscription.Active = true
+	if err := subscription.GenerateSecret(); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if infrastructure.GetDB().Create(&subscription).Error != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	utils.CreateApiResponse(w, subscription, http.StatusCreated, webhookLinks(subscription))
+}
+
+// GetWebhooks handler to get the webhook subscriptions of an organisation (organisation_id parameter)
+// The subscriptions are returned without the secret
+var GetWebhooks = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	organisationID, err := utils.ConvertStringToUUID(r.URL.Query().Get("organisation_id"))
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_ORGANISATION_NOT_FOUND, http.StatusBadRequest)
+		return
+	}
+
+	// The organisation must exist and the user must be a member
+	if !checkPaymentOrganisation(w, r, models.Payment{OrganisationID: organisationID}) {
+		return
+	}
+
+	subscriptions, err := models.GetWebhookSubscriptions(organisationID)
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: "/v1/webhooks?organisation_id=" + organisationID.String(),
+	}}
+	for i := range subscriptions {
+		subscriptions[i].Secret = "" // Delete secret
+		links = append(links, utils.Link{
+			Rel:  subscriptions[i].ID.String(),
+			Href: fmt.Sprintf("/v1/webhooks/%s", subscriptions[i].ID.String()),
+		})
+	}
+	utils.CreateApiResponse(w, subscriptions, http.StatusOK, links)
+}
+
+// GetWebhook handler to get a single webhook subscription, without its secret
+var GetWebhook = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	subscription, ok := getWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	subscription.Secret = "" // Delete secret
+	utils.CreateApiResponse(w, subscription, http.StatusOK, webhookLinks(subscription))
+}
+
+// UpdateWebhook handler to change the url, the event types and the activation of a webhook subscription
+// An inactive subscription does not receive new events, the deliveries already created are still sent. The activation
+// is kept when active is missing
+var UpdateWebhook = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	subscription, ok := getWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	var changed struct {
+		models.WebhookSubscription
+		Active *bool `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&changed); err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_INVALID_JSON, http.StatusBadRequest)
+		return
+	}
+	if !uuid.Equal(changed.ID, uuid.Nil) && !uuid.Equal(changed.ID, subscription.ID) {
+		utils.CreateApiErrorResponse(w, utils.ERROR_ID_MISMATCH, http.StatusBadRequest)
+		return
+	}
+
+	if errs := webhooks.ValidateSubscription(changed.WebhookSubscription); len(errs) > 0 {
+		utils.CreateApiErrorsResponse(w, errs, http.StatusBadRequest)
+		return
+	}
+
+	// The organisation and the secret are kept
+	subscription.URL, subscription.Events = changed.URL, changed.Events
+	if changed.Active != nil {
+		subscription.Active = *changed.Active
+	}
+	if infrastructure.GetDB().Save(&subscription).Error != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	subscription.Secret = "" // Delete secret
+	utils.CreateApiResponse(w, subscription, http.StatusOK, webhookLinks(subscription))
+}
+
+// DeleteWebhook handler to delete a webhook subscription with its deliveries
+var DeleteWebhook = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	subscription, ok := getWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	tx := infrastructure.GetDB().Begin()
+	if err := tx.Where("subscription_id = ?", subscription.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		tx.Rollback()
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Delete(&subscription).Error; err != nil {
+		tx.Rollback()
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	utils.CreateApiResponse(w, nil, http.StatusNoContent, nil)
+}
+
+// GetWebhookDeliveries handler to get the delivery log of a webhook subscription, the latest first
+// The status parameter only returns the deliveries in that status, e.g. dead
+var GetWebhookDeliveries = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	subscription, ok := getWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := models.GetWebhookDeliveries(subscription.ID, r.URL.Query().Get("status"))
+	if err != nil {
+		utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	links := []utils.Link{{
+		Rel:  "self",
+		Href: fmt.Sprintf("/v1/webhooks/%s/deliveries", subscription.ID.String()),
+	}}
+	utils.CreateApiResponse(w, deliveries, http.StatusOK, links)
+}
+
+// RedeliverWebhook handler to send a delivery again, e.g. a dead delivery once the receiver is fixed
+// A new pending delivery of the same event is created, so the log keeps the previous one
+var RedeliverWebhook = func(w http.ResponseWriter, r *http.Request) {
+
+	infrastructure.LogApiRequest(r)
+
+	subscription, ok := getWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := utils.ConvertStringToUUID(mux.Vars(r)["delivery_id"])
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_REQUESTED_UUID_INVALID, http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := models.GetWebhookDeliveryByID(subscription.ID, deliveryID)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	redelivery := models.WebhookDelivery{
+		ID:             uuid.NewV4(),
+		SubscriptionID: delivery.SubscriptionID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		PaymentID:      delivery.PaymentID,
+		Payload:        delivery.Payload,
+		Status:         models.WEBHOOK_DELIVERY_PENDING,
+	}
+	if infrastructure.GetDB().Create(&redelivery).Error != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	links := []utils.Link{{
+		Rel:  "deliveries",
+		Href: fmt.Sprintf("/v1/webhooks/%s/deliveries", subscription.ID.String()),
+	}}
+	utils.CreateApiResponse(w, redelivery, http.StatusAccepted, links)
+}
+
+// getWebhook reads the webhook subscription of the id of the url, the user must be a member of its organisation
+func getWebhook(w http.ResponseWriter, r *http.Request) (models.WebhookSubscription, bool) {
+	id, err := utils.ConvertStringToUUID(mux.Vars(r)["id"])
+	if err != nil {
+		utils.CreateApiErrorResponse(w, utils.ERROR_REQUESTED_UUID_INVALID, http.StatusBadRequest)
+		return models.WebhookSubscription{}, false
+	}
+
+	subscription, err := models.GetWebhookSubscriptionByID(id)
+	if err != nil {
+		if err.Error() != utils.ERROR_SERVER {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusNotFound)
+		} else {
+			utils.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return subscription, false
+	}
+
+	return subscription, checkPaymentOrganisation(w, r, models.Payment{OrganisationID: subscription.OrganisationID})
+}
+
+func webhookLinks(subscription models.WebhookSubscription) []utils.Link {
+	return []utils.Link{{
+		Rel:  "self",
+		Href: fmt.Sprintf("/v1/webhooks/%s", subscription.ID.String()),
+	}, {
+		Rel:  "deliveries",
+		Href: fmt.Sprintf("/v1/webhooks/%s/deliveries", subscription.ID.String()),
+	}}
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"payments/app/models"
+	"payments/app/outbox"
+	"payments/app/webhooks"
+	"payments/infrastructure"
+	"payments/utils"
+	"strings"
+	"testing"
+	"time"
+)
+
+func webhookExample(url string, events ...string) []byte {
+	body, _ := json.Marshal(models.WebhookSubscription{OrganisationID: exampleOrganisationID, URL: url, Events: events})
+	return body
+}
+
+func decodeDeliveries(t *testing.T, response utils.Response) []models.WebhookDelivery {
+	deliveries := []models.WebhookDelivery{}
+	require.Nil(t, json.Unmarshal(response.Data, &deliveries))
+	return deliveries
+}
+
+func TestWebhook(t *testing.T) {
+
+	deleteDatabase()
+
+	// The receiver of the test is on the loopback address
+	os.Setenv("WEBHOOK_ALLOW_PRIVATE_URLS", "true")
+	defer os.Unsetenv("WEBHOOK_ALLOW_PRIVATE_URLS")
+
+	status := http.StatusInternalServerError
+	received := []webhooks.Event{}
+	receiver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		event := webhooks.Event{}
+		require.Nil(t, json.Unmarshal(body, &event))
+		received = append(received, event)
+		assert.True(t, strings.HasPrefix(r.Header.Get(webhooks.HEADER_SIGNATURE), "t="))
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	rw := doRequestWithLogin(t, http.MethodPost, "/v1/webhooks", bytes.NewBuffer(webhookExample(receiver.URL, models.EVENT_PAYMENT_CREATED)), http.StatusCreated)
+	subscription := models.WebhookSubscription{}
+	require.Nil(t, json.Unmarshal(decodeApiResponse(t, rw).Data, &subscription))
+	assert.True(t, strings.HasPrefix(subscription.Secret, "whsec_"))
+	assert.True(t, subscription.Active)
+
+	// The secret is only returned when the subscription is created
+	rw = doRequestWithLogin(t, http.MethodGet, fmt.Sprintf("/v1/webhooks/%s", subscription.ID), nil, http.StatusOK)
+	assert.NotContains(t, rw.Body.String(), subscription.Secret)
+
+	// A created payment is delivered, the updates are not subscribed
+	paymentID := uuid.NewV4()
+	doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(paymentExample(paymentID)), http.StatusCreated)
+	doRequestWithLogin(t, http.MethodPut, fmt.Sprintf("/v1/payments/%s", paymentID), bytes.NewBuffer(paymentExample(paymentID)), http.StatusOK)
+
+	// The deliveries are created when the outbox relay publishes the events
+	relayed, err := outbox.NewRelay().RelayDue(time.Now())
+	require.Nil(t, err)
+	assert.EqualValues(t, 2, relayed)
+
+	deliverer := webhooks.NewDeliverer()
+	deliverer.Client = receiver.Client()
+	deliverer.MaxAttempts = 1
+	delivered, err := deliverer.DeliverDue(time.Now())
+	require.Nil(t, err)
+	assert.EqualValues(t, 1, delivered)
+	require.Len(t, received, 1)
+	assert.EqualValues(t, models.EVENT_PAYMENT_CREATED, received[0].Type)
+	assert.EqualValues(t, paymentID, received[0].Data.ID)
+
+	// The receiver failed, so the delivery is dead after its only attempt
+	rw = doRequestWithLogin(t, http.MethodGet, fmt.Sprintf("/v1/webhooks/%s/deliveries?status=dead", subscription.ID), nil, http.StatusOK)
+	deliveries := decodeDeliveries(t, decodeApiResponse(t, rw))
+	require.Len(t, deliveries, 1)
+	assert.EqualValues(t, http.StatusInternalServerError, deliveries[0].ResponseStatus)
+
+	// Redelivered once the receiver is fixed
+	status = http.StatusNoContent
+	doRequestWithLogin(t, http.MethodPost, fmt.Sprintf("/v1/webhooks/%s/deliveries/%s/redeliver", subscription.ID, deliveries[0].ID), nil, http.StatusAccepted)
+	_, err = deliverer.DeliverDue(time.Now())
+	require.Nil(t, err)
+	require.Len(t, received, 2)
+	assert.EqualValues(t, received[0].ID, received[1].ID)
+
+	rw = doRequestWithLogin(t, http.MethodGet, fmt.Sprintf("/v1/webhooks/%s/deliveries", subscription.ID), nil, http.StatusOK)
+	deliveries = decodeDeliveries(t, decodeApiResponse(t, rw))
+	require.Len(t, deliveries, 2)
+	assert.EqualValues(t, models.WEBHOOK_DELIVERY_DELIVERED, deliveries[0].Status)
+
+	doRequestWithLogin(t, http.MethodDelete, fmt.Sprintf("/v1/webhooks/%s", subscription.ID), nil, http.StatusNoContent)
+	doRequestWithLogin(t, http.MethodGet, fmt.Sprintf("/v1/webhooks/%s/deliveries", subscription.ID), nil, http.StatusNotFound)
+}
+
+func TestUpdateWebhook(t *testing.T) {
+
+	deleteDatabase()
+
+	rw := doRequestWithLogin(t, http.MethodPost, "/v1/webhooks", bytes.NewBuffer(webhookExample("https://example.com/hooks", models.EVENT_PAYMENT_CREATED)), http.StatusCreated)
+	subscription := models.WebhookSubscription{}
+	require.Nil(t, json.Unmarshal(decodeApiResponse(t, rw).Data, &subscription))
+
+	body := []byte(`{"url": "https://example.com/v2/hooks", "events": ["payment.deleted"], "active": false}`)
+	rw = doRequestWithLogin(t, http.MethodPut, fmt.Sprintf("/v1/webhooks/%s", subscription.ID), bytes.NewBuffer(body), http.StatusOK)
+	updated := models.WebhookSubscription{}
+	require.Nil(t, json.Unmarshal(decodeApiResponse(t, rw).Data, &updated))
+	assert.EqualValues(t, "https://example.com/v2/hooks", updated.URL)
+	assert.EqualValues(t, []string{models.EVENT_PAYMENT_DELETED}, updated.Events)
+	assert.False(t, updated.Active)
+
+	// An inactive subscription does not receive the events
+	paymentID := uuid.NewV4()
+	doRequestWithLogin(t, http.MethodPost, "/v1/payments", bytes.NewBuffer(paymentExample(paymentID)), http.StatusCreated)
+	doRequestWithLogin(t, http.MethodDelete, fmt.Sprintf("/v1/payments/%s", paymentID), nil, http.StatusNoContent)
+	_, err := outbox.NewRelay().RelayDue(time.Now())
+	require.Nil(t, err)
+	rw = doRequestWithLogin(t, http.MethodGet, fmt.Sprintf("/v1/webhooks/%s/deliveries", subscription.ID), nil, http.StatusOK)
+	assert.Empty(t, decodeDeliveries(t, decodeApiResponse(t, rw)))
+
+	rw = doRequestWithLogin(t, http.MethodPut, fmt.Sprintf("/v1/webhooks/%s", subscription.ID), bytes.NewBufferString(`{"url": "example.com", "events": []}`), http.StatusBadRequest)
+	assert.EqualValues(t, []string{"url: " + utils.ERROR_WEBHOOK_URL_INVALID, "events: " + utils.ERROR_WEBHOOK_EVENTS_REQUIRED}, decodeApiResponse(t, rw).Errors)
+}
+
+func TestDeliverClaimedDelivery(t *testing.T) {
+
+	deleteDatabase()
+
+	received := 0
+	receiver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	// The delivery is being sent by another deliverer
+	subscription := models.WebhookSubscription{ID: uuid.NewV4(), OrganisationID: exampleOrganisationID, URL: receiver.URL, Events: []string{models.EVENT_PAYMENT_CREATED}, Secret: "whsec_secret", Active: true}
+	require.Nil(t, infrastructure.GetDB().Create(&subscription).Error)
+	claimedUntil := time.Now().Add(time.Minute)
+	delivery := models.WebhookDelivery{ID: uuid.NewV4(), SubscriptionID: subscription.ID, EventID: uuid.NewV4(), EventType: models.EVENT_PAYMENT_CREATED,
+		Payload: `{"type":"payment.created"}`, Status: models.WEBHOOK_DELIVERY_PENDING, Attempts: 1, NextAttemptAt: &claimedUntil, ClaimToken: "other"}
+	require.Nil(t, infrastructure.GetDB().Create(&delivery).Error)
+
+	deliverer := webhooks.NewDeliverer()
+	deliverer.Client = receiver.Client()
+	delivered, err := deliverer.DeliverDue(time.Now())
+	require.Nil(t, err)
+	assert.EqualValues(t, 0, delivered)
+	assert.EqualValues(t, 0, received)
+
+	// The claim of the other deliverer expired, the delivery is sent again with a new claim
+	delivered, err = deliverer.DeliverDue(time.Now().Add(2 * time.Minute))
+	require.Nil(t, err)
+	assert.EqualValues(t, 1, delivered)
+	assert.EqualValues(t, 1, received)
+
+	stored, err := models.GetWebhookDeliveryByID(subscription.ID, delivery.ID)
+	require.Nil(t, err)
+	assert.EqualValues(t, models.WEBHOOK_DELIVERY_DELIVERED, stored.Status)
+	assert.EqualValues(t, 2, stored.Attempts)
+	assert.Empty(t, stored.ClaimToken)
+}
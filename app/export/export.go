@@ -0,0 +1,49 @@
+package export
+
+import (
+	"errors"
+	"github.com/satori/go.uuid"
+	"os"
+	"payments/app/bacs"
+	"payments/app/iso20022"
+	"payments/app/models"
+	"payments/utils"
+	"strings"
+	"time"
+)
+
+// Formats of the payment exports
+const FORMAT_PACS008 = "pacs008"
+const FORMAT_BACS18 = "bacs18"
+
+// ErrNoPayments is returned when no payment can be exported in the format, the formats need at least one
+var ErrNoPayments = errors.New("no payments to export")
+
+// Export writes the payments in the format and returns the document with its content type
+// The bacs18 format only exports the Bacs payments, with the service user of BACS_SERVICE_USER_NUMBER and BACS_SERVICE_USER_NAME
+func Export(format string, payments []models.Payment, now time.Time) ([]byte, string, error) {
+	switch format {
+	case FORMAT_PACS008:
+		if len(payments) == 0 {
+			return nil, "", ErrNoPayments
+		}
+		document, err := iso20022.MarshalPacs008(strings.Replace(uuid.NewV4().String(), "-", "", -1), payments, now)
+		return document, "application/xml", err
+
+	case FORMAT_BACS18:
+		bacsPayments := []models.Payment{}
+		for _, payment := range payments {
+			if bacs.IsBacs(payment) {
+				bacsPayments = append(bacsPayments, payment)
+			}
+		}
+		if len(bacsPayments) == 0 {
+			return nil, "", ErrNoPayments
+		}
+		serviceUser := bacs.ServiceUser{Number: os.Getenv("BACS_SERVICE_USER_NUMBER"), Name: os.Getenv("BACS_SERVICE_USER_NAME")}
+		document, err := bacs.MarshalStandard18(bacsPayments, serviceUser, now)
+		return document, "text/plain", err
+	}
+
+	return nil, "", errors.New(utils.ERROR_EXPORT_FORMAT_INVALID)
+}
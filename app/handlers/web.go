@@ -10,10 +10,75 @@ import (
 var Routes = func(router *mux.Router) {
 	router.HandleFunc("/v1/user", controllers.CreateAccount).Methods(http.MethodPost)
 	router.HandleFunc("/v1/user/login", controllers.Authenticate).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/login/mfa", controllers.AuthenticateMFA).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/email/verify", controllers.VerifyEmail).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/email/verify/resend", controllers.ResendEmailVerification).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/password/forgot", controllers.ForgotPassword).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/password/reset", controllers.ResetPassword).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/me", controllers.GetMe).Methods(http.MethodGet)
+	router.HandleFunc("/v1/user/me", controllers.DeleteMe).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/user/me/password", controllers.ChangePassword).Methods(http.MethodPut)
+	router.HandleFunc("/v1/user/me/email", controllers.ChangeEmail).Methods(http.MethodPut)
+	router.HandleFunc("/v1/user/mfa/totp", controllers.EnrolTOTP).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/mfa/totp/confirm", controllers.ConfirmTOTP).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/mfa/totp", controllers.DisableTOTP).Methods(http.MethodDelete)
 	router.HandleFunc("/v1/payments", controllers.CreatePayment).Methods(http.MethodPost)
 	router.HandleFunc("/v1/payments", controllers.GetPayments).Methods(http.MethodGet)
+	router.HandleFunc("/v1/payments/import", controllers.ImportPayments).Methods(http.MethodPost)
+	router.HandleFunc("/v1/payments/export", controllers.ExportPayments).Methods(http.MethodGet)
 	router.HandleFunc("/v1/payments/{id}", controllers.GetPayment).Methods(http.MethodGet)
 	router.HandleFunc("/v1/payments/{id}", controllers.UpdatePayment).Methods(http.MethodPut)
 	router.HandleFunc("/v1/payments/{id}", controllers.DeletePayment).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/standing-orders", controllers.CreateStandingOrder).Methods(http.MethodPost)
+	router.HandleFunc("/v1/standing-orders", controllers.GetStandingOrders).Methods(http.MethodGet)
+	router.HandleFunc("/v1/standing-orders/{id}", controllers.GetStandingOrder).Methods(http.MethodGet)
+	router.HandleFunc("/v1/standing-orders/{id}", controllers.UpdateStandingOrder).Methods(http.MethodPut)
+	router.HandleFunc("/v1/standing-orders/{id}/pause", controllers.PauseStandingOrder).Methods(http.MethodPost)
+	router.HandleFunc("/v1/standing-orders/{id}/resume", controllers.ResumeStandingOrder).Methods(http.MethodPost)
+	router.HandleFunc("/v1/standing-orders/{id}/cancel", controllers.CancelStandingOrder).Methods(http.MethodPost)
+	router.HandleFunc("/v1/mandates", controllers.CreateMandate).Methods(http.MethodPost)
+	router.HandleFunc("/v1/mandates", controllers.GetMandates).Methods(http.MethodGet)
+	router.HandleFunc("/v1/mandates/{id}", controllers.GetMandate).Methods(http.MethodGet)
+	router.HandleFunc("/v1/mandates/{id}", controllers.UpdateMandate).Methods(http.MethodPut)
+	router.HandleFunc("/v1/mandates/{id}/cancel", controllers.CancelMandate).Methods(http.MethodPost)
+	router.HandleFunc("/v1/mandates/{id}/collections", controllers.CreateCollection).Methods(http.MethodPost)
+	router.HandleFunc("/v1/mandates/{id}/collections", controllers.GetCollections).Methods(http.MethodGet)
+	router.HandleFunc("/v1/webhooks", controllers.CreateWebhook).Methods(http.MethodPost)
+	router.HandleFunc("/v1/webhooks", controllers.GetWebhooks).Methods(http.MethodGet)
+	router.HandleFunc("/v1/webhooks/{id}", controllers.GetWebhook).Methods(http.MethodGet)
+	router.HandleFunc("/v1/webhooks/{id}", controllers.UpdateWebhook).Methods(http.MethodPut)
+	router.HandleFunc("/v1/webhooks/{id}", controllers.DeleteWebhook).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/webhooks/{id}/deliveries", controllers.GetWebhookDeliveries).Methods(http.MethodGet)
+	router.HandleFunc("/v1/webhooks/{id}/deliveries/{delivery_id}/redeliver", controllers.RedeliverWebhook).Methods(http.MethodPost)
+	router.HandleFunc("/v1/banks", controllers.GetBanks).Methods(http.MethodGet)
+	router.HandleFunc("/v1/calendars/{scheme}/next-business-day", controllers.GetNextBusinessDay).Methods(http.MethodGet)
+	router.HandleFunc("/v1/organisations", controllers.CreateOrganisation).Methods(http.MethodPost)
+	router.HandleFunc("/v1/organisations", controllers.GetOrganisations).Methods(http.MethodGet)
+	router.HandleFunc("/v1/organisations/invitations/accept", controllers.AcceptInvitation).Methods(http.MethodPost)
+	router.HandleFunc("/v1/organisations/{id}", controllers.GetOrganisation).Methods(http.MethodGet)
+	router.HandleFunc("/v1/organisations/{id}", controllers.UpdateOrganisation).Methods(http.MethodPut)
+	router.HandleFunc("/v1/organisations/{id}", controllers.DeleteOrganisation).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/organisations/{id}/members", controllers.GetMembers).Methods(http.MethodGet)
+	router.HandleFunc("/v1/organisations/{id}/members/{account_id}", controllers.UpdateMember).Methods(http.MethodPut)
+	router.HandleFunc("/v1/organisations/{id}/members/{account_id}", controllers.DeleteMember).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/organisations/{id}/invitations", controllers.CreateInvitation).Methods(http.MethodPost)
+	router.HandleFunc("/v1/organisations/{id}/invitations", controllers.GetInvitations).Methods(http.MethodGet)
+	router.HandleFunc("/v1/api-keys", controllers.CreateApiKey).Methods(http.MethodPost)
+	router.HandleFunc("/v1/api-keys", controllers.GetApiKeys).Methods(http.MethodGet)
+	router.HandleFunc("/v1/api-keys/{id}", controllers.RevokeApiKey).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/signing-keys", controllers.CreateSigningKey).Methods(http.MethodPost)
+	router.HandleFunc("/v1/signing-keys", controllers.GetSigningKeys).Methods(http.MethodGet)
+	router.HandleFunc("/v1/signing-keys/{id}", controllers.RevokeSigningKey).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/admin/accounts/{id}/certificates", controllers.CreateCertificate).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/certificates", controllers.GetCertificates).Methods(http.MethodGet)
+	router.HandleFunc("/v1/user/certificates/{id}", controllers.DeleteCertificate).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/admin/lockouts", controllers.GetLockouts).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/lockouts/{id}", controllers.ClearLockout).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/admin/accounts", controllers.GetAccounts).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/accounts/{id}/disable", controllers.DisableAccount).Methods(http.MethodPost)
+	router.HandleFunc("/v1/admin/accounts/{id}/enable", controllers.EnableAccount).Methods(http.MethodPost)
+	router.HandleFunc("/v1/admin/audit-events", controllers.GetAuditEvents).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/organisations/{id}/owner", controllers.ClaimOrganisation).Methods(http.MethodPost)
 	router.HandleFunc("/v1/health", controllers.HealthCheck).Methods(http.MethodGet)
+	router.HandleFunc("/.well-known/jwks.json", controllers.JWKS).Methods(http.MethodGet)
 }
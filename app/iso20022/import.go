@@ -0,0 +1,217 @@
+package iso20022
+
+import (
+	"github.com/satori/go.uuid"
+	"io"
+	"payments/app/banks"
+	"payments/app/calendar"
+	"payments/app/models"
+	"payments/app/schemes"
+	"payments/utils"
+	"strings"
+	"time"
+)
+
+// Status of the transactions of an import
+const TRANSACTION_CREATED = "created"
+const TRANSACTION_VALID = "valid"
+const TRANSACTION_DUPLICATE = "duplicate"
+const TRANSACTION_REJECTED = "rejected"
+
+// ImportResult is the result of the import of a pain.001 message, with the result of each transaction
+type ImportResult struct {
+	MessageID    string              `json:"message_id"`
+	Version      string              `json:"version"`
+	DryRun       bool                `json:"dry_run"`
+	Created      int                 `json:"created"`
+	Duplicates   int                 `json:"duplicates"`
+	Rejected     int                 `json:"rejected"`
+	Transactions []TransactionResult `json:"transactions"`
+}
+
+// TransactionResult is the result of the import of a CdtTrfTxInf
+type TransactionResult struct {
+	PaymentInformationID string     `json:"payment_information_id"`
+	EndToEndID           string     `json:"end_to_end_id"`
+	Status               string     `json:"status"`
+	PaymentID            *uuid.UUID `json:"payment_id,omitempty"`
+	Errors               []string   `json:"errors,omitempty"`
+	Warnings             []string   `json:"warnings,omitempty"`
+}
+
+// ValidationError is returned when the message can not be imported at all: invalid XML or invalid group header
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Errors, ", ")
+}
+
+// ImportPain001 parses the message and creates a payment of the organisation for each valid transaction
+// Invalid transactions are rejected without stopping the import. The payment ids are derived from the message,
+// payment information and end to end ids, so importing the same message again reports the payments as duplicates
+// The payments record the key that signed the import request, empty when it was not signed
+// With dryRun the transactions are only validated
+func ImportPain001(r io.Reader, organisationID uuid.UUID, signatureKeyID string, dryRun bool) (*ImportResult, error) {
+	document, err := ParsePain001(r)
+	if err != nil {
+		return nil, &ValidationError{Errors: []string{err.Error()}}
+	}
+	if errs := document.Validate(); len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+
+	header := document.Initiation.GroupHeader
+	result := &ImportResult{MessageID: strings.TrimSpace(header.MessageID), Version: document.Version(), DryRun: dryRun, Transactions: []TransactionResult{}}
+	seen := map[uuid.UUID]bool{}
+
+	for _, information := range document.Initiation.PaymentInformation {
+		informationErrors := information.Validate()
+
+		for _, transaction := range information.Transactions {
+			transactionResult := TransactionResult{
+				PaymentInformationID: strings.TrimSpace(information.PaymentInformationID),
+				EndToEndID:           strings.TrimSpace(transaction.PaymentID.EndToEndID),
+			}
+
+			errs := append(append([]string{}, informationErrors...), transaction.Validate()...)
+			if len(errs) > 0 {
+				transactionResult.Status, transactionResult.Errors = TRANSACTION_REJECTED, errs
+				result.add(transactionResult)
+				continue
+			}
+
+			payment := MapPayment(header, information, transaction, organisationID)
+			transactionResult.PaymentID = &payment.ID
+
+			// The payment must also follow the rules of its scheme, with the beneficiary bank completed by the bank directory
+			// and the requested execution date moved to a business day of the scheme
+			banks.GetDirectory().EnrichPayment(&payment)
+			transactionResult.Warnings = calendar.GetCalendars().RollPayment(&payment, time.Now())
+			if errs := schemes.ValidatePayment(payment); len(errs) > 0 {
+				transactionResult.Status, transactionResult.Errors = TRANSACTION_REJECTED, errs
+				result.add(transactionResult)
+				continue
+			}
+
+			if seen[payment.ID] {
+				transactionResult.Status = TRANSACTION_DUPLICATE
+				result.add(transactionResult)
+				continue
+			}
+			seen[payment.ID] = true
+
+			status, err := createPayment(payment, signatureKeyID, dryRun)
+			if err != nil {
+				return nil, err
+			}
+			transactionResult.Status = status
+			result.add(transactionResult)
+		}
+	}
+
+	return result, nil
+}
+
+func (result *ImportResult) add(transaction TransactionResult) {
+	switch transaction.Status {
+	case TRANSACTION_CREATED, TRANSACTION_VALID:
+		result.Created++
+	case TRANSACTION_DUPLICATE:
+		result.Duplicates++
+	case TRANSACTION_REJECTED:
+		result.Rejected++
+	}
+	result.Transactions = append(result.Transactions, transaction)
+}
+
+// createPayment creates the payment, signed by the key, unless it already exists
+func createPayment(payment models.Payment, signatureKeyID string, dryRun bool) (string, error) {
+	if _, err := models.GetPaymentByID(payment.ID); err == nil {
+		return TRANSACTION_DUPLICATE, nil
+	} else if err.Error() != utils.ERROR_RESOURCE_NOT_FOUND {
+		return "", err
+	}
+
+	if dryRun {
+		return TRANSACTION_VALID, nil
+	}
+
+	payment.SignatureKeyID = signatureKeyID
+	payment.Schedule()
+	if err := models.CreatePayment(&payment); err != nil {
+		return "", err
+	}
+	return TRANSACTION_CREATED, nil
+}
+
+// MapPayment maps a credit transfer transaction, with its payment information, into a payment
+func MapPayment(header GroupHeader, information PaymentInformation, transaction CreditTransferTransaction, organisationID uuid.UUID) models.Payment {
+	name := strings.Join([]string{header.MessageID, information.PaymentInformationID, transaction.PaymentID.EndToEndID}, "/")
+
+	payment := models.Payment{
+		Type:           "Payment",
+		ID:             uuid.NewV5(organisationID, strings.TrimSpace(name)),
+		OrganisationID: organisationID,
+		Attributes: models.Attributes{
+			Amount:            strings.TrimSpace(transaction.Amount.InstructedAmount.Value),
+			Currency:          transaction.Amount.InstructedAmount.Currency,
+			EndToEndReference: strings.TrimSpace(transaction.PaymentID.EndToEndID),
+			PaymentID:         strings.TrimSpace(transaction.PaymentID.InstructionID),
+			PaymentPurpose:    transaction.Purpose.Value(),
+			PaymentType:       "Credit",
+			ProcessingDate:    information.RequestedExecutionDate.String(),
+			DebtorParty:       models.DebtorParty{DebtorPartySkeleton: mapParty(&information.Debtor, information.DebtorAccount, information.DebtorAgent)},
+			BeneficiaryParty:  models.BeneficiaryParty{DebtorPartySkeleton: mapParty(transaction.Creditor, transaction.CreditorAccount, transaction.CreditorAgent)},
+			SponsorParty:      models.SponsorParty{SponsorPartySkeleton: &models.SponsorPartySkeleton{}},
+		},
+	}
+
+	// The payment type information of the transaction overrides the one of the payment information
+	typeInformation := information.PaymentTypeInformation
+	if transaction.PaymentTypeInformation != nil {
+		typeInformation = transaction.PaymentTypeInformation
+	}
+	if typeInformation != nil {
+		payment.Attributes.PaymentScheme = typeInformation.ServiceLevel.Value()
+		payment.Attributes.SchemePaymentType = typeInformation.LocalInstrument.Value()
+		payment.Attributes.SchemePaymentSubType = typeInformation.CategoryPurpose.Value()
+	}
+
+	payment.Attributes.ChargesInformation.BearerCode = information.ChargeBearer
+	if transaction.ChargeBearer != "" {
+		payment.Attributes.ChargesInformation.BearerCode = transaction.ChargeBearer
+	}
+
+	if transaction.ExchangeRate != nil {
+		payment.Attributes.FX.ExchangeRate = strings.TrimSpace(transaction.ExchangeRate.Rate)
+		payment.Attributes.FX.ContractReference = strings.TrimSpace(transaction.ExchangeRate.ContractID)
+	}
+
+	if transaction.RemittanceInformation != nil {
+		payment.Attributes.Reference = strings.TrimSpace(strings.Join(transaction.RemittanceInformation.Unstructured, " "))
+	}
+
+	return payment
+}
+
+func mapParty(party *Party, account *CashAccount, agent *Agent) *models.DebtorPartySkeleton {
+	accountNumber, accountNumberCode := account.Identification()
+	bankID, bankIDCode := agent.Identification()
+
+	skeleton := &models.DebtorPartySkeleton{
+		SponsorPartySkeleton: &models.SponsorPartySkeleton{AccountNumber: accountNumber, BankID: bankID, BankIDCode: bankIDCode},
+		AccountNumberCode:    accountNumberCode,
+	}
+	if party != nil {
+		skeleton.Name = strings.TrimSpace(party.Name)
+		skeleton.AccountName = skeleton.Name
+		skeleton.Address = party.PostalAddress.String()
+	}
+	if account != nil && strings.TrimSpace(account.Name) != "" {
+		skeleton.AccountName = strings.TrimSpace(account.Name)
+	}
+
+	return skeleton
+}
@@ -0,0 +1,310 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"math/big"
+	"payments/app/models"
+	"strings"
+	"time"
+)
+
+// Namespace of the FI to FI customer credit transfer
+const PACS008_V08 = "urn:iso:std:iso:20022:tech:xsd:pacs.008.001.08"
+
+// Settlement method of the exported transfers, settled through the clearing system of the payment scheme
+const PACS008_SETTLEMENT_METHOD = "CLRG"
+
+// The elements are written in the order of the schema, optional elements are omitted when empty
+type pacs008Document struct {
+	XMLName  xml.Name        `xml:"Document"`
+	Xmlns    string          `xml:"xmlns,attr"`
+	Transfer pacs008Transfer `xml:"FIToFICstmrCdtTrf"`
+}
+
+type pacs008Transfer struct {
+	GroupHeader  pacs008GroupHeader   `xml:"GrpHdr"`
+	Transactions []pacs008Transaction `xml:"CdtTrfTxInf"`
+}
+
+type pacs008GroupHeader struct {
+	MessageID                string          `xml:"MsgId"`
+	CreationDateTime         string          `xml:"CreDtTm"`
+	NumberOfTransactions     int             `xml:"NbOfTxs"`
+	ControlSum               string          `xml:"CtrlSum,omitempty"`
+	TotalInterbankSettlement *CurrencyAmount `xml:"TtlIntrBkSttlmAmt,omitempty"`
+	InterbankSettlementDate  string          `xml:"IntrBkSttlmDt,omitempty"`
+	SettlementInformation    struct {
+		SettlementMethod string `xml:"SttlmMtd"`
+	} `xml:"SttlmInf"`
+}
+
+type pacs008Transaction struct {
+	PaymentID               pacs008PaymentID       `xml:"PmtId"`
+	PaymentTypeInformation  *pacs008PaymentType    `xml:"PmtTpInf,omitempty"`
+	InterbankSettlement     CurrencyAmount         `xml:"IntrBkSttlmAmt"`
+	InterbankSettlementDate string                 `xml:"IntrBkSttlmDt,omitempty"`
+	InstructedAmount        *CurrencyAmount        `xml:"InstdAmt,omitempty"`
+	ExchangeRate            string                 `xml:"XchgRate,omitempty"`
+	ChargeBearer            string                 `xml:"ChrgBr"`
+	Charges                 []pacs008Charge        `xml:"ChrgsInf,omitempty"`
+	InstructingAgent        *pacs008Agent          `xml:"InstgAgt,omitempty"`
+	Debtor                  pacs008Party           `xml:"Dbtr"`
+	DebtorAccount           *pacs008Account        `xml:"DbtrAcct,omitempty"`
+	DebtorAgent             pacs008Agent           `xml:"DbtrAgt"`
+	DebtorAgentAccount      *pacs008Account        `xml:"DbtrAgtAcct,omitempty"`
+	CreditorAgent           pacs008Agent           `xml:"CdtrAgt"`
+	Creditor                pacs008Party           `xml:"Cdtr"`
+	CreditorAccount         *pacs008Account        `xml:"CdtrAcct,omitempty"`
+	InstructionForNextAgent []pacs008Instruction   `xml:"InstrForNxtAgt,omitempty"`
+	Purpose                 *pacs008Proprietary    `xml:"Purp,omitempty"`
+	RemittanceInformation   *RemittanceInformation `xml:"RmtInf,omitempty"`
+}
+
+type pacs008PaymentID struct {
+	InstructionID string `xml:"InstrId,omitempty"`
+	EndToEndID    string `xml:"EndToEndId"`
+	TransactionID string `xml:"TxId"`
+}
+
+type pacs008PaymentType struct {
+	ServiceLevel    *pacs008Proprietary `xml:"SvcLvl,omitempty"`
+	LocalInstrument *pacs008Proprietary `xml:"LclInstrm,omitempty"`
+	CategoryPurpose *pacs008Proprietary `xml:"CtgyPurp,omitempty"`
+}
+
+type pacs008Proprietary struct {
+	Proprietary string `xml:"Prtry"`
+}
+
+type pacs008Charge struct {
+	Amount CurrencyAmount `xml:"Amt"`
+	Agent  pacs008Agent   `xml:"Agt"`
+}
+
+type pacs008Instruction struct {
+	Information string `xml:"InstrInf"`
+}
+
+type pacs008Party struct {
+	Name          string          `xml:"Nm,omitempty"`
+	PostalAddress *pacs008Address `xml:"PstlAdr,omitempty"`
+}
+
+type pacs008Address struct {
+	AddressLines []string `xml:"AdrLine"`
+}
+
+type pacs008Account struct {
+	ID struct {
+		IBAN  string        `xml:"IBAN,omitempty"`
+		Other *pacs008Other `xml:"Othr,omitempty"`
+	} `xml:"Id"`
+	Name string `xml:"Nm,omitempty"`
+}
+
+type pacs008Other struct {
+	ID string `xml:"Id"`
+}
+
+type pacs008Agent struct {
+	FinancialInstitution struct {
+		BICFI                string                       `xml:"BICFI,omitempty"`
+		ClearingSystemMember *pacs008ClearingSystemMember `xml:"ClrSysMmbId,omitempty"`
+	} `xml:"FinInstnId"`
+}
+
+type pacs008ClearingSystemMember struct {
+	ClearingSystem *pacs008Code `xml:"ClrSysId,omitempty"`
+	MemberID       string       `xml:"MmbId"`
+}
+
+type pacs008Code struct {
+	Code string `xml:"Cd"`
+}
+
+// MarshalPacs008 writes the payments as one pacs.008.001.08 message
+// The group header totals the transactions: the number and control sum always, the total settlement amount
+// when every payment has the same currency and the settlement date when every payment has the same processing date
+func MarshalPacs008(messageID string, payments []models.Payment, now time.Time) ([]byte, error) {
+	document := pacs008Document{Xmlns: PACS008_V08}
+	header := &document.Transfer.GroupHeader
+	header.MessageID = truncate(messageID, 35)
+	header.CreationDateTime = now.UTC().Format("2006-01-02T15:04:05Z")
+	header.NumberOfTransactions = len(payments)
+	header.SettlementInformation.SettlementMethod = PACS008_SETTLEMENT_METHOD
+
+	sum := new(big.Rat)
+	decimals := 0
+	currency, date := "", ""
+	for i, payment := range payments {
+		attributes := payment.Attributes
+		value := strings.TrimSpace(attributes.Amount)
+		if amount, ok := new(big.Rat).SetString(value); ok {
+			sum.Add(sum, amount)
+		}
+		if index := strings.Index(value, "."); index >= 0 && len(value)-index-1 > decimals {
+			decimals = len(value) - index - 1
+		}
+		if i == 0 || currency == attributes.Currency {
+			currency = attributes.Currency
+		} else {
+			currency = "-"
+		}
+		if i == 0 || date == attributes.ProcessingDate {
+			date = attributes.ProcessingDate
+		} else {
+			date = "-"
+		}
+
+		document.Transfer.Transactions = append(document.Transfer.Transactions, newPacs008Transaction(payment))
+	}
+
+	header.ControlSum = sum.FloatString(decimals)
+	if currency != "-" && currency != "" {
+		header.TotalInterbankSettlement = &CurrencyAmount{Value: header.ControlSum, Currency: currency}
+	}
+	if date != "-" {
+		header.InterbankSettlementDate = date
+	}
+
+	output, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), output...), nil
+}
+
+func newPacs008Transaction(payment models.Payment) pacs008Transaction {
+	attributes := payment.Attributes
+
+	transaction := pacs008Transaction{
+		PaymentID: pacs008PaymentID{
+			InstructionID: truncate(attributes.PaymentID, 35),
+			EndToEndID:    truncate(attributes.EndToEndReference, 35),
+			TransactionID: strings.Replace(payment.ID.String(), "-", "", -1),
+		},
+		InterbankSettlement:     CurrencyAmount{Value: strings.TrimSpace(attributes.Amount), Currency: attributes.Currency},
+		InterbankSettlementDate: attributes.ProcessingDate,
+		ChargeBearer:            attributes.ChargesInformation.BearerCode,
+		Debtor:                  newPacs008Party(attributes.DebtorParty.DebtorPartySkeleton),
+		DebtorAccount:           newPacs008Account(attributes.DebtorParty.DebtorPartySkeleton),
+		DebtorAgent:             newPacs008Agent(sponsorSkeleton(attributes.DebtorParty.DebtorPartySkeleton)),
+		CreditorAgent:           newPacs008Agent(sponsorSkeleton(attributes.BeneficiaryParty.DebtorPartySkeleton)),
+		Creditor:                newPacs008Party(attributes.BeneficiaryParty.DebtorPartySkeleton),
+		CreditorAccount:         newPacs008Account(attributes.BeneficiaryParty.DebtorPartySkeleton),
+	}
+
+	if transaction.PaymentID.EndToEndID == "" {
+		transaction.PaymentID.EndToEndID = "NOTPROVIDED"
+	}
+	if !chargeBearers[transaction.ChargeBearer] {
+		transaction.ChargeBearer = "SHAR"
+	}
+
+	if attributes.PaymentScheme != "" || attributes.SchemePaymentType != "" || attributes.SchemePaymentSubType != "" {
+		transaction.PaymentTypeInformation = &pacs008PaymentType{
+			ServiceLevel:    newPacs008Proprietary(attributes.PaymentScheme),
+			LocalInstrument: newPacs008Proprietary(attributes.SchemePaymentType),
+			CategoryPurpose: newPacs008Proprietary(attributes.SchemePaymentSubType),
+		}
+	}
+
+	// The sponsor settles on behalf of the debtor agent, which holds an account with the sponsor
+	if sponsor := attributes.SponsorParty.SponsorPartySkeleton; sponsor != nil && sponsor.BankID != "" {
+		agent := newPacs008Agent(sponsor)
+		transaction.InstructingAgent = &agent
+		if sponsor.AccountNumber != "" {
+			transaction.DebtorAgentAccount = newPacs008Account(&models.DebtorPartySkeleton{SponsorPartySkeleton: sponsor})
+		}
+	}
+
+	// Charges deducted by the debtor agent and by the creditor agent
+	for _, charge := range attributes.ChargesInformation.SenderCharges {
+		transaction.Charges = append(transaction.Charges, pacs008Charge{Amount: CurrencyAmount{Value: charge.Amount, Currency: charge.Currency}, Agent: transaction.DebtorAgent})
+	}
+	if charges := attributes.ChargesInformation; charges.ReceiverChargesAmount != "" {
+		transaction.Charges = append(transaction.Charges, pacs008Charge{Amount: CurrencyAmount{Value: charges.ReceiverChargesAmount, Currency: charges.ReceiverChargesCurrency}, Agent: transaction.CreditorAgent})
+	}
+
+	// The instructed amount is the amount before the currency exchange
+	fx := attributes.FX
+	if fx.OriginalAmount != "" && fx.OriginalCurrency != "" {
+		transaction.InstructedAmount = &CurrencyAmount{Value: fx.OriginalAmount, Currency: fx.OriginalCurrency}
+	}
+	transaction.ExchangeRate = fx.ExchangeRate
+	if fx.ContractReference != "" {
+		transaction.InstructionForNextAgent = []pacs008Instruction{{Information: truncate("/FXREF/"+fx.ContractReference, 140)}}
+	}
+
+	transaction.Purpose = newPacs008Proprietary(attributes.PaymentPurpose)
+	if reference := strings.TrimSpace(attributes.Reference); reference != "" {
+		transaction.RemittanceInformation = &RemittanceInformation{Unstructured: []string{truncate(reference, 140)}}
+	}
+
+	return transaction
+}
+
+func sponsorSkeleton(skeleton *models.DebtorPartySkeleton) *models.SponsorPartySkeleton {
+	if skeleton == nil {
+		return nil
+	}
+	return skeleton.SponsorPartySkeleton
+}
+
+func newPacs008Party(skeleton *models.DebtorPartySkeleton) pacs008Party {
+	party := pacs008Party{}
+	if skeleton == nil {
+		return party
+	}
+	party.Name = truncate(skeleton.Name, 140)
+	if skeleton.Address != "" {
+		party.PostalAddress = &pacs008Address{AddressLines: []string{truncate(skeleton.Address, 70)}}
+	}
+	return party
+}
+
+func newPacs008Account(skeleton *models.DebtorPartySkeleton) *pacs008Account {
+	if skeleton == nil || skeleton.SponsorPartySkeleton == nil || skeleton.AccountNumber == "" {
+		return nil
+	}
+	account := &pacs008Account{Name: truncate(skeleton.AccountName, 70)}
+	if skeleton.AccountNumberCode == "IBAN" {
+		account.ID.IBAN = skeleton.AccountNumber
+	} else {
+		account.ID.Other = &pacs008Other{ID: skeleton.AccountNumber}
+	}
+	return account
+}
+
+// newPacs008Agent identifies the bank by BIC or, with other bank id codes, by clearing system member id
+func newPacs008Agent(skeleton *models.SponsorPartySkeleton) pacs008Agent {
+	agent := pacs008Agent{}
+	if skeleton == nil {
+		return agent
+	}
+	if skeleton.BankIDCode == "SWBIC" {
+		agent.FinancialInstitution.BICFI = skeleton.BankID
+		return agent
+	}
+	member := &pacs008ClearingSystemMember{MemberID: skeleton.BankID}
+	if skeleton.BankIDCode != "" {
+		member.ClearingSystem = &pacs008Code{Code: skeleton.BankIDCode}
+	}
+	agent.FinancialInstitution.ClearingSystemMember = member
+	return agent
+}
+
+func newPacs008Proprietary(value string) *pacs008Proprietary {
+	if value = strings.TrimSpace(value); value == "" {
+		return nil
+	}
+	return &pacs008Proprietary{Proprietary: truncate(value, 35)}
+}
+
+func truncate(value string, maxLength int) string {
+	value = strings.TrimSpace(value)
+	if runes := []rune(value); len(runes) > maxLength {
+		return string(runes[:maxLength])
+	}
+	return value
+}
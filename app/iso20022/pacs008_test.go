@@ -0,0 +1,161 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"payments/app/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func examplePayment(amount string, currency string, processingDate string) models.Payment {
+	return models.Payment{
+		Type:           "Payment",
+		ID:             uuid.FromStringOrNil("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"),
+		OrganisationID: organisationID,
+		Attributes: models.Attributes{
+			Amount:   amount,
+			Currency: currency,
+			BeneficiaryParty: models.BeneficiaryParty{DebtorPartySkeleton: &models.DebtorPartySkeleton{
+				SponsorPartySkeleton: &models.SponsorPartySkeleton{AccountNumber: "31926819", BankID: "403000", BankIDCode: "GBDSC"},
+				AccountName:          "W Owens",
+				AccountNumberCode:    "BBAN",
+				Address:              "1 The Beneficiary Localtown SE2",
+				Name:                 "Wilfred Jeremiah Owens",
+			}},
+			ChargesInformation: models.ChargesInformation{
+				BearerCode:              "SHAR",
+				SenderCharges:           []models.Charge{{Amount: "5.00", Currency: "GBP"}, {Amount: "10.00", Currency: "USD"}},
+				ReceiverChargesAmount:   "1.00",
+				ReceiverChargesCurrency: "USD",
+			},
+			DebtorParty: models.DebtorParty{DebtorPartySkeleton: &models.DebtorPartySkeleton{
+				SponsorPartySkeleton: &models.SponsorPartySkeleton{AccountNumber: "GB29XABC10161234567801", BankID: "XABCGB2L", BankIDCode: "SWBIC"},
+				AccountName:          "EJ Brown Black",
+				AccountNumberCode:    "IBAN",
+				Address:              "10 Debtor Crescent Sourcetown NE1",
+				Name:                 "Emelia Jane Brown",
+			}},
+			EndToEndReference:    "Wil piano Jan",
+			FX:                   models.FX{ContractReference: "FX123", ExchangeRate: "2.00000", OriginalAmount: "200.42", OriginalCurrency: "USD"},
+			PaymentID:            "123456789012345678",
+			PaymentPurpose:       "Paying for goods/services",
+			PaymentScheme:        "FPS",
+			PaymentType:          "Credit",
+			ProcessingDate:       processingDate,
+			Reference:            "Payment for Em's piano lessons",
+			SchemePaymentSubType: "InternetBanking",
+			SchemePaymentType:    "ImmediatePayment",
+			SponsorParty:         models.SponsorParty{SponsorPartySkeleton: &models.SponsorPartySkeleton{AccountNumber: "56781234", BankID: "123123", BankIDCode: "GBDSC"}},
+		},
+	}
+}
+
+// decodePacs008 reads the message back with the structure of the schema
+func decodePacs008(t *testing.T, document []byte) pacs008Document {
+	decoded := pacs008Document{}
+	if err := xml.Unmarshal(document, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestMarshalPacs008(t *testing.T) {
+	now := time.Date(2017, 1, 17, 9, 30, 47, 0, time.UTC)
+	document, err := MarshalPacs008("MSG-1", []models.Payment{examplePayment("100.21", "GBP", "2017-01-18")}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, strings.HasPrefix(string(document), xml.Header))
+	assert.Contains(t, string(document), `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pacs.008.001.08">`)
+
+	decoded := decodePacs008(t, document)
+	header := decoded.Transfer.GroupHeader
+	assert.EqualValues(t, "MSG-1", header.MessageID)
+	assert.EqualValues(t, "2017-01-17T09:30:47Z", header.CreationDateTime)
+	assert.EqualValues(t, 1, header.NumberOfTransactions)
+	assert.EqualValues(t, "100.21", header.ControlSum)
+	assert.EqualValues(t, &CurrencyAmount{Value: "100.21", Currency: "GBP"}, header.TotalInterbankSettlement)
+	assert.EqualValues(t, "2017-01-18", header.InterbankSettlementDate)
+	assert.EqualValues(t, "CLRG", header.SettlementInformation.SettlementMethod)
+
+	transaction := decoded.Transfer.Transactions[0]
+	assert.EqualValues(t, pacs008PaymentID{InstructionID: "123456789012345678", EndToEndID: "Wil piano Jan", TransactionID: "4ee3a8d8ca7b4290a52cdd5b6165ec43"}, transaction.PaymentID)
+	assert.EqualValues(t, "FPS", transaction.PaymentTypeInformation.ServiceLevel.Proprietary)
+	assert.EqualValues(t, "ImmediatePayment", transaction.PaymentTypeInformation.LocalInstrument.Proprietary)
+	assert.EqualValues(t, CurrencyAmount{Value: "100.21", Currency: "GBP"}, transaction.InterbankSettlement)
+	assert.EqualValues(t, "SHAR", transaction.ChargeBearer)
+
+	// Debtor with IBAN and BIC, creditor with account number and sort code
+	assert.EqualValues(t, "Emelia Jane Brown", transaction.Debtor.Name)
+	assert.EqualValues(t, "GB29XABC10161234567801", transaction.DebtorAccount.ID.IBAN)
+	assert.EqualValues(t, "XABCGB2L", transaction.DebtorAgent.FinancialInstitution.BICFI)
+	assert.EqualValues(t, "31926819", transaction.CreditorAccount.ID.Other.ID)
+	assert.EqualValues(t, "W Owens", transaction.CreditorAccount.Name)
+	assert.EqualValues(t, "403000", transaction.CreditorAgent.FinancialInstitution.ClearingSystemMember.MemberID)
+	assert.EqualValues(t, "GBDSC", transaction.CreditorAgent.FinancialInstitution.ClearingSystemMember.ClearingSystem.Code)
+
+	// The sponsor instructs the transfer and holds the account of the debtor agent
+	assert.EqualValues(t, "123123", transaction.InstructingAgent.FinancialInstitution.ClearingSystemMember.MemberID)
+	assert.EqualValues(t, "56781234", transaction.DebtorAgentAccount.ID.Other.ID)
+
+	// Sender charges taken by the debtor agent, receiver charges by the creditor agent
+	assert.Len(t, transaction.Charges, 3)
+	assert.EqualValues(t, CurrencyAmount{Value: "10.00", Currency: "USD"}, transaction.Charges[1].Amount)
+	assert.EqualValues(t, "XABCGB2L", transaction.Charges[1].Agent.FinancialInstitution.BICFI)
+	assert.EqualValues(t, "403000", transaction.Charges[2].Agent.FinancialInstitution.ClearingSystemMember.MemberID)
+
+	assert.EqualValues(t, &CurrencyAmount{Value: "200.42", Currency: "USD"}, transaction.InstructedAmount)
+	assert.EqualValues(t, "2.00000", transaction.ExchangeRate)
+	assert.EqualValues(t, []pacs008Instruction{{Information: "/FXREF/FX123"}}, transaction.InstructionForNextAgent)
+	assert.EqualValues(t, "Paying for goods/services", transaction.Purpose.Proprietary)
+	assert.EqualValues(t, []string{"Payment for Em's piano lessons"}, transaction.RemittanceInformation.Unstructured)
+}
+
+func TestMarshalPacs008GroupHeaderTotals(t *testing.T) {
+	payments := []models.Payment{examplePayment("100.21", "GBP", "2017-01-18"), examplePayment("0.7", "GBP", "2017-01-18")}
+
+	document, err := MarshalPacs008("MSG-1", payments, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := decodePacs008(t, document).Transfer.GroupHeader
+	assert.EqualValues(t, 2, header.NumberOfTransactions)
+	assert.EqualValues(t, "100.91", header.ControlSum)
+	assert.EqualValues(t, &CurrencyAmount{Value: "100.91", Currency: "GBP"}, header.TotalInterbankSettlement)
+
+	// The total settlement amount and date are only written when every transaction shares them
+	payments = append(payments, examplePayment("10", "EUR", "2017-01-19"))
+	document, err = MarshalPacs008("MSG-2", payments, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	header = decodePacs008(t, document).Transfer.GroupHeader
+	assert.EqualValues(t, "110.91", header.ControlSum)
+	assert.Nil(t, header.TotalInterbankSettlement)
+	assert.Empty(t, header.InterbankSettlementDate)
+	assert.NotContains(t, string(document), "<TtlIntrBkSttlmAmt")
+}
+
+func TestMarshalPacs008WithoutOptionalElements(t *testing.T) {
+	payment := examplePayment("100.21", "GBP", "2017-01-18")
+	payment.Attributes.EndToEndReference = ""
+	payment.Attributes.ChargesInformation = models.ChargesInformation{}
+	payment.Attributes.FX = models.FX{}
+	payment.Attributes.SponsorParty = models.SponsorParty{}
+
+	document, err := MarshalPacs008("MSG-1", []models.Payment{payment}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transaction := decodePacs008(t, document).Transfer.Transactions[0]
+	assert.EqualValues(t, "NOTPROVIDED", transaction.PaymentID.EndToEndID)
+	assert.EqualValues(t, "SHAR", transaction.ChargeBearer)
+	for _, element := range []string{"<ChrgsInf>", "<InstgAgt>", "<DbtrAgtAcct>", "<InstdAmt", "<XchgRate>", "<InstrForNxtAgt>"} {
+		assert.NotContains(t, string(document), element)
+	}
+}
@@ -0,0 +1,431 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Namespaces of the supported versions of the customer credit transfer initiation
+const PAIN001_V03 = "urn:iso:std:iso:20022:tech:xsd:pain.001.001.03"
+const PAIN001_V09 = "urn:iso:std:iso:20022:tech:xsd:pain.001.001.09"
+
+// Pain001 is a pain.001 document. The elements are matched by local name, so both versions share the types
+type Pain001 struct {
+	XMLName    xml.Name
+	Initiation CustomerCreditTransferInitiation `xml:"CstmrCdtTrfInitn"`
+}
+
+type CustomerCreditTransferInitiation struct {
+	GroupHeader        GroupHeader          `xml:"GrpHdr"`
+	PaymentInformation []PaymentInformation `xml:"PmtInf"`
+}
+
+type GroupHeader struct {
+	MessageID            string     `xml:"MsgId"`
+	CreationDateTime     string     `xml:"CreDtTm"`
+	NumberOfTransactions string     `xml:"NbOfTxs"`
+	ControlSum           string     `xml:"CtrlSum"`
+	InitiatingParty      *PartyName `xml:"InitgPty"`
+}
+
+type PaymentInformation struct {
+	PaymentInformationID   string                      `xml:"PmtInfId"`
+	PaymentMethod          string                      `xml:"PmtMtd"`
+	NumberOfTransactions   string                      `xml:"NbOfTxs"`
+	ControlSum             string                      `xml:"CtrlSum"`
+	PaymentTypeInformation *PaymentTypeInformation     `xml:"PmtTpInf"`
+	RequestedExecutionDate DateChoice                  `xml:"ReqdExctnDt"`
+	Debtor                 Party                       `xml:"Dbtr"`
+	DebtorAccount          *CashAccount                `xml:"DbtrAcct"`
+	DebtorAgent            *Agent                      `xml:"DbtrAgt"`
+	ChargeBearer           string                      `xml:"ChrgBr"`
+	Transactions           []CreditTransferTransaction `xml:"CdtTrfTxInf"`
+}
+
+type PaymentTypeInformation struct {
+	ServiceLevel        *Code  `xml:"SvcLvl"`
+	LocalInstrument     *Code  `xml:"LclInstrm"`
+	CategoryPurpose     *Code  `xml:"CtgyPurp"`
+	InstructionPriority string `xml:"InstrPrty"`
+}
+
+type CreditTransferTransaction struct {
+	PaymentID              PaymentIdentification   `xml:"PmtId"`
+	PaymentTypeInformation *PaymentTypeInformation `xml:"PmtTpInf"`
+	Amount                 Amount                  `xml:"Amt"`
+	ExchangeRate           *ExchangeRate           `xml:"XchgRateInf"`
+	ChargeBearer           string                  `xml:"ChrgBr"`
+	CreditorAgent          *Agent                  `xml:"CdtrAgt"`
+	Creditor               *Party                  `xml:"Cdtr"`
+	CreditorAccount        *CashAccount            `xml:"CdtrAcct"`
+	Purpose                *Code                   `xml:"Purp"`
+	RemittanceInformation  *RemittanceInformation  `xml:"RmtInf"`
+}
+
+type PaymentIdentification struct {
+	InstructionID string `xml:"InstrId"`
+	EndToEndID    string `xml:"EndToEndId"`
+}
+
+type Amount struct {
+	InstructedAmount *CurrencyAmount `xml:"InstdAmt"`
+}
+
+type CurrencyAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type ExchangeRate struct {
+	Rate       string `xml:"XchgRate"`
+	ContractID string `xml:"CtrctId"`
+}
+
+type RemittanceInformation struct {
+	Unstructured []string `xml:"Ustrd"`
+}
+
+type PartyName struct {
+	Name string `xml:"Nm"`
+}
+
+type Party struct {
+	Name          string         `xml:"Nm"`
+	PostalAddress *PostalAddress `xml:"PstlAdr"`
+}
+
+type PostalAddress struct {
+	StreetName     string   `xml:"StrtNm"`
+	BuildingNumber string   `xml:"BldgNb"`
+	PostCode       string   `xml:"PstCd"`
+	TownName       string   `xml:"TwnNm"`
+	Country        string   `xml:"Ctry"`
+	AddressLines   []string `xml:"AdrLine"`
+}
+
+type CashAccount struct {
+	ID       AccountIdentification `xml:"Id"`
+	Currency string                `xml:"Ccy"`
+	Name     string                `xml:"Nm"`
+}
+
+type AccountIdentification struct {
+	IBAN  string `xml:"IBAN"`
+	Other *struct {
+		ID string `xml:"Id"`
+	} `xml:"Othr"`
+}
+
+// Agent is a financial institution, identified by BIC (BICFI since version 09) or a clearing system member id
+type Agent struct {
+	FinancialInstitution struct {
+		BIC                  string `xml:"BIC"`
+		BICFI                string `xml:"BICFI"`
+		ClearingSystemMember *struct {
+			ClearingSystem *Code  `xml:"ClrSysId"`
+			MemberID       string `xml:"MmbId"`
+		} `xml:"ClrSysMmbId"`
+	} `xml:"FinInstnId"`
+}
+
+type Code struct {
+	Code        string `xml:"Cd"`
+	Proprietary string `xml:"Prtry"`
+}
+
+// DateChoice is an ISO date until version 08 and a choice of date or date time since version 09
+type DateChoice struct {
+	Value    string `xml:",chardata"`
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// String returns the date in the YYYY-MM-DD format
+func (d DateChoice) String() string {
+	if d.Date != "" {
+		return strings.TrimSpace(d.Date)
+	}
+	if dateTime := strings.TrimSpace(d.DateTime); len(dateTime) >= 10 {
+		return dateTime[:10]
+	}
+	return strings.TrimSpace(d.Value)
+}
+
+// Value returns the code or, without code, the proprietary value
+func (c *Code) Value() string {
+	if c == nil {
+		return ""
+	}
+	if c.Code != "" {
+		return c.Code
+	}
+	return c.Proprietary
+}
+
+// Identification returns the account number and its type: IBAN or BBAN for other identifications
+func (a *CashAccount) Identification() (string, string) {
+	if a == nil {
+		return "", ""
+	}
+	if a.ID.IBAN != "" {
+		return strings.TrimSpace(a.ID.IBAN), "IBAN"
+	}
+	if a.ID.Other != nil {
+		return strings.TrimSpace(a.ID.Other.ID), "BBAN"
+	}
+	return "", ""
+}
+
+// Identification returns the bank id and its type: the clearing system (e.g. GBDSC for sort codes) or SWBIC for BICs
+func (a *Agent) Identification() (string, string) {
+	if a == nil {
+		return "", ""
+	}
+	institution := a.FinancialInstitution
+	if member := institution.ClearingSystemMember; member != nil && member.MemberID != "" {
+		return strings.TrimSpace(member.MemberID), member.ClearingSystem.Value()
+	}
+	if institution.BICFI != "" {
+		return strings.TrimSpace(institution.BICFI), "SWBIC"
+	}
+	if institution.BIC != "" {
+		return strings.TrimSpace(institution.BIC), "SWBIC"
+	}
+	return "", ""
+}
+
+// String returns the address in one line
+func (a *PostalAddress) String() string {
+	if a == nil {
+		return ""
+	}
+	parts := []string{}
+	for _, part := range append(append([]string{}, a.AddressLines...), a.StreetName, a.BuildingNumber, a.TownName, a.PostCode, a.Country) {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParsePain001 reads a pain.001.001.03 or pain.001.001.09 document
+func ParsePain001(r io.Reader) (*Pain001, error) {
+	document := &Pain001{}
+	if err := xml.NewDecoder(r).Decode(document); err != nil {
+		return nil, fmt.Errorf("invalid XML: %s", err)
+	}
+
+	if document.XMLName.Local != "Document" || (document.XMLName.Space != PAIN001_V03 && document.XMLName.Space != PAIN001_V09) {
+		return nil, errors.New("unsupported message, expected a pain.001.001.03 or pain.001.001.09 Document")
+	}
+
+	return document, nil
+}
+
+// Version returns the version of the message, e.g. pain.001.001.03
+func (d *Pain001) Version() string {
+	return d.XMLName.Space[strings.LastIndex(d.XMLName.Space, ":")+1:]
+}
+
+var amountPattern = regexp.MustCompile(`^[0-9]{1,13}(\.[0-9]{1,5})?$`)
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+var ibanPattern = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[a-zA-Z0-9]{1,30}$`)
+var bicPattern = regexp.MustCompile(`^[A-Z]{6}[A-Z2-9][A-NP-Z0-9]([A-Z0-9]{3})?$`)
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+var chargeBearers = map[string]bool{"DEBT": true, "CRED": true, "SHAR": true, "SLEV": true}
+
+// Validate checks the group header: the MsgId, CreDtTm and InitgPty elements are required, the MsgId has at most 35
+// characters, and the number of transactions and the control sum match the payment information
+// The message is not validated against the XSD, only the constraints checked by the Validate methods are enforced
+func (d *Pain001) Validate() []string {
+	header := d.Initiation.GroupHeader
+	errs := []string{}
+
+	errs = append(errs, validateText("GrpHdr/MsgId", header.MessageID, 35, true)...)
+	if creationDateTime := strings.TrimSpace(header.CreationDateTime); len(creationDateTime) < 19 || !isDateTime(creationDateTime[:19]) {
+		errs = append(errs, "GrpHdr/CreDtTm must be an ISO date time")
+	}
+	if header.InitiatingParty == nil {
+		errs = append(errs, "GrpHdr/InitgPty is required")
+	}
+	if len(d.Initiation.PaymentInformation) == 0 {
+		errs = append(errs, "PmtInf is required")
+	}
+
+	transactions := []CreditTransferTransaction{}
+	for _, information := range d.Initiation.PaymentInformation {
+		transactions = append(transactions, information.Transactions...)
+	}
+	errs = append(errs, validateTotals("GrpHdr", header.NumberOfTransactions, header.ControlSum, transactions)...)
+
+	return errs
+}
+
+// Validate checks the payment information, without its transactions: the required elements, the lengths of the
+// identifier and the names, the payment method, the dates, the debtor account (IBAN) and agent (BIC) and the totals
+func (p *PaymentInformation) Validate() []string {
+	path := fmt.Sprintf("PmtInf[%s]", p.PaymentInformationID)
+	errs := validateText("PmtInf/PmtInfId", p.PaymentInformationID, 35, true)
+
+	if p.PaymentMethod != "TRF" {
+		errs = append(errs, path+"/PmtMtd must be TRF")
+	}
+	if _, err := time.Parse("2006-01-02", p.RequestedExecutionDate.String()); err != nil {
+		errs = append(errs, path+"/ReqdExctnDt must be an ISO date")
+	}
+	errs = append(errs, validateText(path+"/Dbtr/Nm", p.Debtor.Name, 140, true)...)
+	errs = append(errs, validateAddress(path+"/Dbtr/PstlAdr", p.Debtor.PostalAddress)...)
+	errs = append(errs, validateAccount(path+"/DbtrAcct", p.DebtorAccount, true)...)
+	errs = append(errs, validateAgent(path+"/DbtrAgt", p.DebtorAgent, true)...)
+	if p.ChargeBearer != "" && !chargeBearers[p.ChargeBearer] {
+		errs = append(errs, path+"/ChrgBr must be DEBT, CRED, SHAR or SLEV")
+	}
+	if len(p.Transactions) == 0 {
+		errs = append(errs, path+"/CdtTrfTxInf is required")
+	}
+	errs = append(errs, validateTotals(path, p.NumberOfTransactions, p.ControlSum, p.Transactions)...)
+
+	return errs
+}
+
+// Validate checks the transaction: the required elements, the lengths of the identifiers, names and remittance
+// information, the amount and its currency, the creditor account (IBAN) and agent (BIC) and the charge bearer
+// The creditor account is optional in the schema but required to create the payment
+func (t *CreditTransferTransaction) Validate() []string {
+	errs := validateText("PmtId/EndToEndId", t.PaymentID.EndToEndID, 35, true)
+	errs = append(errs, validateText("PmtId/InstrId", t.PaymentID.InstructionID, 35, false)...)
+
+	if amount := t.Amount.InstructedAmount; amount == nil {
+		errs = append(errs, "Amt/InstdAmt is required")
+	} else {
+		if value, err := strconv.ParseFloat(strings.TrimSpace(amount.Value), 64); !amountPattern.MatchString(strings.TrimSpace(amount.Value)) || err != nil || value <= 0 {
+			errs = append(errs, "Amt/InstdAmt must be a positive amount with up to 5 decimals")
+		}
+		if !currencyPattern.MatchString(amount.Currency) {
+			errs = append(errs, "Amt/InstdAmt/@Ccy must be an ISO 4217 currency code")
+		}
+	}
+
+	if t.ChargeBearer != "" && !chargeBearers[t.ChargeBearer] {
+		errs = append(errs, "ChrgBr must be DEBT, CRED, SHAR or SLEV")
+	}
+	if t.Creditor == nil {
+		errs = append(errs, "Cdtr is required")
+	} else {
+		errs = append(errs, validateText("Cdtr/Nm", t.Creditor.Name, 140, true)...)
+		errs = append(errs, validateAddress("Cdtr/PstlAdr", t.Creditor.PostalAddress)...)
+	}
+	errs = append(errs, validateAccount("CdtrAcct", t.CreditorAccount, true)...)
+	errs = append(errs, validateAgent("CdtrAgt", t.CreditorAgent, false)...)
+
+	if t.RemittanceInformation != nil {
+		for _, line := range t.RemittanceInformation.Unstructured {
+			errs = append(errs, validateText("RmtInf/Ustrd", line, 140, false)...)
+		}
+	}
+
+	return errs
+}
+
+func validateText(path string, value string, maxLength int, required bool) []string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		if required {
+			return []string{path + " is required"}
+		}
+		return nil
+	}
+	if len([]rune(value)) > maxLength {
+		return []string{fmt.Sprintf("%s must have at most %d characters", path, maxLength)}
+	}
+	return nil
+}
+
+func validateAddress(path string, address *PostalAddress) []string {
+	if address == nil {
+		return nil
+	}
+	errs := []string{}
+	if address.Country != "" && !countryPattern.MatchString(address.Country) {
+		errs = append(errs, path+"/Ctry must be an ISO 3166 country code")
+	}
+	if len(address.AddressLines) > 7 {
+		errs = append(errs, path+"/AdrLine must have at most 7 lines")
+	}
+	for _, line := range address.AddressLines {
+		errs = append(errs, validateText(path+"/AdrLine", line, 70, false)...)
+	}
+	return errs
+}
+
+func validateAccount(path string, account *CashAccount, required bool) []string {
+	number, code := account.Identification()
+	if number == "" {
+		if required {
+			return []string{path + "/Id is required"}
+		}
+		return nil
+	}
+	if code == "IBAN" && !ibanPattern.MatchString(number) {
+		return []string{path + "/Id/IBAN is not a valid IBAN"}
+	}
+	return validateText(path+"/Id/Othr/Id", number, 34, true)
+}
+
+func validateAgent(path string, agent *Agent, required bool) []string {
+	id, code := agent.Identification()
+	if id == "" {
+		if required {
+			return []string{path + "/FinInstnId is required"}
+		}
+		return nil
+	}
+	if code == "SWBIC" && !bicPattern.MatchString(id) {
+		return []string{path + "/FinInstnId/BIC is not a valid BIC"}
+	}
+	return validateText(path+"/FinInstnId/ClrSysMmbId/MmbId", id, 35, true)
+}
+
+// validateTotals checks the optional number of transactions and control sum
+func validateTotals(path string, numberOfTransactions string, controlSum string, transactions []CreditTransferTransaction) []string {
+	errs := []string{}
+
+	if numberOfTransactions == "" && path == "GrpHdr" {
+		errs = append(errs, "GrpHdr/NbOfTxs is required")
+	} else if numberOfTransactions != "" {
+		if count, err := strconv.Atoi(strings.TrimSpace(numberOfTransactions)); err != nil || count != len(transactions) {
+			errs = append(errs, fmt.Sprintf("%s/NbOfTxs does not match the %d transactions", path, len(transactions)))
+		}
+	}
+
+	if controlSum != "" {
+		var sum float64
+		for _, transaction := range transactions {
+			if amount := transaction.Amount.InstructedAmount; amount != nil {
+				value, _ := strconv.ParseFloat(strings.TrimSpace(amount.Value), 64)
+				sum += value
+			}
+		}
+		if expected, err := strconv.ParseFloat(strings.TrimSpace(controlSum), 64); err != nil || !amountsEqual(expected, sum) {
+			errs = append(errs, fmt.Sprintf("%s/CtrlSum does not match the sum of the transactions", path))
+		}
+	}
+
+	return errs
+}
+
+func amountsEqual(a float64, b float64) bool {
+	diff := a - b
+	return diff < 0.000005 && diff > -0.000005
+}
+
+func isDateTime(value string) bool {
+	_, err := time.Parse("2006-01-02T15:04:05", value)
+	return err == nil
+}
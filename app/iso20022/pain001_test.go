@@ -0,0 +1,157 @@
+package iso20022
+
+import (
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+)
+
+var organisationID = uuid.FromStringOrNil("743d5b63-8e6f-432e-a8fa-c5d8d2ee5fcb")
+
+func parseFile(t *testing.T, name string) *Pain001 {
+	file, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	document, err := ParsePain001(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
+
+func TestParsePain001V03(t *testing.T) {
+	document := parseFile(t, "pain.001.001.03.xml")
+
+	assert.EqualValues(t, "pain.001.001.03", document.Version())
+	assert.Empty(t, document.Validate())
+
+	information := document.Initiation.PaymentInformation[0]
+	assert.Empty(t, information.Validate())
+	assert.Len(t, information.Transactions, 2)
+
+	payment := MapPayment(document.Initiation.GroupHeader, information, information.Transactions[0], organisationID)
+	attributes := payment.Attributes
+
+	assert.EqualValues(t, "Payment", payment.Type)
+	assert.EqualValues(t, organisationID, payment.OrganisationID)
+	assert.EqualValues(t, "100.21", attributes.Amount)
+	assert.EqualValues(t, "GBP", attributes.Currency)
+	assert.EqualValues(t, "Wil piano Jan", attributes.EndToEndReference)
+	assert.EqualValues(t, "123456789012345678", attributes.PaymentID)
+	assert.EqualValues(t, "Paying for goods/services", attributes.PaymentPurpose)
+	assert.EqualValues(t, "FPS", attributes.PaymentScheme)
+	assert.EqualValues(t, "ImmediatePayment", attributes.SchemePaymentType)
+	assert.EqualValues(t, "Credit", attributes.PaymentType)
+	assert.EqualValues(t, "2017-01-18", attributes.ProcessingDate)
+	assert.EqualValues(t, "Em's piano lessons", attributes.Reference)
+	assert.EqualValues(t, "SHAR", attributes.ChargesInformation.BearerCode)
+
+	assert.EqualValues(t, "Emelia Jane Brown", attributes.DebtorParty.Name)
+	assert.EqualValues(t, "EJ Brown Black", attributes.DebtorParty.AccountName)
+	assert.EqualValues(t, "GB29XABC10161234567801", attributes.DebtorParty.AccountNumber)
+	assert.EqualValues(t, "IBAN", attributes.DebtorParty.AccountNumberCode)
+	assert.EqualValues(t, "10 Debtor Crescent Sourcetown NE1 GB", attributes.DebtorParty.Address)
+	assert.EqualValues(t, "XABCGB2L", attributes.DebtorParty.BankID)
+	assert.EqualValues(t, "SWBIC", attributes.DebtorParty.BankIDCode)
+
+	assert.EqualValues(t, "Wilfred Jeremiah Owens", attributes.BeneficiaryParty.Name)
+	assert.EqualValues(t, "W Owens", attributes.BeneficiaryParty.AccountName)
+	assert.EqualValues(t, "31926819", attributes.BeneficiaryParty.AccountNumber)
+	assert.EqualValues(t, "BBAN", attributes.BeneficiaryParty.AccountNumberCode)
+	assert.EqualValues(t, "403000", attributes.BeneficiaryParty.BankID)
+	assert.EqualValues(t, "GBDSC", attributes.BeneficiaryParty.BankIDCode)
+
+	// The charge bearer of the transaction overrides the one of the payment information
+	other := MapPayment(document.Initiation.GroupHeader, information, information.Transactions[1], organisationID)
+	assert.EqualValues(t, "DEBT", other.Attributes.ChargesInformation.BearerCode)
+	assert.EqualValues(t, "Rent January", other.Attributes.Reference)
+	assert.NotEqual(t, payment.ID, other.ID)
+}
+
+func TestParsePain001V09(t *testing.T) {
+	document := parseFile(t, "pain.001.001.09.xml")
+
+	assert.EqualValues(t, "pain.001.001.09", document.Version())
+	assert.Empty(t, document.Validate())
+
+	information := document.Initiation.PaymentInformation[0]
+	assert.Empty(t, information.Validate())
+
+	attributes := MapPayment(document.Initiation.GroupHeader, information, information.Transactions[0], organisationID).Attributes
+
+	assert.EqualValues(t, "2021-03-02", attributes.ProcessingDate)
+	assert.EqualValues(t, "SEPA", attributes.PaymentScheme)
+	assert.EqualValues(t, "SLEV", attributes.ChargesInformation.BearerCode)
+	assert.EqualValues(t, "COBADEFFXXX", attributes.DebtorParty.BankID)
+	assert.EqualValues(t, "SWBIC", attributes.DebtorParty.BankIDCode)
+	assert.EqualValues(t, "Hauptstrasse 1 Berlin 10115 DE", attributes.DebtorParty.Address)
+	assert.EqualValues(t, "FR1420041010050500013M02606", attributes.BeneficiaryParty.AccountNumber)
+	assert.EqualValues(t, "1.00000", attributes.FX.ExchangeRate)
+	assert.EqualValues(t, "FX123", attributes.FX.ContractReference)
+}
+
+func TestMapPaymentIDIsDeterministic(t *testing.T) {
+	document := parseFile(t, "pain.001.001.03.xml")
+	header, information := document.Initiation.GroupHeader, document.Initiation.PaymentInformation[0]
+
+	payment := MapPayment(header, information, information.Transactions[0], organisationID)
+	assert.EqualValues(t, payment.ID, MapPayment(header, information, information.Transactions[0], organisationID).ID)
+
+	// Other organisations importing the same message create other payments
+	assert.NotEqual(t, payment.ID, MapPayment(header, information, information.Transactions[0], uuid.NewV4()).ID)
+}
+
+func TestParseUnsupportedMessage(t *testing.T) {
+	_, err := ParsePain001(strings.NewReader(`<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.008.001.02"></Document>`))
+	assert.Error(t, err)
+
+	_, err = ParsePain001(strings.NewReader(`<Document`))
+	assert.Error(t, err)
+}
+
+func TestValidateGroupHeaderTotals(t *testing.T) {
+	document := parseFile(t, "pain.001.001.03.xml")
+	document.Initiation.GroupHeader.NumberOfTransactions = "3"
+	document.Initiation.GroupHeader.ControlSum = "350.70"
+
+	assert.EqualValues(t, []string{
+		"GrpHdr/NbOfTxs does not match the 2 transactions",
+		"GrpHdr/CtrlSum does not match the sum of the transactions",
+	}, document.Validate())
+}
+
+func TestValidateTransaction(t *testing.T) {
+	transaction := parseFile(t, "pain.001.001.03.xml").Initiation.PaymentInformation[0].Transactions[1]
+	transaction.PaymentID.EndToEndID = ""
+	transaction.Amount.InstructedAmount = &CurrencyAmount{Value: "-1", Currency: "gbp"}
+	transaction.ChargeBearer = "OUR"
+	transaction.CreditorAccount.ID.IBAN = "GB82 WEST"
+	transaction.CreditorAgent.FinancialInstitution.BIC = "NWBK"
+
+	assert.EqualValues(t, []string{
+		"PmtId/EndToEndId is required",
+		"Amt/InstdAmt must be a positive amount with up to 5 decimals",
+		"Amt/InstdAmt/@Ccy must be an ISO 4217 currency code",
+		"ChrgBr must be DEBT, CRED, SHAR or SLEV",
+		"CdtrAcct/Id/IBAN is not a valid IBAN",
+		"CdtrAgt/FinInstnId/BIC is not a valid BIC",
+	}, transaction.Validate())
+}
+
+func TestValidatePaymentInformation(t *testing.T) {
+	information := parseFile(t, "pain.001.001.03.xml").Initiation.PaymentInformation[0]
+	information.PaymentMethod = "CHK"
+	information.RequestedExecutionDate = DateChoice{Value: "18/01/2017"}
+	information.DebtorAccount = nil
+
+	assert.EqualValues(t, []string{
+		"PmtInf[PMTINF-1]/PmtMtd must be TRF",
+		"PmtInf[PMTINF-1]/ReqdExctnDt must be an ISO date",
+		"PmtInf[PMTINF-1]/DbtrAcct/Id is required",
+	}, information.Validate())
+}
@@ -0,0 +1,101 @@
+package mandates
+
+import (
+	"errors"
+	"github.com/satori/go.uuid"
+	"payments/app/banks"
+	"payments/app/calendar"
+	"payments/app/models"
+	"payments/app/schemes"
+	"payments/utils"
+	"strings"
+	"time"
+)
+
+// Collection is the request of a payment collected from the debtor of a mandate
+type Collection struct {
+	// Id of the payment, generated when missing
+	ID       uuid.UUID `json:"id"`
+	Amount   string    `json:"amount"`
+	Currency string    `json:"currency"`
+	// Default today, moved to the next business day of the scheme
+	ProcessingDate    string `json:"processing_date"`
+	EndToEndReference string `json:"end_to_end_reference"`
+}
+
+// NewPayment returns the direct debit of the collection, paid from the account of the debtor to the creditor, which
+// is also the sponsor of the submission. The reference of the payment is the reference of the mandate
+func NewPayment(mandate models.Mandate, collection Collection) models.Payment {
+	currency := strings.ToUpper(strings.TrimSpace(collection.Currency))
+	if currency == "" {
+		currency = "GBP"
+	}
+
+	id := collection.ID
+	if uuid.Equal(id, uuid.Nil) {
+		id = uuid.NewV4()
+	}
+
+	mandateID := mandate.ID
+	return models.Payment{
+		Type:           "Payment",
+		ID:             id,
+		OrganisationID: mandate.OrganisationID,
+		MandateID:      &mandateID,
+		Attributes: models.Attributes{
+			Amount:            strings.TrimSpace(collection.Amount),
+			Currency:          currency,
+			EndToEndReference: collection.EndToEndReference,
+			PaymentScheme:     mandate.Scheme,
+			PaymentType:       "Debit",
+			ProcessingDate:    collection.ProcessingDate,
+			Reference:         mandate.Reference,
+			SchemePaymentType: "DirectDebit",
+			DebtorParty:       models.DebtorParty{DebtorPartySkeleton: party(mandate.Debtor)},
+			BeneficiaryParty:  models.BeneficiaryParty{DebtorPartySkeleton: party(mandate.Creditor)},
+			SponsorParty: models.SponsorParty{SponsorPartySkeleton: &models.SponsorPartySkeleton{
+				AccountNumber: mandate.Creditor.AccountNumber,
+				BankID:        mandate.Creditor.BankID,
+				BankIDCode:    mandate.Creditor.BankIDCode,
+			}},
+		},
+	}
+}
+
+// Collect returns the pending payment of the collection and the warnings of its processing date
+// The mandate must be active, a mandate not collected for MANDATE_DORMANCY_MONTHS becomes dormant. The payment must
+// follow the rules of its scheme, the errors are returned as a ValidationError
+func Collect(mandate *models.Mandate, collection Collection, now time.Time) (models.Payment, []string, error) {
+	mandate.Refresh(now)
+	if mandate.Status != models.MANDATE_ACTIVE {
+		return models.Payment{}, nil, errors.New(utils.ERROR_MANDATE_NOT_ACTIVE)
+	}
+
+	if collection.ProcessingDate == "" {
+		collection.ProcessingDate = now.UTC().Format(calendar.DATE_FORMAT)
+	}
+	payment := NewPayment(*mandate, collection)
+
+	banks.GetDirectory().EnrichPayment(&payment)
+	warnings := calendar.GetCalendars().RollPayment(&payment, now)
+
+	if errs := schemes.ValidatePayment(payment); len(errs) > 0 {
+		return payment, warnings, &ValidationError{Errors: errs}
+	}
+
+	payment.Schedule()
+	return payment, warnings, nil
+}
+
+func party(party models.MandateParty) *models.DebtorPartySkeleton {
+	return &models.DebtorPartySkeleton{
+		SponsorPartySkeleton: &models.SponsorPartySkeleton{
+			AccountNumber: party.AccountNumber,
+			BankID:        party.BankID,
+			BankIDCode:    party.BankIDCode,
+		},
+		AccountName:       party.AccountName,
+		AccountNumberCode: party.AccountNumberCode,
+		Name:              party.Name,
+	}
+}
@@ -0,0 +1,94 @@
+package mandates
+
+import (
+	"payments/app/models"
+	"payments/app/modulus"
+	"payments/utils"
+	"regexp"
+	"strings"
+)
+
+// Payment scheme of the mandates, the Bacs Direct Debits
+const PAYMENT_SCHEME_BACS = "BACS"
+
+// Identification codes of the UK accounts and sort codes
+const ACCOUNT_NUMBER_CODE_BBAN = "BBAN"
+const BANK_ID_CODE_SORT_CODE = "GBDSC"
+
+// ValidationError lists the errors of a mandate or of a collection, as `field: message`
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return strings.Join(e.Errors, ", ")
+}
+
+// The references are up to the 18 characters of the collections, of the Bacs set, with at least 6 letters or digits
+var referencePattern = regexp.MustCompile(`^[A-Z0-9.&/\- ]{6,18}$`)
+var alphanumericPattern = regexp.MustCompile(`[A-Z0-9]`)
+var serviceUserNumberPattern = regexp.MustCompile(`^[0-9]{6}$`)
+var sortCodePattern = regexp.MustCompile(`^[0-9]{6}$`)
+var accountNumberPattern = regexp.MustCompile(`^[0-9]{8}$`)
+
+// Normalize writes the scheme and the reference in upper case, and identifies the accounts without codes by sort code
+// and account number
+func Normalize(mandate *models.Mandate) {
+	mandate.Scheme = strings.ToUpper(strings.TrimSpace(mandate.Scheme))
+	mandate.Reference = strings.ToUpper(strings.TrimSpace(mandate.Reference))
+	mandate.CreditorID = strings.TrimSpace(mandate.CreditorID)
+
+	for _, party := range []*models.MandateParty{&mandate.Creditor, &mandate.Debtor} {
+		party.BankID = strings.Replace(strings.TrimSpace(party.BankID), "-", "", -1)
+		party.AccountNumber = strings.Replace(strings.TrimSpace(party.AccountNumber), " ", "", -1)
+		if party.BankIDCode == "" {
+			party.BankIDCode = BANK_ID_CODE_SORT_CODE
+		}
+		if party.AccountNumberCode == "" {
+			party.AccountNumberCode = ACCOUNT_NUMBER_CODE_BBAN
+		}
+	}
+}
+
+// Validate returns the errors of a normalized mandate, as `field: message`
+// The accounts are modulus checked when modulus checking is configured
+func Validate(mandate models.Mandate) []string {
+	errs := []string{}
+
+	if mandate.Scheme != PAYMENT_SCHEME_BACS {
+		errs = append(errs, "scheme: "+utils.ERROR_MANDATE_SCHEME)
+	}
+	if !referencePattern.MatchString(mandate.Reference) || len(alphanumericPattern.FindAllString(mandate.Reference, -1)) < 6 {
+		errs = append(errs, "reference: "+utils.ERROR_MANDATE_REFERENCE)
+	}
+	if !serviceUserNumberPattern.MatchString(mandate.CreditorID) {
+		errs = append(errs, "creditor_id: "+utils.ERROR_SERVICE_USER_NUMBER_INVALID)
+	}
+
+	if strings.TrimSpace(mandate.Creditor.Name) == "" {
+		errs = append(errs, "creditor.name: "+utils.ERROR_FIELD_REQUIRED)
+	}
+	if strings.TrimSpace(mandate.Debtor.AccountName) == "" {
+		errs = append(errs, "debtor.account_name: "+utils.ERROR_FIELD_REQUIRED)
+	}
+
+	errs = append(errs, validateAccount("creditor", mandate.Creditor)...)
+	return append(errs, validateAccount("debtor", mandate.Debtor)...)
+}
+
+// validateAccount checks the party has a UK account of 8 digits
+func validateAccount(field string, party models.MandateParty) []string {
+	if strings.ToUpper(party.BankIDCode) != BANK_ID_CODE_SORT_CODE || !sortCodePattern.MatchString(party.BankID) {
+		return []string{field + ".bank_id: " + utils.ERROR_SORT_CODE_INVALID}
+	}
+	if strings.ToUpper(party.AccountNumberCode) != ACCOUNT_NUMBER_CODE_BBAN || !accountNumberPattern.MatchString(party.AccountNumber) {
+		return []string{field + ".account_number: " + utils.ERROR_BACS_ACCOUNT_NUMBER_INVALID}
+	}
+
+	if checker := modulus.GetChecker(); checker != nil {
+		if err := checker.Check(party.BankID, party.AccountNumber); err != nil {
+			return []string{field + ".account_number: " + err.Error()}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package mandates
+
+import (
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"payments/app/models"
+	"payments/utils"
+	"testing"
+	"time"
+)
+
+func mandateExample() models.Mandate {
+	return models.Mandate{
+		ID:             uuid.NewV4(),
+		OrganisationID: uuid.NewV4(),
+		Reference:      "ddi-000123",
+		Scheme:         "Bacs",
+		Status:         models.MANDATE_ACTIVE,
+		CreditorID:     "123456",
+		Creditor:       models.MandateParty{Name: "Gym Ltd", AccountName: "Gym Ltd", AccountNumber: "56781234", BankID: "12-31-23"},
+		Debtor:         models.MandateParty{Name: "Jane Smith", AccountName: "J Smith", AccountNumber: "55779911", BankID: "200000"},
+		CreatedAt:      time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestValidate(t *testing.T) {
+	mandate := mandateExample()
+	Normalize(&mandate)
+
+	assert.EqualValues(t, "BACS", mandate.Scheme)
+	assert.EqualValues(t, "DDI-000123", mandate.Reference)
+	assert.EqualValues(t, "123123", mandate.Creditor.BankID)
+	assert.EqualValues(t, BANK_ID_CODE_SORT_CODE, mandate.Debtor.BankIDCode)
+	assert.EqualValues(t, ACCOUNT_NUMBER_CODE_BBAN, mandate.Debtor.AccountNumberCode)
+	assert.Empty(t, Validate(mandate))
+}
+
+func TestValidateInvalidMandate(t *testing.T) {
+	mandate := mandateExample()
+	mandate.Scheme = "SEPA"
+	mandate.Reference = "DD-1/2"
+	mandate.CreditorID = "1234"
+	mandate.Creditor.Name = ""
+	mandate.Debtor.AccountNumber = "5577991"
+	Normalize(&mandate)
+
+	assert.EqualValues(t, []string{
+		"scheme: " + utils.ERROR_MANDATE_SCHEME,
+		"reference: " + utils.ERROR_MANDATE_REFERENCE,
+		"creditor_id: " + utils.ERROR_SERVICE_USER_NUMBER_INVALID,
+		"creditor.name: " + utils.ERROR_FIELD_REQUIRED,
+		"debtor.account_number: " + utils.ERROR_BACS_ACCOUNT_NUMBER_INVALID,
+	}, Validate(mandate))
+
+	mandate = mandateExample()
+	mandate.Debtor.BankIDCode = "SWBIC"
+	mandate.Reference = "REFERENCE LONGER THAN 18"
+	Normalize(&mandate)
+	assert.EqualValues(t, []string{
+		"reference: " + utils.ERROR_MANDATE_REFERENCE,
+		"debtor.bank_id: " + utils.ERROR_SORT_CODE_INVALID,
+	}, Validate(mandate))
+}
+
+func TestNewPayment(t *testing.T) {
+	mandate := mandateExample()
+	Normalize(&mandate)
+
+	payment := NewPayment(mandate, Collection{Amount: "25.50", ProcessingDate: "2026-11-02"})
+
+	assert.NotEqual(t, uuid.Nil, payment.ID)
+	assert.EqualValues(t, mandate.OrganisationID, payment.OrganisationID)
+	assert.EqualValues(t, mandate.ID, *payment.MandateID)
+	attributes := payment.Attributes
+	assert.EqualValues(t, "GBP", attributes.Currency)
+	assert.EqualValues(t, "Debit", attributes.PaymentType)
+	assert.EqualValues(t, "DirectDebit", attributes.SchemePaymentType)
+	assert.EqualValues(t, "DDI-000123", attributes.Reference)
+	assert.EqualValues(t, "55779911", attributes.DebtorParty.AccountNumber)
+	assert.EqualValues(t, "56781234", attributes.BeneficiaryParty.AccountNumber)
+	assert.EqualValues(t, "123123", attributes.SponsorParty.BankID)
+}
+
+func TestCollect(t *testing.T) {
+	mandate := mandateExample()
+	Normalize(&mandate)
+	now := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+
+	id := uuid.NewV4()
+	payment, _, err := Collect(&mandate, Collection{ID: id, Amount: "25.50", ProcessingDate: "2026-10-21"}, now)
+	if assert.Nil(t, err) {
+		assert.EqualValues(t, id, payment.ID)
+		assert.EqualValues(t, models.PAYMENT_STATUS_PENDING, payment.Status)
+		assert.EqualValues(t, "2026-10-21", payment.Attributes.ProcessingDate)
+	}
+
+	// Without processing date the payment is collected from today
+	payment, _, err = Collect(&mandate, Collection{Amount: "25.50"}, now)
+	if assert.Nil(t, err) {
+		assert.EqualValues(t, "2026-10-19", payment.Attributes.ProcessingDate)
+	}
+
+	_, _, err = Collect(&mandate, Collection{Amount: "25.505", Currency: "EUR"}, now)
+	if assert.IsType(t, &ValidationError{}, err) {
+		assert.Len(t, err.(*ValidationError).Errors, 2)
+	}
+}
+
+func TestCollectInactiveMandate(t *testing.T) {
+	mandate := mandateExample()
+	mandate.Status = models.MANDATE_CANCELLED
+	_, _, err := Collect(&mandate, Collection{Amount: "25.50"}, time.Now())
+	assert.EqualError(t, err, utils.ERROR_MANDATE_NOT_ACTIVE)
+
+	// Dormant after 13 months without collection
+	mandate = mandateExample()
+	mandate.LastCollectionDate = "2026-02-01"
+	_, _, err = Collect(&mandate, Collection{Amount: "25.50"}, time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC))
+	assert.EqualError(t, err, utils.ERROR_MANDATE_NOT_ACTIVE)
+	assert.EqualValues(t, models.MANDATE_DORMANT, mandate.Status)
+
+	mandate = mandateExample()
+	mandate.LastCollectionDate = "2026-02-01"
+	mandate.Refresh(time.Date(2027, 2, 28, 0, 0, 0, 0, time.UTC))
+	assert.EqualValues(t, models.MANDATE_ACTIVE, mandate.Status)
+
+	// A mandate never collected is dormant 13 months after its set up
+	mandate = mandateExample()
+	mandate.Refresh(time.Date(2027, 2, 5, 9, 0, 0, 0, time.UTC))
+	assert.EqualValues(t, models.MANDATE_DORMANT, mandate.Status)
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"github.com/dgrijalva/jwt-go"
 	"net/http"
-	"os"
 	"payments/app/models"
 	u "payments/utils"
 	"strings"
@@ -15,12 +14,14 @@ const ERROR_MISSING_TOKEN = "Missing auth token"
 const ERROR_MALFORMED_TOKEN = "Invalid/Malformed auth token"
 const ERROR_TOKEN_INVALID = "Token Invalid"
 
+// JwtAuthentication authenticates the caller with a JWT (`Bearer {token}`), an api key (`ApiKey {key}`)
+// or a client certificate (mutual TLS)
 var JwtAuthentication = func(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		// List of endpoints that doesn't require auth
-		notAuth := []string{"/v1/user", "/v1/user/login", "/v1/health"}
+		notAuth := []string{"/v1/user", "/v1/user/login", "/v1/user/login/mfa", "/v1/user/email/verify", "/v1/user/password/forgot", "/v1/user/password/reset", "/v1/health", "/.well-known/jwks.json"}
 
 		// Current Request Path
 		requestPath := r.URL.Path
@@ -37,61 +38,87 @@ var JwtAuthentication = func(next http.Handler) http.Handler {
 		// Grab the token from the header
 		tokenHeader := r.Header.Get("Authorization")
 
-		// Token is missing, returns with error code 403 Unauthorized
-		if tokenHeader == "" {
+		// Bank partners without token authenticate with the client certificate verified in the TLS handshake
+		if tokenHeader == "" && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			certificate, err := models.GetClientCertificateBySubject(r.TLS.VerifiedChains[0][0].Subject.String())
+			if err != nil {
+				if err.Error() == u.ERROR_SERVER {
+					u.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+				} else {
+					forbidden(w, err.Error())
+				}
+				return
+			}
 
-			if response, err := json.Marshal(u.Response{Errors: []string{ERROR_MISSING_TOKEN}}); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-			} else {
-				w.Header().Add("Content-Type", "application/json")
-				w.WriteHeader(http.StatusForbidden)
-				w.Write(response)
+			if !activeAccount(w, certificate.AccountID, nil) {
+				return
 			}
+
+			ctx := context.WithValue(r.Context(), "user", certificate.AccountID)
+			ctx = context.WithValue(ctx, "client_certificate", certificate.Subject)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		// Token is missing, returns with error code 403 Unauthorized
+		if tokenHeader == "" {
+			forbidden(w, ERROR_MISSING_TOKEN)
 			return
 		}
 
 		// The token normally comes in format `Bearer {token-body}`, we check if the retrieved token matched this requirement
 		splitted := strings.Split(tokenHeader, " ")
 		if len(splitted) != 2 {
-			if response, err := json.Marshal(u.Response{Errors: []string{ERROR_MALFORMED_TOKEN}}); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-			} else {
-				w.Header().Add("Content-Type", "application/json")
-				w.WriteHeader(http.StatusForbidden)
-				w.Write(response)
+			forbidden(w, ERROR_MALFORMED_TOKEN)
+			return
+		}
+
+		// Machines authenticate with `ApiKey {key}`, limited to the scopes granted to the key
+		if strings.EqualFold(splitted[0], "ApiKey") {
+			apiKey, err := models.AuthenticateApiKey(splitted[1])
+			if err != nil {
+				if err.Error() == u.ERROR_SERVER {
+					u.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+				} else {
+					forbidden(w, err.Error())
+				}
+				return
+			}
+
+			scope, ok := requiredScope(r)
+			if !ok || !apiKey.HasScope(scope) {
+				forbidden(w, u.ERROR_API_KEY_SCOPE)
+				return
 			}
+
+			if !activeAccount(w, apiKey.AccountID, nil) {
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "user", apiKey.AccountID)
+			ctx = context.WithValue(ctx, "api_key", apiKey.ID)
+			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
 
 		// Grab the token part, what we are truly interested in
 		tokenPart := splitted[1]
-		tk := &models.Token{}
 
-		token, err := jwt.ParseWithClaims(tokenPart, tk, func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("token_password")), nil
-		})
-
-		// Malformed token, returns with http code 403
+		// Verify the token signature with the key ring
+		tk, err := models.ParseToken(tokenPart)
 		if err != nil {
-			if response, err := json.Marshal(u.Response{Errors: []string{ERROR_MALFORMED_TOKEN}}); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-			} else {
-				w.Header().Add("Content-Type", "application/json")
-				w.WriteHeader(http.StatusForbidden)
-				w.Write(response)
+			// Malformed token, returns with http code 403
+			if validationError, ok := err.(*jwt.ValidationError); ok && validationError.Errors&jwt.ValidationErrorMalformed != 0 {
+				forbidden(w, ERROR_MALFORMED_TOKEN)
+				return
 			}
+
+			// Token is invalid, maybe not signed on this server
+			forbidden(w, ERROR_TOKEN_INVALID)
 			return
 		}
 
-		// Token is invalid, maybe not signed on this server
-		if !token.Valid {
-			if response, err := json.Marshal(u.Response{Errors: []string{ERROR_TOKEN_INVALID}}); err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-			} else {
-				w.Header().Add("Content-Type", "application/json")
-				w.WriteHeader(http.StatusForbidden)
-				w.Write(response)
-			}
+		if !activeAccount(w, tk.UserId, tk) {
 			return
 		}
 
@@ -103,3 +130,40 @@ var JwtAuthentication = func(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// activeAccount check if the account of the caller was not deleted or disabled and, for tokens, did not revoke the token
+// Otherwise writes a forbidden response
+func activeAccount(w http.ResponseWriter, accountID uint, tk *models.Token) bool {
+	account, err := models.GetAccountByID(accountID)
+	if err != nil {
+		if err.Error() == u.ERROR_SERVER {
+			u.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		} else {
+			forbidden(w, ERROR_TOKEN_INVALID)
+		}
+		return false
+	}
+
+	if account.Disabled {
+		forbidden(w, u.ERROR_ACCOUNT_DISABLED)
+		return false
+	}
+
+	if tk != nil && account.IsTokenRevoked(tk) {
+		forbidden(w, u.ERROR_TOKEN_REVOKED)
+		return false
+	}
+
+	return true
+}
+
+// forbidden writes a 403 response with the error
+func forbidden(w http.ResponseWriter, error string) {
+	if response, err := json.Marshal(u.Response{Errors: []string{error}}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	} else {
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write(response)
+	}
+}
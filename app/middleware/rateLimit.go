@@ -0,0 +1,311 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"payments/app/models"
+	"payments/infrastructure"
+	u "payments/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitRule limits the requests of each client to Limit requests per Period on the matching routes
+// Pattern is `[METHOD ]PATH`, a path ending with `*` matches every path with that prefix
+type RateLimitRule struct {
+	Pattern string
+	Method  string
+	Path    string
+	Limit   int
+	Period  time.Duration
+}
+
+// Rules used when RATE_LIMITS is not defined
+// The public endpoints are limited by ip address to slow down the creation of accounts and emails sent
+const DEFAULT_RATE_LIMITS = "POST /v1/user=10/1h,POST /v1/user/login=20/1m,POST /v1/user/login/mfa=20/1m," +
+	"POST /v1/user/password/forgot=5/1h,POST /v1/user/email/verify/resend=5/1h,*=600/1m"
+
+// Rules used when IP_RATE_LIMITS is not defined
+// Every request is limited by ip address before the authentication, so the requests with invalid credentials are limited too
+const DEFAULT_IP_RATE_LIMITS = "*=1200/1m"
+
+// RateLimitStore keeps the token buckets of the clients
+type RateLimitStore interface {
+	Take(key string, limit int, period time.Duration) (models.RateLimitBucket, bool, error)
+}
+
+// MemoryRateLimitStore keeps the buckets in memory, the limits only apply to each instance of the api
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+type memoryBucket struct {
+	models.RateLimitBucket
+	period time.Duration
+}
+
+// PostgresRateLimitStore keeps the buckets in the database, so the limits are shared by all instances of the api
+type PostgresRateLimitStore struct{}
+
+// RateLimiter applies the rules to the requests
+type RateLimiter struct {
+	Rules []RateLimitRule
+	Store RateLimitStore
+	// Client returns the key of the client of the request, the api key, the user or the ip address when nil
+	Client func(r *http.Request) string
+	// Quiet limiters only write the RateLimit-* headers of the refused requests, so they do not hide the headers of the
+	// limiter that runs after them
+	Quiet bool
+}
+
+var rateLimiter *RateLimiter
+var rateLimiterOnce sync.Once
+
+var ipRateLimiter *RateLimiter
+var ipRateLimiterOnce sync.Once
+
+// RateLimit limits the requests of each client (api key, user or ip address) with token buckets
+// Every matching rule applies, the RateLimit-* headers describe the rule with less remaining requests
+// Configured by RATE_LIMITS (`off` disables) and RATE_LIMIT_STORE (`memory` or `postgres`)
+var RateLimit = func(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		GetRateLimiter().ServeHTTP(w, r, next)
+	})
+}
+
+// RateLimitByIP limits the requests of each ip address, it runs before the authentication
+// Configured by IP_RATE_LIMITS (`off` disables) and RATE_LIMIT_STORE (`memory` or `postgres`)
+var RateLimitByIP = func(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		GetIPRateLimiter().ServeHTTP(w, r, next)
+	})
+}
+
+// GetRateLimiter returns the rate limiter configured by the environment
+func GetRateLimiter() *RateLimiter {
+	rateLimiterOnce.Do(func() {
+		rateLimiter = newRateLimiter(os.Getenv("RATE_LIMITS"), DEFAULT_RATE_LIMITS)
+	})
+	return rateLimiter
+}
+
+// GetIPRateLimiter returns the rate limiter by ip address configured by the environment
+func GetIPRateLimiter() *RateLimiter {
+	ipRateLimiterOnce.Do(func() {
+		ipRateLimiter = newRateLimiter(os.Getenv("IP_RATE_LIMITS"), DEFAULT_IP_RATE_LIMITS)
+		ipRateLimiter.Client = rateLimitAddress
+		ipRateLimiter.Quiet = true
+	})
+	return ipRateLimiter
+}
+
+// newRateLimiter creates the limiter of the rules, or of the default rules when the config is empty
+func newRateLimiter(config string, defaultConfig string) *RateLimiter {
+	if config == "" {
+		config = defaultConfig
+	}
+
+	rules, err := ParseRateLimitRules(config)
+	if err != nil {
+		panic(err)
+	}
+
+	var store RateLimitStore = NewMemoryRateLimitStore()
+	if os.Getenv("RATE_LIMIT_STORE") == "postgres" {
+		store = NewPostgresRateLimitStore(rules)
+	}
+
+	return &RateLimiter{Rules: rules, Store: store}
+}
+
+// ParseRateLimitRules parses comma separated rules in the format `[METHOD ]PATH=LIMIT/PERIOD`, e.g. `POST /v1/payments=100/1m`
+func ParseRateLimitRules(config string) ([]RateLimitRule, error) {
+	rules := []RateLimitRule{}
+	if strings.TrimSpace(config) == "off" {
+		return rules, nil
+	}
+
+	for _, value := range strings.Split(config, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		parts := strings.SplitN(value, "=", 2)
+		rate := []string{}
+		if len(parts) == 2 {
+			rate = strings.SplitN(parts[1], "/", 2)
+		}
+		if len(rate) != 2 {
+			return nil, fmt.Errorf("invalid rate limit rule %q", value)
+		}
+
+		limit, err := strconv.Atoi(rate[0])
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid rate limit rule %q", value)
+		}
+		period, err := time.ParseDuration(rate[1])
+		if err != nil || period <= 0 {
+			return nil, fmt.Errorf("invalid rate limit rule %q", value)
+		}
+
+		rule := RateLimitRule{Pattern: strings.TrimSpace(parts[0]), Limit: limit, Period: period}
+		if fields := strings.Fields(rule.Pattern); len(fields) == 2 {
+			rule.Method, rule.Path = strings.ToUpper(fields[0]), fields[1]
+		} else {
+			rule.Path = rule.Pattern
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// Matches check if the rule applies to the request
+func (rule *RateLimitRule) Matches(r *http.Request) bool {
+	if rule.Method != "" && rule.Method != r.Method {
+		return false
+	}
+	if strings.HasSuffix(rule.Path, "*") {
+		return strings.HasPrefix(r.URL.Path, strings.TrimSuffix(rule.Path, "*"))
+	}
+	return rule.Path == r.URL.Path
+}
+
+// ServeHTTP takes a token of every matching rule and serves the request, or writes a 429 response if a bucket is empty
+// The store errors are logged and the request is served, the api stays available without the shared store
+func (l *RateLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	client := rateLimitClient
+	if l.Client != nil {
+		client = l.Client
+	}
+	key := client(r)
+
+	var headerRule *RateLimitRule
+	var headerBucket models.RateLimitBucket
+
+	for i := range l.Rules {
+		rule := &l.Rules[i]
+		if !rule.Matches(r) {
+			continue
+		}
+
+		bucket, allowed, err := l.Store.Take(rule.Pattern+"|"+key, rule.Limit, rule.Period)
+		if err != nil {
+			infrastructure.LogError(http.StatusInternalServerError, err.Error())
+			continue
+		}
+
+		if !allowed {
+			setRateLimitHeaders(w, rule, bucket)
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(bucket.UntilNextToken(rule.Limit, rule.Period))))
+			u.CreateApiErrorResponse(w, u.ERROR_RATE_LIMITED, http.StatusTooManyRequests)
+			return
+		}
+
+		if headerRule == nil || bucket.Remaining() < headerBucket.Remaining() {
+			headerRule, headerBucket = rule, bucket
+		}
+	}
+
+	if headerRule != nil && !l.Quiet {
+		setRateLimitHeaders(w, headerRule, headerBucket)
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// rateLimitClient returns the key of the client: the api key, the user or the ip address
+func rateLimitClient(r *http.Request) string {
+	if apiKey, ok := r.Context().Value("api_key").(uint); ok {
+		return fmt.Sprintf("api_key:%d", apiKey)
+	}
+	if user, ok := r.Context().Value("user").(uint); ok {
+		return fmt.Sprintf("user:%d", user)
+	}
+	return "ip:" + u.ClientIP(r)
+}
+
+// rateLimitAddress returns the key of the ip address of any request, apart from the keys of the clients by ip address
+func rateLimitAddress(r *http.Request) string {
+	return "address:" + u.ClientIP(r)
+}
+
+// setRateLimitHeaders writes the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers
+func setRateLimitHeaders(w http.ResponseWriter, rule *RateLimitRule, bucket models.RateLimitBucket) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(rule.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(bucket.Remaining()))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(bucket.UntilFull(rule.Limit, rule.Period))))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rule.Limit, ceilSeconds(rule.Period)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// NewMemoryRateLimitStore creates an empty memory store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*memoryBucket{}}
+}
+
+// Take takes one token of the bucket of the key
+func (s *MemoryRateLimitStore) Take(key string, limit int, period time.Duration) (models.RateLimitBucket, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := s.buckets[key]
+	if !ok {
+		// Buckets unused for a period are full, the same as missing buckets. Remove them once in a while to bound the memory
+		if len(s.buckets) > 0 && len(s.buckets)%10000 == 0 {
+			s.removeFull(now)
+		}
+
+		bucket = &memoryBucket{RateLimitBucket: models.RateLimitBucket{Key: key}, period: period}
+		s.buckets[key] = bucket
+	}
+
+	allowed := bucket.Take(limit, period, now)
+	return bucket.RateLimitBucket, allowed, nil
+}
+
+func (s *MemoryRateLimitStore) removeFull(now time.Time) {
+	for key, bucket := range s.buckets {
+		if now.Sub(bucket.UpdatedAt) > bucket.period {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// NewPostgresRateLimitStore creates the store and removes the unused buckets every period of the longest rule
+func NewPostgresRateLimitStore(rules []RateLimitRule) *PostgresRateLimitStore {
+	longest := time.Minute
+	for _, rule := range rules {
+		if rule.Period > longest {
+			longest = rule.Period
+		}
+	}
+
+	go func() {
+		for range time.Tick(longest) {
+			if err := models.DeleteStaleRateLimitBuckets(time.Now().Add(-longest)); err != nil {
+				infrastructure.LogError(http.StatusInternalServerError, err.Error())
+			}
+		}
+	}()
+
+	return &PostgresRateLimitStore{}
+}
+
+// Take takes one token of the bucket of the key
+func (s *PostgresRateLimitStore) Take(key string, limit int, period time.Duration) (models.RateLimitBucket, bool, error) {
+	return models.TakeRateLimitToken(key, limit, period)
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestRateLimiter(t *testing.T, config string) http.Handler {
+	rules, err := ParseRateLimitRules(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limiter := &RateLimiter{Rules: rules, Store: NewMemoryRateLimitStore()}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter.ServeHTTP(w, r, next)
+	})
+}
+
+func doRateLimitedRequest(handler http.Handler, method string, url string, user uint) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, nil)
+	if user != 0 {
+		req = req.WithContext(context.WithValue(req.Context(), "user", user))
+	}
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+	return rw
+}
+
+func TestParseRateLimitRules(t *testing.T) {
+	rules, err := ParseRateLimitRules("POST /v1/payments=100/1m, /v1/payments*=1000/24h")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, rules, 2)
+	assert.Equal(t, RateLimitRule{Pattern: "POST /v1/payments", Method: http.MethodPost, Path: "/v1/payments", Limit: 100, Period: time.Minute}, rules[0])
+	assert.Equal(t, RateLimitRule{Pattern: "/v1/payments*", Path: "/v1/payments*", Limit: 1000, Period: 24 * time.Hour}, rules[1])
+
+	rules, err = ParseRateLimitRules("off")
+	assert.Nil(t, err)
+	assert.Len(t, rules, 0)
+
+	for _, invalid := range []string{"/v1/payments", "/v1/payments=0/1m", "/v1/payments=10/never", "/v1/payments=10"} {
+		_, err := ParseRateLimitRules(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+
+	_, err = ParseRateLimitRules(DEFAULT_RATE_LIMITS)
+	assert.Nil(t, err)
+	_, err = ParseRateLimitRules(DEFAULT_IP_RATE_LIMITS)
+	assert.Nil(t, err)
+}
+
+func TestRateLimit(t *testing.T) {
+	handler := newTestRateLimiter(t, "*=2/1m")
+
+	rw := doRateLimitedRequest(handler, http.MethodGet, "/v1/payments", 1)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "2", rw.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rw.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", rw.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", rw.Header().Get("RateLimit-Policy"))
+
+	rw = doRateLimitedRequest(handler, http.MethodGet, "/v1/payments", 1)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "0", rw.Header().Get("RateLimit-Remaining"))
+
+	rw = doRateLimitedRequest(handler, http.MethodGet, "/v1/payments", 1)
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+	assert.Equal(t, "30", rw.Header().Get("Retry-After"))
+
+	// Other clients have their own bucket
+	assert.Equal(t, http.StatusOK, doRateLimitedRequest(handler, http.MethodGet, "/v1/payments", 2).Code)
+	assert.Equal(t, http.StatusOK, doRateLimitedRequest(handler, http.MethodGet, "/v1/payments", 0).Code)
+}
+
+func TestRateLimitPerRoute(t *testing.T) {
+	handler := newTestRateLimiter(t, "POST /v1/user/login=1/1m,*=10/1m")
+
+	assert.Equal(t, http.StatusOK, doRateLimitedRequest(handler, http.MethodPost, "/v1/user/login", 0).Code)
+	assert.Equal(t, http.StatusTooManyRequests, doRateLimitedRequest(handler, http.MethodPost, "/v1/user/login", 0).Code)
+
+	// The other routes only have the general limit
+	rw := doRateLimitedRequest(handler, http.MethodGet, "/v1/payments", 0)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "10", rw.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	rules, err := ParseRateLimitRules("*=2/1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := &RateLimiter{Rules: rules, Store: NewMemoryRateLimitStore(), Client: rateLimitAddress, Quiet: true}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limiter.ServeHTTP(w, r, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+	})
+
+	// The users of the same address share the bucket, the headers are only written on the refused requests
+	rw := doRateLimitedRequest(handler, http.MethodGet, "/v1/payments", 1)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Empty(t, rw.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, http.StatusOK, doRateLimitedRequest(handler, http.MethodGet, "/v1/payments", 2).Code)
+
+	rw = doRateLimitedRequest(handler, http.MethodGet, "/v1/payments", 0)
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+	assert.Equal(t, "2", rw.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "30", rw.Header().Get("Retry-After"))
+}
+
+func TestRateLimitOff(t *testing.T) {
+	handler := newTestRateLimiter(t, "off")
+
+	rw := doRateLimitedRequest(handler, http.MethodGet, "/v1/payments", 1)
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Empty(t, rw.Header().Get("RateLimit-Limit"))
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"payments/app/models"
+	"strings"
+)
+
+// requiredScope returns the scope an api key needs to call the route
+// Routes not listed here can only be called with a user token
+func requiredScope(r *http.Request) (string, bool) {
+	if r.URL.Path == "/v1/payments" || strings.HasPrefix(r.URL.Path, "/v1/payments/") ||
+		r.URL.Path == "/v1/standing-orders" || strings.HasPrefix(r.URL.Path, "/v1/standing-orders/") ||
+		r.URL.Path == "/v1/mandates" || strings.HasPrefix(r.URL.Path, "/v1/mandates/") {
+		if r.Method == http.MethodGet {
+			return models.SCOPE_PAYMENTS_READ, true
+		}
+		return models.SCOPE_PAYMENTS_WRITE, true
+	}
+
+	// The bank directory is read to create payments
+	if r.URL.Path == "/v1/banks" {
+		return models.SCOPE_PAYMENTS_READ, true
+	}
+
+	// The calendars of the schemes are read to choose the processing dates
+	if strings.HasPrefix(r.URL.Path, "/v1/calendars/") {
+		return models.SCOPE_PAYMENTS_READ, true
+	}
+
+	return "", false
+}
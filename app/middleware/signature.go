@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"payments/app/models"
+	u "payments/utils"
+	"strings"
+	"time"
+)
+
+const SIGNATURE_ALGORITHM = "hmac-sha256"
+
+// Headers that must be covered by the signature of a request
+var signedHeaders = []string{"(request-target)", "date", "digest", "x-nonce"}
+
+// RequestSignature verifies the HMAC signature of the requests changing payments, standing orders and mandates (scheme
+// described in the README)
+// Signatures are mandatory, unless REQUEST_SIGNING_REQUIRED is false: then they are only verified when present
+// The key id of a valid signature is set in the request context as "signature_key"
+var RequestSignature = func(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if !requiresSignature(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Header.Get("Signature") == "" {
+			if signingRequired() {
+				u.CreateApiErrorResponse(w, u.ERROR_SIGNATURE_REQUIRED, http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		keyID, err := verifySignature(r)
+		if err != nil {
+			if err.Error() == u.ERROR_SERVER {
+				u.CreateApiErrorResponse(w, err.Error(), http.StatusInternalServerError)
+			} else {
+				u.CreateApiErrorResponse(w, err.Error(), http.StatusUnauthorized)
+			}
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "signature_key", keyID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// SignRequest signs the request with the key, setting the Date, Digest, X-Nonce and Signature headers
+func SignRequest(r *http.Request, keyID string, secret string, nonce string) error {
+	body := []byte{}
+	if r.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return err
+		}
+		r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+	}
+
+	r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	r.Header.Set("Digest", digest(body))
+	r.Header.Set("X-Nonce", nonce)
+
+	signature := sign(signingString(r, signedHeaders), secret)
+	r.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="%s",headers="%s",signature="%s"`,
+		keyID, SIGNATURE_ALGORITHM, strings.Join(signedHeaders, " "), signature))
+
+	return nil
+}
+
+// signingRequired is true unless the signatures are disabled with REQUEST_SIGNING_REQUIRED=false
+func signingRequired() bool {
+	return strings.TrimSpace(os.Getenv("REQUEST_SIGNING_REQUIRED")) != "false"
+}
+
+// Resources whose mutating requests must be signed: the payments, and the standing orders and mandates generating them
+var signedResources = []string{"/v1/payments", "/v1/standing-orders", "/v1/mandates"}
+
+// requiresSignature check if the request creates or changes a payment, a standing order or a mandate
+func requiresSignature(r *http.Request) bool {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		return false
+	}
+	for _, resource := range signedResources {
+		if r.URL.Path == resource || strings.HasPrefix(r.URL.Path, resource+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySignature verifies the signature of the request and returns the key id
+func verifySignature(r *http.Request) (string, error) {
+	params := parseSignatureHeader(r.Header.Get("Signature"))
+	keyID := params["keyId"]
+	headers := strings.Fields(strings.ToLower(params["headers"]))
+
+	if keyID == "" || params["signature"] == "" || params["algorithm"] != SIGNATURE_ALGORITHM {
+		return "", errors.New(u.ERROR_SIGNATURE_MALFORMED)
+	}
+
+	for _, required := range signedHeaders {
+		if !contains(headers, required) {
+			return "", errors.New(u.ERROR_SIGNATURE_MALFORMED)
+		}
+	}
+
+	// The key must be active and belong to the authenticated user
+	key, err := models.GetRequestSigningKeyByKeyID(keyID)
+	if err != nil {
+		return "", err
+	}
+	if user, ok := r.Context().Value("user").(uint); !ok || user != key.AccountID || !key.IsActive() {
+		return "", errors.New(u.ERROR_SIGNATURE_UNKNOWN_KEY)
+	}
+
+	// The date must be inside the window
+	window := signatureWindow()
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil || date.Before(time.Now().Add(-window)) || date.After(time.Now().Add(window)) {
+		return "", errors.New(u.ERROR_SIGNATURE_EXPIRED)
+	}
+
+	// The digest must match the body
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", errors.New(u.ERROR_INVALID_JSON)
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewBuffer(body)) // To Read body again in handler
+	if !hmac.Equal([]byte(r.Header.Get("Digest")), []byte(digest(body))) {
+		return "", errors.New(u.ERROR_SIGNATURE_DIGEST)
+	}
+
+	expected := sign(signingString(r, headers), key.Secret)
+	if !hmac.Equal([]byte(expected), []byte(params["signature"])) {
+		return "", errors.New(u.ERROR_SIGNATURE_INVALID)
+	}
+
+	// Only valid signatures consume the nonce
+	nonce := r.Header.Get("X-Nonce")
+	if nonce == "" {
+		return "", errors.New(u.ERROR_SIGNATURE_MALFORMED)
+	}
+	if err := models.UseRequestNonce(keyID, nonce, window); err != nil {
+		return "", err
+	}
+
+	return keyID, nil
+}
+
+// signatureWindow returns the time a signed request is accepted (REQUEST_SIGNING_WINDOW, default 5m)
+func signatureWindow() time.Duration {
+	window, err := time.ParseDuration(os.Getenv("REQUEST_SIGNING_WINDOW"))
+	if err != nil || window <= 0 {
+		return 5 * time.Minute
+	}
+	return window
+}
+
+// parseSignatureHeader parses the comma separated key="value" pairs of the Signature header
+func parseSignatureHeader(header string) map[string]string {
+	params := map[string]string{}
+	for _, param := range strings.Split(header, ",") {
+		pair := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(pair) == 2 {
+			params[pair[0]] = strings.Trim(pair[1], `"`)
+		}
+	}
+	return params
+}
+
+// signingString builds the string signed by the client with the listed headers
+func signingString(r *http.Request, headers []string) string {
+	lines := make([]string, 0, len(headers))
+	for _, header := range headers {
+		if header == "(request-target)" {
+			lines = append(lines, fmt.Sprintf("(request-target): %s %s", strings.ToLower(r.Method), r.URL.RequestURI()))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: %s", header, strings.TrimSpace(r.Header.Get(header))))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func sign(signingString string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signingString))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -4,4 +4,6 @@ type BeneficiaryParty struct {
 	ID                   uint64 `json:"-" gorm:"primary_key"`
 	*DebtorPartySkeleton `gorm:"embedded"`
 	AccountType          int `json:"account_type"`
+	// Name of the bank of the beneficiary, from the bank directory
+	BankName string `json:"bank_name,omitempty"`
 }
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"os"
+	"payments/infrastructure"
+	"payments/utils"
+	"time"
+)
+
+const ACCOUNT_TOKEN_VERIFY_EMAIL = "verify_email"
+const ACCOUNT_TOKEN_RESET_PASSWORD = "reset_password"
+
+const VERIFY_EMAIL_EXPIRATION = 48 * time.Hour
+const RESET_PASSWORD_EXPIRATION = time.Hour
+
+// AccountToken is a single use token sent by email to verify the email or reset the password
+// Only the SHA-256 of the token is stored
+type AccountToken struct {
+	ID          uint64 `gorm:"primary_key"`
+	AccountID   uint   `gorm:"index"`
+	Purpose     string
+	Email       string
+	HashedToken string `gorm:"unique_index"`
+	ExpiresAt   time.Time
+	UsedAt      *time.Time
+	CreatedAt   time.Time
+}
+
+// AccountTokenRequest is the token, and new password, sent by the user
+type AccountTokenRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password,omitempty"`
+}
+
+// SendEmailVerification sends a token to verify the email
+func (a *Account) SendEmailVerification(email string) error {
+	token, err := createAccountToken(a.ID, ACCOUNT_TOKEN_VERIFY_EMAIL, email, VERIFY_EMAIL_EXPIRATION)
+	if err != nil {
+		return err
+	}
+
+	return infrastructure.GetMailer().Send(infrastructure.Email{
+		To:      email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Use the link below to verify your email. It expires in %s.\n\n%s/verify-email?token=%s\n",
+			VERIFY_EMAIL_EXPIRATION, os.Getenv("APP_URL"), token),
+	})
+}
+
+// SendPasswordReset sends a token to reset the password
+func (a *Account) SendPasswordReset() error {
+	// Only the last requested token can be used
+	if err := invalidateAccountTokens(a.ID, ACCOUNT_TOKEN_RESET_PASSWORD); err != nil {
+		return err
+	}
+
+	token, err := createAccountToken(a.ID, ACCOUNT_TOKEN_RESET_PASSWORD, a.Email, RESET_PASSWORD_EXPIRATION)
+	if err != nil {
+		return err
+	}
+
+	return infrastructure.GetMailer().Send(infrastructure.Email{
+		To:      a.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use the link below to choose a new password. It expires in %s.\nIf you did not ask to reset your password ignore this email.\n\n%s/reset-password?token=%s\n",
+			RESET_PASSWORD_EXPIRATION, os.Getenv("APP_URL"), token),
+	})
+}
+
+// GetValidAccountToken Get the token for the purpose if it was not used and did not expire
+func GetValidAccountToken(token string, purpose string) (AccountToken, error) {
+	accountToken := AccountToken{}
+
+	err := infrastructure.GetDB().Where("hashed_token = ? AND purpose = ?", hashAccountToken(token), purpose).First(&accountToken).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return accountToken, errors.New(utils.ERROR_ACCOUNT_TOKEN_INVALID)
+		}
+		return accountToken, errors.New(utils.ERROR_SERVER)
+	}
+
+	if accountToken.UsedAt != nil || accountToken.ExpiresAt.Before(time.Now()) {
+		return accountToken, errors.New(utils.ERROR_ACCOUNT_TOKEN_INVALID)
+	}
+
+	return accountToken, nil
+}
+
+// UseAccountToken Get the valid token for the purpose and marks it as used
+func UseAccountToken(token string, purpose string) (AccountToken, error) {
+	accountToken, err := GetValidAccountToken(token, purpose)
+	if err != nil {
+		return accountToken, err
+	}
+	return accountToken, accountToken.Use()
+}
+
+// Use marks the token as used, only one request can use the token
+func (t *AccountToken) Use() error {
+	result := infrastructure.GetDB().Model(t).Where("used_at IS NULL").UpdateColumn("used_at", time.Now())
+	if result.Error != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New(utils.ERROR_ACCOUNT_TOKEN_INVALID)
+	}
+	return nil
+}
+
+// createAccountToken creates a random token and stores its hash
+func createAccountToken(accountID uint, purpose string, email string, expiration time.Duration) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+
+	accountToken := AccountToken{
+		AccountID:   accountID,
+		Purpose:     purpose,
+		Email:       email,
+		HashedToken: hashAccountToken(token),
+		ExpiresAt:   time.Now().Add(expiration),
+	}
+	if err := infrastructure.GetDB().Create(&accountToken).Error; err != nil {
+		return "", errors.New(utils.ERROR_SERVER)
+	}
+
+	return token, nil
+}
+
+// invalidateAccountTokens marks the unused tokens of the account for the purpose as used
+func invalidateAccountTokens(accountID uint, purpose string) error {
+	err := infrastructure.GetDB().Model(&AccountToken{}).
+		Where("account_id = ? AND purpose = ? AND used_at IS NULL", accountID, purpose).
+		UpdateColumn("used_at", time.Now()).Error
+	if err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
+
+func hashAccountToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -4,11 +4,12 @@ import (
 	"errors"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/jinzhu/gorm"
-	"golang.org/x/crypto/bcrypt"
+	"net/mail"
 	"os"
 	"payments/infrastructure"
 	"payments/utils"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,33 +17,110 @@ import (
 JWT claims struct
 */
 type Token struct {
-	UserId uint
+	UserId  uint
+	Purpose string `json:"purpose,omitempty"`
 	jwt.StandardClaims
 }
 
-//a struct to rep user account
+const ROLE_USER = "user"
+const ROLE_ADMIN = "admin"
+
+// Purpose of the token issued after the password when the account has two-factor authentication
+// It can only be exchanged for a full token in the MFA login
+const TOKEN_PURPOSE_MFA = "mfa"
+
+// a struct to rep user account
 type Account struct {
 	gorm.Model
-	Email    string `json:"email"`
-	Password string `json:"password"`
-	Token    string `json:"token";sql:"-"`
+	Email           string `json:"email"`
+	EmailVerified   bool   `json:"email_verified"`
+	Password        string `json:"password"`
+	Role            string `json:"role"`
+	TOTPEnabled     bool   `json:"totp_enabled"`
+	TOTPSecret      string `json:"-"`
+	TOTPLastCounter uint64 `json:"-"`
+	Disabled        bool   `json:"disabled"`
+	// Tokens issued before are refused, set when the password changes or the account is disabled
+	TokensValidAfter *time.Time `json:"-"`
+	Token            string     `json:"token" sql:"-"`
+}
+
+// AccountUpdateRequest is the new password or email sent by the user, confirmed with the current password
+type AccountUpdateRequest struct {
+	CurrentPassword string `json:"current_password"`
+	Password        string `json:"password,omitempty"`
+	Email           string `json:"email,omitempty"`
 }
 
 // CreateToken creates a token after a success login
-func (a *Account) CreateToken() {
-	tk := &Token{
-		UserId: a.ID,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 12).Unix(),
-		}}
-	token := jwt.NewWithClaims(jwt.GetSigningMethod("HS256"), tk)
-	a.Token, _ = token.SignedString([]byte(os.Getenv("token_password")))
+// The token is signed with the current key of the key ring and carries its kid in the header
+func (a *Account) CreateToken() error {
+	var err error
+	a.Token, err = signToken(&Token{UserId: a.ID}, time.Hour*12)
+	return err
+}
+
+// CreateChallengeToken creates the short-lived token returned by the login when a TOTP code is still required
+func (a *Account) CreateChallengeToken() (string, error) {
+	return signToken(&Token{UserId: a.ID, Purpose: TOKEN_PURPOSE_MFA}, time.Minute*5)
+}
+
+// signToken signs the claims with the current key of the key ring
+func signToken(tk *Token, duration time.Duration) (string, error) {
+	key, err := infrastructure.GetKeyRing().SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	tk.IssuedAt = now.Unix()
+	tk.ExpiresAt = now.Add(duration).Unix()
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), tk)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// ParseToken parses and verifies a token signed by CreateToken
+// The token must reference a known kid and use the algorithm of that key, any other algorithm is refused
+func ParseToken(tokenString string) (*Token, error) {
+	return parseToken(tokenString, "")
+}
+
+// ParseChallengeToken parses and verifies a token signed by CreateChallengeToken
+func ParseChallengeToken(tokenString string) (*Token, error) {
+	return parseToken(tokenString, TOKEN_PURPOSE_MFA)
+}
+
+func parseToken(tokenString string, purpose string) (*Token, error) {
+	tk := &Token{}
+	token, err := jwt.ParseWithClaims(tokenString, tk, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := infrastructure.GetKeyRing().Key(kid)
+		if !ok {
+			return nil, errors.New(utils.ERROR_TOKEN_UNKNOWN_KEY)
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, errors.New(utils.ERROR_TOKEN_ALGORITHM)
+		}
+		return key.PublicKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || tk.Purpose != purpose {
+		return nil, errors.New(utils.ERROR_TOKEN_INVALID)
+	}
+
+	return tk, nil
 }
 
 // IsEmailValid check if email is valid
 func (a *Account) IsEmailValid() error {
-	// Check if Email contains @ character
-	if !strings.Contains(a.Email, "@") {
+	// Check if Email is a plain address with a domain (RFC 5322)
+	address, err := mail.ParseAddress(a.Email)
+	if err != nil || address.Address != a.Email || !strings.Contains(a.Email[strings.LastIndex(a.Email, "@"):], ".") {
 		return errors.New(utils.ERROR_EMAIL_REQUIRED)
 	}
 
@@ -59,30 +137,182 @@ func (a *Account) IsEmailValid() error {
 	return nil
 }
 
-// IsPasswordValid check if password is valid
-func (a *Account) IsPasswordValid() bool {
-	// Check if Password has 6 or more characters
-	return len(a.Password) >= 6
+// ValidatePassword check if password follows the password policy
+func (a *Account) ValidatePassword() error {
+	return GetPasswordPolicy().Validate(a.Password, a.Email)
 }
 
-// CreateHashedPassword check if password is valid
+// CreateHashedPassword replaces the password by its argon2id hash
 func (a *Account) CreateHashedPassword() error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(a.Password), bcrypt.DefaultCost)
+	hashedPassword, err := HashPassword(a.Password, GetArgon2Params())
 	if err == nil {
-		a.Password = string(hashedPassword)
+		a.Password = hashedPassword
 	}
 	return err
 }
 
+// AssignRole sets the role of a new account, emails listed in ADMIN_EMAILS are admins
+func (a *Account) AssignRole() {
+	a.Role = ROLE_USER
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if strings.TrimSpace(email) != "" && strings.EqualFold(strings.TrimSpace(email), a.Email) {
+			a.Role = ROLE_ADMIN
+		}
+	}
+}
+
+// IsAdmin check if the account is an admin
+// The email must be verified, otherwise anyone signing up with an email of ADMIN_EMAILS would be an admin
+func (a *Account) IsAdmin() bool {
+	return a.Role == ROLE_ADMIN && a.EmailVerified
+}
+
 // CheckPassword check if the password is correct to the user
 func (a *Account) CheckPassword(password string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(a.Password), []byte(password))
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword { //Password does not match!
+	if !ComparePassword(a.Password, password) { //Password does not match!
 		return errors.New(utils.ERROR_INVALID_LOGIN)
 	}
 	return nil
 }
 
+// PasswordNeedsRehash check if the stored hash is bcrypt or uses old argon2id parameters
+func (a *Account) PasswordNeedsRehash() bool {
+	return PasswordNeedsRehash(a.Password, GetArgon2Params())
+}
+
+// CheckDummyPassword spends the same time as CheckPassword, used when the account does not exist
+func CheckDummyPassword(password string) {
+	dummyPasswordOnce.Do(func() {
+		dummyPasswordHash, _ = HashPassword("dummy password", GetArgon2Params())
+	})
+	ComparePassword(dummyPasswordHash, password)
+}
+
+var dummyPasswordHash string
+var dummyPasswordOnce sync.Once
+
+// IsTokenRevoked check if the token was issued before the tokens of the account were revoked
+// The issue time has a precision of seconds, tokens issued in the second of the revocation are still accepted
+func (a *Account) IsTokenRevoked(tk *Token) bool {
+	return a.TokensValidAfter != nil && tk.IssuedAt < a.TokensValidAfter.Unix()
+}
+
+// RevokeTokens refuses all tokens issued until now
+func (a *Account) RevokeTokens() error {
+	return a.update(map[string]interface{}{"tokens_valid_after": time.Now()})
+}
+
+// ChangePassword validates and stores the new password, revoking the tokens and password resets issued before
+func (a *Account) ChangePassword(password string) error {
+	newPassword := Account{Email: a.Email, Password: password}
+	if err := newPassword.ValidatePassword(); err != nil {
+		return err
+	}
+	if err := newPassword.CreateHashedPassword(); err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+
+	if err := a.update(map[string]interface{}{"password": newPassword.Password, "tokens_valid_after": time.Now()}); err != nil {
+		return err
+	}
+
+	// The pending resets are cancelled once the password changed
+	return invalidateAccountTokens(a.ID, ACCOUNT_TOKEN_RESET_PASSWORD)
+}
+
+// ChangeEmail sends a verification to the new email, the email only changes when it is verified
+func (a *Account) ChangeEmail(email string) error {
+	newEmail := Account{Email: email}
+	if err := newEmail.IsEmailValid(); err != nil {
+		return err
+	}
+
+	// Only the last requested email can be verified
+	if err := invalidateAccountTokens(a.ID, ACCOUNT_TOKEN_VERIFY_EMAIL); err != nil {
+		return err
+	}
+
+	return a.SendEmailVerification(email)
+}
+
+// VerifyEmail marks the email of the token as verified, replacing the email of the account if it was changed
+func (a *Account) VerifyEmail(email string) error {
+	if a.Email == email {
+		return a.update(map[string]interface{}{"email_verified": true})
+	}
+
+	// The email could be taken by other account since the change was requested
+	newEmail := Account{Email: email}
+	if err := newEmail.IsEmailValid(); err != nil {
+		return err
+	}
+
+	// Password resets were sent to the old email
+	if err := invalidateAccountTokens(a.ID, ACCOUNT_TOKEN_RESET_PASSWORD); err != nil {
+		return err
+	}
+
+	return a.update(map[string]interface{}{"email": email, "email_verified": true})
+}
+
+// SetDisabled disables or enables the account. Disabling revokes the tokens, so enabling does not accept them again
+func (a *Account) SetDisabled(disabled bool) error {
+	fields := map[string]interface{}{"disabled": disabled}
+	if disabled {
+		fields["tokens_valid_after"] = time.Now()
+	}
+	return a.update(fields)
+}
+
+// Delete removes the account, revoking its tokens, api keys, signing keys, client certificates and memberships
+// Payments are kept. The only owner of an organisation can not be deleted
+func (a *Account) Delete() error {
+	if err := checkNotLastOwner(a.ID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tx := infrastructure.GetDB().Begin()
+
+	err := tx.Where("account_id = ?", a.ID).Delete(&Membership{}).Error
+	if err == nil {
+		err = tx.Model(&ApiKey{}).Where("account_id = ? AND revoked_at IS NULL", a.ID).UpdateColumn("revoked_at", now).Error
+	}
+	if err == nil {
+		err = tx.Model(&RequestSigningKey{}).Where("account_id = ? AND revoked_at IS NULL", a.ID).UpdateColumn("revoked_at", now).Error
+	}
+	if err == nil {
+		// Hard delete, the subject is unique and must be available to register again
+		err = tx.Unscoped().Where("account_id = ?", a.ID).Delete(&ClientCertificate{}).Error
+	}
+	if err == nil {
+		err = tx.Model(&AccountToken{}).Where("account_id = ? AND used_at IS NULL", a.ID).UpdateColumn("used_at", now).Error
+	}
+	if err == nil {
+		err = tx.Model(a).UpdateColumn("tokens_valid_after", now).Error
+	}
+	if err == nil {
+		err = tx.Delete(a).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return errors.New(utils.ERROR_SERVER)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
+
+// update stores the fields of the account
+func (a *Account) update(fields map[string]interface{}) error {
+	if err := infrastructure.GetDB().Model(a).Updates(fields).Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
+
 // GetAccountByEmail Get a account model through an email
 func GetAccountByEmail(email string) (Account, error) {
 	account := Account{}
@@ -92,3 +322,27 @@ func GetAccountByEmail(email string) (Account, error) {
 	}
 	return account, nil
 }
+
+// GetAccountByID Get a account model through an ID
+func GetAccountByID(id uint) (Account, error) {
+	account := Account{}
+	if err := infrastructure.GetDB().Where("id = ?", id).First(&account).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return account, errors.New(utils.ERROR_RESOURCE_NOT_FOUND)
+		}
+		return account, errors.New(utils.ERROR_SERVER)
+	}
+	return account, nil
+}
+
+// GetAccounts Get all accounts, for the admins
+func GetAccounts() ([]Account, error) {
+	accounts := []Account{}
+	if err := infrastructure.GetDB().Order("id").Find(&accounts).Error; err != nil {
+		return accounts, errors.New(utils.ERROR_SERVER)
+	}
+	for i := range accounts {
+		accounts[i].Password = ""
+	}
+	return accounts, nil
+}
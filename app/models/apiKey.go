@@ -0,0 +1,175 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"payments/infrastructure"
+	"payments/utils"
+	"strings"
+	"time"
+)
+
+const SCOPE_PAYMENTS_READ = "payments:read"
+const SCOPE_PAYMENTS_WRITE = "payments:write"
+
+// Scopes that can be granted to api keys
+var Scopes = []string{SCOPE_PAYMENTS_READ, SCOPE_PAYMENTS_WRITE}
+
+const apiKeyPrefix = "pk_"
+
+// ApiKey is a credential used by machines to call the api without a user password
+// Only the SHA-256 of the secret is stored, the key is returned once when it is created
+type ApiKey struct {
+	gorm.Model
+	AccountID      uint       `json:"account_id"`
+	OrganisationID *uuid.UUID `json:"organisation_id,omitempty" sql:",type:uuid"`
+	Name           string     `json:"name"`
+	Prefix         string     `json:"prefix" gorm:"unique_index"`
+	HashedSecret   string     `json:"-"`
+	Scopes         []string   `json:"scopes" sql:"-"`
+	ScopeList      string     `json:"-"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	Key            string     `json:"key,omitempty" sql:"-"`
+}
+
+// BeforeSave stores the scopes as a space separated list
+func (k *ApiKey) BeforeSave() error {
+	k.ScopeList = strings.Join(k.Scopes, " ")
+	return nil
+}
+
+// AfterFind loads the scopes from the space separated list
+func (k *ApiKey) AfterFind() error {
+	k.Scopes = strings.Fields(k.ScopeList)
+	return nil
+}
+
+// IsValid check if the name and scopes of a new key are valid
+func (k *ApiKey) IsValid() error {
+	if strings.TrimSpace(k.Name) == "" {
+		return errors.New(utils.ERROR_API_KEY_NAME_REQUIRED)
+	}
+
+	if len(k.Scopes) == 0 {
+		return errors.New(utils.ERROR_API_KEY_SCOPE_REQUIRED)
+	}
+
+	for _, scope := range k.Scopes {
+		if !isKnownScope(scope) {
+			return errors.New(utils.ERROR_API_KEY_SCOPE_INVALID)
+		}
+	}
+
+	if k.ExpiresAt != nil && k.ExpiresAt.Before(time.Now()) {
+		return errors.New(utils.ERROR_API_KEY_EXPIRATION_INVALID)
+	}
+
+	return nil
+}
+
+// GenerateKey creates the key returned to the client and stores its hash
+// The key has the format pk_<prefix>.<secret>, the prefix is used to find the key
+func (k *ApiKey) GenerateKey() error {
+	prefix := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(prefix); err != nil {
+		return err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+
+	k.Prefix = hex.EncodeToString(prefix)
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	k.HashedSecret = hashApiKeySecret(encodedSecret)
+	k.Key = apiKeyPrefix + k.Prefix + "." + encodedSecret
+	return nil
+}
+
+// IsActive check if the key was not revoked and did not expire
+func (k *ApiKey) IsActive() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(time.Now()))
+}
+
+// HasScope check if the key was granted the scope
+func (k *ApiKey) HasScope(scope string) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticateApiKey Get the active api key matching the key sent by the client
+func AuthenticateApiKey(key string) (ApiKey, error) {
+	apiKey := ApiKey{}
+
+	parts := strings.SplitN(strings.TrimPrefix(key, apiKeyPrefix), ".", 2)
+	if !strings.HasPrefix(key, apiKeyPrefix) || len(parts) != 2 {
+		return apiKey, errors.New(utils.ERROR_API_KEY_INVALID)
+	}
+
+	err := infrastructure.GetDB().Where("prefix = ?", parts[0]).First(&apiKey).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return apiKey, errors.New(utils.ERROR_API_KEY_INVALID)
+		}
+		return apiKey, errors.New(utils.ERROR_SERVER)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.HashedSecret), []byte(hashApiKeySecret(parts[1]))) != 1 || !apiKey.IsActive() {
+		return apiKey, errors.New(utils.ERROR_API_KEY_INVALID)
+	}
+
+	now := time.Now()
+	apiKey.LastUsedAt = &now
+	infrastructure.GetDB().Model(&apiKey).UpdateColumn("last_used_at", now)
+
+	return apiKey, nil
+}
+
+// GetApiKeysByAccount Get all api keys created by the account
+func GetApiKeysByAccount(accountID uint) ([]ApiKey, error) {
+	apiKeys := []ApiKey{}
+	if err := infrastructure.GetDB().Where("account_id = ?", accountID).Order("id").Find(&apiKeys).Error; err != nil {
+		return apiKeys, errors.New(utils.ERROR_SERVER)
+	}
+	return apiKeys, nil
+}
+
+// GetApiKeyByID Get an api key created by the account
+func GetApiKeyByID(id uint, accountID uint) (ApiKey, error) {
+	apiKey := ApiKey{}
+	if err := infrastructure.GetDB().Where("id = ? AND account_id = ?", id, accountID).First(&apiKey).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return apiKey, errors.New(utils.ERROR_RESOURCE_NOT_FOUND)
+		}
+		return apiKey, errors.New(utils.ERROR_SERVER)
+	}
+	return apiKey, nil
+}
+
+// hashApiKeySecret returns the hex SHA-256 of the secret
+// Keys are random with 256 bits so a slow hash is not needed
+func hashApiKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func isKnownScope(scope string) bool {
+	for _, known := range Scopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"payments/infrastructure"
+	"payments/utils"
+	"time"
+)
+
+const AUDIT_ACCOUNT_LOCKED = "account.locked"
+const AUDIT_IP_LOCKED = "ip.locked"
+const AUDIT_LOCKOUT_CLEARED = "lockout.cleared"
+const AUDIT_PASSWORD_CHANGED = "account.password_changed"
+const AUDIT_EMAIL_CHANGED = "account.email_changed"
+const AUDIT_ACCOUNT_DISABLED = "account.disabled"
+const AUDIT_ACCOUNT_ENABLED = "account.enabled"
+const AUDIT_ACCOUNT_DELETED = "account.deleted"
+const AUDIT_CERTIFICATE_REGISTERED = "certificate.registered"
+const AUDIT_ORGANISATION_CLAIMED = "organisation.claimed"
+
+// AuditEvent is a security relevant event kept for the admins
+type AuditEvent struct {
+	ID        uint64    `json:"id" gorm:"primary_key"`
+	Type      string    `json:"type" gorm:"index"`
+	AccountID *uint     `json:"account_id,omitempty"`
+	ActorID   *uint     `json:"actor_id,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RecordAuditEvent stores the event and writes it to the log
+func RecordAuditEvent(event AuditEvent) error {
+	infrastructure.GetLog().WithFields(logrus.Fields{
+		"type":       event.Type,
+		"account_id": event.AccountID,
+		"actor_id":   event.ActorID,
+		"ip":         event.IP,
+		"details":    event.Details,
+	}).Warn("Audit Event")
+
+	if err := infrastructure.GetDB().Create(&event).Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
+
+// GetAuditEvents Get the most recent audit events
+func GetAuditEvents(limit int) ([]AuditEvent, error) {
+	events := []AuditEvent{}
+	if err := infrastructure.GetDB().Order("id desc").Limit(limit).Find(&events).Error; err != nil {
+		return events, errors.New(utils.ERROR_SERVER)
+	}
+	return events, nil
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"payments/infrastructure"
+	"payments/utils"
+	"strings"
+)
+
+// ClientCertificate maps the subject of a client certificate to the account authenticated by it (mutual TLS)
+// The subject is the RFC 2253 distinguished name, e.g. CN=payments,O=Bank A,C=GB
+type ClientCertificate struct {
+	gorm.Model
+	AccountID uint   `json:"account_id"`
+	Subject   string `json:"subject" gorm:"unique_index"`
+}
+
+// IsValid check if the subject of a new certificate mapping is valid and not used by other account
+func (c *ClientCertificate) IsValid() error {
+	c.Subject = strings.TrimSpace(c.Subject)
+	if c.Subject == "" {
+		return errors.New(utils.ERROR_CERTIFICATE_SUBJECT_REQUIRED)
+	}
+
+	_, err := GetClientCertificateBySubject(c.Subject)
+	if err == nil {
+		return errors.New(utils.ERROR_CERTIFICATE_SUBJECT_ALREADY_EXISTS)
+	} else if err.Error() != utils.ERROR_CERTIFICATE_UNKNOWN {
+		return err
+	}
+
+	return nil
+}
+
+// GetClientCertificateBySubject Get the certificate mapping of a subject
+func GetClientCertificateBySubject(subject string) (ClientCertificate, error) {
+	certificate := ClientCertificate{}
+	if err := infrastructure.GetDB().Where("subject = ?", subject).First(&certificate).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return certificate, errors.New(utils.ERROR_CERTIFICATE_UNKNOWN)
+		}
+		return certificate, errors.New(utils.ERROR_SERVER)
+	}
+	return certificate, nil
+}
+
+// GetClientCertificatesByAccount Get all certificate mappings of the account
+func GetClientCertificatesByAccount(accountID uint) ([]ClientCertificate, error) {
+	certificates := []ClientCertificate{}
+	if err := infrastructure.GetDB().Where("account_id = ?", accountID).Order("id").Find(&certificates).Error; err != nil {
+		return certificates, errors.New(utils.ERROR_SERVER)
+	}
+	return certificates, nil
+}
+
+// GetClientCertificateByID Get a certificate mapping of the account
+func GetClientCertificateByID(id uint, accountID uint) (ClientCertificate, error) {
+	certificate := ClientCertificate{}
+	if err := infrastructure.GetDB().Where("id = ? AND account_id = ?", id, accountID).First(&certificate).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return certificate, errors.New(utils.ERROR_RESOURCE_NOT_FOUND)
+		}
+		return certificate, errors.New(utils.ERROR_SERVER)
+	}
+	return certificate, nil
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"payments/infrastructure"
+	"payments/utils"
+	"strings"
+	"time"
+)
+
+const LOGIN_MAX_EMAIL_FAILURES = 10
+const LOGIN_MAX_IP_FAILURES = 50
+const LOGIN_DELAY_AFTER_FAILURES = 3
+const LOGIN_MAX_DELAY = time.Minute
+const LOGIN_LOCKOUT_DURATION = 15 * time.Minute
+const LOGIN_FAILURE_WINDOW = 15 * time.Minute
+
+// LoginThrottle tracks the failed logins of an email or an ip address
+// After LOGIN_DELAY_AFTER_FAILURES failures each attempt must wait a delay that doubles with every failure,
+// after the maximum failures the key is locked during LOGIN_LOCKOUT_DURATION or until an admin clears it
+type LoginThrottle struct {
+	ID            uint64     `json:"id" gorm:"primary_key"`
+	Key           string     `json:"key" gorm:"unique_index"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// EmailThrottleKey returns the throttle key of an email, used for existing and non existing accounts alike
+func EmailThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// IPThrottleKey returns the throttle key of an ip address
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// IsLocked check if the key is locked
+func (t *LoginThrottle) IsLocked(now time.Time) bool {
+	return t.LockedUntil != nil && t.LockedUntil.After(now)
+}
+
+// Wait returns the time until the next login attempt is allowed
+func (t *LoginThrottle) Wait(now time.Time) time.Duration {
+	if t.IsLocked(now) {
+		return t.LockedUntil.Sub(now)
+	}
+
+	if t.isStale(now) || t.Failures < LOGIN_DELAY_AFTER_FAILURES {
+		return 0
+	}
+
+	delay := LOGIN_MAX_DELAY
+	if shift := uint(t.Failures - LOGIN_DELAY_AFTER_FAILURES); shift < 6 {
+		delay = time.Second << shift
+	}
+	if delay > LOGIN_MAX_DELAY {
+		delay = LOGIN_MAX_DELAY
+	}
+
+	if next := t.LastFailureAt.Add(delay); next.After(now) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// isStale check if the failures are older than the failure window and the key is not locked
+func (t *LoginThrottle) isStale(now time.Time) bool {
+	return !t.IsLocked(now) && t.LastFailureAt.Before(now.Add(-LOGIN_FAILURE_WINDOW))
+}
+
+// GetLoginThrottle Get the throttle of a key, an empty throttle is returned if the key has no failures
+func GetLoginThrottle(key string) (LoginThrottle, error) {
+	throttle := LoginThrottle{Key: key}
+	err := infrastructure.GetDB().Where("key = ?", key).First(&throttle).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return throttle, errors.New(utils.ERROR_SERVER)
+	}
+	return throttle, nil
+}
+
+// GetLoginThrottleByID Get a throttle through an ID
+func GetLoginThrottleByID(id uint64) (LoginThrottle, error) {
+	throttle := LoginThrottle{}
+	if err := infrastructure.GetDB().Where("id = ?", id).First(&throttle).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return throttle, errors.New(utils.ERROR_RESOURCE_NOT_FOUND)
+		}
+		return throttle, errors.New(utils.ERROR_SERVER)
+	}
+	return throttle, nil
+}
+
+// GetLockedLoginThrottles Get all keys currently locked
+func GetLockedLoginThrottles() ([]LoginThrottle, error) {
+	throttles := []LoginThrottle{}
+	if err := infrastructure.GetDB().Where("locked_until > ?", time.Now()).Order("id").Find(&throttles).Error; err != nil {
+		return throttles, errors.New(utils.ERROR_SERVER)
+	}
+	return throttles, nil
+}
+
+// LoginWait returns the longest wait of the keys before a new login attempt
+func LoginWait(keys ...string) (time.Duration, error) {
+	var wait time.Duration
+	now := time.Now()
+	for _, key := range keys {
+		throttle, err := GetLoginThrottle(key)
+		if err != nil {
+			return 0, err
+		}
+		if keyWait := throttle.Wait(now); keyWait > wait {
+			wait = keyWait
+		}
+	}
+	return wait, nil
+}
+
+// RecordLoginFailure counts a failed login of the key and returns true when the key was locked by this failure
+// The failure is counted with a single upsert, so parallel failures are all counted, and the lock is set by the
+// first failure that reaches the maximum. Failures older than the failure window restart from one
+func RecordLoginFailure(key string, maxFailures int) (bool, error) {
+	now := time.Now()
+	stale := "(login_throttles.locked_until IS NULL OR login_throttles.locked_until <= ?) AND login_throttles.last_failure_at < ?"
+	windowStart := now.Add(-LOGIN_FAILURE_WINDOW)
+
+	throttle := LoginThrottle{}
+	err := infrastructure.GetDB().Raw(`INSERT INTO login_throttles (key, failures, last_failure_at) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+		failures = CASE WHEN `+stale+` THEN 1 ELSE login_throttles.failures + 1 END,
+		locked_until = CASE WHEN `+stale+` THEN NULL ELSE login_throttles.locked_until END,
+		last_failure_at = EXCLUDED.last_failure_at
+		RETURNING id, key, failures, last_failure_at, locked_until`,
+		key, now, now, windowStart, now, windowStart).Scan(&throttle).Error
+	if err != nil {
+		return false, errors.New(utils.ERROR_SERVER)
+	}
+
+	if throttle.Failures < maxFailures || throttle.IsLocked(now) {
+		return false, nil
+	}
+
+	// Only one of the parallel failures locks the key
+	result := infrastructure.GetDB().Exec("UPDATE login_throttles SET locked_until = ? WHERE id = ? AND (locked_until IS NULL OR locked_until <= ?)",
+		now.Add(LOGIN_LOCKOUT_DURATION), throttle.ID, now)
+	if result.Error != nil {
+		return false, errors.New(utils.ERROR_SERVER)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ClearLoginThrottle removes the failures of the key
+func ClearLoginThrottle(key string) error {
+	if err := infrastructure.GetDB().Where("key = ?", key).Delete(&LoginThrottle{}).Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"payments/infrastructure"
+	"payments/utils"
+	"time"
+)
+
+// Status of the direct debit mandates
+// Active mandates accept collections. A mandate becomes dormant when it is not collected for MANDATE_DORMANCY_MONTHS,
+// and a new mandate must be set up with the debtor. Cancelled and dormant mandates can not be collected anymore
+const MANDATE_ACTIVE = "active"
+const MANDATE_DORMANT = "dormant"
+const MANDATE_CANCELLED = "cancelled"
+
+// Months without collection after which a mandate is dormant (Bacs Direct Debit rules)
+const MANDATE_DORMANCY_MONTHS = 13
+
+// MandateParty is the creditor or the debtor of a mandate, with the account the collections are paid to or from
+type MandateParty struct {
+	Name              string `json:"name"`
+	AccountName       string `json:"account_name"`
+	AccountNumber     string `json:"account_number"`
+	AccountNumberCode string `json:"account_number_code"`
+	BankID            string `json:"bank_id"`
+	BankIDCode        string `json:"bank_id_code"`
+}
+
+// Mandate is the authorisation of a debtor for the creditor to collect payments from its account
+type Mandate struct {
+	ID             uuid.UUID `gorm:"primary_key" json:"id" sql:",type:uuid"`
+	OrganisationID uuid.UUID `json:"organisation_id" gorm:"index;unique_index:idx_mandates_reference" sql:",type:uuid"`
+	// Reference of the mandate, unique in the organisation, given to the debtor and sent with every collection
+	Reference string `json:"reference" gorm:"unique_index:idx_mandates_reference"`
+	Scheme    string `json:"scheme"`
+	Status    string `json:"status" gorm:"index"`
+	// Identifier of the creditor in the scheme, the service user number (SUN) of Bacs
+	CreditorID string       `json:"creditor_id"`
+	Creditor   MandateParty `json:"creditor" gorm:"embedded;embedded_prefix:creditor_"`
+	Debtor     MandateParty `json:"debtor" gorm:"embedded;embedded_prefix:debtor_"`
+	// Number of collections, and processing date of the last one
+	Collections        uint       `json:"collections"`
+	LastCollectionDate string     `json:"last_collection_date,omitempty"`
+	SignatureKeyID     string     `json:"signature_key_id,omitempty"`
+	CancelledAt        *time.Time `json:"cancelled_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// Refresh makes an active mandate dormant when it was not collected for MANDATE_DORMANCY_MONTHS at the time
+// The months are counted from the last collection, or from the set up of a mandate never collected
+func (m *Mandate) Refresh(now time.Time) {
+	if m.Status != MANDATE_ACTIVE {
+		return
+	}
+	last := m.CreatedAt
+	if date, err := time.Parse("2006-01-02", m.LastCollectionDate); err == nil && date.After(last) {
+		last = date
+	}
+	if !last.IsZero() && !now.Before(last.AddDate(0, MANDATE_DORMANCY_MONTHS, 0)) {
+		m.Status = MANDATE_DORMANT
+	}
+}
+
+// GetMandateByID Get a mandate through an ID
+func GetMandateByID(id uuid.UUID) (Mandate, error) {
+	mandate := Mandate{}
+	if err := infrastructure.GetDB().Where("id = ?", id).First(&mandate).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return mandate, errors.New(utils.ERROR_RESOURCE_NOT_FOUND)
+		}
+		return mandate, errors.New(utils.ERROR_SERVER)
+	}
+	return mandate, nil
+}
+
+// GetMandateByReference Get the mandate of an organisation through its reference
+func GetMandateByReference(organisationID uuid.UUID, reference string) (Mandate, error) {
+	mandate := Mandate{}
+	if err := infrastructure.GetDB().Where("organisation_id = ? AND reference = ?", organisationID, reference).First(&mandate).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return mandate, errors.New(utils.ERROR_RESOURCE_NOT_FOUND)
+		}
+		return mandate, errors.New(utils.ERROR_SERVER)
+	}
+	return mandate, nil
+}
+
+// GetMandates Get the mandates of an organisation
+func GetMandates(organisationID uuid.UUID) ([]Mandate, error) {
+	mandates := []Mandate{}
+	if err := infrastructure.GetDB().Where("organisation_id = ?", organisationID).Order("created_at").Find(&mandates).Error; err != nil {
+		return mandates, errors.New(utils.ERROR_SERVER)
+	}
+	return mandates, nil
+}
+
+// GetCollections Get the payments collected with a mandate
+func GetCollections(mandateID uuid.UUID) ([]Payment, error) {
+	payments := []Payment{}
+	if err := infrastructure.GetDB().Set("gorm:auto_preload", true).Where("mandate_id = ?", mandateID).Order("id").Find(&payments).Error; err != nil {
+		return payments, errors.New(utils.ERROR_SERVER)
+	}
+	return payments, nil
+}
+
+// UpdateMandate locks the mandate, applies the change and saves the mandate
+// The row stays locked during the change, so it does not race with the collections of the mandate
+// The errors of the change are returned as they are
+func UpdateMandate(id uuid.UUID, change func(mandate *Mandate) error) (Mandate, error) {
+	mandate := Mandate{}
+	tx := infrastructure.GetDB().Begin()
+
+	if err := lockMandate(tx, id, &mandate); err != nil {
+		tx.Rollback()
+		return mandate, err
+	}
+
+	if err := change(&mandate); err != nil {
+		tx.Rollback()
+		return mandate, err
+	}
+
+	if err := tx.Save(&mandate).Error; err != nil {
+		tx.Rollback()
+		return mandate, errors.New(utils.ERROR_SERVER)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return mandate, errors.New(utils.ERROR_SERVER)
+	}
+	return mandate, nil
+}
+
+// CollectMandate locks the mandate, creates the payment returned by collect with its event and counts the collection
+// The mandate can not be cancelled or amended while its payment is created. The errors of collect are returned as they are
+func CollectMandate(id uuid.UUID, collect func(mandate *Mandate) (Payment, error)) (Payment, error) {
+	mandate := Mandate{}
+	tx := infrastructure.GetDB().Begin()
+
+	if err := lockMandate(tx, id, &mandate); err != nil {
+		tx.Rollback()
+		return Payment{}, err
+	}
+
+	payment, err := collect(&mandate)
+	if err != nil {
+		tx.Rollback()
+		return payment, err
+	}
+
+	mandateID := mandate.ID
+	payment.MandateID = &mandateID
+	if err := tx.Create(&payment).Error; err != nil {
+		tx.Rollback()
+		return payment, errors.New(utils.ERROR_SERVER)
+	}
+	if err := RecordPaymentEvent(tx, EVENT_PAYMENT_CREATED, payment); err != nil {
+		tx.Rollback()
+		return payment, err
+	}
+
+	mandate.Collections++
+	if payment.Attributes.ProcessingDate > mandate.LastCollectionDate {
+		mandate.LastCollectionDate = payment.Attributes.ProcessingDate
+	}
+	if err := tx.Save(&mandate).Error; err != nil {
+		tx.Rollback()
+		return payment, errors.New(utils.ERROR_SERVER)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return payment, errors.New(utils.ERROR_SERVER)
+	}
+	return payment, nil
+}
+
+func lockMandate(tx *gorm.DB, id uuid.UUID, mandate *Mandate) error {
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", id).First(mandate).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return errors.New(utils.ERROR_RESOURCE_NOT_FOUND)
+		}
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"payments/infrastructure"
+	"payments/utils"
+	"strings"
+	"time"
+)
+
+const RECOVERY_CODES = 10
+
+// RecoveryCode is a single use code to login when the TOTP device is lost, only the hash is stored
+type RecoveryCode struct {
+	ID         uint64 `gorm:"primary_key"`
+	AccountID  uint   `gorm:"index"`
+	HashedCode string
+	UsedAt     *time.Time
+}
+
+// TOTPEnrolment is returned when the user starts the TOTP enrolment
+type TOTPEnrolment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// MFARequest is the TOTP or recovery code sent by the user
+type MFARequest struct {
+	ChallengeToken string `json:"challenge_token,omitempty"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code,omitempty"`
+}
+
+// MFAChallenge is returned by the login when the account has two-factor authentication
+type MFAChallenge struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+}
+
+// StartTOTPEnrolment generates a new secret, not enabled until confirmed with a code
+func (a *Account) StartTOTPEnrolment() (TOTPEnrolment, error) {
+	if a.TOTPEnabled {
+		return TOTPEnrolment{}, errors.New(utils.ERROR_TOTP_ALREADY_ENABLED)
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return TOTPEnrolment{}, err
+	}
+
+	if err := infrastructure.GetDB().Model(a).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_counter": 0}).Error; err != nil {
+		return TOTPEnrolment{}, errors.New(utils.ERROR_SERVER)
+	}
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "Payments API"
+	}
+
+	return TOTPEnrolment{Secret: secret, URI: utils.TOTPURI(issuer, a.Email, secret)}, nil
+}
+
+// ConfirmTOTPEnrolment enables TOTP after a valid code and returns new recovery codes
+func (a *Account) ConfirmTOTPEnrolment(code string) ([]string, error) {
+	if a.TOTPEnabled {
+		return nil, errors.New(utils.ERROR_TOTP_ALREADY_ENABLED)
+	}
+	if a.TOTPSecret == "" {
+		return nil, errors.New(utils.ERROR_TOTP_NOT_ENROLLED)
+	}
+
+	if err := a.CheckTOTP(code); err != nil {
+		return nil, err
+	}
+
+	codes, err := a.generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := infrastructure.GetDB().Model(a).Update("totp_enabled", true).Error; err != nil {
+		return nil, errors.New(utils.ERROR_SERVER)
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP disables TOTP and removes the secret and recovery codes
+func (a *Account) DisableTOTP() error {
+	db := infrastructure.GetDB()
+	if err := db.Where("account_id = ?", a.ID).Delete(&RecoveryCode{}).Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	if err := db.Model(a).Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_counter": 0}).Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
+
+// CheckTOTP check if the code is valid, each code can only be used once
+func (a *Account) CheckTOTP(code string) error {
+	counter, ok := utils.ValidateTOTP(a.TOTPSecret, strings.TrimSpace(code), time.Now(), a.TOTPLastCounter)
+	if !ok {
+		return errors.New(utils.ERROR_TOTP_INVALID)
+	}
+
+	// Only one request can use the counter
+	result := infrastructure.GetDB().Model(&Account{}).
+		Where("id = ? AND totp_last_counter < ?", a.ID, counter).
+		UpdateColumn("totp_last_counter", counter)
+	if result.Error != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New(utils.ERROR_TOTP_INVALID)
+	}
+
+	a.TOTPLastCounter = counter
+	return nil
+}
+
+// UseRecoveryCode check if the recovery code is valid and marks it as used
+func (a *Account) UseRecoveryCode(code string) error {
+	codes := []RecoveryCode{}
+	if err := infrastructure.GetDB().Where("account_id = ? AND used_at IS NULL", a.ID).Find(&codes).Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+
+	normalized := strings.ToUpper(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+	for _, recoveryCode := range codes {
+		if bcrypt.CompareHashAndPassword([]byte(recoveryCode.HashedCode), []byte(normalized)) == nil {
+			result := infrastructure.GetDB().Model(&recoveryCode).Where("used_at IS NULL").UpdateColumn("used_at", time.Now())
+			if result.Error != nil {
+				return errors.New(utils.ERROR_SERVER)
+			}
+			if result.RowsAffected == 0 {
+				break
+			}
+			return nil
+		}
+	}
+
+	return errors.New(utils.ERROR_TOTP_INVALID)
+}
+
+// generateRecoveryCodes replaces the recovery codes of the account
+func (a *Account) generateRecoveryCodes() ([]string, error) {
+	db := infrastructure.GetDB()
+	if err := db.Where("account_id = ?", a.ID).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, errors.New(utils.ERROR_SERVER)
+	}
+
+	codes := make([]string, 0, RECOVERY_CODES)
+	for i := 0; i < RECOVERY_CODES; i++ {
+		random := make([]byte, 10)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+
+		code := base32.StdEncoding.EncodeToString(random)[:10]
+		hashedCode, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := db.Create(&RecoveryCode{AccountID: a.ID, HashedCode: string(hashedCode)}).Error; err != nil {
+			return nil, errors.New(utils.ERROR_SERVER)
+		}
+
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+
+	return codes, nil
+}
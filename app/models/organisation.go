@@ -0,0 +1,404 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"os"
+	"payments/infrastructure"
+	"payments/utils"
+	"strings"
+	"time"
+)
+
+// Roles of the members of an organisation
+// Members read and create payments, admins also manage the members and owners also delete the organisation
+const ORGANISATION_ROLE_OWNER = "owner"
+const ORGANISATION_ROLE_ADMIN = "admin"
+const ORGANISATION_ROLE_MEMBER = "member"
+
+const INVITATION_EXPIRATION = 7 * 24 * time.Hour
+
+// Organisation owns payments, accounts access them through a membership
+type Organisation struct {
+	ID        uuid.UUID  `gorm:"primary_key" json:"id" sql:",type:uuid"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"-" sql:"index"`
+}
+
+// Membership gives an account a role in an organisation
+type Membership struct {
+	ID             uint      `json:"id" gorm:"primary_key"`
+	OrganisationID uuid.UUID `json:"organisation_id" gorm:"unique_index:idx_membership" sql:",type:uuid"`
+	AccountID      uint      `json:"account_id" gorm:"unique_index:idx_membership"`
+	Email          string    `json:"email,omitempty" sql:"-"`
+	Role           string    `json:"role"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Invitation is sent by email to join an organisation, only the SHA-256 of the token is stored
+type Invitation struct {
+	ID             uint       `json:"id" gorm:"primary_key"`
+	OrganisationID uuid.UUID  `json:"organisation_id" gorm:"index" sql:",type:uuid"`
+	Email          string     `json:"email"`
+	Role           string     `json:"role"`
+	InvitedBy      uint       `json:"invited_by"`
+	HashedToken    string     `json:"-" gorm:"unique_index"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// InvitationAcceptRequest is the invitation token sent by the invited user
+type InvitationAcceptRequest struct {
+	Token string `json:"token"`
+}
+
+// IsValid check if the name of the organisation is valid
+func (o *Organisation) IsValid() error {
+	o.Name = strings.TrimSpace(o.Name)
+	if o.Name == "" {
+		return errors.New(utils.ERROR_ORGANISATION_NAME_REQUIRED)
+	}
+	return nil
+}
+
+// Create stores the organisation with the account as its owner
+// The id is always generated, so an account cannot create the organisation of payments it does not own
+func (o *Organisation) Create(owner uint) error {
+	o.ID = uuid.NewV4()
+
+	tx := infrastructure.GetDB().Begin()
+	if err := tx.Create(o).Error; err != nil {
+		tx.Rollback()
+		return errors.New(utils.ERROR_SERVER)
+	}
+	if err := tx.Create(&Membership{OrganisationID: o.ID, AccountID: owner, Role: ORGANISATION_ROLE_OWNER}).Error; err != nil {
+		tx.Rollback()
+		return errors.New(utils.ERROR_SERVER)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
+
+// Claim makes the account the owner of an organisation without owner, like the organisations created for the payments
+// stored before the organisations
+func (o *Organisation) Claim(owner uint) (Membership, error) {
+	membership := Membership{}
+
+	tx := infrastructure.GetDB().Begin()
+	// Locks the organisation, so two claims cannot both find it without owner
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", o.ID).First(&Organisation{}).Error; err != nil {
+		tx.Rollback()
+		return membership, errors.New(utils.ERROR_SERVER)
+	}
+
+	var owners int
+	if err := tx.Model(&Membership{}).Where("organisation_id = ? AND role = ?", o.ID, ORGANISATION_ROLE_OWNER).Count(&owners).Error; err != nil {
+		tx.Rollback()
+		return membership, errors.New(utils.ERROR_SERVER)
+	}
+	if owners > 0 {
+		tx.Rollback()
+		return membership, errors.New(utils.ERROR_ORGANISATION_HAS_OWNER)
+	}
+
+	err := tx.Where(Membership{OrganisationID: o.ID, AccountID: owner}).Assign(Membership{Role: ORGANISATION_ROLE_OWNER}).FirstOrCreate(&membership).Error
+	if err != nil {
+		tx.Rollback()
+		return membership, errors.New(utils.ERROR_SERVER)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return membership, errors.New(utils.ERROR_SERVER)
+	}
+	return membership, nil
+}
+
+// CreateMissingOrganisations creates, without members, the organisations of the payments stored before the organisations,
+// and returns the number of organisations created. Admins give them an owner with Claim
+func CreateMissingOrganisations() (int64, error) {
+	result := infrastructure.GetDB().Exec(`INSERT INTO organisations (id, name, created_at, updated_at)
+		SELECT DISTINCT organisation_id, 'Organisation ' || organisation_id, now(), now() FROM payments
+		WHERE organisation_id IS NOT NULL AND organisation_id NOT IN (SELECT id FROM organisations)`)
+	if result.Error != nil {
+		return 0, errors.New(utils.ERROR_SERVER)
+	}
+	return result.RowsAffected, nil
+}
+
+// Delete removes the organisation, its memberships and pending invitations. Payments are kept
+func (o *Organisation) Delete() error {
+	tx := infrastructure.GetDB().Begin()
+
+	err := tx.Where("organisation_id = ?", o.ID).Delete(&Membership{}).Error
+	if err == nil {
+		err = tx.Where("organisation_id = ? AND accepted_at IS NULL", o.ID).Delete(&Invitation{}).Error
+	}
+	if err == nil {
+		err = tx.Delete(o).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return errors.New(utils.ERROR_SERVER)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
+
+// Invite sends an invitation to join the organisation to the email
+func (o *Organisation) Invite(email string, role string, invitedBy uint) (Invitation, error) {
+	invitation := Invitation{OrganisationID: o.ID, Email: strings.TrimSpace(email), Role: role, InvitedBy: invitedBy}
+
+	if !strings.Contains(invitation.Email, "@") {
+		return invitation, errors.New(utils.ERROR_EMAIL_REQUIRED)
+	}
+	if !IsOrganisationRole(role) {
+		return invitation, errors.New(utils.ERROR_ORGANISATION_ROLE_INVALID)
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return invitation, errors.New(utils.ERROR_SERVER)
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+
+	invitation.HashedToken = hashAccountToken(token)
+	invitation.ExpiresAt = time.Now().Add(INVITATION_EXPIRATION)
+	if err := infrastructure.GetDB().Create(&invitation).Error; err != nil {
+		return invitation, errors.New(utils.ERROR_SERVER)
+	}
+
+	err := infrastructure.GetMailer().Send(infrastructure.Email{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("Invitation to join %s", o.Name),
+		Body: fmt.Sprintf("You were invited to join %s as %s. Use the link below to accept the invitation. It expires in %s.\n\n%s/accept-invitation?token=%s\n",
+			o.Name, role, INVITATION_EXPIRATION, os.Getenv("APP_URL"), token),
+	})
+	if err != nil {
+		return invitation, errors.New(utils.ERROR_SERVER)
+	}
+
+	return invitation, nil
+}
+
+// AcceptInvitation adds the account to the organisation of the invitation
+// The invitation can only be accepted by the account of the invited email
+func AcceptInvitation(token string, account Account) (Membership, error) {
+	membership := Membership{}
+	invitation := Invitation{}
+
+	if err := infrastructure.GetDB().Where("hashed_token = ?", hashAccountToken(token)).First(&invitation).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return membership, errors.New(utils.ERROR_INVITATION_INVALID)
+		}
+		return membership, errors.New(utils.ERROR_SERVER)
+	}
+
+	if invitation.AcceptedAt != nil || invitation.ExpiresAt.Before(time.Now()) || !strings.EqualFold(invitation.Email, account.Email) {
+		return membership, errors.New(utils.ERROR_INVITATION_INVALID)
+	}
+
+	if _, err := GetOrganisationByID(invitation.OrganisationID); err != nil {
+		if err.Error() == utils.ERROR_SERVER {
+			return membership, err
+		}
+		return membership, errors.New(utils.ERROR_INVITATION_INVALID)
+	}
+
+	// Members keep their role
+	membership, err := GetMembership(invitation.OrganisationID, account.ID)
+	if err != nil && err.Error() != utils.ERROR_ORGANISATION_FORBIDDEN {
+		return membership, err
+	}
+
+	tx := infrastructure.GetDB().Begin()
+	result := tx.Model(&invitation).Where("accepted_at IS NULL").UpdateColumn("accepted_at", time.Now())
+	if result.Error != nil {
+		tx.Rollback()
+		return membership, errors.New(utils.ERROR_SERVER)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return membership, errors.New(utils.ERROR_INVITATION_INVALID)
+	}
+	if err != nil {
+		membership = Membership{OrganisationID: invitation.OrganisationID, AccountID: account.ID, Role: invitation.Role}
+		if err := tx.Create(&membership).Error; err != nil {
+			tx.Rollback()
+			return membership, errors.New(utils.ERROR_SERVER)
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return membership, errors.New(utils.ERROR_SERVER)
+	}
+
+	return membership, nil
+}
+
+// CanManageMembers check if the member can invite, change and remove members
+func (m *Membership) CanManageMembers() bool {
+	return m.Role == ORGANISATION_ROLE_OWNER || m.Role == ORGANISATION_ROLE_ADMIN
+}
+
+// IsOwner check if the member is an owner of the organisation
+func (m *Membership) IsOwner() bool {
+	return m.Role == ORGANISATION_ROLE_OWNER
+}
+
+// SetRole changes the role of the member. The organisation must keep one owner
+func (m *Membership) SetRole(role string) error {
+	if !IsOrganisationRole(role) {
+		return errors.New(utils.ERROR_ORGANISATION_ROLE_INVALID)
+	}
+
+	if m.IsOwner() && role != ORGANISATION_ROLE_OWNER {
+		if err := m.checkOtherOwner(); err != nil {
+			return err
+		}
+	}
+
+	if err := infrastructure.GetDB().Model(m).UpdateColumn("role", role).Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
+
+// Delete removes the member from the organisation. The organisation must keep one owner
+func (m *Membership) Delete() error {
+	if m.IsOwner() {
+		if err := m.checkOtherOwner(); err != nil {
+			return err
+		}
+	}
+
+	if err := infrastructure.GetDB().Delete(m).Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
+
+func (m *Membership) checkOtherOwner() error {
+	var owners int
+	err := infrastructure.GetDB().Model(&Membership{}).
+		Where("organisation_id = ? AND role = ? AND id <> ?", m.OrganisationID, ORGANISATION_ROLE_OWNER, m.ID).
+		Count(&owners).Error
+	if err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	if owners == 0 {
+		return errors.New(utils.ERROR_ORGANISATION_LAST_OWNER)
+	}
+	return nil
+}
+
+// IsOrganisationRole check if the role is a known organisation role
+func IsOrganisationRole(role string) bool {
+	return role == ORGANISATION_ROLE_OWNER || role == ORGANISATION_ROLE_ADMIN || role == ORGANISATION_ROLE_MEMBER
+}
+
+// GetOrganisationByID Get an organisation through an ID
+func GetOrganisationByID(id uuid.UUID) (Organisation, error) {
+	organisation := Organisation{}
+	if err := infrastructure.GetDB().Where("id = ?", id).First(&organisation).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return organisation, errors.New(utils.ERROR_RESOURCE_NOT_FOUND)
+		}
+		return organisation, errors.New(utils.ERROR_SERVER)
+	}
+	return organisation, nil
+}
+
+// GetOrganisationsByAccount Get the organisations the account is a member of
+func GetOrganisationsByAccount(accountID uint) ([]Organisation, error) {
+	organisations := []Organisation{}
+	err := infrastructure.GetDB().
+		Joins("JOIN memberships ON memberships.organisation_id = organisations.id").
+		Where("memberships.account_id = ?", accountID).
+		Order("organisations.created_at").
+		Find(&organisations).Error
+	if err != nil {
+		return organisations, errors.New(utils.ERROR_SERVER)
+	}
+	return organisations, nil
+}
+
+// GetMembership Get the membership of the account in the organisation
+// Returns ERROR_ORGANISATION_FORBIDDEN if the account is not a member
+func GetMembership(organisationID uuid.UUID, accountID uint) (Membership, error) {
+	membership := Membership{}
+	err := infrastructure.GetDB().Where("organisation_id = ? AND account_id = ?", organisationID, accountID).First(&membership).Error
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return membership, errors.New(utils.ERROR_ORGANISATION_FORBIDDEN)
+		}
+		return membership, errors.New(utils.ERROR_SERVER)
+	}
+	return membership, nil
+}
+
+// GetMembershipsByOrganisation Get the members of the organisation with their email
+func GetMembershipsByOrganisation(organisationID uuid.UUID) ([]Membership, error) {
+	memberships := []Membership{}
+	if err := infrastructure.GetDB().Where("organisation_id = ?", organisationID).Order("id").Find(&memberships).Error; err != nil {
+		return memberships, errors.New(utils.ERROR_SERVER)
+	}
+
+	accountIDs := make([]uint, 0, len(memberships))
+	for _, membership := range memberships {
+		accountIDs = append(accountIDs, membership.AccountID)
+	}
+
+	accounts := []Account{}
+	if err := infrastructure.GetDB().Where("id IN (?)", accountIDs).Find(&accounts).Error; err != nil {
+		return memberships, errors.New(utils.ERROR_SERVER)
+	}
+
+	emails := map[uint]string{}
+	for _, account := range accounts {
+		emails[account.ID] = account.Email
+	}
+	for i := range memberships {
+		memberships[i].Email = emails[memberships[i].AccountID]
+	}
+
+	return memberships, nil
+}
+
+// checkNotLastOwner check if the account is not the only owner of an organisation
+func checkNotLastOwner(accountID uint) error {
+	memberships := []Membership{}
+	err := infrastructure.GetDB().Where("account_id = ? AND role = ?", accountID, ORGANISATION_ROLE_OWNER).Find(&memberships).Error
+	if err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+
+	for _, membership := range memberships {
+		if err := membership.checkOtherOwner(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPendingInvitations Get the invitations of the organisation that were not accepted and did not expire
+func GetPendingInvitations(organisationID uuid.UUID) ([]Invitation, error) {
+	invitations := []Invitation{}
+	err := infrastructure.GetDB().
+		Where("organisation_id = ? AND accepted_at IS NULL AND expires_at > ?", organisationID, time.Now()).
+		Order("id").
+		Find(&invitations).Error
+	if err != nil {
+		return invitations, errors.New(utils.ERROR_SERVER)
+	}
+	return invitations, nil
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"payments/utils"
+	"time"
+)
+
+// Types of the payment events
+const EVENT_PAYMENT_CREATED = "payment.created"
+const EVENT_PAYMENT_UPDATED = "payment.updated"
+const EVENT_PAYMENT_DELETED = "payment.deleted"
+
+// EVENT_PAYMENT_STATUS_CHANGED is recorded when the scheduler submits a payment or the payment fails
+const EVENT_PAYMENT_STATUS_CHANGED = "payment.status_changed"
+
+// OutboxEvent is a payment event waiting to be published by the outbox relay
+// The events are recorded in the transaction of the change of the payment, so an event exists if and only if the
+// change was committed. The sequence orders the events of a payment
+type OutboxEvent struct {
+	Sequence       uint64    `gorm:"primary_key" json:"sequence"`
+	EventID        uuid.UUID `json:"id" sql:",type:uuid"`
+	Type           string    `json:"type"`
+	OrganisationID uuid.UUID `json:"organisation_id" sql:",type:uuid"`
+	PaymentID      uuid.UUID `json:"payment_id" gorm:"index" sql:",type:uuid"`
+	// The payment after the change, as JSON
+	Payload   string    `json:"-" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at"`
+	// Set once the event is published to every sink
+	PublishedAt *time.Time `json:"published_at,omitempty" gorm:"index"`
+	Attempts    uint       `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	// Claim of the relay publishing the event, which publishes it until the time
+	ClaimToken   string     `json:"-"`
+	ClaimedUntil *time.Time `json:"-"`
+}
+
+// RecordPaymentEvent adds the event of the payment to the outbox, with the transaction that changes the payment
+func RecordPaymentEvent(tx *gorm.DB, eventType string, payment Payment) error {
+	payload, err := json.Marshal(payment)
+	if err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+
+	event := OutboxEvent{
+		EventID:        uuid.NewV4(),
+		Type:           eventType,
+		OrganisationID: payment.OrganisationID,
+		PaymentID:      payment.ID,
+		Payload:        string(payload),
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"payments/infrastructure"
+	"payments/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Argon2Params are the argon2id parameters, stored in each hash so they can change without breaking old hashes
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// PasswordPolicy are the rules new passwords must follow
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// SHA-1 (uppercase hex) of known breached passwords
+	Breached map[string]bool
+}
+
+var passwordPolicy *PasswordPolicy
+var passwordPolicyOnce sync.Once
+
+// GetPasswordPolicy returns the policy configured by the environment
+// PASSWORD_MIN_LENGTH: minimum number of characters (default 8)
+// PASSWORD_BREACHED_LIST: file with breached passwords, one per line, in plain text or as SHA-1 hex (with an optional :count suffix)
+func GetPasswordPolicy() *PasswordPolicy {
+	passwordPolicyOnce.Do(func() {
+		passwordPolicy = &PasswordPolicy{MinLength: 8, MaxLength: 128, Breached: map[string]bool{}}
+
+		if minLength, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && minLength > 0 {
+			passwordPolicy.MinLength = minLength
+		}
+
+		if file := os.Getenv("PASSWORD_BREACHED_LIST"); file != "" {
+			if err := passwordPolicy.LoadBreachedList(file); err != nil {
+				panic(err)
+			}
+		}
+	})
+	return passwordPolicy
+}
+
+// LoadBreachedList adds the passwords of the file to the breached passwords
+func (p *PasswordPolicy) LoadBreachedList(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if hash := strings.SplitN(line, ":", 2)[0]; len(hash) == 40 {
+			if _, err := hex.DecodeString(hash); err == nil {
+				p.Breached[strings.ToUpper(hash)] = true
+				continue
+			}
+		}
+		p.Breached[sha1Hex(line)] = true
+	}
+
+	return scanner.Err()
+}
+
+// Validate check if the password of the account follows the policy
+func (p *PasswordPolicy) Validate(password string, email string) error {
+	length := utf8.RuneCountInString(password)
+	if length == 0 {
+		return errors.New(utils.ERROR_PASSWORD_REQUIRED)
+	}
+	if length < p.MinLength {
+		return fmt.Errorf("%s (at least %d characters)", utils.ERROR_PASSWORD_TOO_SHORT, p.MinLength)
+	}
+	if length > p.MaxLength {
+		return errors.New(utils.ERROR_PASSWORD_TOO_LONG)
+	}
+
+	// The password can not contain the email or its local part
+	lowerPassword := strings.ToLower(password)
+	localPart := strings.ToLower(strings.SplitN(email, "@", 2)[0])
+	if email != "" && (strings.Contains(lowerPassword, strings.ToLower(email)) || (len(localPart) >= 3 && strings.Contains(lowerPassword, localPart))) {
+		return errors.New(utils.ERROR_PASSWORD_CONTAINS_EMAIL)
+	}
+
+	if p.Breached[sha1Hex(password)] {
+		return errors.New(utils.ERROR_PASSWORD_BREACHED)
+	}
+
+	return nil
+}
+
+// GetArgon2Params returns the parameters for new hashes configured by the environment
+// ARGON2_MEMORY (KiB, default 65536), ARGON2_ITERATIONS (default 3), ARGON2_PARALLELISM (default 2)
+func GetArgon2Params() Argon2Params {
+	params := Argon2Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+
+	if memory, err := strconv.ParseUint(os.Getenv("ARGON2_MEMORY"), 10, 32); err == nil && memory > 0 {
+		params.Memory = uint32(memory)
+	}
+	if iterations, err := strconv.ParseUint(os.Getenv("ARGON2_ITERATIONS"), 10, 32); err == nil && iterations > 0 {
+		params.Iterations = uint32(iterations)
+	}
+	if parallelism, err := strconv.ParseUint(os.Getenv("ARGON2_PARALLELISM"), 10, 8); err == nil && parallelism > 0 {
+		params.Parallelism = uint8(parallelism)
+	}
+
+	return params
+}
+
+// HashPassword hashes the password with argon2id in the PHC string format
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func HashPassword(password string, params Argon2Params) (string, error) {
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// ComparePassword check if the password matches the hash, argon2id and bcrypt hashes are supported
+func ComparePassword(hash string, password string) bool {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+
+	params, salt, key, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return false
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return subtle.ConstantTimeCompare(key, otherKey) == 1
+}
+
+// PasswordNeedsRehash check if the hash is not argon2id or uses other parameters than the current ones
+func PasswordNeedsRehash(hash string, current Argon2Params) bool {
+	params, salt, _, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != current.Memory || params.Iterations != current.Iterations ||
+		params.Parallelism != current.Parallelism || params.KeyLength != current.KeyLength || uint32(len(salt)) != current.SaltLength
+}
+
+// decodeArgon2Hash reads the parameters, salt and key of an argon2id hash
+func decodeArgon2Hash(hash string) (Argon2Params, []byte, []byte, error) {
+	params := Argon2Params{}
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// RehashPassword replaces the stored hash of the account with a new argon2id hash of the password
+// Used after a successful login, when the password is known, to upgrade old hashes
+func (a *Account) RehashPassword(password string) error {
+	hash, err := HashPassword(password, GetArgon2Params())
+	if err != nil {
+		return err
+	}
+
+	if err := infrastructure.GetDB().Model(a).UpdateColumn("password", hash).Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	a.Password = hash
+	return nil
+}
+
+func sha1Hex(value string) string {
+	sum := sha1.Sum([]byte(value))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
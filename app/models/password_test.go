@@ -0,0 +1,92 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"payments/utils"
+	"strings"
+	"testing"
+)
+
+// Small parameters to keep the tests fast
+var testArgon2Params = Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("dummypassword", testArgon2Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+	assert.True(t, ComparePassword(hash, "dummypassword"))
+	assert.False(t, ComparePassword(hash, "wrongpassword"))
+
+	// Salted, the same password has different hashes
+	otherHash, _ := HashPassword("dummypassword", testArgon2Params)
+	assert.NotEqual(t, hash, otherHash)
+}
+
+func TestComparePasswordWithBcryptHash(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("dummypassword"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, ComparePassword(string(hash), "dummypassword"))
+	assert.False(t, ComparePassword(string(hash), "wrongpassword"))
+	assert.False(t, ComparePassword("dummypassword", "dummypassword"), "Plain text password accepted")
+	assert.False(t, ComparePassword("$argon2id$v=19$m=1024,t=1,p=1$invalid", "dummypassword"))
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	hash, _ := HashPassword("dummypassword", testArgon2Params)
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("dummypassword"), bcrypt.MinCost)
+
+	stronger := testArgon2Params
+	stronger.Iterations = 2
+
+	assert.False(t, PasswordNeedsRehash(hash, testArgon2Params))
+	assert.True(t, PasswordNeedsRehash(hash, stronger))
+	assert.True(t, PasswordNeedsRehash(string(bcryptHash), testArgon2Params))
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := &PasswordPolicy{MinLength: 8, MaxLength: 128, Breached: map[string]bool{}}
+
+	assert.Nil(t, policy.Validate("dummypassword", "dummyemail@dummy.com"))
+	assert.EqualError(t, policy.Validate("", "dummyemail@dummy.com"), utils.ERROR_PASSWORD_REQUIRED)
+	assert.EqualError(t, policy.Validate("short", "dummyemail@dummy.com"), utils.ERROR_PASSWORD_TOO_SHORT+" (at least 8 characters)")
+	assert.EqualError(t, policy.Validate(strings.Repeat("a", 129), "dummyemail@dummy.com"), utils.ERROR_PASSWORD_TOO_LONG)
+	assert.EqualError(t, policy.Validate("xDummyEmail@dummy.com", "dummyemail@dummy.com"), utils.ERROR_PASSWORD_CONTAINS_EMAIL)
+	assert.EqualError(t, policy.Validate("dummyemail123", "dummyemail@dummy.com"), utils.ERROR_PASSWORD_CONTAINS_EMAIL)
+
+	// Length is counted in characters, not bytes
+	assert.Nil(t, policy.Validate("pässwörd", ""))
+}
+
+func TestPasswordPolicyBreachedList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "passwords")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Plain text and SHA-1 of "password123" in the Have I Been Pwned format
+	file := filepath.Join(dir, "breached.txt")
+	content := "qwertyuiop\nCBFDAC6008F9CAB4083784CBD1874F76618D2A97:12345\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &PasswordPolicy{MinLength: 8, MaxLength: 128, Breached: map[string]bool{}}
+	if err := policy.LoadBreachedList(file); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.EqualError(t, policy.Validate("qwertyuiop", ""), utils.ERROR_PASSWORD_BREACHED)
+	assert.EqualError(t, policy.Validate("password123", ""), utils.ERROR_PASSWORD_BREACHED)
+	assert.Nil(t, policy.Validate("dummypassword", ""))
+}
@@ -6,14 +6,46 @@ import (
 	"github.com/satori/go.uuid"
 	"payments/infrastructure"
 	"payments/utils"
+	"time"
 )
 
+// Status of the payments
+// Pending payments are submitted by the scheduler on their processing date, and fail after the last attempt
+// Submitting payments are claimed by a scheduler until their next attempt, and can not be changed meanwhile
+const PAYMENT_STATUS_PENDING = "pending"
+const PAYMENT_STATUS_SUBMITTING = "submitting"
+const PAYMENT_STATUS_SUBMITTED = "submitted"
+const PAYMENT_STATUS_FAILED = "failed"
+
 type Payment struct {
 	Type           string     `json:"type"`
 	ID             uuid.UUID  `gorm:"primary_key" json:"id" sql:",type:uuid"`
 	Version        uint       `json:"version"`
 	OrganisationID uuid.UUID  `json:"organisation_id" sql:",type:uuid"`
 	Attributes     Attributes `json:"attributes" gorm:"foreignkey:PaymentRefer"`
+	SignatureKeyID string     `json:"signature_key_id,omitempty"`
+	Status         string     `json:"status,omitempty" gorm:"index"`
+	Attempts       uint       `json:"attempts,omitempty"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	SubmittedAt    *time.Time `json:"submitted_at,omitempty"`
+	// Claim of the scheduler submitting the payment
+	ClaimToken string `json:"-"`
+	// Standing order that generated the payment
+	StandingOrderID *uuid.UUID `json:"standing_order_id,omitempty" gorm:"index" sql:",type:uuid"`
+	// Direct debit mandate the payment is collected with
+	MandateID *uuid.UUID `json:"mandate_id,omitempty" gorm:"index" sql:",type:uuid"`
+}
+
+// Schedule makes the payment pending, to be submitted by the scheduler on its processing date
+// The status sent by the clients is ignored
+func (p *Payment) Schedule() {
+	p.Status = PAYMENT_STATUS_PENDING
+	p.Attempts = 0
+	p.NextAttemptAt = nil
+	p.LastError = ""
+	p.SubmittedAt = nil
+	p.ClaimToken = ""
 }
 
 // GetPaymentByID Get a payment model through an ID
@@ -27,3 +59,117 @@ func GetPaymentByID(id uuid.UUID) (Payment, error) {
 	}
 	return payment, nil
 }
+
+// GetPayments Get the payments of an organisation, optionally only the ones processed on a date (YYYY-MM-DD)
+func GetPayments(organisationID uuid.UUID, processingDate string) ([]Payment, error) {
+	payments := []Payment{}
+	query := infrastructure.GetDB().Set("gorm:auto_preload", true).Where("organisation_id = ?", organisationID)
+	if processingDate != "" {
+		query = query.Where("id IN (?)", infrastructure.GetDB().Table("attributes").Select("payment_refer").Where("processing_date = ?", processingDate).QueryExpr())
+	}
+	if err := query.Order("id").Find(&payments).Error; err != nil {
+		return payments, errors.New(utils.ERROR_SERVER)
+	}
+	return payments, nil
+}
+
+// GetPaymentsByAccount Get the payments of the organisations the account is a member of, only the ones of the
+// organisation when it is given
+func GetPaymentsByAccount(accountID uint, organisationID *uuid.UUID) ([]Payment, error) {
+	payments := []Payment{}
+	query := infrastructure.GetDB().Set("gorm:auto_preload", true).
+		Where("organisation_id IN (?)", infrastructure.GetDB().Table("memberships").Select("organisation_id").Where("account_id = ?", accountID).QueryExpr())
+	if organisationID != nil {
+		query = query.Where("organisation_id = ?", *organisationID)
+	}
+	if err := query.Find(&payments).Error; err != nil {
+		return payments, errors.New(utils.ERROR_SERVER)
+	}
+	return payments, nil
+}
+
+// CreatePayment creates the payment with its payment.created event
+func CreatePayment(payment *Payment) error {
+	tx := infrastructure.GetDB().Begin()
+
+	if err := tx.Create(payment).Error; err != nil {
+		tx.Rollback()
+		return errors.New(utils.ERROR_SERVER)
+	}
+	if err := RecordPaymentEvent(tx, EVENT_PAYMENT_CREATED, *payment); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
+
+// SavePayment replaces the payment, unless it was already submitted, and records its payment.updated event
+// The row is locked during the update, so the scheduler can not submit the payment meanwhile
+func SavePayment(payment *Payment) error {
+	tx := infrastructure.GetDB().Begin()
+
+	current := Payment{}
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", payment.ID).First(&current).Error; err != nil {
+		tx.Rollback()
+		if gorm.IsRecordNotFoundError(err) {
+			return errors.New(utils.ERROR_RESOURCE_NOT_FOUND)
+		}
+		return errors.New(utils.ERROR_SERVER)
+	}
+	if current.Status == PAYMENT_STATUS_SUBMITTED {
+		tx.Rollback()
+		return errors.New(utils.ERROR_PAYMENT_SUBMITTED)
+	}
+	if current.Status == PAYMENT_STATUS_SUBMITTING {
+		tx.Rollback()
+		return errors.New(utils.ERROR_PAYMENT_SUBMITTING)
+	}
+
+	if err := tx.Save(payment).Error; err != nil {
+		tx.Rollback()
+		return errors.New(utils.ERROR_SERVER)
+	}
+	if err := RecordPaymentEvent(tx, EVENT_PAYMENT_UPDATED, *payment); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
+
+// DeletePayment deletes the payment and records its payment.deleted event, with the payment before the deletion
+// The row is locked, so the payment is not submitted while it is deleted, and a payment being submitted is not deleted
+func DeletePayment(payment *Payment) error {
+	tx := infrastructure.GetDB().Begin()
+
+	current := Payment{}
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", payment.ID).First(&current).Error; err != nil {
+		tx.Rollback()
+		if gorm.IsRecordNotFoundError(err) {
+			return errors.New(utils.ERROR_RESOURCE_NOT_FOUND)
+		}
+		return errors.New(utils.ERROR_SERVER)
+	}
+	if current.Status == PAYMENT_STATUS_SUBMITTING {
+		tx.Rollback()
+		return errors.New(utils.ERROR_PAYMENT_SUBMITTING)
+	}
+
+	if err := tx.Delete(payment).Error; err != nil {
+		tx.Rollback()
+		return errors.New(utils.ERROR_SERVER)
+	}
+	if err := RecordPaymentEvent(tx, EVENT_PAYMENT_DELETED, *payment); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
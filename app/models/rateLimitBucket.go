@@ -0,0 +1,102 @@
+package models
+
+import (
+	"errors"
+	"github.com/jinzhu/gorm"
+	"math"
+	"payments/infrastructure"
+	"payments/utils"
+	"time"
+)
+
+// RateLimitBucket is the token bucket of a client for a rate limit rule
+// The bucket holds up to Limit tokens and refills Limit tokens per Period, each request takes one token
+type RateLimitBucket struct {
+	Key       string `gorm:"primary_key"`
+	Tokens    float64
+	UpdatedAt time.Time `gorm:"index"`
+}
+
+// Take refills the bucket up to now and takes one token. Returns false, without taking, if the bucket is empty
+func (b *RateLimitBucket) Take(limit int, period time.Duration, now time.Time) bool {
+	b.refill(limit, period, now)
+
+	if b.Tokens < 1 {
+		return false
+	}
+	b.Tokens--
+	return true
+}
+
+// refill adds the tokens of the time elapsed since the last update
+func (b *RateLimitBucket) refill(limit int, period time.Duration, now time.Time) {
+	if b.UpdatedAt.IsZero() {
+		b.Tokens = float64(limit)
+	} else if elapsed := now.Sub(b.UpdatedAt); elapsed > 0 {
+		b.Tokens = math.Min(float64(limit), b.Tokens+elapsed.Seconds()*float64(limit)/period.Seconds())
+	}
+	b.UpdatedAt = now
+}
+
+// Remaining returns the whole tokens left in the bucket
+func (b *RateLimitBucket) Remaining() int {
+	return int(math.Floor(b.Tokens))
+}
+
+// UntilNextToken returns the time until the bucket has one token
+func (b *RateLimitBucket) UntilNextToken(limit int, period time.Duration) time.Duration {
+	return b.until(1, limit, period)
+}
+
+// UntilFull returns the time until the bucket is full again
+func (b *RateLimitBucket) UntilFull(limit int, period time.Duration) time.Duration {
+	return b.until(float64(limit), limit, period)
+}
+
+func (b *RateLimitBucket) until(tokens float64, limit int, period time.Duration) time.Duration {
+	if b.Tokens >= tokens {
+		return 0
+	}
+	return time.Duration((tokens - b.Tokens) * float64(period) / float64(limit))
+}
+
+// TakeRateLimitToken takes one token of the bucket stored in the database
+// The token is taken with a single upsert, so the limit holds across all instances of the api without locking the
+// row. The first request creates the full bucket minus its token, an empty bucket is not updated and returns no row
+func TakeRateLimitToken(key string, limit int, period time.Duration) (RateLimitBucket, bool, error) {
+	bucket := RateLimitBucket{}
+	now := time.Now()
+	rate := float64(limit) / period.Seconds()
+	refilled := "LEAST(?, rate_limit_buckets.tokens + GREATEST(0, EXTRACT(EPOCH FROM EXCLUDED.updated_at - rate_limit_buckets.updated_at)) * ?)"
+
+	db := infrastructure.GetDB()
+	err := db.Raw(`INSERT INTO rate_limit_buckets (key, tokens, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+		tokens = `+refilled+` - 1,
+		updated_at = GREATEST(rate_limit_buckets.updated_at, EXCLUDED.updated_at)
+		WHERE `+refilled+` >= 1
+		RETURNING key, tokens, updated_at`,
+		key, limit-1, now, limit, rate, limit, rate).Scan(&bucket).Error
+	if err == nil {
+		return bucket, true, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return bucket, true, errors.New(utils.ERROR_SERVER)
+	}
+
+	// The bucket is empty, it is only read for the headers of the refused request
+	if err := db.Where("key = ?", key).First(&bucket).Error; err != nil {
+		return bucket, true, errors.New(utils.ERROR_SERVER)
+	}
+	bucket.refill(limit, period, now)
+
+	return bucket, false, nil
+}
+
+// DeleteStaleRateLimitBuckets removes the buckets not used since the time, they are full again
+func DeleteStaleRateLimitBuckets(before time.Time) error {
+	if err := infrastructure.GetDB().Where("updated_at < ?", before).Delete(&RateLimitBucket{}).Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRateLimitBucketRefill(t *testing.T) {
+	now := time.Now()
+	bucket := RateLimitBucket{}
+
+	// New buckets are full
+	assert.True(t, bucket.Take(2, time.Minute, now))
+	assert.True(t, bucket.Take(2, time.Minute, now))
+	assert.False(t, bucket.Take(2, time.Minute, now))
+	assert.Equal(t, 30*time.Second, bucket.UntilNextToken(2, time.Minute))
+	assert.Equal(t, time.Minute, bucket.UntilFull(2, time.Minute))
+
+	// One token every 30 seconds
+	assert.False(t, bucket.Take(2, time.Minute, now.Add(29*time.Second)))
+	assert.True(t, bucket.Take(2, time.Minute, now.Add(30*time.Second)))
+
+	// Never more than the limit
+	bucket.Take(2, time.Minute, now.Add(time.Hour))
+	assert.Equal(t, 1, bucket.Remaining())
+}
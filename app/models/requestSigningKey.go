@@ -0,0 +1,119 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"payments/infrastructure"
+	"payments/utils"
+	"strings"
+	"time"
+)
+
+// RequestSigningKey is a shared secret used by clients to sign mutating payment requests (HMAC-SHA256)
+// The secret is needed to verify the signatures, so it is stored and only returned when the key is created
+type RequestSigningKey struct {
+	gorm.Model
+	KeyID     string     `json:"key_id" gorm:"unique_index"`
+	AccountID uint       `json:"account_id"`
+	Name      string     `json:"name"`
+	Secret    string     `json:"secret,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// RequestNonce is a nonce already used in a signed request, kept during the signature window to refuse replays
+type RequestNonce struct {
+	ID        uint64    `gorm:"primary_key"`
+	KeyID     string    `gorm:"unique_index:idx_request_nonce"`
+	Nonce     string    `gorm:"unique_index:idx_request_nonce"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// IsValid check if the name of a new key is valid
+func (k *RequestSigningKey) IsValid() error {
+	if strings.TrimSpace(k.Name) == "" {
+		return errors.New(utils.ERROR_SIGNING_KEY_NAME_REQUIRED)
+	}
+	return nil
+}
+
+// GenerateSecret creates the key id and the secret
+func (k *RequestSigningKey) GenerateSecret() error {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+
+	k.KeyID = "rsk_" + hex.EncodeToString(id)
+	k.Secret = base64.RawURLEncoding.EncodeToString(secret)
+	return nil
+}
+
+// IsActive check if the key was not revoked
+func (k *RequestSigningKey) IsActive() bool {
+	return k.RevokedAt == nil
+}
+
+// GetRequestSigningKeyByKeyID Get a signing key through the key id sent in the signature
+func GetRequestSigningKeyByKeyID(keyID string) (RequestSigningKey, error) {
+	key := RequestSigningKey{}
+	if err := infrastructure.GetDB().Where("key_id = ?", keyID).First(&key).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return key, errors.New(utils.ERROR_SIGNATURE_UNKNOWN_KEY)
+		}
+		return key, errors.New(utils.ERROR_SERVER)
+	}
+	return key, nil
+}
+
+// GetRequestSigningKeysByAccount Get all signing keys created by the account
+func GetRequestSigningKeysByAccount(accountID uint) ([]RequestSigningKey, error) {
+	keys := []RequestSigningKey{}
+	if err := infrastructure.GetDB().Where("account_id = ?", accountID).Order("id").Find(&keys).Error; err != nil {
+		return keys, errors.New(utils.ERROR_SERVER)
+	}
+	return keys, nil
+}
+
+// GetRequestSigningKeyByID Get a signing key created by the account
+func GetRequestSigningKeyByID(id uint, accountID uint) (RequestSigningKey, error) {
+	key := RequestSigningKey{}
+	if err := infrastructure.GetDB().Where("id = ? AND account_id = ?", id, accountID).First(&key).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return key, errors.New(utils.ERROR_RESOURCE_NOT_FOUND)
+		}
+		return key, errors.New(utils.ERROR_SERVER)
+	}
+	return key, nil
+}
+
+// UseRequestNonce registers the nonce of a signed request
+// Returns an error if the nonce was already used by the key. Nonces older than the window are removed
+func UseRequestNonce(keyID string, nonce string, window time.Duration) error {
+	db := infrastructure.GetDB()
+
+	if err := db.Where("key_id = ? AND created_at < ?", keyID, time.Now().Add(-2*window)).Delete(&RequestNonce{}).Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+
+	var count int
+	if err := db.Model(&RequestNonce{}).Where("key_id = ? AND nonce = ?", keyID, nonce).Count(&count).Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	if count > 0 {
+		return errors.New(utils.ERROR_SIGNATURE_REPLAYED)
+	}
+
+	// The unique index refuses concurrent requests with the same nonce
+	if err := db.Create(&RequestNonce{KeyID: keyID, Nonce: nonce}).Error; err != nil {
+		return errors.New(utils.ERROR_SIGNATURE_REPLAYED)
+	}
+
+	return nil
+}
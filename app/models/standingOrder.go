@@ -0,0 +1,147 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"payments/infrastructure"
+	"payments/utils"
+	"time"
+)
+
+// Status of the standing orders
+// Active orders generate their payments, paused orders skip the occurrences until they are resumed, and cancelled or
+// completed orders do not generate payments anymore
+const STANDING_ORDER_ACTIVE = "active"
+const STANDING_ORDER_PAUSED = "paused"
+const STANDING_ORDER_CANCELLED = "cancelled"
+const STANDING_ORDER_COMPLETED = "completed"
+
+// Frequencies of the recurrences
+const RECURRENCE_WEEKLY = "weekly"
+const RECURRENCE_MONTHLY = "monthly"
+const RECURRENCE_LAST_BUSINESS_DAY = "last_business_day"
+
+// Recurrence is the rule of the dates of the payments of a standing order
+type Recurrence struct {
+	// weekly (on the day of the week of the start date), monthly (on the day of the month) or last_business_day (of the month)
+	Frequency string `json:"frequency"`
+	// Every Interval weeks or months (default 1)
+	Interval int `json:"interval,omitempty"`
+	// Day of the month of the monthly recurrences (default the day of the start date), the last day of shorter months
+	DayOfMonth int    `json:"day_of_month,omitempty"`
+	StartDate  string `json:"start_date"`
+	// The recurrence ends on the end date or after Count payments, whichever comes first. Without both it never ends
+	EndDate string `json:"end_date,omitempty"`
+	Count   uint   `json:"count,omitempty"`
+}
+
+// StandingOrder generates a payment of the organisation for every occurrence of its recurrence
+type StandingOrder struct {
+	ID             uuid.UUID `gorm:"primary_key" json:"id" sql:",type:uuid"`
+	OrganisationID uuid.UUID `json:"organisation_id" gorm:"index" sql:",type:uuid"`
+	Status         string    `json:"status" gorm:"index"`
+	// Template of the attributes of the payments, the processing date is set by the recurrence
+	Payment     Attributes `json:"payment" gorm:"-"`
+	PaymentJSON string     `json:"-" gorm:"column:payment;type:text"`
+	Recurrence  Recurrence `json:"recurrence" gorm:"embedded;embedded_prefix:recurrence_"`
+	// Index and date (YYYY-MM-DD) of the next occurrence, empty when the order has ended
+	NextOccurrence int    `json:"-"`
+	NextDate       string `json:"next_date,omitempty" gorm:"index"`
+	// Number of payments generated, and date of the last occurrence generated
+	Generated      uint      `json:"generated"`
+	LastDate       string    `json:"last_date,omitempty"`
+	SignatureKeyID string    `json:"signature_key_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// BeforeSave stores the payment template as JSON
+func (o *StandingOrder) BeforeSave() error {
+	template, err := json.Marshal(o.Payment)
+	if err != nil {
+		return err
+	}
+	o.PaymentJSON = string(template)
+	return nil
+}
+
+// AfterFind reads the payment template
+func (o *StandingOrder) AfterFind() error {
+	if o.PaymentJSON == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(o.PaymentJSON), &o.Payment)
+}
+
+// NewPayment returns a pending payment of the template, processed on the date
+func (o *StandingOrder) NewPayment(processingDate string) Payment {
+	attributes := Attributes{}
+	template, _ := json.Marshal(o.Payment)
+	json.Unmarshal(template, &attributes)
+	attributes.ProcessingDate = processingDate
+
+	orderID := o.ID
+	payment := Payment{
+		Type:            "Payment",
+		ID:              uuid.NewV4(),
+		OrganisationID:  o.OrganisationID,
+		Attributes:      attributes,
+		SignatureKeyID:  o.SignatureKeyID,
+		StandingOrderID: &orderID,
+	}
+	payment.Schedule()
+	return payment
+}
+
+// GetStandingOrderByID Get a standing order through an ID
+func GetStandingOrderByID(id uuid.UUID) (StandingOrder, error) {
+	order := StandingOrder{}
+	if err := infrastructure.GetDB().Where("id = ?", id).First(&order).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return order, errors.New(utils.ERROR_RESOURCE_NOT_FOUND)
+		}
+		return order, errors.New(utils.ERROR_SERVER)
+	}
+	return order, nil
+}
+
+// GetStandingOrders Get the standing orders of an organisation
+func GetStandingOrders(organisationID uuid.UUID) ([]StandingOrder, error) {
+	orders := []StandingOrder{}
+	if err := infrastructure.GetDB().Where("organisation_id = ?", organisationID).Order("created_at").Find(&orders).Error; err != nil {
+		return orders, errors.New(utils.ERROR_SERVER)
+	}
+	return orders, nil
+}
+
+// UpdateStandingOrder locks the order, applies the change and saves the order
+// The row stays locked during the change, so it does not race with the generation of the payments of the order
+// The errors of the change are returned as they are
+func UpdateStandingOrder(id uuid.UUID, change func(order *StandingOrder) error) (StandingOrder, error) {
+	order := StandingOrder{}
+	tx := infrastructure.GetDB().Begin()
+
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", id).First(&order).Error; err != nil {
+		tx.Rollback()
+		if gorm.IsRecordNotFoundError(err) {
+			return order, errors.New(utils.ERROR_RESOURCE_NOT_FOUND)
+		}
+		return order, errors.New(utils.ERROR_SERVER)
+	}
+
+	if err := change(&order); err != nil {
+		tx.Rollback()
+		return order, err
+	}
+
+	if err := tx.Save(&order).Error; err != nil {
+		tx.Rollback()
+		return order, errors.New(utils.ERROR_SERVER)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return order, errors.New(utils.ERROR_SERVER)
+	}
+	return order, nil
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"payments/infrastructure"
+	"payments/utils"
+	"strings"
+	"time"
+)
+
+// Status of the webhook deliveries
+// Pending deliveries are sent by the scheduler and retried with backoff, the deliveries still failing after the last
+// attempt are dead until they are redelivered
+const WEBHOOK_DELIVERY_PENDING = "pending"
+const WEBHOOK_DELIVERY_DELIVERED = "delivered"
+const WEBHOOK_DELIVERY_DEAD = "dead"
+
+// WebhookSubscription receives the payment events of an organisation on its url
+// The secret signs the deliveries, so it is stored and only returned when the subscription is created
+type WebhookSubscription struct {
+	ID             uuid.UUID `gorm:"primary_key" json:"id" sql:",type:uuid"`
+	OrganisationID uuid.UUID `json:"organisation_id" gorm:"index" sql:",type:uuid"`
+	URL            string    `json:"url"`
+	// Types of the events sent to the subscription
+	Events     []string  `json:"events" gorm:"-"`
+	EventsText string    `json:"-" gorm:"column:events"`
+	Secret     string    `json:"secret,omitempty"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WebhookDelivery is an event sent to a subscription, with the result of its last attempt
+type WebhookDelivery struct {
+	ID             uuid.UUID  `gorm:"primary_key" json:"id" sql:",type:uuid"`
+	SubscriptionID uuid.UUID  `json:"subscription_id" gorm:"index" sql:",type:uuid"`
+	EventID        uuid.UUID  `json:"event_id" sql:",type:uuid"`
+	EventType      string     `json:"event_type"`
+	PaymentID      uuid.UUID  `json:"payment_id" gorm:"index" sql:",type:uuid"`
+	Payload        string     `json:"-" gorm:"type:text"`
+	Status         string     `json:"status" gorm:"index"`
+	Attempts       uint       `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	// Claim of the deliverer sending the delivery
+	ClaimToken string `json:"-"`
+}
+
+// BeforeSave stores the event types as a comma separated list
+func (s *WebhookSubscription) BeforeSave() error {
+	s.EventsText = strings.Join(s.Events, ",")
+	return nil
+}
+
+// AfterFind reads the event types
+func (s *WebhookSubscription) AfterFind() error {
+	s.Events = []string{}
+	if s.EventsText != "" {
+		s.Events = strings.Split(s.EventsText, ",")
+	}
+	return nil
+}
+
+// GenerateSecret creates the secret signing the deliveries
+func (s *WebhookSubscription) GenerateSecret() error {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	s.Secret = "whsec_" + base64.RawURLEncoding.EncodeToString(secret)
+	return nil
+}
+
+// Receives check if the subscription receives the events of the type
+func (s *WebhookSubscription) Receives(eventType string) bool {
+	if !s.Active {
+		return false
+	}
+	for _, event := range s.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// GetWebhookSubscriptionByID Get a webhook subscription through an ID
+func GetWebhookSubscriptionByID(id uuid.UUID) (WebhookSubscription, error) {
+	subscription := WebhookSubscription{}
+	if err := infrastructure.GetDB().Where("id = ?", id).First(&subscription).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return subscription, errors.New(utils.ERROR_RESOURCE_NOT_FOUND)
+		}
+		return subscription, errors.New(utils.ERROR_SERVER)
+	}
+	return subscription, nil
+}
+
+// GetWebhookSubscriptions Get the webhook subscriptions of an organisation
+func GetWebhookSubscriptions(organisationID uuid.UUID) ([]WebhookSubscription, error) {
+	subscriptions := []WebhookSubscription{}
+	if err := infrastructure.GetDB().Where("organisation_id = ?", organisationID).Order("created_at").Find(&subscriptions).Error; err != nil {
+		return subscriptions, errors.New(utils.ERROR_SERVER)
+	}
+	return subscriptions, nil
+}
+
+// GetWebhookDeliveries Get the deliveries of a subscription, the latest first, optionally only the ones in a status
+func GetWebhookDeliveries(subscriptionID uuid.UUID, status string) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+	query := infrastructure.GetDB().Where("subscription_id = ?", subscriptionID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Order("created_at DESC").Find(&deliveries).Error; err != nil {
+		return deliveries, errors.New(utils.ERROR_SERVER)
+	}
+	return deliveries, nil
+}
+
+// GetWebhookDeliveryByID Get a delivery of a subscription through an ID
+func GetWebhookDeliveryByID(subscriptionID uuid.UUID, id uuid.UUID) (WebhookDelivery, error) {
+	delivery := WebhookDelivery{}
+	if err := infrastructure.GetDB().Where("id = ? AND subscription_id = ?", id, subscriptionID).First(&delivery).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return delivery, errors.New(utils.ERROR_RESOURCE_NOT_FOUND)
+		}
+		return delivery, errors.New(utils.ERROR_SERVER)
+	}
+	return delivery, nil
+}
@@ -0,0 +1,347 @@
+package modulus
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"payments/utils"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Methods of the checks of the Vocalink modulus checking specification
+const METHOD_MOD10 = "MOD10"
+const METHOD_MOD11 = "MOD11"
+const METHOD_DOUBLE_ALTERNATE = "DBLAL"
+
+// Sort codes substituted by the exceptions 8 and 9
+const EXCEPTION_8_SORT_CODE = "090126"
+const EXCEPTION_9_SORT_CODE = "309634"
+
+// Rule is a check of the sort codes of a range, a line of the valacdos file
+// The 14 weights apply to the digits of the sort code (u to z) followed by the account number (a to h)
+type Rule struct {
+	From      string
+	To        string
+	Method    string
+	Weights   [14]int
+	Exception int
+}
+
+// Checker checks the account numbers with the rules of their sort code
+type Checker struct {
+	Rules []Rule
+	// Sort codes replaced by another sort code in the checks with the exception 5, from the scsubtab file
+	Substitutions map[string]string
+}
+
+var defaultChecker *Checker
+var checkerOnce sync.Once
+
+// GetChecker returns the checker configured by the environment, nil when modulus checking is not configured
+// MODULUS_VALACDOS_FILE: the weight table (valacdos.txt) published by Vocalink
+// MODULUS_SCSUBTAB_FILE: the sort code substitution table (scsubtab.txt), optional
+func GetChecker() *Checker {
+	checkerOnce.Do(func() {
+		weights := os.Getenv("MODULUS_VALACDOS_FILE")
+		if weights == "" {
+			return
+		}
+
+		var err error
+		if defaultChecker, err = LoadFiles(weights, os.Getenv("MODULUS_SCSUBTAB_FILE")); err != nil {
+			panic(err)
+		}
+	})
+	return defaultChecker
+}
+
+// SetChecker replaces the checker configured by the environment, nil disables modulus checking
+func SetChecker(checker *Checker) {
+	checkerOnce.Do(func() {})
+	defaultChecker = checker
+}
+
+// LoadFiles reads the weight table and, if the file is given, the substitution table
+func LoadFiles(weightsFile string, substitutionsFile string) (*Checker, error) {
+	weights, err := os.Open(weightsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer weights.Close()
+
+	var substitutions io.Reader
+	if substitutionsFile != "" {
+		file, err := os.Open(substitutionsFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		substitutions = file
+	}
+
+	return Load(weights, substitutions)
+}
+
+// Load reads the weight table and the substitution table, which can be nil
+func Load(weights io.Reader, substitutions io.Reader) (*Checker, error) {
+	checker := &Checker{Substitutions: map[string]string{}}
+
+	if err := readLines(weights, func(number int, fields []string) error {
+		rule, err := parseRule(fields)
+		if err != nil {
+			return fmt.Errorf("valacdos line %d: %s", number, err)
+		}
+		checker.Rules = append(checker.Rules, rule)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if substitutions != nil {
+		if err := readLines(substitutions, func(number int, fields []string) error {
+			if len(fields) < 2 || !sortCodePattern.MatchString(fields[0]) || !sortCodePattern.MatchString(fields[1]) {
+				return fmt.Errorf("scsubtab line %d: expected the original and the substitute sort codes", number)
+			}
+			checker.Substitutions[fields[0]] = fields[1]
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return checker, nil
+}
+
+// readLines calls the parse function with the fields of every line that is not blank
+func readLines(reader io.Reader, parse func(number int, fields []string) error) error {
+	scanner := bufio.NewScanner(reader)
+	for number := 1; scanner.Scan(); number++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if err := parse(number, fields); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func parseRule(fields []string) (Rule, error) {
+	rule := Rule{}
+	if len(fields) != 17 && len(fields) != 18 {
+		return rule, errors.New("expected the sort code range, the method, 14 weights and an optional exception")
+	}
+
+	rule.From, rule.To, rule.Method = fields[0], fields[1], fields[2]
+	if !sortCodePattern.MatchString(rule.From) || !sortCodePattern.MatchString(rule.To) || rule.From > rule.To {
+		return rule, errors.New("invalid sort code range")
+	}
+	if rule.Method != METHOD_MOD10 && rule.Method != METHOD_MOD11 && rule.Method != METHOD_DOUBLE_ALTERNATE {
+		return rule, fmt.Errorf("unknown method %s", rule.Method)
+	}
+
+	for i := range rule.Weights {
+		weight, err := strconv.Atoi(fields[3+i])
+		if err != nil {
+			return rule, fmt.Errorf("invalid weight %s", fields[3+i])
+		}
+		rule.Weights[i] = weight
+	}
+
+	if len(fields) == 18 {
+		exception, err := strconv.Atoi(fields[17])
+		if err != nil || exception < 1 || exception > 14 {
+			return rule, fmt.Errorf("invalid exception %s", fields[17])
+		}
+		rule.Exception = exception
+	}
+
+	return rule, nil
+}
+
+var sortCodePattern = regexp.MustCompile(`^[0-9]{6}$`)
+var accountNumberPattern = regexp.MustCompile(`^[0-9]{6,8}$`)
+
+// RulesOf returns the rules of the sort code, in the order of the weight table
+func (checker *Checker) RulesOf(sortCode string) []Rule {
+	rules := []Rule{}
+	for _, rule := range checker.Rules {
+		if sortCode >= rule.From && sortCode <= rule.To {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// Check checks the account number of the sort code
+// The sort codes and accounts without rules can not be checked and are valid
+// Account numbers of 6 or 7 digits are padded with zeros on the left
+func (checker *Checker) Check(sortCode string, accountNumber string) error {
+	sortCode = strings.Replace(strings.TrimSpace(sortCode), "-", "", -1)
+	accountNumber = strings.Replace(strings.TrimSpace(accountNumber), " ", "", -1)
+
+	if !sortCodePattern.MatchString(sortCode) {
+		return errors.New(utils.ERROR_SORT_CODE_INVALID)
+	}
+	if !accountNumberPattern.MatchString(accountNumber) {
+		return errors.New(utils.ERROR_ACCOUNT_NUMBER_INVALID)
+	}
+	accountNumber = strings.Repeat("0", 8-len(accountNumber)) + accountNumber
+
+	if !checker.valid(sortCode, accountNumber) {
+		return errors.New(utils.ERROR_MODULUS_CHECK_FAILED)
+	}
+	return nil
+}
+
+func (checker *Checker) valid(sortCode string, accountNumber string) bool {
+	rules := checker.RulesOf(sortCode)
+	if len(rules) == 0 {
+		return true
+	}
+
+	number := digits(sortCode + accountNumber)
+	first := rules[0]
+
+	// Foreign currency accounts can not be checked
+	if first.Exception == 6 && number[a] >= 4 && number[a] <= 8 && number[g] == number[h] {
+		return true
+	}
+
+	firstValid := checker.checkRule(first, sortCode, accountNumber)
+	if len(rules) == 1 {
+		return firstValid
+	}
+	second := rules[1]
+
+	switch {
+	// Either check can pass
+	case first.Exception == 2 && second.Exception == 9,
+		first.Exception == 10 && second.Exception == 11,
+		first.Exception == 12 && second.Exception == 13:
+		return firstValid || checker.checkRule(second, sortCode, accountNumber)
+	// The double alternate check is not needed when c is 6 or 9
+	case second.Exception == 3 && (number[c] == 6 || number[c] == 9):
+		return firstValid
+	}
+	return firstValid && checker.checkRule(second, sortCode, accountNumber)
+}
+
+// Positions of the digits of the sort code and account number
+const (
+	u = iota
+	v
+	w
+	x
+	y
+	z
+	a
+	b
+	c
+	d
+	e
+	f
+	g
+	h
+)
+
+// checkRule applies the rule, with its exception, to the account
+func (checker *Checker) checkRule(rule Rule, sortCode string, accountNumber string) bool {
+	weights := rule.Weights
+	number := digits(sortCode + accountNumber)
+
+	switch rule.Exception {
+	case 2:
+		if number[a] != 0 {
+			if number[g] != 9 {
+				weights = [14]int{0, 0, 1, 2, 5, 3, 6, 4, 8, 7, 10, 9, 3, 1}
+			} else {
+				weights = [14]int{0, 0, 0, 0, 0, 0, 0, 0, 8, 7, 10, 9, 3, 1}
+			}
+		}
+	case 5:
+		if substitute, ok := checker.Substitutions[sortCode]; ok {
+			number = digits(substitute + accountNumber)
+		}
+	case 7:
+		if number[g] == 9 {
+			zeroise(&weights, u, b)
+		}
+	case 8:
+		number = digits(EXCEPTION_8_SORT_CODE + accountNumber)
+	case 9:
+		number = digits(EXCEPTION_9_SORT_CODE + accountNumber)
+	case 10:
+		if (number[a] == 0 || number[a] == 9) && number[b] == 9 && number[g] == 9 {
+			zeroise(&weights, u, b)
+		}
+	}
+
+	total := 0
+	for i, digit := range number {
+		product := digit * weights[i]
+		if rule.Method == METHOD_DOUBLE_ALTERNATE {
+			// The digits of the products are added, e.g. 18 adds 1 + 8
+			product = product/10 + product%10
+		}
+		total += product
+	}
+
+	switch rule.Method {
+	case METHOD_MOD10:
+		return total%10 == 0
+	case METHOD_DOUBLE_ALTERNATE:
+		if rule.Exception == 1 {
+			total += 27
+		}
+		if rule.Exception == 5 {
+			remainder := total % 10
+			return (remainder == 0 && number[h] == 0) || (remainder != 0 && 10-remainder == number[h])
+		}
+		return total%10 == 0
+	}
+
+	// MOD11
+	remainder := total % 11
+	switch rule.Exception {
+	case 4:
+		return remainder == number[g]*10+number[h]
+	case 5:
+		if remainder == 1 {
+			return false
+		}
+		return (remainder == 0 && number[g] == 0) || (remainder != 0 && 11-remainder == number[g])
+	case 14:
+		if remainder == 0 {
+			return true
+		}
+		// The last digit is dropped and the account shifted right, when it is 0, 1 or 9
+		if number[h] != 0 && number[h] != 1 && number[h] != 9 {
+			return false
+		}
+		shifted := rule
+		shifted.Exception = 0
+		return checker.checkRule(shifted, sortCode, "0"+accountNumber[:7])
+	}
+	return remainder == 0
+}
+
+func digits(value string) [14]int {
+	result := [14]int{}
+	for i := range result {
+		result[i] = int(value[i] - '0')
+	}
+	return result
+}
+
+func zeroise(weights *[14]int, from int, to int) {
+	for i := from; i <= to; i++ {
+		weights[i] = 0
+	}
+}
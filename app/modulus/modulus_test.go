@@ -0,0 +1,100 @@
+package modulus
+
+import (
+	"github.com/stretchr/testify/assert"
+	"payments/utils"
+	"strings"
+	"testing"
+)
+
+func testChecker(t *testing.T) *Checker {
+	checker, err := LoadFiles("testdata/valacdos.txt", "testdata/scsubtab.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return checker
+}
+
+func TestLoad(t *testing.T) {
+	checker := testChecker(t)
+
+	assert.Len(t, checker.Rules, 21)
+	assert.EqualValues(t, Rule{From: "938000", To: "938999", Method: METHOD_DOUBLE_ALTERNATE, Weights: [14]int{2, 1, 2, 1, 2, 1, 2, 1, 2, 1, 2, 1, 2, 0}, Exception: 5}, checker.Rules[20])
+	assert.EqualValues(t, map[string]string{"938611": "938600"}, checker.Substitutions)
+	assert.Len(t, checker.RulesOf("820500"), 2)
+
+	_, err := Load(strings.NewReader("010004 016715 MOD12 0 0 0 0 0 0 8 7 6 5 4 3 2 1"), nil)
+	assert.EqualError(t, err, "valacdos line 1: unknown method MOD12")
+	_, err = Load(strings.NewReader("\n016715 010004 MOD11 0 0 0 0 0 0 8 7 6 5 4 3 2 1"), nil)
+	assert.EqualError(t, err, "valacdos line 2: invalid sort code range")
+	_, err = Load(strings.NewReader("010004 016715 MOD11 0 0 0 0 0 0 8 7 6 5 4 3 2 1 15"), nil)
+	assert.EqualError(t, err, "valacdos line 1: invalid exception 15")
+}
+
+func TestCheck(t *testing.T) {
+	checker := testChecker(t)
+
+	tests := []struct {
+		name          string
+		sortCode      string
+		accountNumber string
+		valid         bool
+	}{
+		// Worked examples of the specification
+		{"modulus 11", "000000", "58177632", true},
+		{"modulus 11 fails", "000000", "58177633", false},
+		{"modulus 10", "089999", "66374958", true},
+		{"modulus 10 fails", "089999", "66374959", false},
+		{"double alternate", "499273", "12345678", true},
+		{"double alternate fails", "499273", "12345679", false},
+		{"sort code without rules", "401010", "12345678", true},
+		{"both checks pass", "100050", "93393106", true},
+		{"second check fails", "100050", "63383683", false},
+		{"first check fails", "100050", "02996023", false},
+		{"exception 1 adds 27", "118765", "15826780", true},
+		{"exception 1 fails", "118765", "93393106", false},
+		{"exception 2 with g not 9", "309070", "81528947", true},
+		{"exception 2 with g 9", "309070", "66546792", true},
+		{"exception 9 with the substituted sort code", "309070", "52319252", true},
+		{"exceptions 2 and 9 fail", "309070", "18034063", false},
+		{"exception 3 skips the second check when c is 6", "820000", "83612653", true},
+		{"exception 3 second check fails", "820000", "18034063", false},
+		{"exception 4 remainder equals gh", "134020", "00212701", true},
+		{"exception 4 fails", "134020", "00212702", false},
+		{"exception 5 both checks", "938063", "56654242", true},
+		{"exception 5 with the sort code substitution", "938611", "56654242", true},
+		{"exception 5 first check fails", "938063", "59778857", false},
+		{"exception 5 second check fails", "938063", "81528947", false},
+		{"exception 6 foreign currency account", "200915", "40000011", true},
+		{"exception 6 fails", "200915", "76397250", false},
+		{"exception 7 zeroises u to b when g is 9", "772798", "46449792", true},
+		{"exception 8 substitutes the sort code", "086090", "08470054", true},
+		{"exception 10 zeroises u to b", "871427", "99690090", true},
+		{"exception 11 passes", "871427", "93393106", true},
+		{"exceptions 10 and 11 fail", "871427", "76397250", false},
+		{"exception 13 passes", "070116", "93393106", true},
+		{"exception 14 shifts the account", "180002", "60329669", true},
+		{"exception 14 with h not 0, 1 or 9", "180002", "93393106", false},
+	}
+
+	for _, test := range tests {
+		err := checker.Check(test.sortCode, test.accountNumber)
+		if test.valid {
+			assert.NoError(t, err, test.name)
+		} else if assert.Error(t, err, test.name) {
+			assert.EqualValues(t, utils.ERROR_MODULUS_CHECK_FAILED, err.Error(), test.name)
+		}
+	}
+}
+
+func TestCheckFormats(t *testing.T) {
+	checker := testChecker(t)
+
+	assert.NoError(t, checker.Check("00-00-00", "5817 7632"))
+	// Accounts of 6 and 7 digits are padded with zeros
+	assert.NoError(t, checker.Check("134020", "212701"))
+
+	assert.EqualError(t, checker.Check("0000", "58177632"), utils.ERROR_SORT_CODE_INVALID)
+	assert.EqualError(t, checker.Check("000000", "5817763"+"21"), utils.ERROR_ACCOUNT_NUMBER_INVALID)
+	assert.EqualError(t, checker.Check("000000", "GB29XABC"), utils.ERROR_ACCOUNT_NUMBER_INVALID)
+}
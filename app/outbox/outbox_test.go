@@ -0,0 +1,146 @@
+package outbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"payments/app/models"
+	"testing"
+	"time"
+)
+
+type recordingSink struct {
+	messages []Message
+	err      error
+}
+
+func (s *recordingSink) Publish(message Message) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.messages = append(s.messages, message)
+	return nil
+}
+
+func outboxEventExample(sequence uint64, paymentID uuid.UUID) models.OutboxEvent {
+	return models.OutboxEvent{
+		Sequence:       sequence,
+		EventID:        uuid.NewV4(),
+		Type:           models.EVENT_PAYMENT_CREATED,
+		OrganisationID: uuid.NewV4(),
+		PaymentID:      paymentID,
+		Payload:        `{"id":"` + paymentID.String() + `"}`,
+		CreatedAt:      time.Unix(1700000000, 0),
+	}
+}
+
+func TestNewMessage(t *testing.T) {
+	event := outboxEventExample(42, uuid.NewV4())
+
+	message := NewMessage(event)
+	assert.EqualValues(t, event.EventID, message.ID)
+	assert.EqualValues(t, 42, message.Sequence)
+	assert.EqualValues(t, event.PaymentID, message.PaymentID)
+	assert.JSONEq(t, event.Payload, string(message.Data))
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.jsonl")
+	sink, err := NewFileSink(path)
+	require.Nil(t, err)
+	first, second := NewMessage(outboxEventExample(1, uuid.NewV4())), NewMessage(outboxEventExample(2, uuid.NewV4()))
+	require.Nil(t, sink.Publish(first))
+	require.Nil(t, sink.Publish(second))
+
+	file, err := os.Open(path)
+	require.Nil(t, err)
+	defer file.Close()
+	ids := []uuid.UUID{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		message := Message{}
+		require.Nil(t, json.Unmarshal(scanner.Bytes(), &message))
+		ids = append(ids, message.ID)
+	}
+	assert.EqualValues(t, []uuid.UUID{first.ID, second.ID}, ids)
+}
+
+func TestHTTPSink(t *testing.T) {
+	message := NewMessage(outboxEventExample(1, uuid.NewV4()))
+
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received := Message{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&received))
+		assert.EqualValues(t, message.ID, received.ID)
+		assert.EqualValues(t, message.ID.String(), r.Header.Get("Idempotency-Key"))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.URL)
+	assert.Nil(t, sink.Publish(message))
+
+	status = http.StatusBadGateway
+	assert.EqualError(t, sink.Publish(message), "sink responded with status 502")
+}
+
+func TestKafkaSink(t *testing.T) {
+	message := NewMessage(outboxEventExample(1, uuid.NewV4()))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.EqualValues(t, "/topics/payments", r.URL.Path)
+		assert.EqualValues(t, "application/vnd.kafka.json.v2+json", r.Header.Get("Content-Type"))
+
+		body := struct {
+			Records []struct {
+				Key   string  `json:"key"`
+				Value Message `json:"value"`
+			} `json:"records"`
+		}{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		if assert.Len(t, body.Records, 1) {
+			assert.EqualValues(t, message.PaymentID.String(), body.Records[0].Key)
+			assert.EqualValues(t, message.ID, body.Records[0].Value.ID)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	assert.Nil(t, NewKafkaSink(server.URL+"/", "payments").Publish(message))
+}
+
+func TestPublish(t *testing.T) {
+	message := NewMessage(outboxEventExample(1, uuid.NewV4()))
+
+	first, second := &recordingSink{}, &recordingSink{}
+	require.Nil(t, NewRelay(first, second).Publish(message))
+	assert.Len(t, first.messages, 1)
+	assert.Len(t, second.messages, 1)
+
+	// The sinks after a failing sink are not published to
+	failing, last := &recordingSink{err: errors.New("broker unavailable")}, &recordingSink{}
+	assert.EqualError(t, NewRelay(failing, last).Publish(message), "broker unavailable")
+	assert.Empty(t, last.messages)
+}
+
+func TestWaiting(t *testing.T) {
+	a, b, c := uuid.NewV4(), uuid.NewV4(), uuid.NewV4()
+	events := []models.OutboxEvent{outboxEventExample(5, a), outboxEventExample(6, b), outboxEventExample(7, a), outboxEventExample(9, c)}
+
+	// The earlier event of b is locked by another relay
+	waiting := Waiting(events, []Earliest{{PaymentID: a, Sequence: 5}, {PaymentID: b, Sequence: 3}, {PaymentID: c, Sequence: 9}})
+	assert.EqualValues(t, map[uuid.UUID]bool{b: true}, waiting)
+}
@@ -0,0 +1,341 @@
+package outbox
+
+import (
+	"errors"
+	"github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+	"os"
+	"payments/app/models"
+	"payments/app/webhooks"
+	"payments/infrastructure"
+	"payments/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the sinks in OUTBOX_SINKS
+const SINK_STDOUT = "stdout"
+const SINK_FILE = "file"
+const SINK_HTTP = "http"
+const SINK_KAFKA = "kafka"
+
+// Relay publishes the events of the outbox to the sinks, and creates their webhook deliveries
+// The events are published at least once: an event is marked published after every sink accepted it, so an event
+// published by a relay that fails to mark it is published again. The events of a payment are published in the order
+// they were recorded, an event is not published before the previous events of its payment
+type Relay struct {
+	Sinks []Sink
+	// Interval between the searches of unpublished events
+	Interval time.Duration
+	// Maximum number of events claimed by a batch
+	BatchSize int
+	// Time the events of a batch stay claimed by their relay, they are claimed again after it
+	ClaimTimeout time.Duration
+	// Time the published events are kept, they are kept forever when zero
+	Retention time.Duration
+}
+
+var relay *Relay
+var relayOnce sync.Once
+
+// GetRelay returns the relay configured by the environment, nil when the relay is disabled
+// OUTBOX_INTERVAL: interval between the searches of unpublished events (default 1s), `off` disables the relay
+// OUTBOX_BATCH_SIZE: maximum number of events published by a batch (default 100)
+// OUTBOX_CLAIM_TIMEOUT: time the events of a batch stay claimed by their relay (default 5m)
+// OUTBOX_RETENTION: time the published events are kept (default 168h), `off` keeps them forever
+// OUTBOX_SINKS: comma separated sinks the events are published to, among stdout, file, http and kafka (default none)
+// OUTBOX_FILE: file the file sink appends the events to
+// OUTBOX_HTTP_URL: url the http sink posts the events to
+// OUTBOX_KAFKA_REST_URL, OUTBOX_KAFKA_TOPIC: Kafka REST proxy and topic of the kafka sink (default topic payments)
+func GetRelay() *Relay {
+	relayOnce.Do(func() {
+		if strings.TrimSpace(os.Getenv("OUTBOX_INTERVAL")) == "off" {
+			return
+		}
+		relay = NewRelay()
+
+		if interval, err := time.ParseDuration(os.Getenv("OUTBOX_INTERVAL")); err == nil && interval > 0 {
+			relay.Interval = interval
+		}
+		if batchSize, err := strconv.Atoi(os.Getenv("OUTBOX_BATCH_SIZE")); err == nil && batchSize > 0 {
+			relay.BatchSize = batchSize
+		}
+		if claimTimeout, err := time.ParseDuration(os.Getenv("OUTBOX_CLAIM_TIMEOUT")); err == nil && claimTimeout > 0 {
+			relay.ClaimTimeout = claimTimeout
+		}
+		if retention := strings.TrimSpace(os.Getenv("OUTBOX_RETENTION")); retention == "off" {
+			relay.Retention = 0
+		} else if duration, err := time.ParseDuration(retention); err == nil && duration > 0 {
+			relay.Retention = duration
+		}
+
+		for _, name := range strings.Split(os.Getenv("OUTBOX_SINKS"), ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			sink, err := newSink(name)
+			if err != nil {
+				infrastructure.GetLog().WithFields(logrus.Fields{"sink": name, "error": err.Error()}).Error("Failed to configure the outbox sink")
+				continue
+			}
+			relay.Sinks = append(relay.Sinks, sink)
+		}
+	})
+	return relay
+}
+
+// newSink creates the sink of the name configured by the environment
+func newSink(name string) (Sink, error) {
+	switch name {
+	case SINK_STDOUT:
+		return NewStdoutSink(), nil
+	case SINK_FILE:
+		if os.Getenv("OUTBOX_FILE") == "" {
+			return nil, errors.New("OUTBOX_FILE is not defined")
+		}
+		return NewFileSink(os.Getenv("OUTBOX_FILE"))
+	case SINK_HTTP:
+		if os.Getenv("OUTBOX_HTTP_URL") == "" {
+			return nil, errors.New("OUTBOX_HTTP_URL is not defined")
+		}
+		return NewHTTPSink(os.Getenv("OUTBOX_HTTP_URL")), nil
+	case SINK_KAFKA:
+		if os.Getenv("OUTBOX_KAFKA_REST_URL") == "" {
+			return nil, errors.New("OUTBOX_KAFKA_REST_URL is not defined")
+		}
+		topic := os.Getenv("OUTBOX_KAFKA_TOPIC")
+		if topic == "" {
+			topic = "payments"
+		}
+		return NewKafkaSink(os.Getenv("OUTBOX_KAFKA_REST_URL"), topic), nil
+	}
+	return nil, errors.New("unknown sink")
+}
+
+// NewRelay creates a relay without sinks and with the default configuration
+func NewRelay(sinks ...Sink) *Relay {
+	return &Relay{
+		Sinks:        sinks,
+		Interval:     time.Second,
+		BatchSize:    100,
+		ClaimTimeout: 5 * time.Minute,
+		Retention:    7 * 24 * time.Hour,
+	}
+}
+
+// Start runs the relay configured by the environment in the background
+func Start() {
+	if r := GetRelay(); r != nil {
+		go r.run()
+	}
+}
+
+// run publishes the events every interval, in batches until none is left, and deletes the events past their retention
+func (r *Relay) run() {
+	for range time.Tick(r.Interval) {
+		for {
+			relayed, err := r.RelayDue(time.Now())
+			if err != nil {
+				infrastructure.GetLog().WithField("error", err.Error()).Error("Failed to publish the outbox events")
+			}
+			if err != nil || relayed < r.BatchSize {
+				break
+			}
+		}
+		if r.Retention > 0 {
+			if err := DeletePublished(time.Now().Add(-r.Retention)); err != nil {
+				infrastructure.GetLog().WithField("error", err.Error()).Error("Failed to delete the published outbox events")
+			}
+		}
+	}
+}
+
+// RelayDue publishes a batch of the unpublished events, and returns the number of events published
+// The events are claimed by a first transaction, with SKIP LOCKED, so each event is published by a single relay until
+// the claim timeout. The events of a payment whose earlier event is not in the batch, claimed by another relay or past
+// the batch, wait for the next batch. The claimed events are published once the claim is committed, so no row is
+// locked while the sinks answer, and each event is marked published, with its webhook deliveries, by its own short
+// transaction while the claim is the relay's. A failed event is retried by the next batch, and the later events of its
+// payment wait for it. The events left when the claim expires are released for the next batch
+func (r *Relay) RelayDue(now time.Time) (int, error) {
+	token, claimedUntil := uuid.NewV4().String(), time.Now().Add(r.ClaimTimeout)
+	events, err := r.claimDue(now, token, claimedUntil)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	waiting := map[uuid.UUID]bool{}
+	published := 0
+	for _, event := range events {
+		if waiting[event.PaymentID] || time.Now().After(claimedUntil) {
+			continue
+		}
+
+		log := infrastructure.GetLog().WithFields(logrus.Fields{
+			"event_id":   event.EventID.String(),
+			"payment_id": event.PaymentID.String(),
+			"attempt":    event.Attempts + 1,
+		})
+		webhookEvent, err := webhooks.NewEvent(event)
+		if err == nil {
+			err = r.Publish(NewMessage(event))
+		}
+
+		if err != nil {
+			log.WithField("error", err.Error()).Warn("Outbox event not published, retrying")
+			waiting[event.PaymentID] = true
+			changes := map[string]interface{}{"attempts": event.Attempts + 1, "last_error": err.Error(), "claim_token": "", "claimed_until": nil}
+			if err := infrastructure.GetDB().Model(&models.OutboxEvent{}).Where("sequence = ? AND claim_token = ?", event.Sequence, token).Updates(changes).Error; err != nil {
+				return published, errors.New(utils.ERROR_SERVER)
+			}
+			continue
+		}
+
+		marked, err := markPublished(event, webhookEvent, token, now)
+		if err != nil {
+			return published, err
+		}
+		if !marked {
+			// The claim expired and another relay claimed the event, the later events are its
+			log.Warn("Outbox event claimed by another relay, its publication is not recorded")
+			break
+		}
+		log.Debug("Outbox event published")
+		published++
+	}
+
+	// The events not published by the batch are claimed by the next one
+	release := map[string]interface{}{"claim_token": "", "claimed_until": nil}
+	if err := infrastructure.GetDB().Model(&models.OutboxEvent{}).Where("claim_token = ? AND published_at IS NULL", token).Updates(release).Error; err != nil {
+		return published, errors.New(utils.ERROR_SERVER)
+	}
+	return published, nil
+}
+
+// claimDue claims with the token, until the time, a batch of the unpublished events not claimed by another relay,
+// without the events of the payments whose earliest unpublished event is not in the batch, and returns them in order
+func (r *Relay) claimDue(now time.Time, token string, claimedUntil time.Time) ([]models.OutboxEvent, error) {
+	tx := infrastructure.GetDB().Begin()
+
+	events := []models.OutboxEvent{}
+	err := tx.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+		Where("published_at IS NULL AND (claimed_until IS NULL OR claimed_until <= ?)", now).
+		Order("sequence").Limit(r.BatchSize).Find(&events).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.New(utils.ERROR_SERVER)
+	}
+	if len(events) == 0 {
+		tx.Rollback()
+		return nil, nil
+	}
+
+	// The earliest unpublished event of every payment of the batch, claimed or not
+	paymentIDs := make([]uuid.UUID, len(events))
+	for i, event := range events {
+		paymentIDs[i] = event.PaymentID
+	}
+	earliest := []Earliest{}
+	err = tx.Raw(`SELECT payment_id, MIN(sequence) AS sequence FROM outbox_events
+		WHERE published_at IS NULL AND payment_id IN (?) GROUP BY payment_id`, paymentIDs).Scan(&earliest).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.New(utils.ERROR_SERVER)
+	}
+
+	waiting := Waiting(events, earliest)
+	claimed := []models.OutboxEvent{}
+	sequences := []uint64{}
+	for _, event := range events {
+		if !waiting[event.PaymentID] {
+			claimed = append(claimed, event)
+			sequences = append(sequences, event.Sequence)
+		}
+	}
+	if len(claimed) == 0 {
+		tx.Rollback()
+		return nil, nil
+	}
+
+	claim := map[string]interface{}{"claim_token": token, "claimed_until": claimedUntil}
+	if err := tx.Model(&models.OutboxEvent{}).Where("sequence IN (?)", sequences).Updates(claim).Error; err != nil {
+		tx.Rollback()
+		return nil, errors.New(utils.ERROR_SERVER)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, errors.New(utils.ERROR_SERVER)
+	}
+	return claimed, nil
+}
+
+// markPublished marks the event claimed with the token published, and creates its webhook deliveries
+// Returns false when the claim is no longer the relay's
+func markPublished(event models.OutboxEvent, webhookEvent webhooks.Event, token string, now time.Time) (bool, error) {
+	tx := infrastructure.GetDB().Begin()
+
+	changes := map[string]interface{}{"attempts": event.Attempts + 1, "last_error": "", "published_at": now, "claim_token": "", "claimed_until": nil}
+	result := tx.Model(&models.OutboxEvent{}).Where("sequence = ? AND claim_token = ?", event.Sequence, token).Updates(changes)
+	if result.Error != nil {
+		tx.Rollback()
+		return false, errors.New(utils.ERROR_SERVER)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	if err := webhooks.Publish(tx, webhookEvent); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, errors.New(utils.ERROR_SERVER)
+	}
+	return true, nil
+}
+
+// Publish sends the message to every sink, and stops at the first sink that fails
+// The sinks that accepted the message receive it again when it is retried
+func (r *Relay) Publish(message Message) error {
+	for _, sink := range r.Sinks {
+		if err := sink.Publish(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Earliest is the sequence of the earliest unpublished event of a payment
+type Earliest struct {
+	PaymentID uuid.UUID
+	Sequence  uint64
+}
+
+// Waiting returns the payments of the events, ordered by sequence, whose earliest unpublished event is not in the events
+func Waiting(events []models.OutboxEvent, earliest []Earliest) map[uuid.UUID]bool {
+	first := map[uuid.UUID]uint64{}
+	for _, event := range events {
+		if _, ok := first[event.PaymentID]; !ok {
+			first[event.PaymentID] = event.Sequence
+		}
+	}
+
+	waiting := map[uuid.UUID]bool{}
+	for _, e := range earliest {
+		if sequence, ok := first[e.PaymentID]; ok && e.Sequence < sequence {
+			waiting[e.PaymentID] = true
+		}
+	}
+	return waiting
+}
+
+// DeletePublished deletes the events published before the time
+func DeletePublished(before time.Time) error {
+	if err := infrastructure.GetDB().Where("published_at < ?", before).Delete(&models.OutboxEvent{}).Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
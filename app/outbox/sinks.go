@@ -0,0 +1,160 @@
+package outbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"io"
+	"net/http"
+	"os"
+	"payments/app/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is an event of the outbox as published to the sinks, with the payment after the change
+// The id of the event is kept when the event is published again, so the consumers can ignore the repeated ones
+type Message struct {
+	ID             uuid.UUID       `json:"id"`
+	Sequence       uint64          `json:"sequence"`
+	Type           string          `json:"type"`
+	OrganisationID uuid.UUID       `json:"organisation_id"`
+	PaymentID      uuid.UUID       `json:"payment_id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Data           json.RawMessage `json:"data"`
+}
+
+// NewMessage returns the message of an event of the outbox
+func NewMessage(event models.OutboxEvent) Message {
+	return Message{
+		ID:             event.EventID,
+		Sequence:       event.Sequence,
+		Type:           event.Type,
+		OrganisationID: event.OrganisationID,
+		PaymentID:      event.PaymentID,
+		CreatedAt:      event.CreatedAt.UTC(),
+		Data:           json.RawMessage(event.Payload),
+	}
+}
+
+// Sink receives the events of the outbox
+type Sink interface {
+	// Publish returns an error when the message must be published again
+	Publish(message Message) error
+}
+
+// WriterSink writes the messages as JSON lines
+type WriterSink struct {
+	Writer io.Writer
+	mutex  sync.Mutex
+}
+
+// NewStdoutSink creates a sink writing the messages to the standard output, for local development
+func NewStdoutSink() *WriterSink {
+	return &WriterSink{Writer: os.Stdout}
+}
+
+func (s *WriterSink) Publish(message Message) error {
+	line, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = s.Writer.Write(append(line, '\n'))
+	return err
+}
+
+// FileSink appends the messages as JSON lines to a file, synced after every message
+type FileSink struct {
+	WriterSink
+	file *os.File
+}
+
+// NewFileSink opens, or creates, the file of the sink
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{WriterSink: WriterSink{Writer: file}, file: file}, nil
+}
+
+func (s *FileSink) Publish(message Message) error {
+	if err := s.WriterSink.Publish(message); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// HTTPSink posts the messages, as JSON, to an url
+// The event id is sent as the Idempotency-Key, so the receiver can ignore the events published again
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPSink creates a sink of the url
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *HTTPSink) Publish(message Message) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return post(s.Client, s.URL, "application/json", message.ID, body)
+}
+
+// KafkaSink produces the messages to a topic through a Kafka REST proxy (v2 api, JSON embedded format)
+// The key of the records is the payment id, so the events of a payment go to the same partition and keep their order
+type KafkaSink struct {
+	URL    string
+	Topic  string
+	Client *http.Client
+}
+
+// NewKafkaSink creates a sink of the topic of the REST proxy url
+func NewKafkaSink(url string, topic string) *KafkaSink {
+	return &KafkaSink{URL: strings.TrimRight(url, "/"), Topic: topic, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type kafkaRecord struct {
+	Key   string  `json:"key"`
+	Value Message `json:"value"`
+}
+
+func (s *KafkaSink) Publish(message Message) error {
+	body, err := json.Marshal(struct {
+		Records []kafkaRecord `json:"records"`
+	}{[]kafkaRecord{{Key: message.PaymentID.String(), Value: message}}})
+	if err != nil {
+		return err
+	}
+	return post(s.Client, s.URL+"/topics/"+s.Topic, "application/vnd.kafka.json.v2+json", message.ID, body)
+}
+
+// post sends the body of the message, only the 2xx responses are successful
+func post(client *http.Client, url string, contentType string, id uuid.UUID, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Idempotency-Key", id.String())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sink responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package scheduler
+
+import (
+	"errors"
+	"github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+	"os"
+	"payments/app/calendar"
+	"payments/app/models"
+	"payments/app/standingorders"
+	"payments/app/webhooks"
+	"payments/infrastructure"
+	"payments/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheduler submits the pending payments on their processing date, generates the payments of the standing orders and
+// sends the webhook deliveries
+// Every instance of the api runs a scheduler, the rows of the due payments are locked with SKIP LOCKED so each
+// payment is submitted by a single instance
+type Scheduler struct {
+	Submitter Submitter
+	// Interval between the searches of due payments
+	Interval time.Duration
+	// Maximum number of payments dispatched by a batch, claimed one at a time
+	BatchSize int
+	// Submissions of a payment before it fails
+	MaxAttempts uint
+	// Wait before the first retry, doubled on every retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Time a payment stays claimed by its submission, longer than a submission; it is claimed again after it
+	ClaimTimeout time.Duration
+	// Days before their date the payments of the standing orders are generated
+	LeadDays int
+	// Sends the webhook deliveries, they are not sent without it
+	Webhooks *webhooks.Deliverer
+}
+
+var scheduler *Scheduler
+var schedulerOnce sync.Once
+
+// GetScheduler returns the scheduler configured by the environment, nil when the scheduler is disabled
+// SCHEDULER_INTERVAL: interval between the searches of due payments (default 30s), `off` disables the scheduler
+// SCHEDULER_BATCH_SIZE: maximum number of payments dispatched by a batch (default 100)
+// SCHEDULER_MAX_ATTEMPTS: submissions of a payment before it fails (default 5)
+// SCHEDULER_BACKOFF, SCHEDULER_MAX_BACKOFF: wait before the first retry, doubled on every retry up to the maximum (default 1m and 1h)
+// SCHEDULER_CLAIM_TIMEOUT: time a payment stays submitting before it is claimed again (default 5m)
+// SCHEDULER_SUBMIT_URL: gateway the payments are posted to, the payments are only logged without it
+// STANDING_ORDERS_LEAD_DAYS: days before their date the payments of the standing orders are generated (default 3)
+func GetScheduler() *Scheduler {
+	schedulerOnce.Do(func() {
+		if strings.TrimSpace(os.Getenv("SCHEDULER_INTERVAL")) == "off" {
+			return
+		}
+		scheduler = NewScheduler(&LogSubmitter{})
+		scheduler.Webhooks = webhooks.GetDeliverer()
+
+		if url := os.Getenv("SCHEDULER_SUBMIT_URL"); url != "" {
+			scheduler.Submitter = NewHTTPSubmitter(url)
+		}
+		if interval, err := time.ParseDuration(os.Getenv("SCHEDULER_INTERVAL")); err == nil && interval > 0 {
+			scheduler.Interval = interval
+		}
+		if batchSize, err := strconv.Atoi(os.Getenv("SCHEDULER_BATCH_SIZE")); err == nil && batchSize > 0 {
+			scheduler.BatchSize = batchSize
+		}
+		if maxAttempts, err := strconv.Atoi(os.Getenv("SCHEDULER_MAX_ATTEMPTS")); err == nil && maxAttempts > 0 {
+			scheduler.MaxAttempts = uint(maxAttempts)
+		}
+		if backoff, err := time.ParseDuration(os.Getenv("SCHEDULER_BACKOFF")); err == nil && backoff > 0 {
+			scheduler.Backoff = backoff
+		}
+		if maxBackoff, err := time.ParseDuration(os.Getenv("SCHEDULER_MAX_BACKOFF")); err == nil && maxBackoff > 0 {
+			scheduler.MaxBackoff = maxBackoff
+		}
+		if claimTimeout, err := time.ParseDuration(os.Getenv("SCHEDULER_CLAIM_TIMEOUT")); err == nil && claimTimeout > 0 {
+			scheduler.ClaimTimeout = claimTimeout
+		}
+		if leadDays, err := strconv.Atoi(os.Getenv("STANDING_ORDERS_LEAD_DAYS")); err == nil && leadDays >= 0 {
+			scheduler.LeadDays = leadDays
+		}
+	})
+	return scheduler
+}
+
+// NewScheduler creates a scheduler with the default configuration
+func NewScheduler(submitter Submitter) *Scheduler {
+	return &Scheduler{
+		Submitter:    submitter,
+		Interval:     30 * time.Second,
+		BatchSize:    100,
+		MaxAttempts:  5,
+		Backoff:      time.Minute,
+		MaxBackoff:   time.Hour,
+		ClaimTimeout: 5 * time.Minute,
+		LeadDays:     3,
+	}
+}
+
+// Start runs the scheduler configured by the environment in the background
+func Start() {
+	if s := GetScheduler(); s != nil {
+		go s.run()
+	}
+}
+
+// run generates the payments of the standing orders, dispatches the due payments and sends the webhook deliveries every
+// interval, in batches until none is left
+func (s *Scheduler) run() {
+	for range time.Tick(s.Interval) {
+		for {
+			generated, err := standingorders.GenerateDue(time.Now(), s.LeadDays, s.BatchSize)
+			if err != nil {
+				infrastructure.GetLog().WithField("error", err.Error()).Error("Failed to generate the standing order payments")
+			}
+			if err != nil || generated < s.BatchSize {
+				break
+			}
+		}
+		for {
+			dispatched, err := s.DispatchDue(time.Now())
+			if err != nil {
+				infrastructure.GetLog().WithField("error", err.Error()).Error("Failed to dispatch the due payments")
+			}
+			if err != nil || dispatched < s.BatchSize {
+				break
+			}
+		}
+		for s.Webhooks != nil {
+			delivered, err := s.Webhooks.DeliverDue(time.Now())
+			if err != nil {
+				infrastructure.GetLog().WithField("error", err.Error()).Error("Failed to send the webhook deliveries")
+			}
+			if err != nil || delivered < s.Webhooks.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// DispatchDue submits a batch of the pending payments due at the time, and returns the number of payments of the batch
+// Payments are due from their processing date (UTC), or immediately without processing date, and their next attempt
+// The payments are claimed one at a time by a first transaction, which makes the payment submitting until the claim
+// timeout, counts the attempt and records a claim token, and are submitted once it committed, so the rows are not locked
+// during the submission. The result of the submission is recorded by a second transaction, only while the claim token
+// is the payment's. The payment of a scheduler that stopped before recording its result is claimed again after the
+// timeout and submitted again, the submitters must accept duplicates, until it used its attempts
+// The submitted and failed payments record a payment.status_changed event with their new status
+func (s *Scheduler) DispatchDue(now time.Time) (int, error) {
+	dispatched := 0
+	for dispatched < s.BatchSize {
+		payment, err := s.claimNext(now)
+		if err != nil || payment == nil {
+			return dispatched, err
+		}
+		dispatched++
+
+		var changes map[string]interface{}
+		if payment.Attempts > s.MaxAttempts {
+			changes = s.interrupted(*payment)
+		} else {
+			changes = s.submit(*payment, now)
+		}
+		if err := s.record(*payment, changes); err != nil {
+			infrastructure.GetLog().WithFields(logrus.Fields{"payment_id": payment.ID.String(), "error": err.Error()}).
+				Error("Failed to record the submission of the payment, it is submitted again after the claim timeout")
+		}
+	}
+	return dispatched, nil
+}
+
+// claimNext makes the next due payment, or submitting payment past its claim, submitting until the claim timeout, and
+// returns it with its attempt counted, nil when no payment is due
+// The claim timeout starts when the payment is claimed, not at the time of the batch
+func (s *Scheduler) claimNext(now time.Time) (*models.Payment, error) {
+	tx := infrastructure.GetDB().Begin()
+
+	// The due payments locked by other instances are skipped
+	due := []struct{ ID uuid.UUID }{}
+	err := tx.Raw(`SELECT id FROM payments
+		WHERE ((status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)) OR (status = ? AND next_attempt_at <= ?))
+		AND id IN (SELECT payment_refer FROM attributes WHERE processing_date <= ?)
+		ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED`,
+		models.PAYMENT_STATUS_PENDING, now, models.PAYMENT_STATUS_SUBMITTING, now, now.UTC().Format(calendar.DATE_FORMAT)).Scan(&due).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.New(utils.ERROR_SERVER)
+	}
+	if len(due) == 0 {
+		tx.Rollback()
+		return nil, nil
+	}
+
+	payment := models.Payment{}
+	if err := tx.Set("gorm:auto_preload", true).Where("id = ?", due[0].ID).First(&payment).Error; err != nil {
+		tx.Rollback()
+		return nil, errors.New(utils.ERROR_SERVER)
+	}
+
+	claim := map[string]interface{}{
+		"status":          models.PAYMENT_STATUS_SUBMITTING,
+		"attempts":        payment.Attempts + 1,
+		"next_attempt_at": time.Now().Add(s.ClaimTimeout),
+		"claim_token":     uuid.NewV4().String(),
+	}
+	if err := tx.Model(&models.Payment{}).Where("id = ?", payment.ID).Updates(claim).Error; err != nil {
+		tx.Rollback()
+		return nil, errors.New(utils.ERROR_SERVER)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, errors.New(utils.ERROR_SERVER)
+	}
+	payment.Status = models.PAYMENT_STATUS_SUBMITTING
+	payment.Attempts = claim["attempts"].(uint)
+	payment.ClaimToken = claim["claim_token"].(string)
+	return &payment, nil
+}
+
+// record stores the result of the submission of the claimed payment, a retried payment is pending again
+// The result is ignored when the claim is no longer the payment's, e.g. expired and claimed again by another instance
+func (s *Scheduler) record(payment models.Payment, changes map[string]interface{}) error {
+	_, statusChanged := changes["status"]
+	if !statusChanged {
+		changes["status"] = models.PAYMENT_STATUS_PENDING
+	}
+	changes["claim_token"] = ""
+
+	tx := infrastructure.GetDB().Begin()
+
+	result := tx.Model(&models.Payment{}).
+		Where("id = ? AND status = ? AND claim_token = ?", payment.ID, models.PAYMENT_STATUS_SUBMITTING, payment.ClaimToken).
+		Updates(changes)
+	if result.Error != nil {
+		tx.Rollback()
+		return errors.New(utils.ERROR_SERVER)
+	}
+	if result.RowsAffected == 0 || !statusChanged {
+		if err := tx.Commit().Error; err != nil {
+			return errors.New(utils.ERROR_SERVER)
+		}
+		return nil
+	}
+
+	if err := tx.Set("gorm:auto_preload", true).Where("id = ?", payment.ID).First(&payment).Error; err != nil {
+		tx.Rollback()
+		return errors.New(utils.ERROR_SERVER)
+	}
+	if err := models.RecordPaymentEvent(tx, models.EVENT_PAYMENT_STATUS_CHANGED, payment); err != nil {
+		tx.Rollback()
+		return errors.New(utils.ERROR_SERVER)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+	return nil
+}
+
+// submit submits the claimed payment, whose attempts count this submission, and returns the columns of its new status
+func (s *Scheduler) submit(payment models.Payment, now time.Time) map[string]interface{} {
+	log := infrastructure.GetLog().WithFields(logrus.Fields{"payment_id": payment.ID.String(), "attempt": payment.Attempts})
+
+	err := s.Submitter.Submit(payment)
+	if err == nil {
+		log.Info("Payment submitted")
+		return map[string]interface{}{
+			"status":          models.PAYMENT_STATUS_SUBMITTED,
+			"next_attempt_at": nil,
+			"last_error":      "",
+			"submitted_at":    now,
+		}
+	}
+
+	if payment.Attempts >= s.MaxAttempts {
+		log.WithField("error", err.Error()).Error("Payment failed")
+		return map[string]interface{}{
+			"status":          models.PAYMENT_STATUS_FAILED,
+			"next_attempt_at": nil,
+			"last_error":      err.Error(),
+		}
+	}
+
+	log.WithField("error", err.Error()).Warn("Payment submission failed, retrying")
+	return map[string]interface{}{
+		"next_attempt_at": now.Add(s.RetryDelay(payment.Attempts)),
+		"last_error":      err.Error(),
+	}
+}
+
+// interrupted returns the columns of a payment claimed again after its last attempt, whose submission never recorded
+// its result: it fails without another submission
+func (s *Scheduler) interrupted(payment models.Payment) map[string]interface{} {
+	infrastructure.GetLog().WithField("payment_id", payment.ID.String()).Error("Payment failed, its last submission was interrupted")
+	return map[string]interface{}{
+		"status":          models.PAYMENT_STATUS_FAILED,
+		"attempts":        s.MaxAttempts,
+		"next_attempt_at": nil,
+		"last_error":      utils.ERROR_PAYMENT_SUBMISSION_INTERRUPTED,
+	}
+}
+
+// RetryDelay returns the wait after the failed attempt, the backoff doubled on every attempt up to the maximum
+func (s *Scheduler) RetryDelay(attempts uint) time.Duration {
+	delay := s.Backoff
+	for i := uint(1); i < attempts && delay < s.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.MaxBackoff {
+		delay = s.MaxBackoff
+	}
+	return delay
+}
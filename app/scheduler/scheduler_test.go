@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"payments/app/models"
+	"payments/utils"
+	"testing"
+	"time"
+)
+
+type failingSubmitter struct{}
+
+func (s *failingSubmitter) Submit(payment models.Payment) error {
+	return errors.New("gateway unavailable")
+}
+
+func TestRetryDelay(t *testing.T) {
+	s := NewScheduler(&LogSubmitter{})
+
+	assert.EqualValues(t, time.Minute, s.RetryDelay(1))
+	assert.EqualValues(t, 2*time.Minute, s.RetryDelay(2))
+	assert.EqualValues(t, 32*time.Minute, s.RetryDelay(6))
+	assert.EqualValues(t, time.Hour, s.RetryDelay(7))
+	assert.EqualValues(t, time.Hour, s.RetryDelay(100))
+}
+
+func TestSubmit(t *testing.T) {
+	now := time.Now()
+	payment := models.Payment{ID: uuid.NewV4()}
+
+	submitted := NewScheduler(&LogSubmitter{}).submit(payment, now)
+	assert.EqualValues(t, models.PAYMENT_STATUS_SUBMITTED, submitted["status"])
+	assert.EqualValues(t, now, submitted["submitted_at"])
+
+	// The failed submissions are retried with backoff, the claim counted the attempt
+	s := NewScheduler(&failingSubmitter{})
+	payment.Attempts = 2
+	retried := s.submit(payment, now)
+	assert.NotContains(t, retried, "status")
+	assert.EqualValues(t, now.Add(2*time.Minute), retried["next_attempt_at"])
+	assert.EqualValues(t, "gateway unavailable", retried["last_error"])
+
+	// Until the last attempt
+	payment.Attempts = 5
+	failed := s.submit(payment, now)
+	assert.EqualValues(t, models.PAYMENT_STATUS_FAILED, failed["status"])
+	assert.Nil(t, failed["next_attempt_at"])
+}
+
+func TestInterrupted(t *testing.T) {
+	payment := models.Payment{ID: uuid.NewV4(), Attempts: 6}
+
+	// Claimed again after its last attempt, the payment fails without being submitted
+	failed := NewScheduler(&LogSubmitter{}).interrupted(payment)
+	assert.EqualValues(t, models.PAYMENT_STATUS_FAILED, failed["status"])
+	assert.EqualValues(t, 5, failed["attempts"])
+	assert.EqualValues(t, utils.ERROR_PAYMENT_SUBMISSION_INTERRUPTED, failed["last_error"])
+}
+
+func TestHTTPSubmitter(t *testing.T) {
+	payment := models.Payment{ID: uuid.NewV4(), Status: models.PAYMENT_STATUS_PENDING}
+
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.EqualValues(t, payment.ID.String(), r.Header.Get("Idempotency-Key"))
+
+		var received models.Payment
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&received))
+		assert.EqualValues(t, payment.ID, received.ID)
+
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	submitter := NewHTTPSubmitter(server.URL)
+	assert.NoError(t, submitter.Submit(payment))
+
+	status = http.StatusServiceUnavailable
+	assert.EqualError(t, submitter.Submit(payment), "gateway responded with status 503")
+}
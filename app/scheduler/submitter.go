@@ -0,0 +1,62 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"payments/app/models"
+	"payments/infrastructure"
+	"time"
+)
+
+// Submitter sends the payments to their payment scheme
+type Submitter interface {
+	// Submit returns an error when the payment must be submitted again
+	Submit(payment models.Payment) error
+}
+
+// LogSubmitter only logs the payments, for local development
+type LogSubmitter struct{}
+
+func (s *LogSubmitter) Submit(payment models.Payment) error {
+	infrastructure.GetLog().WithField("payment_id", payment.ID.String()).Info("Payment sent to the log submitter")
+	return nil
+}
+
+// HTTPSubmitter posts the payments, as JSON, to a gateway of the payment schemes
+// The payment id is sent as the Idempotency-Key, so the gateway can ignore the payments submitted again
+type HTTPSubmitter struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewHTTPSubmitter creates a submitter of the gateway url
+func NewHTTPSubmitter(url string) *HTTPSubmitter {
+	return &HTTPSubmitter{URL: url, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (s *HTTPSubmitter) Submit(payment models.Payment) error {
+	body, err := json.Marshal(payment)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", payment.ID.String())
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("gateway responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
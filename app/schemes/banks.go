@@ -0,0 +1,31 @@
+package schemes
+
+import (
+	"payments/app/banks"
+	"payments/app/models"
+	"payments/utils"
+	"strings"
+)
+
+// validateBeneficiaryBank checks the bank of the beneficiary is in the directory, when the directory lists the banks
+// of its bank id code, and that the bank can receive payments of the scheme
+func validateBeneficiaryBank(payment models.Payment) []string {
+	beneficiary := payment.Attributes.BeneficiaryParty
+	if beneficiary.DebtorPartySkeleton == nil || beneficiary.SponsorPartySkeleton == nil || strings.TrimSpace(beneficiary.BankID) == "" {
+		return nil
+	}
+
+	directory := banks.GetDirectory()
+	bank, ok := directory.Lookup(beneficiary.BankIDCode, beneficiary.BankID)
+	if !ok {
+		if directory.Covers(beneficiary.BankIDCode) {
+			return []string{fieldError("beneficiary_party.bank_id", utils.ERROR_BANK_NOT_FOUND)}
+		}
+		return nil
+	}
+
+	if scheme := payment.Attributes.PaymentScheme; scheme != "" && !bank.Reaches(scheme) {
+		return []string{fieldError("beneficiary_party.bank_id", utils.ERROR_BANK_NOT_REACHABLE)}
+	}
+	return nil
+}
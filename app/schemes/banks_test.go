@@ -0,0 +1,35 @@
+package schemes
+
+import (
+	"github.com/stretchr/testify/assert"
+	"payments/app/banks"
+	"payments/utils"
+	"strings"
+	"testing"
+)
+
+func TestValidateBeneficiaryBank(t *testing.T) {
+	directory := banks.NewDirectory()
+	if err := directory.Load(strings.NewReader("bank_id,bank_id_code,name,schemes\n403000,GBDSC,HSBC UK Bank,FPS;BACS\n123123,GBDSC,Bank A,\n")); err != nil {
+		t.Fatal(err)
+	}
+	banks.SetDirectory(directory)
+	defer banks.SetDirectory(banks.NewDirectory())
+
+	payment := fpsPayment()
+	assert.Empty(t, ValidatePayment(payment))
+
+	payment.Attributes.PaymentScheme = "Internal"
+	assert.EqualValues(t, []string{"beneficiary_party.bank_id: " + utils.ERROR_BANK_NOT_REACHABLE}, ValidatePayment(payment))
+
+	// Banks without schemes are reachable
+	payment.Attributes.BeneficiaryParty.BankID = "123123"
+	assert.Empty(t, ValidatePayment(payment))
+
+	payment.Attributes.BeneficiaryParty.BankID = "999999"
+	assert.EqualValues(t, []string{"beneficiary_party.bank_id: " + utils.ERROR_BANK_NOT_FOUND}, ValidatePayment(payment))
+
+	// The directory does not list the banks identified by BIC
+	payment.Attributes.BeneficiaryParty.BankID, payment.Attributes.BeneficiaryParty.BankIDCode = "COBADEFF", "SWBIC"
+	assert.Empty(t, ValidatePayment(payment))
+}
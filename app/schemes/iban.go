@@ -0,0 +1,132 @@
+package schemes
+
+import (
+	"errors"
+	"math/big"
+	"payments/utils"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// IbanCountry is the IBAN format of a country: the total length and the structure of the BBAN
+type IbanCountry struct {
+	Length int
+	BBAN   string
+	SEPA   bool
+	bban   *regexp.Regexp
+}
+
+// IBAN formats of the IBAN registry, the BBAN structure is written as in the registry: n digits, a upper case letters, c alphanumerics
+var ibanCountries = map[string]*IbanCountry{
+	"AD": {Length: 24, BBAN: "4n4n12c", SEPA: true},
+	"AT": {Length: 20, BBAN: "5n11n", SEPA: true},
+	"BE": {Length: 16, BBAN: "3n7n2n", SEPA: true},
+	"BG": {Length: 22, BBAN: "4a4n2n8c", SEPA: true},
+	"CH": {Length: 21, BBAN: "5n12c", SEPA: true},
+	"CY": {Length: 28, BBAN: "3n5n16c", SEPA: true},
+	"CZ": {Length: 24, BBAN: "4n6n10n", SEPA: true},
+	"DE": {Length: 22, BBAN: "8n10n", SEPA: true},
+	"DK": {Length: 18, BBAN: "4n9n1n", SEPA: true},
+	"EE": {Length: 20, BBAN: "2n2n11n1n", SEPA: true},
+	"ES": {Length: 24, BBAN: "4n4n1n1n10n", SEPA: true},
+	"FI": {Length: 18, BBAN: "3n11n", SEPA: true},
+	"FR": {Length: 27, BBAN: "5n5n11c2n", SEPA: true},
+	"GB": {Length: 22, BBAN: "4a6n8n", SEPA: true},
+	"GI": {Length: 23, BBAN: "4a15c", SEPA: true},
+	"GR": {Length: 27, BBAN: "3n4n16c", SEPA: true},
+	"HR": {Length: 21, BBAN: "7n10n", SEPA: true},
+	"HU": {Length: 28, BBAN: "3n4n1n15n1n", SEPA: true},
+	"IE": {Length: 22, BBAN: "4a6n8n", SEPA: true},
+	"IS": {Length: 26, BBAN: "4n2n6n10n", SEPA: true},
+	"IT": {Length: 27, BBAN: "1a5n5n12c", SEPA: true},
+	"LI": {Length: 21, BBAN: "5n12c", SEPA: true},
+	"LT": {Length: 20, BBAN: "5n11n", SEPA: true},
+	"LU": {Length: 20, BBAN: "3n13c", SEPA: true},
+	"LV": {Length: 21, BBAN: "4a13c", SEPA: true},
+	"MC": {Length: 27, BBAN: "5n5n11c2n", SEPA: true},
+	"MT": {Length: 31, BBAN: "4a5n18c", SEPA: true},
+	"NL": {Length: 18, BBAN: "4a10n", SEPA: true},
+	"NO": {Length: 15, BBAN: "4n6n1n", SEPA: true},
+	"PL": {Length: 28, BBAN: "8n16n", SEPA: true},
+	"PT": {Length: 25, BBAN: "4n4n11n2n", SEPA: true},
+	"RO": {Length: 24, BBAN: "4a16c", SEPA: true},
+	"SE": {Length: 24, BBAN: "3n16n1n1n", SEPA: true},
+	"SI": {Length: 19, BBAN: "5n8n2n", SEPA: true},
+	"SK": {Length: 24, BBAN: "4n6n10n", SEPA: true},
+	"SM": {Length: 27, BBAN: "1a5n5n12c", SEPA: true},
+	"VA": {Length: 22, BBAN: "3n15n", SEPA: true},
+	"AE": {Length: 23, BBAN: "3n16n"},
+	"BR": {Length: 29, BBAN: "8n5n10n1a1c"},
+	"SA": {Length: 24, BBAN: "2n18c"},
+	"TR": {Length: 26, BBAN: "5n1n16c"},
+}
+
+var bbanPart = regexp.MustCompile(`([0-9]+)([nac])`)
+
+func init() {
+	classes := map[string]string{"n": "[0-9]", "a": "[A-Z]", "c": "[A-Za-z0-9]"}
+	for _, country := range ibanCountries {
+		pattern := "^"
+		for _, part := range bbanPart.FindAllStringSubmatch(country.BBAN, -1) {
+			pattern += classes[part[2]] + "{" + part[1] + "}"
+		}
+		country.bban = regexp.MustCompile(pattern + "$")
+	}
+}
+
+// GetIbanCountry returns the IBAN format of the country
+func GetIbanCountry(code string) (*IbanCountry, bool) {
+	country, ok := ibanCountries[code]
+	return country, ok
+}
+
+// NormalizeIBAN removes the spaces of the printed format and converts to upper case
+func NormalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.Replace(strings.TrimSpace(iban), " ", "", -1))
+}
+
+// ValidateIBAN checks the country format and the ISO 7064 mod 97-10 check digits of the IBAN
+func ValidateIBAN(iban string) error {
+	if len(iban) < 5 {
+		return errors.New(utils.ERROR_IBAN_INVALID)
+	}
+
+	country, ok := ibanCountries[iban[:2]]
+	if !ok {
+		return errors.New(utils.ERROR_IBAN_COUNTRY_UNSUPPORTED)
+	}
+	if _, err := strconv.Atoi(iban[2:4]); err != nil || len(iban) != country.Length || !country.bban.MatchString(iban[4:]) {
+		return errors.New(utils.ERROR_IBAN_FORMAT)
+	}
+
+	if ibanChecksum(iban) != 1 {
+		return errors.New(utils.ERROR_IBAN_CHECKSUM)
+	}
+	return nil
+}
+
+// ibanChecksum moves the country code and check digits to the end, converts the letters to numbers (A = 10) and returns the remainder of 97
+func ibanChecksum(iban string) int64 {
+	digits := ""
+	for _, c := range strings.ToUpper(iban[4:] + iban[:4]) {
+		if c >= 'A' && c <= 'Z' {
+			digits += strconv.Itoa(int(c-'A') + 10)
+		} else {
+			digits += string(c)
+		}
+	}
+
+	number, _ := new(big.Int).SetString(digits, 10)
+	return new(big.Int).Mod(number, big.NewInt(97)).Int64()
+}
+
+var bicPattern = regexp.MustCompile(`^[A-Z]{4}[A-Z]{2}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+
+// ValidateBIC checks the ISO 9362 structure of the BIC: institution, country, location and optional branch
+func ValidateBIC(bic string) error {
+	if !bicPattern.MatchString(bic) {
+		return errors.New(utils.ERROR_BIC_INVALID)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package schemes
+
+import (
+	"math/big"
+	"payments/app/models"
+	"payments/utils"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Check is a validation of a scheme that the declarative rules can not express, e.g. the SEPA IBANs
+type Check func(payment models.Payment) []string
+
+// Rules is the profile of a scheme described by its limits
+// Empty lists and zero limits do not restrict the payments
+type Rules struct {
+	// Accepted currencies, ISO 4217 codes
+	Currencies []string
+	// Amount limits, in the currency of the payment
+	MinAmount string
+	MaxAmount string
+	// Accepted values of payment_type, scheme_payment_type and scheme_payment_sub_type
+	PaymentTypes          []string
+	SchemePaymentTypes    []string
+	SchemePaymentSubTypes []string
+	// Maximum number of characters of the references
+	ReferenceMaxLength         int
+	EndToEndReferenceMaxLength int
+	NumericReferenceMaxLength  int
+	// Fields that must be filled, e.g. beneficiary_party.account_name
+	RequiredFields []string
+	Checks         []Check
+}
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Validate checks the payment follows the rules, the errors are returned as `field: message`
+func (rules Rules) Validate(payment models.Payment) []string {
+	attributes := payment.Attributes
+	errs := []string{}
+
+	if !currencyPattern.MatchString(attributes.Currency) || (len(rules.Currencies) > 0 && !contains(rules.Currencies, attributes.Currency)) {
+		errs = append(errs, fieldError("currency", utils.ERROR_SCHEME_CURRENCY))
+	}
+	errs = append(errs, rules.validateAmount(attributes.Amount)...)
+
+	if attributes.PaymentType != "" && len(rules.PaymentTypes) > 0 && !contains(rules.PaymentTypes, attributes.PaymentType) {
+		errs = append(errs, fieldError("payment_type", utils.ERROR_SCHEME_PAYMENT_TYPE))
+	}
+	if attributes.SchemePaymentType != "" && len(rules.SchemePaymentTypes) > 0 && !contains(rules.SchemePaymentTypes, attributes.SchemePaymentType) {
+		errs = append(errs, fieldError("scheme_payment_type", utils.ERROR_SCHEME_PAYMENT_TYPE))
+	}
+	if attributes.SchemePaymentSubType != "" && len(rules.SchemePaymentSubTypes) > 0 && !contains(rules.SchemePaymentSubTypes, attributes.SchemePaymentSubType) {
+		errs = append(errs, fieldError("scheme_payment_sub_type", utils.ERROR_SCHEME_PAYMENT_SUB_TYPE))
+	}
+
+	// The references are counted in characters, not bytes
+	for _, reference := range []struct {
+		field     string
+		value     string
+		maxLength int
+	}{
+		{"reference", attributes.Reference, rules.ReferenceMaxLength},
+		{"end_to_end_reference", attributes.EndToEndReference, rules.EndToEndReferenceMaxLength},
+		{"numeric_reference", attributes.NumericReference, rules.NumericReferenceMaxLength},
+	} {
+		if reference.maxLength > 0 && utf8.RuneCountInString(reference.value) > reference.maxLength {
+			errs = append(errs, fieldError(reference.field, utils.ERROR_SCHEME_REFERENCE_TOO_LONG))
+		}
+	}
+
+	for _, field := range rules.RequiredFields {
+		if strings.TrimSpace(FieldValue(payment, field)) == "" {
+			errs = append(errs, fieldError(field, utils.ERROR_SCHEME_FIELD_REQUIRED))
+		}
+	}
+
+	for _, check := range rules.Checks {
+		errs = append(errs, check(payment)...)
+	}
+
+	return errs
+}
+
+// validateAmount checks the amount is positive, with up to 2 decimals, and within the limits of the scheme
+func (rules Rules) validateAmount(value string) []string {
+	amount, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok || amount.Sign() <= 0 || !new(big.Rat).Mul(amount, big.NewRat(100, 1)).IsInt() {
+		return []string{fieldError("amount", utils.ERROR_SCHEME_AMOUNT_INVALID)}
+	}
+	if min, ok := new(big.Rat).SetString(rules.MinAmount); ok && amount.Cmp(min) < 0 {
+		return []string{fieldError("amount", utils.ERROR_SCHEME_AMOUNT_TOO_LOW)}
+	}
+	if max, ok := new(big.Rat).SetString(rules.MaxAmount); ok && amount.Cmp(max) > 0 {
+		return []string{fieldError("amount", utils.ERROR_SCHEME_AMOUNT_TOO_HIGH)}
+	}
+	return nil
+}
+
+// FieldValue returns the value of a field of the payment by its json name, e.g. debtor_party.account_number
+// Unknown fields and fields of missing parties are empty
+func FieldValue(payment models.Payment, field string) string {
+	attributes := payment.Attributes
+	parts := strings.SplitN(field, ".", 2)
+
+	if len(parts) == 1 {
+		switch field {
+		case "amount":
+			return attributes.Amount
+		case "currency":
+			return attributes.Currency
+		case "end_to_end_reference":
+			return attributes.EndToEndReference
+		case "numeric_reference":
+			return attributes.NumericReference
+		case "payment_id":
+			return attributes.PaymentID
+		case "payment_purpose":
+			return attributes.PaymentPurpose
+		case "payment_type":
+			return attributes.PaymentType
+		case "processing_date":
+			return attributes.ProcessingDate
+		case "reference":
+			return attributes.Reference
+		case "scheme_payment_type":
+			return attributes.SchemePaymentType
+		case "scheme_payment_sub_type":
+			return attributes.SchemePaymentSubType
+		}
+		return ""
+	}
+
+	var party *models.DebtorPartySkeleton
+	var sponsor *models.SponsorPartySkeleton
+	switch parts[0] {
+	case "debtor_party":
+		party = attributes.DebtorParty.DebtorPartySkeleton
+	case "beneficiary_party":
+		party = attributes.BeneficiaryParty.DebtorPartySkeleton
+	case "sponsor_party":
+		sponsor = attributes.SponsorParty.SponsorPartySkeleton
+	}
+	if party != nil {
+		sponsor = party.SponsorPartySkeleton
+		switch parts[1] {
+		case "account_name":
+			return party.AccountName
+		case "account_number_code":
+			return party.AccountNumberCode
+		case "address":
+			return party.Address
+		case "name":
+			return party.Name
+		}
+	}
+	if sponsor != nil {
+		switch parts[1] {
+		case "account_number":
+			return sponsor.AccountNumber
+		case "bank_id":
+			return sponsor.BankID
+		case "bank_id_code":
+			return sponsor.BankIDCode
+		}
+	}
+	return ""
+}
+
+// contains check if the value is in the list, regardless of the case
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, strings.TrimSpace(value)) {
+			return true
+		}
+	}
+	return false
+}
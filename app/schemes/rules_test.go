@@ -0,0 +1,129 @@
+package schemes
+
+import (
+	"github.com/stretchr/testify/assert"
+	"payments/app/models"
+	"payments/utils"
+	"strings"
+	"testing"
+)
+
+func fpsPayment() models.Payment {
+	return models.Payment{Attributes: models.Attributes{
+		Amount:               "100.21",
+		Currency:             "GBP",
+		PaymentScheme:        "FPS",
+		PaymentType:          "Credit",
+		SchemePaymentType:    "ImmediatePayment",
+		SchemePaymentSubType: "InternetBanking",
+		Reference:            "Em's piano lessons",
+		EndToEndReference:    "Wil piano Jan",
+		DebtorParty: models.DebtorParty{DebtorPartySkeleton: &models.DebtorPartySkeleton{
+			SponsorPartySkeleton: &models.SponsorPartySkeleton{AccountNumber: "GB29XABC10161234567801", BankID: "203301", BankIDCode: "GBDSC"},
+			AccountNumberCode:    ACCOUNT_NUMBER_CODE_IBAN,
+			AccountName:          "EJ Brown Black",
+		}},
+		BeneficiaryParty: models.BeneficiaryParty{DebtorPartySkeleton: &models.DebtorPartySkeleton{
+			SponsorPartySkeleton: &models.SponsorPartySkeleton{AccountNumber: "31926819", BankID: "403000", BankIDCode: "GBDSC"},
+			AccountNumberCode:    "BBAN",
+			AccountName:          "W Owens",
+		}},
+	}}
+}
+
+func TestValidateFpsPayment(t *testing.T) {
+	assert.Empty(t, ValidatePayment(fpsPayment()))
+
+	payment := fpsPayment()
+	payment.Attributes.Currency = "EUR"
+	payment.Attributes.Amount = "1000000.01"
+	payment.Attributes.SchemePaymentType = "DirectDebit"
+	payment.Attributes.SchemePaymentSubType = "Fax"
+	payment.Attributes.Reference = "Payment for Em's piano lessons"
+	payment.Attributes.BeneficiaryParty.AccountName = " "
+	payment.Attributes.DebtorParty.DebtorPartySkeleton = nil
+
+	assert.EqualValues(t, []string{
+		"[FPS] currency: " + utils.ERROR_SCHEME_CURRENCY,
+		"[FPS] amount: " + utils.ERROR_SCHEME_AMOUNT_TOO_HIGH,
+		"[FPS] scheme_payment_type: " + utils.ERROR_SCHEME_PAYMENT_TYPE,
+		"[FPS] scheme_payment_sub_type: " + utils.ERROR_SCHEME_PAYMENT_SUB_TYPE,
+		"[FPS] reference: " + utils.ERROR_SCHEME_REFERENCE_TOO_LONG,
+		"[FPS] debtor_party.account_number: " + utils.ERROR_SCHEME_FIELD_REQUIRED,
+		"[FPS] debtor_party.account_name: " + utils.ERROR_SCHEME_FIELD_REQUIRED,
+		"[FPS] beneficiary_party.account_name: " + utils.ERROR_SCHEME_FIELD_REQUIRED,
+	}, ValidatePayment(payment))
+}
+
+func TestValidateUkSchemes(t *testing.T) {
+	// Bacs needs the sponsor account the payments are submitted from
+	payment := fpsPayment()
+	payment.Attributes.PaymentScheme = "Bacs"
+	payment.Attributes.SchemePaymentType = "DirectCredit"
+	payment.Attributes.SchemePaymentSubType = ""
+	assert.EqualValues(t, []string{
+		"[BACS] sponsor_party.account_number: " + utils.ERROR_SCHEME_FIELD_REQUIRED,
+		"[BACS] sponsor_party.bank_id: " + utils.ERROR_SCHEME_FIELD_REQUIRED,
+	}, ValidatePayment(payment))
+
+	payment.Attributes.SponsorParty.SponsorPartySkeleton = &models.SponsorPartySkeleton{AccountNumber: "56781234", BankID: "123123", BankIDCode: "GBDSC"}
+	assert.Empty(t, ValidatePayment(payment))
+
+	// CHAPS has no upper limit but needs the names of the parties
+	payment = fpsPayment()
+	payment.Attributes.PaymentScheme = "CHAPS"
+	payment.Attributes.Amount = "25000000.00"
+	payment.Attributes.Reference = strings.Repeat("x", 140)
+	assert.EqualValues(t, []string{
+		"[CHAPS] debtor_party.name: " + utils.ERROR_SCHEME_FIELD_REQUIRED,
+		"[CHAPS] beneficiary_party.name: " + utils.ERROR_SCHEME_FIELD_REQUIRED,
+	}, ValidatePayment(payment))
+}
+
+func TestValidateSwiftPayment(t *testing.T) {
+	payment := fpsPayment()
+	payment.Attributes.PaymentScheme = "SWIFT"
+	payment.Attributes.Currency = "USD"
+	payment.Attributes.DebtorParty.Name = "Emelia Jane Brown"
+	payment.Attributes.BeneficiaryParty.Name = "Wilfred Jeremiah Owens"
+	assert.Empty(t, ValidatePayment(payment))
+
+	payment.Attributes.Currency = "usd"
+	payment.Attributes.Amount = "0"
+	payment.Attributes.PaymentType = "Debit"
+	payment.Attributes.EndToEndReference = strings.Repeat("x", 31)
+	assert.EqualValues(t, []string{
+		"[SWIFT] currency: " + utils.ERROR_SCHEME_CURRENCY,
+		"[SWIFT] amount: " + utils.ERROR_SCHEME_AMOUNT_INVALID,
+		"[SWIFT] payment_type: " + utils.ERROR_SCHEME_PAYMENT_TYPE,
+		"[SWIFT] end_to_end_reference: " + utils.ERROR_SCHEME_REFERENCE_TOO_LONG,
+	}, ValidatePayment(payment))
+}
+
+func TestRegister(t *testing.T) {
+	Register("Internal", Rules{Currencies: []string{"GBP"}, MinAmount: "10", Checks: []Check{
+		func(payment models.Payment) []string { return []string{"payment_purpose: Purpose required"} },
+	}})
+	defer delete(profiles, "INTERNAL")
+
+	payment := fpsPayment()
+	payment.Attributes.PaymentScheme = "internal"
+	payment.Attributes.Amount = "9.99"
+	assert.EqualValues(t, []string{
+		"[INTERNAL] amount: " + utils.ERROR_SCHEME_AMOUNT_TOO_LOW,
+		"[INTERNAL] payment_purpose: Purpose required",
+	}, ValidatePayment(payment))
+
+	// Schemes without profile are not validated
+	payment.Attributes.PaymentScheme = "Unknown"
+	assert.Empty(t, ValidatePayment(payment))
+}
+
+func TestFieldValue(t *testing.T) {
+	payment := fpsPayment()
+	assert.EqualValues(t, "403000", FieldValue(payment, "beneficiary_party.bank_id"))
+	assert.EqualValues(t, "EJ Brown Black", FieldValue(payment, "debtor_party.account_name"))
+	assert.EqualValues(t, "Em's piano lessons", FieldValue(payment, "reference"))
+	assert.EqualValues(t, "", FieldValue(payment, "sponsor_party.bank_id"))
+	assert.EqualValues(t, "", FieldValue(payment, "beneficiary_party.unknown"))
+}
@@ -0,0 +1,46 @@
+package schemes
+
+import (
+	"payments/app/models"
+	"strings"
+)
+
+// Profile validates the payments of a payment scheme
+type Profile interface {
+	// Validate returns the errors of the payment, as `field: message`
+	Validate(payment models.Payment) []string
+}
+
+// Profiles of the payment schemes, by upper case scheme name
+var profiles = map[string]Profile{}
+
+// Register sets the profile of the payment scheme
+func Register(scheme string, profile Profile) {
+	profiles[strings.ToUpper(scheme)] = profile
+}
+
+// GetProfile returns the profile of the payment scheme, if the scheme has one
+func GetProfile(scheme string) (Profile, bool) {
+	profile, ok := profiles[strings.ToUpper(strings.TrimSpace(scheme))]
+	return profile, ok
+}
+
+// ValidatePayment validates the payment with the profile of its scheme, checks the UK accounts of its parties and
+// the reachability of the beneficiary bank
+// The payments of schemes without profile only have their accounts and bank checked
+func ValidatePayment(payment models.Payment) []string {
+	errs := []string{}
+	if profile, ok := GetProfile(payment.Attributes.PaymentScheme); ok {
+		// The errors of the scheme are tagged with the scheme, e.g. `[FPS] currency: ...`
+		tag := "[" + strings.ToUpper(strings.TrimSpace(payment.Attributes.PaymentScheme)) + "] "
+		for _, err := range profile.Validate(payment) {
+			errs = append(errs, tag+err)
+		}
+	}
+	errs = append(errs, validateSortCodes(payment)...)
+	return append(errs, validateBeneficiaryBank(payment)...)
+}
+
+func fieldError(field string, message string) string {
+	return field + ": " + message
+}
@@ -0,0 +1,70 @@
+package schemes
+
+import (
+	"errors"
+	"payments/app/models"
+	"payments/utils"
+	"strings"
+)
+
+// Payment scheme of the SEPA Credit Transfers
+const PAYMENT_SCHEME_SEPA = "SEPA"
+
+// Identification codes of the accounts and banks of SEPA payments
+const ACCOUNT_NUMBER_CODE_IBAN = "IBAN"
+const BANK_ID_CODE_BIC = "SWBIC"
+
+func init() {
+	Register(PAYMENT_SCHEME_SEPA, Rules{
+		Currencies:                 []string{"EUR"},
+		MinAmount:                  "0.01",
+		MaxAmount:                  "999999999.99",
+		PaymentTypes:               []string{"Credit"},
+		ReferenceMaxLength:         140,
+		EndToEndReferenceMaxLength: 35,
+		RequiredFields:             []string{"debtor_party.name", "beneficiary_party.name"},
+		Checks:                     []Check{validateSepaParties},
+	})
+}
+
+// validateSepaParties checks the debtor and the beneficiary accounts are SEPA IBANs
+func validateSepaParties(payment models.Payment) []string {
+	errs := validateSepaParty("debtor_party", payment.Attributes.DebtorParty.DebtorPartySkeleton)
+	return append(errs, validateSepaParty("beneficiary_party", payment.Attributes.BeneficiaryParty.DebtorPartySkeleton)...)
+}
+
+// validateSepaParty checks the party is identified by a SEPA IBAN and, when the bank is given, by a BIC
+func validateSepaParty(field string, party *models.DebtorPartySkeleton) []string {
+	if party == nil || party.SponsorPartySkeleton == nil {
+		return []string{fieldError(field, utils.ERROR_PARTY_REQUIRED)}
+	}
+
+	errs := []string{}
+	if strings.ToUpper(party.AccountNumberCode) != ACCOUNT_NUMBER_CODE_IBAN {
+		errs = append(errs, fieldError(field+".account_number_code", utils.ERROR_SEPA_ACCOUNT_NUMBER_CODE))
+	}
+	if err := ValidateSepaIBAN(NormalizeIBAN(party.AccountNumber)); err != nil {
+		errs = append(errs, fieldError(field+".account_number", err.Error()))
+	}
+
+	if party.BankID != "" || party.BankIDCode != "" {
+		if strings.ToUpper(party.BankIDCode) != BANK_ID_CODE_BIC {
+			errs = append(errs, fieldError(field+".bank_id_code", utils.ERROR_SEPA_BANK_ID_CODE))
+		}
+		if err := ValidateBIC(strings.ToUpper(party.BankID)); err != nil {
+			errs = append(errs, fieldError(field+".bank_id", err.Error()))
+		}
+	}
+	return errs
+}
+
+// ValidateSepaIBAN validates the IBAN and checks its country is part of SEPA
+func ValidateSepaIBAN(iban string) error {
+	if err := ValidateIBAN(iban); err != nil {
+		return err
+	}
+	if country, _ := GetIbanCountry(iban[:2]); !country.SEPA {
+		return errors.New(utils.ERROR_IBAN_COUNTRY_NOT_SEPA)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package schemes
+
+import (
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"payments/app/models"
+	"payments/utils"
+	"strings"
+	"testing"
+)
+
+func sepaParty(iban string, bic string) *models.DebtorPartySkeleton {
+	return &models.DebtorPartySkeleton{
+		SponsorPartySkeleton: &models.SponsorPartySkeleton{AccountNumber: iban, BankID: bic, BankIDCode: BANK_ID_CODE_BIC},
+		AccountNumberCode:    ACCOUNT_NUMBER_CODE_IBAN,
+		Name:                 "Jane Doe",
+	}
+}
+
+func sepaPayment() models.Payment {
+	return models.Payment{
+		ID: uuid.NewV4(),
+		Attributes: models.Attributes{
+			Amount:            "250.00",
+			Currency:          "EUR",
+			PaymentScheme:     "SEPA",
+			Reference:         "Invoice 2017-001",
+			EndToEndReference: "E2E-0001",
+			DebtorParty:       models.DebtorParty{DebtorPartySkeleton: sepaParty("DE89370400440532013000", "COBADEFFXXX")},
+			BeneficiaryParty:  models.BeneficiaryParty{DebtorPartySkeleton: sepaParty("FR14 2004 1010 0505 0001 3M02 606", "BNPAFRPP")},
+		},
+	}
+}
+
+func TestValidateIBAN(t *testing.T) {
+	for _, iban := range []string{"DE89370400440532013000", "FR1420041010050500013M02606", "GB29NWBK60161331926819", "NL91ABNA0417164300", "BE68539007547034"} {
+		assert.NoError(t, ValidateIBAN(iban), iban)
+	}
+
+	tests := map[string]string{
+		"DE":                          utils.ERROR_IBAN_INVALID,
+		"XX89370400440532013000":      utils.ERROR_IBAN_COUNTRY_UNSUPPORTED,
+		"DE8937040044053201300":       utils.ERROR_IBAN_FORMAT,
+		"DEAB370400440532013000":      utils.ERROR_IBAN_FORMAT,
+		"GB29NWBK6016133192681A":      utils.ERROR_IBAN_FORMAT,
+		"DE88370400440532013000":      utils.ERROR_IBAN_CHECKSUM,
+		"FR1420041010050500013M02607": utils.ERROR_IBAN_CHECKSUM,
+	}
+	for iban, expected := range tests {
+		if err := ValidateIBAN(iban); assert.Error(t, err, iban) {
+			assert.EqualValues(t, expected, err.Error(), iban)
+		}
+	}
+
+	if err := ValidateSepaIBAN("BR1800360305000010009795493C1"); assert.Error(t, err) {
+		assert.EqualValues(t, utils.ERROR_IBAN_COUNTRY_NOT_SEPA, err.Error())
+	}
+}
+
+func TestValidateBIC(t *testing.T) {
+	for _, bic := range []string{"COBADEFF", "COBADEFFXXX", "NWBKGB2L", "BNPAFRPP123"} {
+		assert.NoError(t, ValidateBIC(bic), bic)
+	}
+	for _, bic := range []string{"", "COBADEF", "COBADEFFXX", "C0BADEFF", "COBA1EFF", "cobadeff"} {
+		assert.Error(t, ValidateBIC(bic), bic)
+	}
+}
+
+func TestValidateSepaPayment(t *testing.T) {
+	assert.Empty(t, ValidatePayment(sepaPayment()))
+
+	// The bank of the parties is optional
+	payment := sepaPayment()
+	payment.Attributes.BeneficiaryParty.DebtorPartySkeleton.SponsorPartySkeleton = &models.SponsorPartySkeleton{AccountNumber: "FR1420041010050500013M02606"}
+	assert.Empty(t, ValidatePayment(payment))
+
+	payment = sepaPayment()
+	payment.Attributes.Currency = "GBP"
+	payment.Attributes.Amount = "10.001"
+	payment.Attributes.Reference = strings.Repeat("é", 141)
+	payment.Attributes.EndToEndReference = strings.Repeat("x", 36)
+	payment.Attributes.DebtorParty.DebtorPartySkeleton = sepaParty("DE88370400440532013000", "COBADE")
+	payment.Attributes.BeneficiaryParty.DebtorPartySkeleton = nil
+
+	assert.EqualValues(t, []string{
+		"[SEPA] currency: " + utils.ERROR_SCHEME_CURRENCY,
+		"[SEPA] amount: " + utils.ERROR_SCHEME_AMOUNT_INVALID,
+		"[SEPA] reference: " + utils.ERROR_SCHEME_REFERENCE_TOO_LONG,
+		"[SEPA] end_to_end_reference: " + utils.ERROR_SCHEME_REFERENCE_TOO_LONG,
+		"[SEPA] beneficiary_party.name: " + utils.ERROR_SCHEME_FIELD_REQUIRED,
+		"[SEPA] debtor_party.account_number: " + utils.ERROR_IBAN_CHECKSUM,
+		"[SEPA] debtor_party.bank_id: " + utils.ERROR_BIC_INVALID,
+		"[SEPA] beneficiary_party: " + utils.ERROR_PARTY_REQUIRED,
+	}, ValidatePayment(payment))
+
+	// 140 characters are allowed
+	payment = sepaPayment()
+	payment.Attributes.Reference = strings.Repeat("é", 140)
+	payment.Attributes.DebtorParty.AccountNumberCode = "BBAN"
+	payment.Attributes.DebtorParty.BankIDCode = "GBDSC"
+	assert.EqualValues(t, []string{
+		"[SEPA] debtor_party.account_number_code: " + utils.ERROR_SEPA_ACCOUNT_NUMBER_CODE,
+		"[SEPA] debtor_party.bank_id_code: " + utils.ERROR_SEPA_BANK_ID_CODE,
+	}, ValidatePayment(payment))
+}
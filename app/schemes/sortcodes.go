@@ -0,0 +1,39 @@
+package schemes
+
+import (
+	"payments/app/models"
+	"payments/app/modulus"
+	"strings"
+)
+
+// Bank id code of the UK sort codes
+const BANK_ID_CODE_SORT_CODE = "GBDSC"
+
+// validateSortCodes checks the account numbers of the debtor and beneficiary identified by a sort code, when modulus checking is configured
+// IBANs are not checked, their check digits are validated by the schemes that use them
+func validateSortCodes(payment models.Payment) []string {
+	checker := modulus.GetChecker()
+	if checker == nil {
+		return nil
+	}
+
+	parties := []struct {
+		field string
+		party *models.DebtorPartySkeleton
+	}{
+		{"debtor_party", payment.Attributes.DebtorParty.DebtorPartySkeleton},
+		{"beneficiary_party", payment.Attributes.BeneficiaryParty.DebtorPartySkeleton},
+	}
+
+	errs := []string{}
+	for _, p := range parties {
+		party := p.party
+		if party == nil || party.SponsorPartySkeleton == nil || strings.ToUpper(party.BankIDCode) != BANK_ID_CODE_SORT_CODE || strings.ToUpper(party.AccountNumberCode) == ACCOUNT_NUMBER_CODE_IBAN {
+			continue
+		}
+		if err := checker.Check(party.BankID, party.AccountNumber); err != nil {
+			errs = append(errs, fieldError(p.field+".account_number", err.Error()))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,53 @@
+package schemes
+
+import (
+	"github.com/stretchr/testify/assert"
+	"payments/app/models"
+	"payments/app/modulus"
+	"payments/utils"
+	"strings"
+	"testing"
+)
+
+func ukParty(sortCode string, accountNumber string, accountNumberCode string) *models.DebtorPartySkeleton {
+	return &models.DebtorPartySkeleton{
+		SponsorPartySkeleton: &models.SponsorPartySkeleton{AccountNumber: accountNumber, BankID: sortCode, BankIDCode: BANK_ID_CODE_SORT_CODE},
+		AccountNumberCode:    accountNumberCode,
+	}
+}
+
+func TestValidateSortCodes(t *testing.T) {
+	checker, err := modulus.Load(strings.NewReader("000000 000999 MOD11 0 0 0 0 0 0 7 5 8 3 4 6 2 1"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modulus.SetChecker(checker)
+	defer modulus.SetChecker(nil)
+
+	payment := models.Payment{Attributes: models.Attributes{
+		DebtorParty:      models.DebtorParty{DebtorPartySkeleton: ukParty("000100", "58177632", "BBAN")},
+		BeneficiaryParty: models.BeneficiaryParty{DebtorPartySkeleton: ukParty("000100", "58177632", "")},
+	}}
+	assert.Empty(t, ValidatePayment(payment))
+
+	payment.Attributes.DebtorParty.AccountNumber = "58177633"
+	payment.Attributes.BeneficiaryParty.BankID = "0001"
+	assert.EqualValues(t, []string{
+		"debtor_party.account_number: " + utils.ERROR_MODULUS_CHECK_FAILED,
+		"beneficiary_party.account_number: " + utils.ERROR_SORT_CODE_INVALID,
+	}, ValidatePayment(payment))
+
+	// IBANs and parties identified by other bank codes are not checked
+	payment.Attributes.DebtorParty.DebtorPartySkeleton = ukParty("000100", "GB29XABC10161234567801", ACCOUNT_NUMBER_CODE_IBAN)
+	payment.Attributes.BeneficiaryParty.BankIDCode = "SWBIC"
+	assert.Empty(t, ValidatePayment(payment))
+}
+
+func TestValidateSortCodesWithoutChecker(t *testing.T) {
+	modulus.SetChecker(nil)
+
+	payment := models.Payment{Attributes: models.Attributes{
+		DebtorParty: models.DebtorParty{DebtorPartySkeleton: ukParty("000100", "58177633", "BBAN")},
+	}}
+	assert.Empty(t, ValidatePayment(payment))
+}
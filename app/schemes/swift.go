@@ -0,0 +1,18 @@
+package schemes
+
+// Payment scheme of the MT103 customer credit transfers
+const PAYMENT_SCHEME_SWIFT = "SWIFT"
+
+func init() {
+	// Any currency; the reference and the end to end reference (/ROC/) share the 4 lines of 35 characters of the field 70
+	Register(PAYMENT_SCHEME_SWIFT, Rules{
+		MinAmount:                  "0.01",
+		PaymentTypes:               []string{"Credit"},
+		ReferenceMaxLength:         140,
+		EndToEndReferenceMaxLength: 30,
+		RequiredFields: []string{
+			"debtor_party.name",
+			"beneficiary_party.account_number", "beneficiary_party.bank_id", "beneficiary_party.name",
+		},
+	})
+}
@@ -0,0 +1,51 @@
+package schemes
+
+// UK payment schemes
+const PAYMENT_SCHEME_FPS = "FPS"
+const PAYMENT_SCHEME_BACS = "BACS"
+const PAYMENT_SCHEME_CHAPS = "CHAPS"
+
+func init() {
+	// Faster Payments: immediate GBP credits up to the scheme limit, the reference is the 18 characters beneficiary reference
+	Register(PAYMENT_SCHEME_FPS, Rules{
+		Currencies:                 []string{"GBP"},
+		MinAmount:                  "0.01",
+		MaxAmount:                  "1000000",
+		PaymentTypes:               []string{"Credit"},
+		SchemePaymentTypes:         []string{"ImmediatePayment", "ForwardDatedPayment", "StandingOrder"},
+		SchemePaymentSubTypes:      []string{"InternetBanking", "TelephoneBanking", "MobileBanking", "BranchInstruction", "Letter", "Email", "MobileSocialPayment"},
+		ReferenceMaxLength:         18,
+		EndToEndReferenceMaxLength: 35,
+		RequiredFields: []string{
+			"debtor_party.account_number", "debtor_party.account_name",
+			"beneficiary_party.account_number", "beneficiary_party.bank_id", "beneficiary_party.account_name",
+		},
+	})
+
+	// Bacs: Standard 18 credits and debits, submitted from the account of the sponsor
+	Register(PAYMENT_SCHEME_BACS, Rules{
+		Currencies:         []string{"GBP"},
+		MinAmount:          "0.01",
+		MaxAmount:          "20000000",
+		PaymentTypes:       []string{"Credit", "Debit"},
+		SchemePaymentTypes: []string{"DirectCredit", "DirectDebit"},
+		ReferenceMaxLength: 18,
+		RequiredFields: []string{
+			"beneficiary_party.account_number", "beneficiary_party.bank_id", "beneficiary_party.account_name",
+			"sponsor_party.account_number", "sponsor_party.bank_id",
+		},
+	})
+
+	// CHAPS: same day GBP high value payments, without upper limit
+	Register(PAYMENT_SCHEME_CHAPS, Rules{
+		Currencies:                 []string{"GBP"},
+		MinAmount:                  "0.01",
+		PaymentTypes:               []string{"Credit"},
+		ReferenceMaxLength:         140,
+		EndToEndReferenceMaxLength: 35,
+		RequiredFields: []string{
+			"debtor_party.account_number", "debtor_party.name",
+			"beneficiary_party.account_number", "beneficiary_party.bank_id", "beneficiary_party.name",
+		},
+	})
+}
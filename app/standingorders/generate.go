@@ -0,0 +1,67 @@
+package standingorders
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"payments/app/calendar"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+	"time"
+)
+
+// GenerateDue creates the payments of the occurrences of the active standing orders due in the next lead days, and
+// returns the number of orders of the batch
+// The orders are locked with SKIP LOCKED, so each occurrence is generated once by one instance of the api
+// The payments are processed on the business day of the occurrence, or today when the occurrence has passed
+func GenerateDue(now time.Time, leadDays int, batchSize int) (int, error) {
+	horizon := now.UTC().AddDate(0, 0, leadDays).Format(calendar.DATE_FORMAT)
+
+	tx := infrastructure.GetDB().Begin()
+
+	orders := []models.StandingOrder{}
+	err := tx.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+		Where("status = ? AND next_date <> '' AND next_date <= ?", models.STANDING_ORDER_ACTIVE, horizon).
+		Order("next_date").Limit(batchSize).Find(&orders).Error
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.New(utils.ERROR_SERVER)
+	}
+
+	for _, order := range orders {
+		schemeCalendar := calendarOf(order.Payment.PaymentScheme)
+
+		for order.Status == models.STANDING_ORDER_ACTIVE && order.NextDate != "" && order.NextDate <= horizon {
+			date, _ := time.Parse(calendar.DATE_FORMAT, order.NextDate)
+
+			payment := order.NewPayment(schemeCalendar.ProcessingDate(date, now).Format(calendar.DATE_FORMAT))
+			if err := tx.Create(&payment).Error; err != nil {
+				tx.Rollback()
+				return 0, errors.New(utils.ERROR_SERVER)
+			}
+			if err := models.RecordPaymentEvent(tx, models.EVENT_PAYMENT_CREATED, payment); err != nil {
+				tx.Rollback()
+				return 0, err
+			}
+			infrastructure.GetLog().WithFields(logrus.Fields{
+				"standing_order_id": order.ID.String(),
+				"payment_id":        payment.ID.String(),
+				"processing_date":   payment.Attributes.ProcessingDate,
+			}).Info("Standing order payment generated")
+
+			order.Generated++
+			order.LastDate = order.NextDate
+			Advance(&order, date)
+		}
+
+		if err := tx.Save(&order).Error; err != nil {
+			tx.Rollback()
+			return 0, errors.New(utils.ERROR_SERVER)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, errors.New(utils.ERROR_SERVER)
+	}
+	return len(orders), nil
+}
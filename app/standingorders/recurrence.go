@@ -0,0 +1,127 @@
+package standingorders
+
+import (
+	"payments/app/calendar"
+	"payments/app/models"
+	"payments/utils"
+	"strings"
+	"time"
+)
+
+// Maximum number of occurrences searched for the next one, more than 190 years of weekly payments
+const MAX_OCCURRENCES = 10000
+
+// ValidateRecurrence returns the errors of the recurrence, as `recurrence.field: message`
+func ValidateRecurrence(recurrence models.Recurrence) []string {
+	errs := []string{}
+
+	switch recurrence.Frequency {
+	case models.RECURRENCE_WEEKLY, models.RECURRENCE_MONTHLY, models.RECURRENCE_LAST_BUSINESS_DAY:
+	default:
+		errs = append(errs, "recurrence.frequency: "+utils.ERROR_RECURRENCE_FREQUENCY)
+	}
+	if recurrence.Interval < 0 {
+		errs = append(errs, "recurrence.interval: "+utils.ERROR_RECURRENCE_INTERVAL)
+	}
+	if recurrence.DayOfMonth < 0 || recurrence.DayOfMonth > 31 {
+		errs = append(errs, "recurrence.day_of_month: "+utils.ERROR_RECURRENCE_DAY_OF_MONTH)
+	}
+
+	start, err := time.Parse(calendar.DATE_FORMAT, recurrence.StartDate)
+	if err != nil {
+		errs = append(errs, "recurrence.start_date: "+utils.ERROR_DATE_INVALID)
+	}
+	if recurrence.EndDate != "" {
+		if end, endErr := time.Parse(calendar.DATE_FORMAT, recurrence.EndDate); endErr != nil {
+			errs = append(errs, "recurrence.end_date: "+utils.ERROR_DATE_INVALID)
+		} else if err == nil && end.Before(start) {
+			errs = append(errs, "recurrence.end_date: "+utils.ERROR_RECURRENCE_END_DATE)
+		}
+	}
+
+	return errs
+}
+
+// Occurrence returns the date of the occurrence n, from 0, of a valid recurrence
+// The last business days are the ones of the calendar of the scheme
+func Occurrence(recurrence models.Recurrence, n int, schemeCalendar *calendar.Calendar) time.Time {
+	start, _ := time.Parse(calendar.DATE_FORMAT, recurrence.StartDate)
+	interval := recurrence.Interval
+	if interval == 0 {
+		interval = 1
+	}
+
+	if recurrence.Frequency == models.RECURRENCE_WEEKLY {
+		return start.AddDate(0, 0, 7*interval*n)
+	}
+
+	// The months are counted from the start date, so a day missing from a month does not move the next ones
+	month := time.Date(start.Year(), start.Month()+time.Month(interval*n), 1, 0, 0, 0, 0, time.UTC)
+	last := month.AddDate(0, 1, -1)
+
+	if recurrence.Frequency == models.RECURRENCE_LAST_BUSINESS_DAY {
+		for i := 0; i < 31 && !schemeCalendar.IsBusinessDay(last); i++ {
+			last = last.AddDate(0, 0, -1)
+		}
+		return last
+	}
+
+	day := recurrence.DayOfMonth
+	if day == 0 {
+		day = start.Day()
+	}
+	if day > last.Day() {
+		day = last.Day()
+	}
+	return month.AddDate(0, 0, day-1)
+}
+
+// Advance sets the next occurrence of the order to the first one after the date, on or after the start date
+// The order is completed when the recurrence has ended
+func Advance(order *models.StandingOrder, after time.Time) {
+	recurrence := order.Recurrence
+	if recurrence.Count > 0 && order.Generated >= recurrence.Count {
+		complete(order)
+		return
+	}
+
+	schemeCalendar := calendarOf(order.Payment.PaymentScheme)
+	start, _ := time.Parse(calendar.DATE_FORMAT, recurrence.StartDate)
+	end, err := time.Parse(calendar.DATE_FORMAT, recurrence.EndDate)
+	for n := 0; n < MAX_OCCURRENCES; n++ {
+		date := Occurrence(recurrence, n, schemeCalendar)
+		if err == nil && date.After(end) {
+			break
+		}
+		// The first month can end before the start date
+		if date.After(after) && !date.Before(start) {
+			order.NextOccurrence, order.NextDate = n, date.Format(calendar.DATE_FORMAT)
+			return
+		}
+	}
+	complete(order)
+}
+
+// Restart sets the next occurrence of an active order after the last occurrence generated, from today
+func Restart(order *models.StandingOrder, now time.Time) {
+	after := calendarOf(order.Payment.PaymentScheme).Today(now).AddDate(0, 0, -1)
+	if last, err := time.Parse(calendar.DATE_FORMAT, order.LastDate); err == nil && last.After(after) {
+		after = last
+	}
+	Advance(order, after)
+}
+
+func complete(order *models.StandingOrder) {
+	order.NextDate = ""
+	if order.Status == models.STANDING_ORDER_ACTIVE || order.Status == models.STANDING_ORDER_PAUSED {
+		order.Status = models.STANDING_ORDER_COMPLETED
+	}
+}
+
+// calendarOf returns the calendar of the scheme, or a calendar closed on weekends for the schemes without calendar
+func calendarOf(scheme string) *calendar.Calendar {
+	if schemeCalendar, ok := calendar.GetCalendars().Get(scheme); ok {
+		return schemeCalendar
+	}
+	return &calendar.Calendar{Scheme: strings.ToUpper(scheme), Location: time.UTC, Holidays: map[string]string{}}
+}
@@ -0,0 +1,122 @@
+package standingorders
+
+import (
+	"github.com/stretchr/testify/assert"
+	"payments/app/calendar"
+	"payments/app/models"
+	"payments/utils"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(value string) time.Time {
+	d, err := time.Parse(calendar.DATE_FORMAT, value)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func occurrences(recurrence models.Recurrence, schemeCalendar *calendar.Calendar, count int) []string {
+	dates := []string{}
+	for n := 0; n < count; n++ {
+		dates = append(dates, Occurrence(recurrence, n, schemeCalendar).Format(calendar.DATE_FORMAT))
+	}
+	return dates
+}
+
+func TestValidateRecurrence(t *testing.T) {
+	assert.Empty(t, ValidateRecurrence(models.Recurrence{Frequency: models.RECURRENCE_MONTHLY, DayOfMonth: 31, StartDate: "2026-01-31", EndDate: "2026-12-31"}))
+
+	assert.EqualValues(t, []string{
+		"recurrence.frequency: " + utils.ERROR_RECURRENCE_FREQUENCY,
+		"recurrence.interval: " + utils.ERROR_RECURRENCE_INTERVAL,
+		"recurrence.day_of_month: " + utils.ERROR_RECURRENCE_DAY_OF_MONTH,
+		"recurrence.end_date: " + utils.ERROR_RECURRENCE_END_DATE,
+	}, ValidateRecurrence(models.Recurrence{Frequency: "daily", Interval: -1, DayOfMonth: 32, StartDate: "2026-01-31", EndDate: "2026-01-30"}))
+
+	assert.EqualValues(t, []string{
+		"recurrence.start_date: " + utils.ERROR_DATE_INVALID,
+		"recurrence.end_date: " + utils.ERROR_DATE_INVALID,
+	}, ValidateRecurrence(models.Recurrence{Frequency: models.RECURRENCE_WEEKLY, EndDate: "31/12/2026"}))
+}
+
+func TestOccurrence(t *testing.T) {
+	bacs, _ := calendar.NewCalendars().Get("BACS")
+	assert.Nil(t, bacs.LoadHolidays(strings.NewReader("2026-08-31 Summer bank holiday")))
+
+	assert.EqualValues(t, []string{"2026-01-05", "2026-01-19", "2026-02-02"},
+		occurrences(models.Recurrence{Frequency: models.RECURRENCE_WEEKLY, Interval: 2, StartDate: "2026-01-05"}, bacs, 3))
+
+	// The last day of the shorter months, without moving the next ones
+	assert.EqualValues(t, []string{"2026-01-31", "2026-02-28", "2026-03-31", "2026-04-30"},
+		occurrences(models.Recurrence{Frequency: models.RECURRENCE_MONTHLY, StartDate: "2026-01-31"}, bacs, 4))
+	assert.EqualValues(t, []string{"2026-11-15", "2027-01-15"},
+		occurrences(models.Recurrence{Frequency: models.RECURRENCE_MONTHLY, Interval: 2, DayOfMonth: 15, StartDate: "2026-11-01"}, bacs, 2))
+
+	// The weekends and the holidays of the scheme are skipped
+	assert.EqualValues(t, []string{"2026-07-31", "2026-08-28", "2026-09-30", "2026-10-30"},
+		occurrences(models.Recurrence{Frequency: models.RECURRENCE_LAST_BUSINESS_DAY, StartDate: "2026-07-01"}, bacs, 4))
+}
+
+func TestAdvance(t *testing.T) {
+	order := models.StandingOrder{
+		Status:     models.STANDING_ORDER_ACTIVE,
+		Payment:    models.Attributes{PaymentScheme: "FPS"},
+		Recurrence: models.Recurrence{Frequency: models.RECURRENCE_MONTHLY, DayOfMonth: 10, StartDate: "2026-01-20", EndDate: "2026-04-10"},
+	}
+
+	// The first month ends before the start date
+	Advance(&order, date("2026-01-01"))
+	assert.EqualValues(t, "2026-02-10", order.NextDate)
+	assert.EqualValues(t, 1, order.NextOccurrence)
+
+	Advance(&order, date("2026-03-10"))
+	assert.EqualValues(t, "2026-04-10", order.NextDate)
+
+	// After the end date
+	Advance(&order, date("2026-04-10"))
+	assert.EqualValues(t, "", order.NextDate)
+	assert.EqualValues(t, models.STANDING_ORDER_COMPLETED, order.Status)
+
+	// After the count
+	order = models.StandingOrder{
+		Status:     models.STANDING_ORDER_PAUSED,
+		Generated:  2,
+		Recurrence: models.Recurrence{Frequency: models.RECURRENCE_WEEKLY, StartDate: "2026-01-05", Count: 2},
+	}
+	Advance(&order, date("2026-01-12"))
+	assert.EqualValues(t, "", order.NextDate)
+	assert.EqualValues(t, models.STANDING_ORDER_COMPLETED, order.Status)
+}
+
+func TestRestart(t *testing.T) {
+	order := models.StandingOrder{
+		Status:     models.STANDING_ORDER_ACTIVE,
+		Payment:    models.Attributes{PaymentScheme: "FPS"},
+		Recurrence: models.Recurrence{Frequency: models.RECURRENCE_WEEKLY, StartDate: "2026-01-05"},
+	}
+
+	// From today
+	Restart(&order, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+	assert.EqualValues(t, "2026-03-02", order.NextDate)
+
+	// After the last occurrence generated
+	order.LastDate = "2026-03-09"
+	Restart(&order, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+	assert.EqualValues(t, "2026-03-16", order.NextDate)
+}
+
+func TestNewPayment(t *testing.T) {
+	order := models.StandingOrder{Payment: models.Attributes{Amount: "10.00", DebtorParty: models.DebtorParty{DebtorPartySkeleton: &models.DebtorPartySkeleton{Name: "Jane Doe"}}}}
+
+	payment := order.NewPayment("2026-03-02")
+	assert.EqualValues(t, "2026-03-02", payment.Attributes.ProcessingDate)
+	assert.EqualValues(t, models.PAYMENT_STATUS_PENDING, payment.Status)
+	assert.EqualValues(t, order.ID, *payment.StandingOrderID)
+
+	// The payments do not share the parties of the template
+	payment.Attributes.DebtorParty.Name = "John Doe"
+	assert.EqualValues(t, "Jane Doe", order.Payment.DebtorParty.Name)
+}
@@ -0,0 +1,373 @@
+package swift
+
+import (
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"payments/app/models"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Payment scheme of the payments created from MT103 messages
+const PAYMENT_SCHEME_SWIFT = "SWIFT"
+
+// MT103 is a single customer credit transfer between the sender and receiver banks
+type MT103 struct {
+	Sender   string
+	Receiver string
+	Payment  models.Payment
+}
+
+var bicPattern = regexp.MustCompile(`^[A-Z]{6}[A-Z2-9][A-NP-Z0-9]([A-Z0-9]{3})?$`)
+var ibanPattern = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]{1,30}$`)
+var tagPattern = regexp.MustCompile(`^:([0-9]{2}[A-Z]?):`)
+
+// SWIFT x character set, the other characters are replaced by spaces
+var invalidCharacters = regexp.MustCompile(`[^a-zA-Z0-9/\-?:().,'+ ]`)
+
+// Codes of field 71A for the bearer codes of the payments
+var chargeCodes = map[string]string{"DEBT": "OUR", "CRED": "BEN", "SHAR": "SHA", "SLEV": "SHA"}
+var bearerCodes = map[string]string{"OUR": "DEBT", "BEN": "CRED", "SHA": "SHAR"}
+
+// Party identifiers (//XX) of the national clearing codes, for banks without BIC
+var clearingCodes = map[string]string{"GBDSC": "SC", "DEBLZ": "BL", "USABA": "FW", "ATBLZ": "AT", "AUBSB": "AU", "CACPA": "CC"}
+
+// FormatMT103 renders the payment as an MT103 message from the sender to the receiver bank (BICs)
+// The payment id travels as the UETR in the user header, so the parsed message keeps the id
+func FormatMT103(payment models.Payment, sender string, receiver string) (string, error) {
+	if !bicPattern.MatchString(sender) || !bicPattern.MatchString(receiver) {
+		return "", errors.New("sender and receiver must be valid BICs")
+	}
+
+	attributes := payment.Attributes
+	processingDate, err := time.Parse("2006-01-02", attributes.ProcessingDate)
+	if err != nil {
+		return "", errors.New("processing date must be a YYYY-MM-DD date")
+	}
+	if attributes.DebtorParty.DebtorPartySkeleton == nil || attributes.BeneficiaryParty.DebtorPartySkeleton == nil {
+		return "", errors.New("debtor and beneficiary parties are required")
+	}
+
+	fields := [][2]string{}
+	add := func(tag string, value string) {
+		fields = append(fields, [2]string{tag, value})
+	}
+
+	reference := attributes.PaymentID
+	if reference == "" || len(reference) > 16 || strings.HasPrefix(reference, "/") || strings.HasSuffix(reference, "/") || strings.Contains(reference, "//") {
+		reference = strings.Replace(payment.ID.String(), "-", "", -1)[:16]
+	}
+	add("20", reference)
+	add("23B", "CRED")
+	add("32A", processingDate.Format("060102")+attributes.Currency+formatAmount(attributes.Amount))
+	if fx := attributes.FX; fx.OriginalAmount != "" && fx.OriginalCurrency != "" {
+		add("33B", fx.OriginalCurrency+formatAmount(fx.OriginalAmount))
+	}
+	if attributes.FX.ExchangeRate != "" {
+		add("36", formatAmount(attributes.FX.ExchangeRate))
+	}
+	add("50K", formatParty(attributes.DebtorParty.DebtorPartySkeleton))
+	if tag, value := formatBank("52", attributes.DebtorParty.SponsorPartySkeleton); tag != "" {
+		add(tag, value)
+	}
+	if tag, value := formatBank("57", attributes.BeneficiaryParty.SponsorPartySkeleton); tag != "" {
+		add(tag, value)
+	}
+	add("59", formatParty(attributes.BeneficiaryParty.DebtorPartySkeleton))
+
+	// The end to end reference is the ordering customer reference (ROC) of the remittance information
+	remittance := strings.TrimSpace(attributes.Reference)
+	if attributes.EndToEndReference != "" {
+		remittance = strings.TrimSpace("/ROC/" + attributes.EndToEndReference + "\n" + remittance)
+	}
+	if remittance != "" {
+		add("70", strings.Join(wrapLines(remittance, 4), "\n"))
+	}
+
+	charges := attributes.ChargesInformation
+	chargeCode, ok := chargeCodes[charges.BearerCode]
+	if !ok {
+		chargeCode = "SHA"
+	}
+	add("71A", chargeCode)
+	for _, charge := range charges.SenderCharges {
+		add("71F", charge.Currency+formatAmount(charge.Amount))
+	}
+	if charges.ReceiverChargesAmount != "" {
+		add("71G", charges.ReceiverChargesCurrency+formatAmount(charges.ReceiverChargesAmount))
+	}
+
+	message := fmt.Sprintf("{1:F01%s0000000000}{2:I103%sN}{3:{121:%s}}{4:\r\n", logicalTerminal(sender), logicalTerminal(receiver), payment.ID)
+	for _, field := range fields {
+		message += ":" + field[0] + ":" + strings.Replace(field[1], "\n", "\r\n", -1) + "\r\n"
+	}
+	return message + "-}", nil
+}
+
+// ParseMT103 reads an MT103 message into a payment
+// The payment id is the UETR of the user header or, without UETR, a new id
+func ParseMT103(text string) (MT103, error) {
+	message := MT103{}
+
+	basicHeader := block(text, "1")
+	applicationHeader := block(text, "2")
+	if len(basicHeader) < 15 || len(applicationHeader) < 16 || !strings.HasPrefix(applicationHeader, "I103") && !strings.HasPrefix(applicationHeader, "O103") {
+		return message, errors.New("not an MT103 message")
+	}
+	message.Sender = basicHeader[3:15]
+	if strings.HasPrefix(applicationHeader, "I103") {
+		message.Receiver = applicationHeader[4:16]
+	} else if len(applicationHeader) >= 30 {
+		// Output messages carry the input time and the message input reference before the sender
+		message.Receiver, message.Sender = message.Sender, applicationHeader[14:26]
+	}
+	message.Sender, message.Receiver = bic(message.Sender), bic(message.Receiver)
+
+	fields, err := parseFields(block(text, "4"))
+	if err != nil {
+		return message, err
+	}
+	missing := []string{}
+	for _, tag := range []string{"20", "23B", "32A", "50K", "59", "71A"} {
+		if len(fields[tag]) == 0 {
+			missing = append(missing, ":"+tag+":")
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return message, fmt.Errorf("missing fields %s", strings.Join(missing, ", "))
+	}
+
+	payment := models.Payment{Type: "Payment", ID: uuid.NewV4()}
+	if id, err := uuid.FromString(block(block(text, "3"), "121")); err == nil {
+		payment.ID = id
+	}
+
+	attributes := &payment.Attributes
+	attributes.PaymentID = fields["20"][0]
+	attributes.PaymentScheme = PAYMENT_SCHEME_SWIFT
+	attributes.PaymentType = "Credit"
+
+	valueDate := fields["32A"][0]
+	if len(valueDate) < 10 {
+		return message, errors.New("invalid field :32A:")
+	}
+	date, err := time.Parse("060102", valueDate[:6])
+	if err != nil {
+		return message, errors.New("invalid field :32A:")
+	}
+	attributes.ProcessingDate = date.Format("2006-01-02")
+	attributes.Currency = valueDate[6:9]
+	attributes.Amount = parseAmount(valueDate[9:])
+
+	if values := fields["33B"]; len(values) > 0 && len(values[0]) > 3 {
+		attributes.FX.OriginalCurrency, attributes.FX.OriginalAmount = values[0][:3], parseAmount(values[0][3:])
+	}
+	if values := fields["36"]; len(values) > 0 {
+		attributes.FX.ExchangeRate = parseAmount(values[0])
+	}
+
+	attributes.DebtorParty = models.DebtorParty{DebtorPartySkeleton: parseParty(fields["50K"][0])}
+	attributes.BeneficiaryParty = models.BeneficiaryParty{DebtorPartySkeleton: parseParty(fields["59"][0])}
+	attributes.SponsorParty = models.SponsorParty{SponsorPartySkeleton: &models.SponsorPartySkeleton{}}
+	parseBank(fields, "52", attributes.DebtorParty.SponsorPartySkeleton)
+	parseBank(fields, "57", attributes.BeneficiaryParty.SponsorPartySkeleton)
+
+	if values := fields["70"]; len(values) > 0 {
+		lines := strings.Split(values[0], "\n")
+		if strings.HasPrefix(lines[0], "/ROC/") {
+			attributes.EndToEndReference, lines = strings.TrimPrefix(lines[0], "/ROC/"), lines[1:]
+		}
+		attributes.Reference = strings.Join(lines, " ")
+	}
+
+	attributes.ChargesInformation.BearerCode = bearerCodes[fields["71A"][0]]
+	for _, value := range fields["71F"] {
+		if len(value) > 3 {
+			attributes.ChargesInformation.SenderCharges = append(attributes.ChargesInformation.SenderCharges, models.Charge{Currency: value[:3], Amount: parseAmount(value[3:])})
+		}
+	}
+	if values := fields["71G"]; len(values) > 0 && len(values[0]) > 3 {
+		attributes.ChargesInformation.ReceiverChargesCurrency = values[0][:3]
+		attributes.ChargesInformation.ReceiverChargesAmount = parseAmount(values[0][3:])
+	}
+
+	message.Payment = payment
+	return message, nil
+}
+
+// formatAmount writes the amount with a decimal comma, e.g. 100,21 or 100,
+func formatAmount(amount string) string {
+	amount = strings.TrimSpace(amount)
+	if !strings.Contains(amount, ".") {
+		return amount + ","
+	}
+	return strings.Replace(amount, ".", ",", 1)
+}
+
+func parseAmount(amount string) string {
+	return strings.TrimSuffix(strings.Replace(strings.TrimSpace(amount), ",", ".", 1), ".")
+}
+
+// formatParty writes the account, the name and the address in lines of 35 characters
+func formatParty(party *models.DebtorPartySkeleton) string {
+	lines := []string{}
+	if party.SponsorPartySkeleton != nil && party.AccountNumber != "" {
+		lines = append(lines, "/"+party.AccountNumber)
+	}
+	lines = append(lines, wrapLines(party.Name, 1)...)
+	lines = append(lines, wrapLines(party.Address, 3)...)
+	return strings.Join(lines, "\n")
+}
+
+func parseParty(value string) *models.DebtorPartySkeleton {
+	party := &models.DebtorPartySkeleton{SponsorPartySkeleton: &models.SponsorPartySkeleton{}}
+	lines := strings.Split(value, "\n")
+	if strings.HasPrefix(lines[0], "/") {
+		party.AccountNumber, lines = strings.TrimPrefix(lines[0], "/"), lines[1:]
+		party.AccountNumberCode = "BBAN"
+		if ibanPattern.MatchString(party.AccountNumber) {
+			party.AccountNumberCode = "IBAN"
+		}
+	}
+	if len(lines) > 0 {
+		party.Name, party.AccountName = lines[0], lines[0]
+		party.Address = strings.Join(lines[1:], " ")
+	}
+	return party
+}
+
+// formatBank identifies the bank by BIC (option A) or by national clearing code (option C)
+func formatBank(tag string, bank *models.SponsorPartySkeleton) (string, string) {
+	if bank == nil || bank.BankID == "" {
+		return "", ""
+	}
+	if bank.BankIDCode == "SWBIC" && bicPattern.MatchString(bank.BankID) {
+		return tag + "A", bank.BankID
+	}
+	// Field 52 has no option C, so only the beneficiary bank is identified by clearing code
+	if code, ok := clearingCodes[bank.BankIDCode]; ok && tag == "57" {
+		return tag + "C", "//" + code + bank.BankID
+	}
+	return "", ""
+}
+
+func parseBank(fields map[string][]string, tag string, bank *models.SponsorPartySkeleton) {
+	if values := fields[tag+"A"]; len(values) > 0 {
+		lines := strings.Split(values[0], "\n")
+		bank.BankID, bank.BankIDCode = lines[len(lines)-1], "SWBIC"
+		return
+	}
+	if values := fields[tag+"C"]; len(values) > 0 && strings.HasPrefix(values[0], "//") && len(values[0]) > 4 {
+		for bankIDCode, code := range clearingCodes {
+			if values[0][2:4] == code {
+				bank.BankID, bank.BankIDCode = values[0][4:], bankIDCode
+			}
+		}
+	}
+}
+
+// wrapLines splits the text, without the characters outside of the SWIFT character set, in up to maxLines lines of 35 characters
+// The lines break between words, so joining the lines with spaces gives the text back
+func wrapLines(text string, maxLines int) []string {
+	lines := []string{}
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(invalidCharacters.ReplaceAllString(paragraph, " ")) {
+			for len(word) > 35 {
+				if line != "" {
+					lines, line = append(lines, line), ""
+				}
+				lines, word = append(lines, word[:35]), word[35:]
+			}
+			if line == "" {
+				line = word
+			} else if len(line)+1+len(word) <= 35 {
+				line += " " + word
+			} else {
+				lines, line = append(lines, line), word
+			}
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+	}
+	return lines
+}
+
+// parseFields reads the fields of the text block, the values of the repeated fields in order
+func parseFields(text string) (map[string][]string, error) {
+	fields := map[string][]string{}
+	tag := ""
+	for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		if line == "" || line == "-" {
+			continue
+		}
+		if match := tagPattern.FindStringSubmatch(line); match != nil {
+			tag = match[1]
+			fields[tag] = append(fields[tag], line[len(match[0]):])
+			continue
+		}
+		if tag == "" {
+			return nil, errors.New("invalid text block")
+		}
+		values := fields[tag]
+		values[len(values)-1] += "\n" + line
+	}
+	return fields, nil
+}
+
+// block returns the content of the block, e.g. `F01...` of `{1:F01...}`
+func block(text string, id string) string {
+	start := strings.Index(text, "{"+id+":")
+	if start < 0 {
+		return ""
+	}
+	content := text[start+len(id)+2:]
+
+	// The text block ends with -}, the user header has nested blocks
+	if id == "4" {
+		if end := strings.Index(content, "-}"); end >= 0 {
+			return content[:end]
+		}
+		return content
+	}
+	depth := 0
+	for i, c := range content {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return content[:i]
+			}
+			depth--
+		}
+	}
+	return content
+}
+
+// logicalTerminal returns the 12 characters address of the bank: the BIC with the terminal code and the branch
+func logicalTerminal(bic string) string {
+	if len(bic) == 8 {
+		return bic + "XXXX"
+	}
+	return bic[:8] + "X" + bic[8:]
+}
+
+// bic returns the BIC of the logical terminal
+func bic(terminal string) string {
+	if len(terminal) != 12 {
+		return terminal
+	}
+	if branch := terminal[9:]; branch != "XXX" {
+		return terminal[:8] + branch
+	}
+	return terminal[:8]
+}
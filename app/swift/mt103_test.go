@@ -0,0 +1,157 @@
+package swift
+
+import (
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"payments/app/models"
+	"strings"
+	"testing"
+)
+
+func examplePayment() models.Payment {
+	return models.Payment{
+		Type: "Payment",
+		ID:   uuid.FromStringOrNil("4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43"),
+		Attributes: models.Attributes{
+			Amount:   "100.21",
+			Currency: "GBP",
+			BeneficiaryParty: models.BeneficiaryParty{DebtorPartySkeleton: &models.DebtorPartySkeleton{
+				SponsorPartySkeleton: &models.SponsorPartySkeleton{AccountNumber: "31926819", BankID: "403000", BankIDCode: "GBDSC"},
+				AccountName:          "Wilfred Jeremiah Owens",
+				AccountNumberCode:    "BBAN",
+				Address:              "1 The Beneficiary Localtown SE2",
+				Name:                 "Wilfred Jeremiah Owens",
+			}},
+			ChargesInformation: models.ChargesInformation{
+				BearerCode:              "SHAR",
+				SenderCharges:           []models.Charge{{Amount: "5.00", Currency: "GBP"}, {Amount: "10.00", Currency: "USD"}},
+				ReceiverChargesAmount:   "1.00",
+				ReceiverChargesCurrency: "USD",
+			},
+			DebtorParty: models.DebtorParty{DebtorPartySkeleton: &models.DebtorPartySkeleton{
+				SponsorPartySkeleton: &models.SponsorPartySkeleton{AccountNumber: "GB29XABC10161234567801", BankID: "XABCGB2L", BankIDCode: "SWBIC"},
+				AccountName:          "Emelia Jane Brown",
+				AccountNumberCode:    "IBAN",
+				Address:              "10 Debtor Crescent Sourcetown NE1",
+				Name:                 "Emelia Jane Brown",
+			}},
+			EndToEndReference: "Wil piano Jan",
+			FX:                models.FX{ExchangeRate: "2.00000", OriginalAmount: "200.42", OriginalCurrency: "USD"},
+			PaymentID:         "123456789012",
+			PaymentScheme:     PAYMENT_SCHEME_SWIFT,
+			PaymentType:       "Credit",
+			ProcessingDate:    "2017-01-18",
+			Reference:         "Payment for Em's piano lessons",
+			SponsorParty:      models.SponsorParty{SponsorPartySkeleton: &models.SponsorPartySkeleton{}},
+		},
+	}
+}
+
+func TestFormatMT103(t *testing.T) {
+	message, err := FormatMT103(examplePayment(), "XABCGB2L", "NWBKGB2LXXX")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.EqualValues(t, "{1:F01XABCGB2LXXXX0000000000}{2:I103NWBKGB2LXXXXN}{3:{121:4ee3a8d8-ca7b-4290-a52c-dd5b6165ec43}}{4:\r\n"+
+		":20:123456789012\r\n"+
+		":23B:CRED\r\n"+
+		":32A:170118GBP100,21\r\n"+
+		":33B:USD200,42\r\n"+
+		":36:2,00000\r\n"+
+		":50K:/GB29XABC10161234567801\r\n"+
+		"Emelia Jane Brown\r\n"+
+		"10 Debtor Crescent Sourcetown NE1\r\n"+
+		":52A:XABCGB2L\r\n"+
+		":57C://SC403000\r\n"+
+		":59:/31926819\r\n"+
+		"Wilfred Jeremiah Owens\r\n"+
+		"1 The Beneficiary Localtown SE2\r\n"+
+		":70:/ROC/Wil piano Jan\r\n"+
+		"Payment for Em's piano lessons\r\n"+
+		":71A:SHA\r\n"+
+		":71F:GBP5,00\r\n"+
+		":71F:USD10,00\r\n"+
+		":71G:USD1,00\r\n"+
+		"-}", message)
+}
+
+func TestMT103RoundTrip(t *testing.T) {
+	payment := examplePayment()
+
+	text, err := FormatMT103(payment, "XABCGB2L", "NWBKGB2L")
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := ParseMT103(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.EqualValues(t, "XABCGB2L", message.Sender)
+	assert.EqualValues(t, "NWBKGB2L", message.Receiver)
+	assert.EqualValues(t, payment, message.Payment)
+}
+
+func TestMT103RoundTripWrapsLongText(t *testing.T) {
+	payment := examplePayment()
+	payment.Attributes.Reference = "Invoices 2017-001, 2017-002 and 2017-003 for the piano lessons of January"
+	payment.Attributes.DebtorParty.Address = "Flat 3 Building 10 Debtor Crescent Sourcetown NE1"
+
+	text, err := FormatMT103(payment, "XABCGB2L", "NWBKGB2L")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(text, "\r\n")[1:] {
+		assert.True(t, len(line) <= 35+len(":50K:"), "Line too long: %s", line)
+	}
+
+	message, err := ParseMT103(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.EqualValues(t, payment.Attributes.Reference, message.Payment.Attributes.Reference)
+	assert.EqualValues(t, payment.Attributes.DebtorParty.Address, message.Payment.Attributes.DebtorParty.Address)
+}
+
+func TestParseIncomingMT103(t *testing.T) {
+	text := "{1:F01NWBKGB2LAXXX0000000000}{2:O1031200170118COBADEFFAXXX00000000001701181200N}{4:\n" +
+		":20:REF-42\n" +
+		":23B:CRED\n" +
+		":32A:170118EUR1234,\n" +
+		":50K:/DE89370400440532013000\n" +
+		"MUSTER GMBH\n" +
+		"HAUPTSTRASSE 1\n" +
+		"10115 BERLIN\n" +
+		":59:/GB82WEST12345698765432\n" +
+		"LANDLORD LTD\n" +
+		":71A:OUR\n" +
+		"-}"
+
+	message, err := ParseMT103(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attributes := message.Payment.Attributes
+	assert.EqualValues(t, "COBADEFF", message.Sender)
+	assert.EqualValues(t, "NWBKGB2L", message.Receiver)
+	assert.NotEqual(t, uuid.Nil, message.Payment.ID)
+	assert.EqualValues(t, "REF-42", attributes.PaymentID)
+	assert.EqualValues(t, "1234", attributes.Amount)
+	assert.EqualValues(t, "EUR", attributes.Currency)
+	assert.EqualValues(t, "2017-01-18", attributes.ProcessingDate)
+	assert.EqualValues(t, "IBAN", attributes.DebtorParty.AccountNumberCode)
+	assert.EqualValues(t, "MUSTER GMBH", attributes.DebtorParty.Name)
+	assert.EqualValues(t, "HAUPTSTRASSE 1 10115 BERLIN", attributes.DebtorParty.Address)
+	assert.EqualValues(t, "GB82WEST12345698765432", attributes.BeneficiaryParty.AccountNumber)
+	assert.EqualValues(t, "DEBT", attributes.ChargesInformation.BearerCode)
+}
+
+func TestParseMT103WithMissingFields(t *testing.T) {
+	_, err := ParseMT103("{1:F01NWBKGB2LAXXX0000000000}{2:I103COBADEFFXXXXN}{4:\r\n:20:REF-42\r\n:23B:CRED\r\n-}")
+	assert.EqualError(t, err, "missing fields :32A:, :50K:, :59:, :71A:")
+
+	_, err = ParseMT103("{1:F01NWBKGB2LAXXX0000000000}{2:I202COBADEFFXXXXN}{4:\r\n-}")
+	assert.EqualError(t, err, "not an MT103 message")
+}
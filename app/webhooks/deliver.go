@@ -0,0 +1,304 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"os"
+	"payments/app/models"
+	"payments/infrastructure"
+	"payments/utils"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Headers of the deliveries
+const HEADER_SIGNATURE = "Webhook-Signature"
+const HEADER_EVENT_ID = "Webhook-Id"
+const HEADER_EVENT_TYPE = "Webhook-Event"
+const HEADER_DELIVERY_ID = "Webhook-Delivery"
+
+// Deliverer posts the pending deliveries to the url of their subscription
+// The due deliveries are claimed with SKIP LOCKED, so each delivery is sent by a single instance of the api
+type Deliverer struct {
+	Client *http.Client
+	// Maximum number of deliveries sent by a batch, claimed one at a time
+	BatchSize int
+	// Attempts of a delivery before it is dead
+	MaxAttempts uint
+	// Wait before the first retry, doubled on every retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Time a delivery stays claimed by its attempt, longer than an attempt; it is claimed again after it
+	ClaimTimeout time.Duration
+}
+
+var deliverer *Deliverer
+var delivererOnce sync.Once
+
+// GetDeliverer returns the deliverer configured by the environment
+// WEBHOOK_MAX_ATTEMPTS: attempts of a delivery before it is dead (default 10)
+// WEBHOOK_BACKOFF, WEBHOOK_MAX_BACKOFF: wait before the first retry, doubled on every retry up to the maximum (default 30s and 6h)
+// WEBHOOK_TIMEOUT: time the receivers have to answer a delivery (default 10s)
+// WEBHOOK_CLAIM_TIMEOUT: time a delivery stays claimed by its attempt before it is claimed again (default 5m)
+// WEBHOOK_ALLOW_PRIVATE_URLS: `true` allows the loopback and private addresses, for local development
+func GetDeliverer() *Deliverer {
+	delivererOnce.Do(func() {
+		deliverer = NewDeliverer()
+
+		if maxAttempts, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && maxAttempts > 0 {
+			deliverer.MaxAttempts = uint(maxAttempts)
+		}
+		if backoff, err := time.ParseDuration(os.Getenv("WEBHOOK_BACKOFF")); err == nil && backoff > 0 {
+			deliverer.Backoff = backoff
+		}
+		if maxBackoff, err := time.ParseDuration(os.Getenv("WEBHOOK_MAX_BACKOFF")); err == nil && maxBackoff > 0 {
+			deliverer.MaxBackoff = maxBackoff
+		}
+		if timeout, err := time.ParseDuration(os.Getenv("WEBHOOK_TIMEOUT")); err == nil && timeout > 0 {
+			deliverer.Client.Timeout = timeout
+		}
+		if claimTimeout, err := time.ParseDuration(os.Getenv("WEBHOOK_CLAIM_TIMEOUT")); err == nil && claimTimeout > 0 {
+			deliverer.ClaimTimeout = claimTimeout
+		}
+	})
+	return deliverer
+}
+
+// NewDeliverer creates a deliverer with the default configuration
+func NewDeliverer() *Deliverer {
+	return &Deliverer{
+		Client:       newClient(),
+		BatchSize:    100,
+		MaxAttempts:  10,
+		Backoff:      30 * time.Second,
+		MaxBackoff:   6 * time.Hour,
+		ClaimTimeout: 5 * time.Minute,
+	}
+}
+
+// newClient creates the client of the deliveries, which only connects to public addresses
+// The address is checked when the connection is dialed, after the resolution of the host, so the host of a subscription
+// cannot resolve, or redirect, to a private address later. The proxies of the environment are not used
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || (privateIP(ip) && !allowPrivateURLs()) {
+				return errors.New(utils.ERROR_WEBHOOK_ADDRESS_FORBIDDEN + " (" + host + ")")
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: 10 * time.Second, Transport: transport}
+}
+
+// privateIP returns whether the address is not reachable on the internet: loopback, private, link-local (like the
+// metadata services of the cloud providers), unspecified or multicast
+func privateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// allowPrivateURLs returns whether the subscriptions may use the private addresses, set by WEBHOOK_ALLOW_PRIVATE_URLS
+func allowPrivateURLs() bool {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("WEBHOOK_ALLOW_PRIVATE_URLS"))) == "true"
+}
+
+// DeliverDue sends a batch of the pending deliveries due at the time, and returns the number of deliveries of the batch
+// The deliveries are claimed one at a time by a first transaction, which postpones the delivery to the claim timeout,
+// counts the attempt and records a claim token, and are posted once it committed, so no row is locked while the
+// receiver answers. The result is recorded by a second transaction, only while the claim token is the delivery's. The
+// delivery of a deliverer that stopped before recording its result is sent again after the claim timeout, the
+// receivers ignore the repeated event ids
+func (d *Deliverer) DeliverDue(now time.Time) (int, error) {
+	subscriptions := map[uuid.UUID]*models.WebhookSubscription{}
+	sent := 0
+	for sent < d.BatchSize {
+		delivery, err := d.claimNext(now)
+		if err != nil || delivery == nil {
+			return sent, err
+		}
+		sent++
+
+		subscription, ok := subscriptions[delivery.SubscriptionID]
+		if !ok {
+			subscription = &models.WebhookSubscription{}
+			if err := infrastructure.GetDB().Where("id = ?", delivery.SubscriptionID).First(subscription).Error; err != nil {
+				subscription = nil
+			}
+			subscriptions[delivery.SubscriptionID] = subscription
+		}
+
+		changes := d.deliver(*delivery, subscription, now)
+		changes["claim_token"] = ""
+		err = infrastructure.GetDB().Model(&models.WebhookDelivery{}).
+			Where("id = ? AND claim_token = ?", delivery.ID, delivery.ClaimToken).Updates(changes).Error
+		if err != nil {
+			infrastructure.GetLog().WithFields(logrus.Fields{"delivery_id": delivery.ID.String(), "error": err.Error()}).
+				Error("Failed to record the webhook delivery, it is sent again after the claim timeout")
+		}
+	}
+	return sent, nil
+}
+
+// claimNext postpones the next due delivery to the claim timeout, and returns it with its attempt counted, nil when
+// no delivery is due
+func (d *Deliverer) claimNext(now time.Time) (*models.WebhookDelivery, error) {
+	tx := infrastructure.GetDB().Begin()
+
+	delivery := models.WebhookDelivery{}
+	err := tx.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+		Where("status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", models.WEBHOOK_DELIVERY_PENDING, now).
+		Order("created_at").First(&delivery).Error
+	if err != nil {
+		tx.Rollback()
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, errors.New(utils.ERROR_SERVER)
+	}
+
+	claim := map[string]interface{}{
+		"attempts":        delivery.Attempts + 1,
+		"next_attempt_at": time.Now().Add(d.ClaimTimeout),
+		"claim_token":     uuid.NewV4().String(),
+	}
+	if err := tx.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(claim).Error; err != nil {
+		tx.Rollback()
+		return nil, errors.New(utils.ERROR_SERVER)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, errors.New(utils.ERROR_SERVER)
+	}
+	delivery.Attempts = claim["attempts"].(uint)
+	delivery.ClaimToken = claim["claim_token"].(string)
+	return &delivery, nil
+}
+
+// deliver posts the claimed delivery, whose attempts count this attempt, and returns the columns of its new status
+// The deliveries of a deleted subscription are dead, and so are the deliveries claimed again after their last attempt
+func (d *Deliverer) deliver(delivery models.WebhookDelivery, subscription *models.WebhookSubscription, now time.Time) map[string]interface{} {
+	log := infrastructure.GetLog().WithFields(logrus.Fields{
+		"delivery_id": delivery.ID.String(),
+		"event_id":    delivery.EventID.String(),
+		"attempt":     delivery.Attempts,
+	})
+
+	if subscription == nil {
+		return map[string]interface{}{
+			"status":          models.WEBHOOK_DELIVERY_DEAD,
+			"next_attempt_at": nil,
+			"last_error":      "subscription not found",
+		}
+	}
+	if delivery.Attempts > d.MaxAttempts {
+		log.Error("Webhook delivery dead, its last attempt was interrupted")
+		return map[string]interface{}{
+			"status":          models.WEBHOOK_DELIVERY_DEAD,
+			"attempts":        d.MaxAttempts,
+			"next_attempt_at": nil,
+			"last_error":      "delivery interrupted before its result was recorded",
+		}
+	}
+
+	status, err := d.post(delivery, *subscription, now)
+	if err == nil {
+		log.Info("Webhook delivered")
+		return map[string]interface{}{
+			"status":          models.WEBHOOK_DELIVERY_DELIVERED,
+			"next_attempt_at": nil,
+			"response_status": status,
+			"last_error":      "",
+			"delivered_at":    now,
+		}
+	}
+
+	if delivery.Attempts >= d.MaxAttempts {
+		log.WithField("error", err.Error()).Error("Webhook delivery dead")
+		return map[string]interface{}{
+			"status":          models.WEBHOOK_DELIVERY_DEAD,
+			"next_attempt_at": nil,
+			"response_status": status,
+			"last_error":      err.Error(),
+		}
+	}
+
+	log.WithField("error", err.Error()).Warn("Webhook delivery failed, retrying")
+	return map[string]interface{}{
+		"next_attempt_at": now.Add(d.RetryDelay(delivery.Attempts)),
+		"response_status": status,
+		"last_error":      err.Error(),
+	}
+}
+
+// post sends the payload of the delivery, signed with the secret of the subscription, and returns the response status
+// Only the 2xx responses are successful
+func (d *Deliverer) post(delivery models.WebhookDelivery, subscription models.WebhookSubscription, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HEADER_EVENT_ID, delivery.EventID.String())
+	req.Header.Set(HEADER_EVENT_TYPE, delivery.EventType)
+	req.Header.Set(HEADER_DELIVERY_ID, delivery.ID.String())
+	req.Header.Set(HEADER_SIGNATURE, SignatureHeader(subscription.Secret, now, []byte(delivery.Payload)))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// RetryDelay returns the wait after the failed attempt, the backoff doubled on every attempt up to the maximum
+func (d *Deliverer) RetryDelay(attempts uint) time.Duration {
+	delay := d.Backoff
+	for i := uint(1); i < attempts && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxBackoff {
+		delay = d.MaxBackoff
+	}
+	return delay
+}
+
+// SignatureHeader returns the signature of a delivery, `t=<unix time>,v1=<signature>`
+// The signature is the base64 HMAC-SHA256, with the secret, of the unix time, a dot and the body
+func SignatureHeader(secret string, now time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + Sign(secret, timestamp, body)
+}
+
+// Sign returns the base64 HMAC-SHA256 of the timestamp, a dot and the body
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
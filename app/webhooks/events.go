@@ -0,0 +1,111 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+	"net"
+	"net/url"
+	"payments/app/models"
+	"payments/utils"
+	"strings"
+	"time"
+)
+
+// EventTypes lists the events a subscription can receive
+var EventTypes = []string{models.EVENT_PAYMENT_CREATED, models.EVENT_PAYMENT_UPDATED, models.EVENT_PAYMENT_DELETED, models.EVENT_PAYMENT_STATUS_CHANGED}
+
+// Event is the body of the deliveries, with the payment after the change
+// The id of the event is the same for all its deliveries, so the receivers can ignore the repeated ones
+type Event struct {
+	ID             uuid.UUID      `json:"id"`
+	Type           string         `json:"type"`
+	OrganisationID uuid.UUID      `json:"organisation_id"`
+	CreatedAt      time.Time      `json:"created_at"`
+	Data           models.Payment `json:"data"`
+}
+
+// NewEvent reads an event of the outbox, its payload is the payment after the change
+// The id of the outbox event is kept, so the event has the same id for the webhooks and for the other sinks
+func NewEvent(outboxEvent models.OutboxEvent) (Event, error) {
+	event := Event{ID: outboxEvent.EventID, Type: outboxEvent.Type, OrganisationID: outboxEvent.OrganisationID, CreatedAt: outboxEvent.CreatedAt.UTC()}
+	if err := json.Unmarshal([]byte(outboxEvent.Payload), &event.Data); err != nil {
+		return event, err
+	}
+	return event, nil
+}
+
+// Publish creates a pending delivery of the event for every active subscription of its organisation that receives
+// the event type. The deliveries are created with the db, so a transaction creates them only if it commits
+func Publish(db *gorm.DB, event Event) error {
+	subscriptions := []models.WebhookSubscription{}
+	if err := db.Where("organisation_id = ? AND active = ?", event.OrganisationID, true).Find(&subscriptions).Error; err != nil {
+		return errors.New(utils.ERROR_SERVER)
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		if !subscription.Receives(event.Type) {
+			continue
+		}
+		delivery := models.WebhookDelivery{
+			ID:             uuid.NewV4(),
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			PaymentID:      event.Data.ID,
+			Payload:        string(payload),
+			Status:         models.WEBHOOK_DELIVERY_PENDING,
+		}
+		if err := db.Create(&delivery).Error; err != nil {
+			return errors.New(utils.ERROR_SERVER)
+		}
+	}
+	return nil
+}
+
+// ValidateSubscription returns the errors of the url and of the event types of the subscription, as `field: message`
+func ValidateSubscription(subscription models.WebhookSubscription) []string {
+	errs := []string{}
+
+	if u, err := url.Parse(subscription.URL); err != nil || u.Scheme != "https" || u.Host == "" {
+		errs = append(errs, "url: "+utils.ERROR_WEBHOOK_URL_INVALID)
+	} else if !allowPrivateURLs() && privateHost(u.Hostname()) {
+		errs = append(errs, "url: "+utils.ERROR_WEBHOOK_URL_PRIVATE)
+	}
+
+	if len(subscription.Events) == 0 {
+		errs = append(errs, "events: "+utils.ERROR_WEBHOOK_EVENTS_REQUIRED)
+	}
+	for _, event := range subscription.Events {
+		if !isEventType(event) {
+			errs = append(errs, "events: "+utils.ERROR_WEBHOOK_EVENT_INVALID+" ("+event+")")
+		}
+	}
+	return errs
+}
+
+// privateHost returns whether the host is localhost or a private address
+// The names resolving to a private address are refused by the deliverer, when the deliveries are sent
+func privateHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && privateIP(ip)
+}
+
+func isEventType(eventType string) bool {
+	for _, known := range EventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package webhooks
+
+import (
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"payments/app/models"
+	"payments/utils"
+	"testing"
+	"time"
+)
+
+func TestValidateSubscription(t *testing.T) {
+	subscription := models.WebhookSubscription{URL: "https://example.com/hooks", Events: []string{models.EVENT_PAYMENT_CREATED, models.EVENT_PAYMENT_STATUS_CHANGED}}
+	assert.Empty(t, ValidateSubscription(subscription))
+
+	assert.EqualValues(t, []string{
+		"url: " + utils.ERROR_WEBHOOK_URL_INVALID,
+		"events: " + utils.ERROR_WEBHOOK_EVENT_INVALID + " (payment.approved)",
+	}, ValidateSubscription(models.WebhookSubscription{URL: "ftp://example.com", Events: []string{"payment.approved"}}))
+
+	assert.EqualValues(t, []string{
+		"url: " + utils.ERROR_WEBHOOK_URL_INVALID,
+		"events: " + utils.ERROR_WEBHOOK_EVENTS_REQUIRED,
+	}, ValidateSubscription(models.WebhookSubscription{URL: "/hooks"}))
+
+	// Only https, and not to the local or private addresses
+	events := []string{models.EVENT_PAYMENT_CREATED}
+	assert.EqualValues(t, []string{"url: " + utils.ERROR_WEBHOOK_URL_INVALID}, ValidateSubscription(models.WebhookSubscription{URL: "http://example.com/hooks", Events: events}))
+	for _, private := range []string{"https://localhost/hooks", "https://127.0.0.1:8443/hooks", "https://10.0.0.12/hooks", "https://192.168.1.1/hooks", "https://169.254.169.254/latest/meta-data", "https://[::1]/hooks", "https://[fd00::1]/hooks"} {
+		assert.EqualValues(t, []string{"url: " + utils.ERROR_WEBHOOK_URL_PRIVATE}, ValidateSubscription(models.WebhookSubscription{URL: private, Events: events}), private)
+	}
+
+	os.Setenv("WEBHOOK_ALLOW_PRIVATE_URLS", "true")
+	defer os.Unsetenv("WEBHOOK_ALLOW_PRIVATE_URLS")
+	assert.Empty(t, ValidateSubscription(models.WebhookSubscription{URL: "https://127.0.0.1:8443/hooks", Events: events}))
+}
+
+func TestPrivateIP(t *testing.T) {
+	for _, private := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.0.1", "169.254.169.254", "0.0.0.0", "224.0.0.1", "::1", "fe80::1", "fd12::1", "::ffff:10.0.0.1"} {
+		assert.True(t, privateIP(net.ParseIP(private)), private)
+	}
+	for _, public := range []string{"93.184.216.34", "8.8.8.8", "172.32.0.1", "2606:2800:220:1::1"} {
+		assert.False(t, privateIP(net.ParseIP(public)), public)
+	}
+}
+
+func TestReceives(t *testing.T) {
+	subscription := models.WebhookSubscription{Active: true, Events: []string{models.EVENT_PAYMENT_DELETED}}
+	assert.True(t, subscription.Receives(models.EVENT_PAYMENT_DELETED))
+	assert.False(t, subscription.Receives(models.EVENT_PAYMENT_CREATED))
+
+	subscription.Active = false
+	assert.False(t, subscription.Receives(models.EVENT_PAYMENT_DELETED))
+}
+
+func TestSign(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"payment.created"}`)
+
+	header := SignatureHeader("whsec_secret", now, body)
+	assert.EqualValues(t, "t=1700000000,v1="+Sign("whsec_secret", "1700000000", body), header)
+	assert.NotEqual(t, Sign("whsec_secret", "1700000000", body), Sign("whsec_other", "1700000000", body))
+	assert.NotEqual(t, Sign("whsec_secret", "1700000000", body), Sign("whsec_secret", "1700000001", body))
+}
+
+func TestRetryDelay(t *testing.T) {
+	d := NewDeliverer()
+
+	assert.EqualValues(t, 30*time.Second, d.RetryDelay(1))
+	assert.EqualValues(t, time.Minute, d.RetryDelay(2))
+	assert.EqualValues(t, 6*time.Hour, d.RetryDelay(20))
+}
+
+func TestDeliver(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	delivery := models.WebhookDelivery{ID: uuid.NewV4(), EventID: uuid.NewV4(), EventType: models.EVENT_PAYMENT_CREATED, Payload: `{"type":"payment.created"}`, Attempts: 1}
+
+	status := http.StatusOK
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.EqualValues(t, delivery.Payload, string(body))
+		assert.EqualValues(t, delivery.EventID.String(), r.Header.Get(HEADER_EVENT_ID))
+		assert.EqualValues(t, models.EVENT_PAYMENT_CREATED, r.Header.Get(HEADER_EVENT_TYPE))
+		assert.EqualValues(t, SignatureHeader("whsec_secret", now, body), r.Header.Get(HEADER_SIGNATURE))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	subscription := &models.WebhookSubscription{URL: server.URL, Secret: "whsec_secret"}
+
+	d := NewDeliverer()
+	d.Client = server.Client()
+	delivered := d.deliver(delivery, subscription, now)
+	assert.EqualValues(t, models.WEBHOOK_DELIVERY_DELIVERED, delivered["status"])
+	assert.EqualValues(t, http.StatusOK, delivered["response_status"])
+	assert.EqualValues(t, now, delivered["delivered_at"])
+
+	// The failed deliveries are retried with backoff, the claim counted the attempt
+	status = http.StatusServiceUnavailable
+	delivery.Attempts = 2
+	retried := d.deliver(delivery, subscription, now)
+	assert.NotContains(t, retried, "status")
+	assert.EqualValues(t, now.Add(time.Minute), retried["next_attempt_at"])
+	assert.EqualValues(t, "receiver responded with status 503", retried["last_error"])
+
+	// Until the last attempt
+	delivery.Attempts = 10
+	dead := d.deliver(delivery, subscription, now)
+	assert.EqualValues(t, models.WEBHOOK_DELIVERY_DEAD, dead["status"])
+	assert.EqualValues(t, http.StatusServiceUnavailable, dead["response_status"])
+
+	// A delivery claimed again after its last attempt is dead without being sent
+	status = http.StatusOK
+	delivery.Attempts = 11
+	interrupted := d.deliver(delivery, subscription, now)
+	assert.EqualValues(t, models.WEBHOOK_DELIVERY_DEAD, interrupted["status"])
+	assert.EqualValues(t, 10, interrupted["attempts"])
+	assert.NotContains(t, interrupted, "response_status")
+
+	// The deliveries of a deleted subscription are dead
+	assert.EqualValues(t, models.WEBHOOK_DELIVERY_DEAD, d.deliver(delivery, nil, now)["status"])
+}
+
+func TestDeliverToPrivateAddress(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	delivery := models.WebhookDelivery{ID: uuid.NewV4(), EventID: uuid.NewV4(), EventType: models.EVENT_PAYMENT_CREATED, Payload: `{"type":"payment.created"}`, Attempts: 1}
+
+	received := false
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+	}))
+	defer server.Close()
+	subscription := &models.WebhookSubscription{URL: server.URL, Secret: "whsec_secret"}
+
+	// The receiver is on the loopback address, the connection is refused before the request is sent
+	retried := NewDeliverer().deliver(delivery, subscription, now)
+	assert.False(t, received)
+	assert.NotContains(t, retried, "status")
+	assert.Contains(t, retried["last_error"], utils.ERROR_WEBHOOK_ADDRESS_FORBIDDEN+" (127.0.0.1)")
+}
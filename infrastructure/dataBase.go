@@ -5,12 +5,15 @@ import (
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 	"os"
+	"sync"
 	"time"
 )
 
 var db *gorm.DB
+var dbOnce sync.Once
 
-func init() {
+// connect opens the connection with the database
+func connect() {
 	var err error
 	// Read Environment DB Variables
 	username := os.Getenv("DB_USER")
@@ -28,7 +31,6 @@ func init() {
 		select {
 		case <-timeout:
 			panic(err)
-			return
 		default:
 			db, err = gorm.Open("postgres", dbUri)
 			if err == nil {
@@ -38,10 +40,11 @@ func init() {
 		}
 		time.Sleep(time.Second)
 	}
-
 }
 
 // Returns a handle to the DB object
+// The connection is opened the first time it is requested
 func GetDB() *gorm.DB {
+	dbOnce.Do(connect)
 	return db
 }
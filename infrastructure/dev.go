@@ -0,0 +1,12 @@
+package infrastructure
+
+import (
+	"os"
+	"strings"
+)
+
+// DevMode reports whether DEV_MODE is true. Only local development and the tests set it: it allows the fallbacks that
+// must not run in production, e.g. the ephemeral JWT signing key
+func DevMode() bool {
+	return strings.TrimSpace(os.Getenv("DEV_MODE")) == "true"
+}
@@ -0,0 +1,316 @@
+package infrastructure
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ALGORITHM_RS256 = "RS256"
+const ALGORITHM_ES256 = "ES256"
+
+// SigningKey is a key used to sign and verify JWT tokens
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+	ActiveFrom time.Time
+}
+
+// JWK is the public representation of a signing key (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served in the JWKS endpoint
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeyRing holds every key accepted to verify tokens and selects the key used to sign new ones
+// Keys are loaded from a directory with one PEM private key per file, the file name (without extension) is the kid
+// A key only starts signing tokens once its file is older than the activation delay, so downstream services
+// have time to fetch the new public key from the JWKS endpoint before receiving tokens signed with it
+type KeyRing struct {
+	mu              sync.RWMutex
+	dir             string
+	activationDelay time.Duration
+	keys            map[string]*SigningKey
+}
+
+var keyRing *KeyRing
+var keyRingOnce sync.Once
+
+// GetKeyRing returns the key ring configured by the environment
+// JWT_KEYS_DIR: directory with the private keys. It is required, unless DEV_MODE generates an ephemeral key: every
+// instance of the api would sign with its own key and refuse the tokens of the others
+// JWT_KEYS_ACTIVATION_DELAY: time a new key waits before being used to sign tokens (default 0)
+// JWT_KEYS_RELOAD_INTERVAL: interval to reload the keys directory (default 1m)
+func GetKeyRing() *KeyRing {
+	keyRingOnce.Do(func() {
+		activationDelay, _ := time.ParseDuration(os.Getenv("JWT_KEYS_ACTIVATION_DELAY"))
+		keyRing = NewKeyRing(os.Getenv("JWT_KEYS_DIR"), activationDelay)
+
+		if keyRing.dir == "" {
+			if !DevMode() {
+				panic("JWT_KEYS_DIR is not defined. Set DEV_MODE=true to use an ephemeral signing key in local development")
+			}
+			GetLog().Warn("JWT_KEYS_DIR not defined. Using an ephemeral signing key, the tokens are refused by the other instances and after a restart")
+			if err := keyRing.AddEphemeralKey(); err != nil {
+				panic(err)
+			}
+			return
+		}
+
+		if err := keyRing.Load(); err != nil {
+			panic(err)
+		}
+
+		reloadInterval, err := time.ParseDuration(os.Getenv("JWT_KEYS_RELOAD_INTERVAL"))
+		if err != nil || reloadInterval <= 0 {
+			reloadInterval = time.Minute
+		}
+		go keyRing.watch(reloadInterval)
+	})
+	return keyRing
+}
+
+// NewKeyRing creates an empty key ring for the keys directory
+func NewKeyRing(dir string, activationDelay time.Duration) *KeyRing {
+	return &KeyRing{
+		dir:             dir,
+		activationDelay: activationDelay,
+		keys:            map[string]*SigningKey{},
+	}
+}
+
+// watch reloads the keys directory periodically
+func (k *KeyRing) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := k.Load(); err != nil {
+			GetLog().WithField("error", err.Error()).Error("Failed to reload JWT keys")
+		}
+	}
+}
+
+// Load reads all keys from the keys directory, replacing the keys in the ring
+// Keys removed from the directory stop being accepted
+func (k *KeyRing) Load() error {
+	files, err := ioutil.ReadDir(k.dir)
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]*SigningKey{}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".pem" {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(k.dir, file.Name()))
+		if err != nil {
+			return err
+		}
+
+		key, err := parseSigningKey(content)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file.Name(), err.Error())
+		}
+
+		key.ID = strings.TrimSuffix(file.Name(), ".pem")
+		key.ActiveFrom = file.ModTime().Add(k.activationDelay)
+		keys[key.ID] = key
+	}
+
+	if len(keys) == 0 {
+		return errors.New("no keys found in " + k.dir)
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+
+	return nil
+}
+
+// AddEphemeralKey generates a new ES256 key only kept in memory
+func (k *KeyRing) AddEphemeralKey() error {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	key := &SigningKey{
+		Algorithm:  ALGORITHM_ES256,
+		PrivateKey: privateKey,
+		PublicKey:  &privateKey.PublicKey,
+		ActiveFrom: time.Now(),
+	}
+	key.ID = thumbprint(key.JWK())
+
+	k.mu.Lock()
+	k.keys[key.ID] = key
+	k.mu.Unlock()
+
+	return nil
+}
+
+// SigningKey returns the newest active key, used to sign new tokens
+// When no key is active yet, the oldest key is used
+func (k *KeyRing) SigningKey() (*SigningKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	var keys []*SigningKey
+	for _, key := range k.keys {
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys available")
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ActiveFrom.Equal(keys[j].ActiveFrom) {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].ActiveFrom.Before(keys[j].ActiveFrom)
+	})
+
+	now := time.Now()
+	signingKey := keys[0]
+	for _, key := range keys {
+		if !key.ActiveFrom.After(now) {
+			signingKey = key
+		}
+	}
+
+	return signingKey, nil
+}
+
+// Key returns the key with the kid
+func (k *KeyRing) Key(id string) (*SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+// JWKS returns the public keys of the ring
+func (k *KeyRing) JWKS() JWKSet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range k.keys {
+		set.Keys = append(set.Keys, key.JWK())
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].KeyID < set.Keys[j].KeyID
+	})
+
+	return set
+}
+
+// JWK returns the public representation of the key
+func (s *SigningKey) JWK() JWK {
+	jwk := JWK{
+		KeyID:     s.ID,
+		Use:       "sig",
+		Algorithm: s.Algorithm,
+	}
+
+	switch publicKey := s.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = publicKey.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(padBytes(publicKey.X.Bytes(), size))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(padBytes(publicKey.Y.Bytes(), size))
+	}
+
+	return jwk
+}
+
+// parseSigningKey parses a PEM encoded RSA or P-256 private key
+func parseSigningKey(content []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("invalid PEM file")
+	}
+
+	var privateKey interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, errors.New("unsupported PEM block " + block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if privateKey.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must have at least 2048 bits")
+		}
+		return &SigningKey{Algorithm: ALGORITHM_RS256, PrivateKey: privateKey, PublicKey: &privateKey.PublicKey}, nil
+	case *ecdsa.PrivateKey:
+		if privateKey.Curve != elliptic.P256() {
+			return nil, errors.New("EC keys must use the P-256 curve")
+		}
+		return &SigningKey{Algorithm: ALGORITHM_ES256, PrivateKey: privateKey, PublicKey: &privateKey.PublicKey}, nil
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+}
+
+// thumbprint returns the RFC 7638 thumbprint of an EC key
+func thumbprint(jwk JWK) string {
+	canonical := fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s","y":"%s"}`, jwk.Curve, jwk.KeyType, jwk.X, jwk.Y)
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// padBytes left pads the bytes with zeros until size
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
@@ -0,0 +1,103 @@
+package infrastructure
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeECKey(t *testing.T, dir string, kid string, modTime time.Time) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	der, err := x509.MarshalECPrivateKey(privateKey)
+	require.Nil(t, err)
+	writeKey(t, dir, kid, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, modTime)
+}
+
+func writeRSAKey(t *testing.T, dir string, kid string, bits int, modTime time.Time) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	require.Nil(t, err)
+	writeKey(t, dir, kid, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}, modTime)
+}
+
+func writeKey(t *testing.T, dir string, kid string, block *pem.Block, modTime time.Time) {
+	path := filepath.Join(dir, kid+".pem")
+	require.Nil(t, ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600))
+	require.Nil(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestKeyRingLoadsKeysAndAlgorithms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeECKey(t, dir, "ec-key", time.Now().Add(-time.Hour))
+	writeRSAKey(t, dir, "rsa-key", 2048, time.Now().Add(-2*time.Hour))
+
+	keyRing := NewKeyRing(dir, 0)
+	require.Nil(t, keyRing.Load())
+
+	ecKey, ok := keyRing.Key("ec-key")
+	require.True(t, ok)
+	assert.Equal(t, ALGORITHM_ES256, ecKey.Algorithm)
+
+	rsaKey, ok := keyRing.Key("rsa-key")
+	require.True(t, ok)
+	assert.Equal(t, ALGORITHM_RS256, rsaKey.Algorithm)
+
+	jwks := keyRing.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "EC", jwks.Keys[0].KeyType)
+	assert.Equal(t, "P-256", jwks.Keys[0].Curve)
+	assert.Len(t, jwks.Keys[0].X, 43)
+	assert.Equal(t, "RSA", jwks.Keys[1].KeyType)
+	assert.Equal(t, "AQAB", jwks.Keys[1].E)
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeECKey(t, dir, "2019-01", time.Now().Add(-48*time.Hour))
+	writeECKey(t, dir, "2019-02", time.Now().Add(-2*time.Hour))
+
+	// The newest key is only used after the activation delay
+	keyRing := NewKeyRing(dir, 24*time.Hour)
+	require.Nil(t, keyRing.Load())
+	signingKey, err := keyRing.SigningKey()
+	require.Nil(t, err)
+	assert.Equal(t, "2019-01", signingKey.ID)
+
+	keyRing = NewKeyRing(dir, time.Hour)
+	require.Nil(t, keyRing.Load())
+	signingKey, err = keyRing.SigningKey()
+	require.Nil(t, err)
+	assert.Equal(t, "2019-02", signingKey.ID)
+
+	// Removed keys are no longer accepted after reload
+	require.Nil(t, os.Remove(filepath.Join(dir, "2019-01.pem")))
+	require.Nil(t, keyRing.Load())
+	_, ok := keyRing.Key("2019-01")
+	assert.False(t, ok)
+}
+
+func TestKeyRingRefusesWeakKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	writeRSAKey(t, dir, "weak", 1024, time.Now())
+
+	assert.NotNil(t, NewKeyRing(dir, 0).Load())
+}
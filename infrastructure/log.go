@@ -22,24 +22,65 @@ func GetLog() *logrus.Logger {
 	return log
 }
 
+// Fields removed from the bodies of the requests and responses in the log, at any depth: the passwords, and the
+// tokens, keys, secrets and codes sent by or issued to the users
+var redactedFields = map[string]bool{
+	"password":         true,
+	"current_password": true,
+	"token":            true,
+	"key":              true,
+	"secret":           true,
+	"otpauth_uri":      true,
+	"recovery_codes":   true,
+	"code":             true,
+	"recovery_code":    true,
+	"challenge_token":  true,
+}
+
+// REDACTED replaces the values of the redacted fields
+const REDACTED = "[REDACTED]"
+
+// Redact replaces the values of the redacted fields in the objects of a decoded JSON, at any depth
+func Redact(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for field, fieldValue := range value {
+			if redactedFields[field] {
+				value[field] = REDACTED
+			} else {
+				value[field] = Redact(fieldValue)
+			}
+		}
+	case []interface{}:
+		for i := range value {
+			value[i] = Redact(value[i])
+		}
+	}
+	return value
+}
+
+// redactBody decodes the JSON body with its redacted fields replaced, nil when the body is not JSON
+func redactBody(body []byte) interface{} {
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return nil
+	}
+	return Redact(decoded)
+}
+
 func LogApiRequest(r *http.Request) {
 	bodyBytes, _ := ioutil.ReadAll(r.Body)
 	r.Body.Close()
 	r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes)) // To Read body again in handler
-	bodyString := string(bodyBytes)
-	body := map[string]interface{}{}
-	if err := json.Unmarshal([]byte(bodyString), &body); err == nil {
-		delete(body, "password") // Delete password from log
-	}
 
-	header := r.Header
+	header := r.Header.Clone()
 	header.Del("Authorization") // Delete Authorization from log
 
 	GetLog().WithFields(logrus.Fields{
 		"endpoint": r.RequestURI,
 		"method":   r.Method,
 		"header":   header,
-		"body":     body,
+		"body":     redactBody(bodyBytes),
 		"host":     r.Host,
 	}).Info("Request")
 
@@ -48,7 +89,7 @@ func LogApiRequest(r *http.Request) {
 func LogApiBadRequestResponse(httpStatusCode int, response []byte) {
 	GetLog().WithFields(logrus.Fields{
 		"httpStatusCode": httpStatusCode,
-		"response":       string(response),
+		"response":       redactBody(response),
 	}).Warn("Request Response")
 }
 
@@ -60,15 +101,7 @@ func LogError(httpStatusCode int, error string) {
 }
 
 func LogApiResponse(httpStatusCode int, response []byte) {
-	body := map[string]interface{}{}
-	if err := json.Unmarshal(response, &body); err == nil {
-		switch body["data"].(type) {
-		case map[string]interface{}:
-			delete(body["data"].(map[string]interface{}), "token") // Delete token from log
-		default:
-
-		}
-
+	if body := redactBody(response); body != nil {
 		GetLog().WithFields(logrus.Fields{
 			"httpStatusCode": httpStatusCode,
 			"response":       body,
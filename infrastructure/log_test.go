@@ -0,0 +1,34 @@
+package infrastructure
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLogRedactsSecrets(t *testing.T) {
+	var output bytes.Buffer
+	out := GetLog().Out
+	GetLog().Out = &output
+	defer func() { GetLog().Out = out }()
+
+	request := httptest.NewRequest(http.MethodPost, "/v1/user/login/mfa", bytes.NewBufferString(
+		`{"email": "user@example.com", "password": "secret-password", "challenge_token": "secret-challenge", "code": "123456", "recovery_code": "secret-recovery"}`))
+	request.Header.Set("Authorization", "Bearer secret-jwt")
+	LogApiRequest(request)
+	assert.EqualValues(t, "Bearer secret-jwt", request.Header.Get("Authorization"))
+
+	LogApiResponse(http.StatusCreated, []byte(`{"data": {"token": "secret-token", "key": "pk_secret-key", "secret": "whsec_secret", "otpauth_uri": "otpauth://totp/secret"}}`))
+	LogApiResponse(http.StatusOK, []byte(`{"data": [{"secret": "signing-secret"}, {"recovery_codes": ["secret-code-1", "secret-code-2"]}]}`))
+	LogApiBadRequestResponse(http.StatusBadRequest, []byte(`{"errors": ["Invalid token"], "data": {"token": "secret-reset-token"}}`))
+
+	logged := output.String()
+	assert.Contains(t, logged, "user@example.com")
+	assert.Contains(t, logged, REDACTED)
+	for _, secret := range []string{"secret-password", "secret-challenge", "123456", "secret-recovery", "secret-jwt", "secret-token",
+		"pk_secret-key", "whsec_secret", "otpauth://", "signing-secret", "secret-code-1", "secret-reset-token"} {
+		assert.NotContains(t, logged, secret)
+	}
+}
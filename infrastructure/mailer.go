@@ -0,0 +1,137 @@
+package infrastructure
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Email is a plain text email sent to an user
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(email Email) error
+}
+
+// SMTPMailer sends the emails through a SMTP server
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// FileMailer writes each email to a file in the directory, used in local development
+type FileMailer struct {
+	Dir string
+}
+
+// LogMailer writes the emails to the log, used in local development
+type LogMailer struct{}
+
+var mailer Mailer
+var mailerOnce sync.Once
+var mailerMutex sync.RWMutex
+
+// GetMailer returns the mailer configured by the environment, and panics when no mailer is configured
+// MAILER: smtp, or file and log which are only allowed with DEV_MODE (log by default in DEV_MODE)
+// SMTP_HOST, SMTP_PORT, SMTP_USER, SMTP_PASS, MAIL_FROM: configuration of the smtp mailer
+// MAIL_DIR: directory of the file mailer
+func GetMailer() Mailer {
+	mailerOnce.Do(func() {
+		mailerMutex.Lock()
+		defer mailerMutex.Unlock()
+		if mailer != nil {
+			return
+		}
+
+		var err error
+		if mailer, err = newMailer(os.Getenv("MAILER"), DevMode()); err != nil {
+			panic(err)
+		}
+	})
+
+	mailerMutex.RLock()
+	defer mailerMutex.RUnlock()
+	return mailer
+}
+
+// newMailer creates the mailer of the name. The file and log mailers write the reset and verification tokens in clear,
+// so they are refused outside of the development mode
+func newMailer(name string, devMode bool) (Mailer, error) {
+	switch name {
+	case "smtp":
+		if os.Getenv("SMTP_HOST") == "" || os.Getenv("MAIL_FROM") == "" {
+			return nil, errors.New("SMTP_HOST and MAIL_FROM are required by the smtp mailer")
+		}
+		return &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASS"),
+			From:     os.Getenv("MAIL_FROM"),
+		}, nil
+	case "file", "log", "":
+		if !devMode {
+			return nil, errors.New("MAILER must be smtp. Set DEV_MODE=true to use the file or log mailer in local development")
+		}
+		if name == "file" {
+			return &FileMailer{Dir: os.Getenv("MAIL_DIR")}, nil
+		}
+		return &LogMailer{}, nil
+	}
+	return nil, fmt.Errorf("unknown MAILER %s", name)
+}
+
+// SetMailer replaces the mailer, used by the tests
+func SetMailer(m Mailer) {
+	GetMailer()
+	mailerMutex.Lock()
+	mailer = m
+	mailerMutex.Unlock()
+}
+
+// Send sends the email with the smtp server, authenticating when an username is configured
+func (m *SMTPMailer) Send(email Email) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	return smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{email.To}, []byte(m.message(email)))
+}
+
+func (m *SMTPMailer) message(email Email) string {
+	return fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		m.From, email.To, email.Subject, time.Now().Format(time.RFC1123Z), strings.Replace(email.Body, "\n", "\r\n", -1))
+}
+
+// Send writes the email to a new file in the directory
+func (m *FileMailer) Send(email Email) error {
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.Replace(email.To, "@", "_at_", -1))
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", email.To, email.Subject, email.Body)
+	return ioutil.WriteFile(filepath.Join(m.Dir, filepath.Base(name)), []byte(content), 0600)
+}
+
+// Send writes the email to the log
+func (m *LogMailer) Send(email Email) error {
+	GetLog().WithFields(logrus.Fields{
+		"to":      email.To,
+		"subject": email.Subject,
+		"body":    email.Body,
+	}).Info("Email")
+	return nil
+}
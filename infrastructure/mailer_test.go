@@ -0,0 +1,53 @@
+package infrastructure
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mails")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	mailer := &FileMailer{Dir: dir}
+	require.Nil(t, mailer.Send(Email{To: "user@email.com", Subject: "Reset your password", Body: "token"}))
+
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+	assert.True(t, strings.HasSuffix(files[0].Name(), "user_at_email.com.eml"))
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.Nil(t, err)
+	assert.Equal(t, "To: user@email.com\nSubject: Reset your password\n\ntoken\n", string(content))
+}
+
+func TestSMTPMailerMessage(t *testing.T) {
+	mailer := &SMTPMailer{From: "payments@email.com"}
+
+	message := mailer.message(Email{To: "user@email.com", Subject: "Verify", Body: "line 1\nline 2"})
+
+	assert.True(t, strings.HasPrefix(message, "From: payments@email.com\r\nTo: user@email.com\r\nSubject: Verify\r\n"))
+	assert.True(t, strings.HasSuffix(message, "\r\n\r\nline 1\r\nline 2"))
+}
+
+func TestNewMailer(t *testing.T) {
+	// The mailers writing the tokens in clear are only allowed in the development mode
+	for _, name := range []string{"", "log", "file"} {
+		_, err := newMailer(name, false)
+		assert.NotNil(t, err, name)
+	}
+
+	mailer, err := newMailer("", true)
+	require.Nil(t, err)
+	assert.IsType(t, &LogMailer{}, mailer)
+
+	_, err = newMailer("sendmail", true)
+	assert.EqualError(t, err, "unknown MAILER sendmail")
+}
@@ -0,0 +1,49 @@
+package infrastructure
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+const CLIENT_AUTH_OPTIONAL = "optional"
+const CLIENT_AUTH_REQUIRE = "require"
+
+// NewTLSConfig creates the server TLS configuration from the environment
+// TLS_CLIENT_CA_FILE: PEM bundle with the CAs that issue client certificates. If empty client certificates are not requested
+// TLS_CLIENT_AUTH: optional (default) accepts requests without certificate, require refuses them in the handshake
+func NewTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.NoClientCert,
+	}
+
+	caFile := os.Getenv("TLS_CLIENT_CA_FILE")
+	if caFile == "" {
+		return config, nil
+	}
+
+	bundle, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, errors.New("no certificates found in " + caFile)
+	}
+	config.ClientCAs = pool
+
+	switch os.Getenv("TLS_CLIENT_AUTH") {
+	case "", CLIENT_AUTH_OPTIONAL:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case CLIENT_AUTH_REQUIRE:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, errors.New("invalid TLS_CLIENT_AUTH " + os.Getenv("TLS_CLIENT_AUTH"))
+	}
+
+	return config, nil
+}
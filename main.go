@@ -4,25 +4,67 @@ import (
 	"fmt"
 	"github.com/gorilla/mux"
 	"net/http"
+	"os"
+	"payments/app/cli"
 	"payments/app/handlers"
 	"payments/app/middleware"
 	"payments/app/models"
+	"payments/app/outbox"
+	"payments/app/scheduler"
 	"payments/infrastructure"
 )
 
 func main() {
+	// Run a command, e.g. `payments import-pain001 -org <id> file.xml`, instead of serving the api
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
 	router := mux.NewRouter()
 	handlers.Routes(router)
+	// The requests are limited by ip address before the authentication, and by client after it
+	router.Use(middleware.RateLimitByIP)
 	router.Use(middleware.JwtAuthentication)
+	router.Use(middleware.RateLimit)
+	router.Use(middleware.RequestSignature)
+
+	// Fail at startup when the signing keys or the mailer are not configured
+	infrastructure.GetKeyRing()
+	infrastructure.GetMailer()
 
 	provisionDatabase()
 
-	err := http.ListenAndServe(":8000", router) //Launch the app
+	// Submit the pending payments on their processing date
+	scheduler.Start()
+
+	// Publish the payment events recorded in the outbox
+	outbox.Start()
+
+	err := serve(router) //Launch the app
 	if err != nil {
 		fmt.Print(err)
 	}
 }
 
+// serve Serve the api with HTTP or, when TLS_CERT_FILE and TLS_KEY_FILE are defined, with TLS
+func serve(router *mux.Router) error {
+	server := &http.Server{Addr: ":8000", Handler: router}
+
+	certFile := os.Getenv("TLS_CERT_FILE")
+	keyFile := os.Getenv("TLS_KEY_FILE")
+	if certFile == "" || keyFile == "" {
+		return server.ListenAndServe()
+	}
+
+	tlsConfig, err := infrastructure.NewTLSConfig()
+	if err != nil {
+		return err
+	}
+	server.TLSConfig = tlsConfig
+
+	return server.ListenAndServeTLS(certFile, keyFile)
+}
+
 // provisionDatabase Create tables on Database
 func provisionDatabase() {
 	infrastructure.GetDB().AutoMigrate(
@@ -35,5 +77,31 @@ func provisionDatabase() {
 		&models.ChargesInformation{},
 		&models.Charge{},
 		&models.FX{},
+		&models.ApiKey{},
+		&models.RequestSigningKey{},
+		&models.RequestNonce{},
+		&models.ClientCertificate{},
+		&models.LoginThrottle{},
+		&models.AuditEvent{},
+		&models.RecoveryCode{},
+		&models.AccountToken{},
+		&models.Organisation{},
+		&models.Membership{},
+		&models.Invitation{},
+		&models.RateLimitBucket{},
+		&models.StandingOrder{},
+		&models.Mandate{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+		&models.OutboxEvent{},
 	)
+
+	// The payments stored before the organisations keep their organisation, which nobody can create with its id
+	created, err := models.CreateMissingOrganisations()
+	if err != nil {
+		infrastructure.GetLog().Fatal("Failed to create the organisations of the payments")
+	}
+	if created > 0 {
+		infrastructure.GetLog().WithField("organisations", created).Warn("Created the organisations of the payments without owner, claim them with POST /v1/admin/organisations/{id}/owner")
+	}
 }
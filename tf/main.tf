@@ -314,6 +314,7 @@ resource "template_file" "task_definition" {
     dbName               = "${var.db_name}"
     dbHost               = "${element(split(":", module.db.this_db_instance_endpoint), 0)}"
     dbPort               = "${element(split(":", module.db.this_db_instance_endpoint), 1)}"
+    trustedProxies       = "${var.vpc_cidr}"
   }
 }
 
@@ -6,9 +6,103 @@ const ERROR_MISSING_TOKEN = "Missing auth token"
 const ERROR_REQUESTED_UUID_INVALID = "Requested UUID is Invalid"
 const ERROR_SERVER = "Server unavailable. Please try later. Sorry for the inconvenience"
 const ERROR_PASSWORD_REQUIRED = "Password is required"
-const ERROR_EMAIL_NON_EXISTS = "Email address not found"
 const ERROR_EMAIL_REQUIRED = "Email address is required"
 const ERROR_EMAIL_ALREADY_EXISTS = "Email address already in use by another user"
 const ERROR_INVALID_LOGIN = "Invalid login credentials. Please try again"
 const ERROR_PAYMENT_ALREADY_EXISTS = "Payment already exists with that ID"
 const ERROR_ID_MISMATCH = "Mismatching IDs"
+const ERROR_TOKEN_INVALID = "Token Invalid"
+const ERROR_TOKEN_UNKNOWN_KEY = "Token signed with an unknown key"
+const ERROR_TOKEN_ALGORITHM = "Token signing algorithm not allowed"
+const ERROR_API_KEY_INVALID = "Invalid API key"
+const ERROR_API_KEY_SCOPE = "API key does not have the required scope"
+const ERROR_API_KEY_NAME_REQUIRED = "API key name is required"
+const ERROR_API_KEY_SCOPE_REQUIRED = "At least one scope is required"
+const ERROR_API_KEY_SCOPE_INVALID = "Invalid scope"
+const ERROR_API_KEY_EXPIRATION_INVALID = "Expiration date must be in the future"
+const ERROR_SIGNING_KEY_NAME_REQUIRED = "Signing key name is required"
+const ERROR_SIGNATURE_REQUIRED = "Request signature is required"
+const ERROR_SIGNATURE_MALFORMED = "Invalid/Malformed request signature"
+const ERROR_SIGNATURE_UNKNOWN_KEY = "Request signed with an unknown key"
+const ERROR_SIGNATURE_EXPIRED = "Request date outside the signature window"
+const ERROR_SIGNATURE_DIGEST = "Digest does not match the body"
+const ERROR_SIGNATURE_INVALID = "Request signature is invalid"
+const ERROR_SIGNATURE_REPLAYED = "Request nonce already used"
+const ERROR_CERTIFICATE_UNKNOWN = "Client certificate not registered"
+const ERROR_CERTIFICATE_SUBJECT_REQUIRED = "Certificate subject is required"
+const ERROR_CERTIFICATE_SUBJECT_ALREADY_EXISTS = "Certificate subject already in use"
+const ERROR_LOGIN_THROTTLED = "Too many failed login attempts. Please try again later"
+const ERROR_FORBIDDEN = "Not allowed to access this resource"
+const ERROR_TOTP_ALREADY_ENABLED = "Two-factor authentication already enabled"
+const ERROR_TOTP_NOT_ENROLLED = "Two-factor authentication enrolment not started"
+const ERROR_TOTP_NOT_ENABLED = "Two-factor authentication not enabled"
+const ERROR_TOTP_INVALID = "Invalid two-factor authentication code"
+const ERROR_ACCOUNT_TOKEN_INVALID = "Invalid or expired token"
+const ERROR_PASSWORD_TOO_SHORT = "Password is too short"
+const ERROR_PASSWORD_TOO_LONG = "Password is too long"
+const ERROR_PASSWORD_CONTAINS_EMAIL = "Password can not contain the email address"
+const ERROR_ACCOUNT_DISABLED = "Account disabled"
+const ERROR_TOKEN_REVOKED = "Token revoked"
+const ERROR_CURRENT_PASSWORD_INVALID = "Current password is invalid"
+const ERROR_ADMIN_SELF_DISABLE = "Admins can not disable their own account"
+const ERROR_PASSWORD_BREACHED = "Password found in a list of breached passwords. Please choose another one"
+const ERROR_ORGANISATION_NAME_REQUIRED = "Organisation name is required"
+const ERROR_ORGANISATION_NOT_FOUND = "Organisation does not exist"
+const ERROR_ORGANISATION_FORBIDDEN = "Not a member of the organisation"
+const ERROR_ORGANISATION_ROLE_INVALID = "Invalid organisation role"
+const ERROR_ORGANISATION_LAST_OWNER = "Organisation must keep one owner"
+const ERROR_ORGANISATION_HAS_OWNER = "Organisation already has an owner"
+const ERROR_INVITATION_INVALID = "Invalid or expired invitation"
+const ERROR_RATE_LIMITED = "Too many requests. Please try again later"
+const ERROR_REQUEST_TOO_LARGE = "Request body is too large"
+const ERROR_EXPORT_FORMAT_INVALID = "Invalid export format"
+const ERROR_PROCESSING_DATE_INVALID = "Invalid processing date, expected YYYY-MM-DD"
+const ERROR_IBAN_INVALID = "Invalid IBAN"
+const ERROR_IBAN_COUNTRY_UNSUPPORTED = "IBAN country not supported"
+const ERROR_IBAN_COUNTRY_NOT_SEPA = "IBAN country is not part of SEPA"
+const ERROR_IBAN_FORMAT = "IBAN does not match the country format"
+const ERROR_IBAN_CHECKSUM = "Invalid IBAN check digits"
+const ERROR_BIC_INVALID = "Invalid BIC"
+const ERROR_SEPA_ACCOUNT_NUMBER_CODE = "SEPA accounts must be identified by IBAN"
+const ERROR_SEPA_BANK_ID_CODE = "SEPA banks must be identified by SWBIC"
+const ERROR_PARTY_REQUIRED = "Party is required"
+const ERROR_SORT_CODE_INVALID = "Sort code must have 6 digits"
+const ERROR_ACCOUNT_NUMBER_INVALID = "Account number must have 6 to 8 digits"
+const ERROR_MODULUS_CHECK_FAILED = "Account number is not valid for the sort code"
+const ERROR_BANK_ID_REQUIRED = "Bank id is required"
+const ERROR_BANK_NOT_FOUND = "Bank not found in the bank directory"
+const ERROR_BANK_NOT_REACHABLE = "Bank can not receive payments of the payment scheme"
+const ERROR_SCHEME_CURRENCY = "Currency not accepted by the payment scheme"
+const ERROR_SCHEME_AMOUNT_INVALID = "Amount must be positive with up to 2 decimals"
+const ERROR_SCHEME_AMOUNT_TOO_LOW = "Amount below the minimum of the payment scheme"
+const ERROR_SCHEME_AMOUNT_TOO_HIGH = "Amount above the limit of the payment scheme"
+const ERROR_SCHEME_PAYMENT_TYPE = "Payment type not accepted by the payment scheme"
+const ERROR_SCHEME_PAYMENT_SUB_TYPE = "Payment sub type not accepted by the payment scheme"
+const ERROR_SCHEME_REFERENCE_TOO_LONG = "Reference longer than the payment scheme accepts"
+const ERROR_SCHEME_FIELD_REQUIRED = "Required by the payment scheme"
+const ERROR_CALENDAR_NOT_FOUND = "Payment scheme has no calendar"
+const ERROR_DATE_INVALID = "Invalid date, expected YYYY-MM-DD"
+const WARNING_PROCESSING_DATE_ROLLED = "Processing date moved to the next business day of the payment scheme"
+const ERROR_PAYMENT_SUBMITTED = "Payment already submitted to the payment scheme"
+const ERROR_PAYMENT_SUBMITTING = "Payment being submitted to the payment scheme"
+const ERROR_PAYMENT_SUBMISSION_INTERRUPTED = "Payment submission interrupted before its result was recorded"
+const ERROR_RECURRENCE_FREQUENCY = "Invalid frequency, expected weekly, monthly or last_business_day"
+const ERROR_RECURRENCE_INTERVAL = "Interval can not be negative"
+const ERROR_RECURRENCE_DAY_OF_MONTH = "Day of the month must be between 1 and 31"
+const ERROR_RECURRENCE_END_DATE = "End date before the start date"
+const ERROR_STANDING_ORDER_STATUS = "Not allowed in the status of the standing order"
+const ERROR_STANDING_ORDER_ALREADY_EXISTS = "Standing order already exists with that ID"
+const ERROR_MANDATE_SCHEME = "Direct debit mandates are only supported for BACS"
+const ERROR_MANDATE_REFERENCE = "Mandate reference must have 6 to 18 letters, digits, spaces or . & / -"
+const ERROR_MANDATE_REFERENCE_EXISTS = "Mandate reference already used in the organisation"
+const ERROR_MANDATE_ALREADY_EXISTS = "Mandate already exists with that ID"
+const ERROR_MANDATE_STATUS = "Not allowed in the status of the mandate"
+const ERROR_MANDATE_NOT_ACTIVE = "Mandate is cancelled or dormant, collections need an active mandate"
+const ERROR_SERVICE_USER_NUMBER_INVALID = "Service user number must have 6 digits"
+const ERROR_BACS_ACCOUNT_NUMBER_INVALID = "Bacs account number must have 8 digits"
+const ERROR_FIELD_REQUIRED = "Field is required"
+const ERROR_WEBHOOK_URL_INVALID = "Webhook url must be an absolute https url"
+const ERROR_WEBHOOK_URL_PRIVATE = "Webhook url must not be a local or private address"
+const ERROR_WEBHOOK_ADDRESS_FORBIDDEN = "Webhook receiver resolves to a local or private address"
+const ERROR_WEBHOOK_EVENTS_REQUIRED = "At least one event type is required"
+const ERROR_WEBHOOK_EVENT_INVALID = "Unknown event type"
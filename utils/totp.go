@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const TOTP_PERIOD = 30
+const TOTP_DIGITS = 6
+
+// TOTP_SKEW is the number of periods accepted before and after the current one, to tolerate clock drift
+const TOTP_SKEW = 1
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret creates a random 160 bits secret encoded in base32 (RFC 6238)
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPCode returns the code of the secret for the time step counter (HOTP with SHA-1, RFC 4226)
+func TOTPCode(secret string, counter uint64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", TOTP_DIGITS, value%1000000), nil
+}
+
+// TOTPCounter returns the time step counter of the time
+func TOTPCounter(t time.Time) uint64 {
+	return uint64(t.Unix()) / TOTP_PERIOD
+}
+
+// ValidateTOTP check if the code is valid at the time
+// Codes of counters not after lastCounter are refused, so a code can only be used once
+// Returns the counter of the code to be stored as the new lastCounter
+func ValidateTOTP(secret string, code string, t time.Time, lastCounter uint64) (uint64, bool) {
+	current := TOTPCounter(t)
+	for counter := current - TOTP_SKEW; counter <= current+TOTP_SKEW; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+
+		expected, err := TOTPCode(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPURI returns the otpauth URI of the secret, used by authenticator apps (usually as a QR code)
+func TOTPURI(issuer string, accountName string, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(TOTP_DIGITS))
+	query.Set("period", fmt.Sprint(TOTP_PERIOD))
+
+	label := url.PathEscape(issuer + ":" + accountName)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"encoding/base32"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Secret of the RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeMatchesRFCVectors(t *testing.T) {
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, expected := range vectors {
+		code, err := TOTPCode(rfcSecret, TOTPCounter(time.Unix(unix, 0)))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, code, "time %d", unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	counter, ok := ValidateTOTP(rfcSecret, "050471", now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, TOTPCounter(now), counter)
+
+	// Previous period is accepted to tolerate clock drift
+	_, ok = ValidateTOTP(rfcSecret, "050471", now.Add(TOTP_PERIOD*time.Second), 0)
+	assert.True(t, ok)
+
+	// A code can not be used twice
+	_, ok = ValidateTOTP(rfcSecret, "050471", now, counter)
+	assert.False(t, ok)
+
+	_, ok = ValidateTOTP(rfcSecret, "000000", now, 0)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Payments API", "user@email.com", "JBSWY3DPEHPK3PXP")
+
+	assert.Equal(t, "otpauth://totp/Payments%20API:user@email.com?algorithm=SHA1&digits=6&issuer=Payments+API&period=30&secret=JBSWY3DPEHPK3PXP", uri)
+}
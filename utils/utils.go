@@ -3,14 +3,19 @@ package utils
 import (
 	"encoding/json"
 	"github.com/satori/go.uuid"
+	"net"
 	"net/http"
+	"os"
 	"payments/infrastructure"
+	"strings"
+	"sync"
 )
 
 type Response struct {
-	Data   json.RawMessage `json:"data,omitempty"`
-	Links  []Link          `json:"links,omitempty"`
-	Errors []string        `json:"errors,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+	Links    []Link          `json:"links,omitempty"`
+	Errors   []string        `json:"errors,omitempty"`
+	Warnings []string        `json:"warnings,omitempty"`
 }
 
 type Link struct {
@@ -25,8 +30,13 @@ func ConvertStringToUUID(id string) (uuid.UUID, error) {
 
 // CreateApiErrorResponse to create an error response
 func CreateApiErrorResponse(w http.ResponseWriter, error string, httpStatusCode int) {
+	CreateApiErrorsResponse(w, []string{error}, httpStatusCode)
+}
+
+// CreateApiErrorsResponse to create an error response with several errors, e.g. every validation error of a request
+func CreateApiErrorsResponse(w http.ResponseWriter, errors []string, httpStatusCode int) {
 	// write an error response
-	if response, err := json.Marshal(Response{Errors: []string{error}}); err != nil {
+	if response, err := json.Marshal(Response{Errors: errors}); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		infrastructure.LogError(http.StatusInternalServerError, err.Error())
 	} else {
@@ -43,8 +53,13 @@ func CreateApiErrorResponse(w http.ResponseWriter, error string, httpStatusCode
 }
 
 func CreateApiResponse(w http.ResponseWriter, response interface{}, httpStatusCode int, links []Link) {
+	CreateApiResponseWithWarnings(w, response, httpStatusCode, links, nil)
+}
 
-	var apiResponse Response
+// CreateApiResponseWithWarnings to create a response with warnings, e.g. the changes made to the request
+func CreateApiResponseWithWarnings(w http.ResponseWriter, response interface{}, httpStatusCode int, links []Link, warnings []string) {
+
+	apiResponse := Response{Warnings: warnings}
 	if response != nil {
 		// Encode the response to JSON
 		data, err := json.Marshal(response)
@@ -78,3 +93,101 @@ func CreateApiResponse(w http.ResponseWriter, response interface{}, httpStatusCo
 
 	infrastructure.LogApiResponse(httpStatusCode, apiJson)
 }
+
+var trustedProxies []*net.IPNet
+var trustedProxiesOnce sync.Once
+
+// TrustedProxies returns the networks of the proxies configured by TRUSTED_PROXIES, comma separated ip addresses or
+// CIDRs, e.g. the subnets of the load balancer. Invalid entries are ignored
+func TrustedProxies() []*net.IPNet {
+	trustedProxiesOnce.Do(func() {
+		trustedProxies = ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	})
+	return trustedProxies
+}
+
+// ParseTrustedProxies parses comma separated ip addresses and CIDRs
+func ParseTrustedProxies(value string) []*net.IPNet {
+	proxies := []*net.IPNet{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			proxies = append(proxies, network)
+		}
+	}
+	return proxies
+}
+
+// ClientIP returns the ip address of the client
+// X-Forwarded-For is only read when the request comes from a trusted proxy (TRUSTED_PROXIES), otherwise any client
+// could choose its address. The client is then the last entry not added by a trusted proxy
+func ClientIP(r *http.Request) string {
+	return clientIP(r, TrustedProxies())
+}
+
+func clientIP(r *http.Request, proxies []*net.IPNet) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !isTrustedProxy(ip, proxies) {
+		return ip
+	}
+
+	entries := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := strings.TrimSpace(entries[i])
+		if net.ParseIP(entry) == nil {
+			// A malformed entry was not added by a trusted proxy
+			return ip
+		}
+		ip = entry
+		if !isTrustedProxy(ip, proxies) {
+			return ip
+		}
+	}
+	return ip
+}
+
+func isTrustedProxy(ip string, proxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptsXML check if the client asks for an XML response with the Accept header
+func AcceptsXML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/xml") || strings.Contains(accept, "text/xml")
+}
+
+// CreateXmlResponse to create a response with an XML document, e.g. an ISO 20022 message
+func CreateXmlResponse(w http.ResponseWriter, document []byte, httpStatusCode int) {
+	CreateDocumentResponse(w, "application/xml", document, httpStatusCode)
+}
+
+// CreateDocumentResponse to create a response with a document of the content type, e.g. an export file
+func CreateDocumentResponse(w http.ResponseWriter, contentType string, document []byte, httpStatusCode int) {
+	w.Header().Add("Content-Type", contentType)
+	w.WriteHeader(httpStatusCode)
+	if _, err := w.Write(document); err != nil {
+		infrastructure.LogError(http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func requestFrom(remoteAddr string, forwarded string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/v1/user/login", nil)
+	r.RemoteAddr = remoteAddr
+	if forwarded != "" {
+		r.Header.Set("X-Forwarded-For", forwarded)
+	}
+	return r
+}
+
+func TestClientIP(t *testing.T) {
+	proxies := ParseTrustedProxies("10.0.0.0/16, 192.0.2.7, invalid")
+	assert.Len(t, proxies, 2)
+
+	// The header of a client that is not a proxy is ignored
+	assert.EqualValues(t, "203.0.113.9", clientIP(requestFrom("203.0.113.9:4321", "198.51.100.1"), proxies))
+	assert.EqualValues(t, "203.0.113.9", clientIP(requestFrom("203.0.113.9:4321", "198.51.100.1"), nil))
+
+	// Behind the load balancer the client is the entry added by the load balancer
+	assert.EqualValues(t, "198.51.100.1", clientIP(requestFrom("10.0.1.5:4321", "198.51.100.1"), proxies))
+
+	// The entries sent by the client are skipped, as well as the trusted proxies of the chain
+	assert.EqualValues(t, "198.51.100.1", clientIP(requestFrom("10.0.1.5:4321", "1.2.3.4, 198.51.100.1, 192.0.2.7"), proxies))
+
+	// A malformed entry is not trusted
+	assert.EqualValues(t, "10.0.1.5", clientIP(requestFrom("10.0.1.5:4321", "198.51.100.1, garbage"), proxies))
+
+	// A proxy without header
+	assert.EqualValues(t, "10.0.1.5", clientIP(requestFrom("10.0.1.5:4321", ""), proxies))
+}